@@ -0,0 +1,99 @@
+// Package delivery is the extension point for digest delivery targets beyond
+// email and Slack, such as internal portals or ticketing systems.
+//
+// A target package registers a factory in its init function:
+//
+//	func init() {
+//		delivery.Register("portal", newPortal)
+//	}
+//
+// and is compiled into shinbun with a blank import in a file of its own next to
+// main.go. DELIVERY_TARGETS then enables it by name.
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Digest is a finished digest as handed to each target.
+type Digest struct {
+	Focus   string
+	Date    time.Time
+	Issue   int // 0 when the issue couldn't be numbered
+	Subject string
+	// Markdown is the digest with its masthead; HTML is the email rendering of it
+	Markdown string
+	HTML     string
+	// ArchiveURL is the digest's web archive page, or "" without one
+	ArchiveURL string
+}
+
+// Target delivers digests somewhere.
+type Target interface {
+	Deliver(ctx context.Context, digest Digest) error
+}
+
+// Options is what a factory gets to configure its target.
+type Options struct {
+	// Getenv reads settings; targets should use their own prefix, e.g. PORTAL_URL
+	Getenv func(key string) string
+	// HTTPClient honours shinbun's proxy, CA and circuit breaker settings
+	HTTPClient *http.Client
+	Logger     *zap.Logger
+}
+
+// Factory creates a target from its settings.
+type Factory func(opts Options) (Target, error)
+
+var (
+	mu        sync.Mutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a target available under name. It panics if the name is
+// taken, like database/sql.Register.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("delivery: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("delivery: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered returns the registered target names in order.
+func Registered() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the target registered under name.
+func New(name string, opts Options) (Target, error) {
+	mu.Lock()
+	factory, ok := factories[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown delivery target %q (registered: %v)", name, Registered())
+	}
+	target, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring delivery target %s: %v", name, err)
+	}
+	return target, nil
+}
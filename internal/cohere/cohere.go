@@ -0,0 +1,98 @@
+package cohere
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxTextsPerRequest is Cohere's limit on texts per embed request.
+const maxTextsPerRequest = 96
+
+// Client calls the Cohere embed API.
+type Client struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Cohere client. An empty baseURL uses Cohere's API host;
+// a nil httpClient uses a default with a timeout.
+func NewClient(apiKey, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = "https://api.cohere.com"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Client{
+		APIKey:     apiKey,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// Embed returns an embedding of each text with model (e.g. "embed-v4.0"),
+// preserving order. inputType tells Cohere what the embeddings are for, e.g.
+// "clustering" or "search_document".
+func (c *Client) Embed(texts []string, model, inputType string) ([][]float32, error) {
+	var embeddings [][]float32
+	for start := 0; start < len(texts); start += maxTextsPerRequest {
+		end := start + maxTextsPerRequest
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := c.embedBatch(texts[start:end], model, inputType)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+func (c *Client) embedBatch(texts []string, model, inputType string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           model,
+		"texts":           texts,
+		"input_type":      inputType,
+		"embedding_types": []string{"float"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cohere request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+"/v2/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building cohere request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling cohere: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cohere returned status %s", resp.Status)
+	}
+
+	var result struct {
+		Embeddings struct {
+			Float [][]float32 `json:"float"`
+		} `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding cohere response: %v", err)
+	}
+	if len(result.Embeddings.Float) != len(texts) {
+		return nil, fmt.Errorf("cohere returned %d embeddings for %d texts", len(result.Embeddings.Float), len(texts))
+	}
+	return result.Embeddings.Float, nil
+}
@@ -1,5 +1,10 @@
 package commontypes
 
+import (
+	"fmt"
+	"time"
+)
+
 // Update represents a single message update
 type Update struct {
 	Text      string
@@ -8,4 +13,43 @@ type Update struct {
 	Channel   string // Added channel name for context
 	Category  string
 	Priority  int
+	Source    string // Where the update came from, e.g. "discord"; empty means Slack
+	// Author is the poster's user ID (Slack) or name (other sources), if known
+	Author        string
+	ReactionCount int
+	// Reactions counts the reactions by emoji name, skin tones folded together
+	Reactions map[string]int
+	// Status is the workflow state signalled by reactions, e.g. "resolved"
+	Status string
+	// Score is the composite priority score; Priority is its integer part
+	Score float64
+	// Translation is the text translated into the digest language, if it was in another language
+	Translation string
+	// RelatedLinks holds links of items merged into this one by cross-source correlation
+	RelatedLinks []string
+	// AfterHours is set when the update was posted outside business hours
+	AfterHours bool
+	// Mentions are the user IDs the text mentioned before mentions were
+	// rewritten to names (Slack messages fetched in this run only)
+	Mentions []string
+	// Attachments are the files, link unfurls and app attachments shared with
+	// the message
+	Attachments []Attachment
+}
+
+// Attachment describes something shared with a message, without its content.
+type Attachment struct {
+	// Kind is "file", "link" (an unfurled URL) or "attachment" (an app's)
+	Kind string
+	// Title is the file's or page's title; Name is the file name or, for a
+	// link, the site's name
+	Title string
+	Name  string
+	URL   string
+}
+
+// TimestampFromTime renders t in Slack's "seconds.micros" timestamp format so
+// updates from non-Slack sources sort and format like Slack messages.
+func TimestampFromTime(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
 }
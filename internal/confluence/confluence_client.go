@@ -0,0 +1,138 @@
+package confluence
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+// Client searches a Confluence Cloud site for page changes.
+type Client struct {
+	BaseURL    string // e.g. https://example.atlassian.net/wiki
+	Email      string
+	APIToken   string
+	Spaces     []string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Confluence client for the given space keys.
+// A nil httpClient uses a default with a timeout.
+func NewClient(baseURL, email, apiToken string, spaces []string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Email:      email,
+		APIToken:   apiToken,
+		Spaces:     spaces,
+		HTTPClient: httpClient,
+	}
+}
+
+type searchResponse struct {
+	Results []struct {
+		Title   string `json:"title"`
+		Excerpt string `json:"excerpt"`
+		URL     string `json:"url"`
+		Content struct {
+			Space struct {
+				Key string `json:"key"`
+			} `json:"space"`
+			History struct {
+				CreatedDate time.Time `json:"createdDate"`
+			} `json:"history"`
+			Version struct {
+				When      time.Time `json:"when"`
+				MinorEdit bool      `json:"minorEdit"`
+				By        struct {
+					DisplayName string `json:"displayName"`
+				} `json:"by"`
+			} `json:"version"`
+		} `json:"content"`
+	} `json:"results"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+// FetchUpdates returns pages created or edited since the given time. Edits
+// flagged as minor in Confluence are not considered substantial and are skipped.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	quoted := make([]string, len(c.Spaces))
+	for i, s := range c.Spaces {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	cql := fmt.Sprintf(`type = page AND space IN (%s) AND lastmodified >= "%s"`,
+		strings.Join(quoted, ","), since.UTC().Format("2006-01-02 15:04"))
+
+	params := url.Values{}
+	params.Set("cql", cql)
+	params.Set("expand", "content.space,content.history,content.version")
+	params.Set("limit", "50")
+	next := "/rest/api/search?" + params.Encode()
+
+	var updates []commontypes.Update
+	for next != "" {
+		var page searchResponse
+		if err := c.get(next, &page); err != nil {
+			return nil, err
+		}
+
+		for _, r := range page.Results {
+			event := "edited"
+			when := r.Content.Version.When
+			if !r.Content.History.CreatedDate.Before(since) {
+				event = "created"
+				when = r.Content.History.CreatedDate
+			} else if r.Content.Version.MinorEdit {
+				continue
+			}
+			updates = append(updates, commontypes.Update{
+				Text: fmt.Sprintf("Page %q %s by %s: %s", r.Title, event, r.Content.Version.By.DisplayName,
+					strings.TrimSpace(r.Excerpt)),
+				Timestamp: commontypes.TimestampFromTime(when),
+				Link:      c.BaseURL + r.URL,
+				Channel:   "confluence/" + r.Content.Space.Key,
+				Category:  "docs",
+				Priority:  1,
+			})
+		}
+		next = page.Links.Next
+	}
+
+	logger.Info("Fetched Confluence page changes",
+		zap.Strings("spaces", c.Spaces),
+		zap.Int("updates", len(updates)))
+	return updates, nil
+}
+
+func (c *Client) get(path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("error building confluence request: %v", err)
+	}
+	req.SetBasicAuth(c.Email, c.APIToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling confluence: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confluence returned status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding confluence response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package deepl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxTextsPerRequest is DeepL's limit on texts per translate request.
+const maxTextsPerRequest = 50
+
+// Client calls the DeepL translation API.
+type Client struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a DeepL client. Free-plan keys (ending in ":fx") use the free
+// API host unless baseURL is set. A nil httpClient uses a default with a timeout.
+func NewClient(apiKey, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = "https://api.deepl.com"
+		if strings.HasSuffix(apiKey, ":fx") {
+			baseURL = "https://api-free.deepl.com"
+		}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Client{
+		APIKey:     apiKey,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// Translation is a translated text with the language DeepL detected in the original.
+type Translation struct {
+	DetectedSourceLanguage string `json:"detected_source_language"`
+	Text                   string `json:"text"`
+}
+
+// Translate translates texts into targetLang (e.g. "EN-US", "JA"), preserving order.
+func (c *Client) Translate(texts []string, targetLang string) ([]Translation, error) {
+	var translations []Translation
+	for start := 0; start < len(texts); start += maxTextsPerRequest {
+		end := start + maxTextsPerRequest
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := c.translateBatch(texts[start:end], targetLang)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, batch...)
+	}
+	return translations, nil
+}
+
+func (c *Client) translateBatch(texts []string, targetLang string) ([]Translation, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"text":        texts,
+		"target_lang": targetLang,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding deepl request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+"/v2/translate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building deepl request: %v", err)
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling deepl: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("deepl returned status %s", resp.Status)
+	}
+
+	var result struct {
+		Translations []Translation `json:"translations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding deepl response: %v", err)
+	}
+	if len(result.Translations) != len(texts) {
+		return nil, fmt.Errorf("deepl returned %d translations for %d texts", len(result.Translations), len(texts))
+	}
+	return result.Translations, nil
+}
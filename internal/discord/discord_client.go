@@ -0,0 +1,151 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+const (
+	apiBase = "https://discord.com/api/v10"
+	// discordEpoch is the first millisecond of 2015, the base of Discord snowflake IDs.
+	discordEpoch = 1420070400000
+)
+
+// Message types worth summarizing: regular messages and replies.
+const (
+	messageTypeDefault = 0
+	messageTypeReply   = 19
+)
+
+// Client reads channel history with a Discord bot token.
+type Client struct {
+	BotToken   string
+	ChannelIDs []string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Discord client for the given channel IDs.
+// A nil httpClient uses a default with a timeout.
+func NewClient(botToken string, channelIDs []string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		BotToken:   botToken,
+		ChannelIDs: channelIDs,
+		HTTPClient: httpClient,
+	}
+}
+
+type channel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	GuildID string `json:"guild_id"`
+}
+
+type message struct {
+	ID        string    `json:"id"`
+	Type      int       `json:"type"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    struct {
+		Username string `json:"username"`
+		Bot      bool   `json:"bot"`
+	} `json:"author"`
+}
+
+// FetchUpdates returns human messages posted since the given time. Category is
+// left empty so the caller can apply its usual categorization.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var updates []commontypes.Update
+	for _, channelID := range c.ChannelIDs {
+		channelUpdates, err := c.fetchChannel(channelID, since)
+		if err != nil {
+			logger.Error("Failed to fetch Discord channel", zap.String("channel_id", channelID), zap.Error(err))
+			continue
+		}
+		logger.Info("Fetched Discord channel",
+			zap.String("channel_id", channelID),
+			zap.Int("updates", len(channelUpdates)))
+		updates = append(updates, channelUpdates...)
+	}
+	return updates, nil
+}
+
+func (c *Client) fetchChannel(channelID string, since time.Time) ([]commontypes.Update, error) {
+	var ch channel
+	if err := c.get(fmt.Sprintf("/channels/%s", channelID), &ch); err != nil {
+		return nil, err
+	}
+
+	var updates []commontypes.Update
+	after := snowflakeFromTime(since)
+	for {
+		var page []message
+		if err := c.get(fmt.Sprintf("/channels/%s/messages?limit=100&after=%d", channelID, after), &page); err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, msg := range page {
+			if id, err := strconv.ParseUint(msg.ID, 10, 64); err == nil && id > after {
+				after = id
+			}
+			if msg.Author.Bot || (msg.Type != messageTypeDefault && msg.Type != messageTypeReply) || msg.Content == "" {
+				continue
+			}
+			updates = append(updates, commontypes.Update{
+				Text:      fmt.Sprintf("%s: %s", msg.Author.Username, msg.Content),
+				Timestamp: commontypes.TimestampFromTime(msg.Timestamp),
+				Link:      fmt.Sprintf("https://discord.com/channels/%s/%s/%s", ch.GuildID, ch.ID, msg.ID),
+				Channel:   ch.Name,
+			})
+		}
+
+		if len(page) < 100 {
+			break
+		}
+		time.Sleep(500 * time.Millisecond) // Be nice to the API
+	}
+	return updates, nil
+}
+
+func (c *Client) get(path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, apiBase+path, nil)
+	if err != nil {
+		return fmt.Errorf("error building discord request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bot "+c.BotToken)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling discord: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord %s returned status %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding discord response: %v", err)
+	}
+	return nil
+}
+
+// snowflakeFromTime returns the smallest snowflake ID created at t, for use with "after".
+func snowflakeFromTime(t time.Time) uint64 {
+	ms := t.UnixMilli() - discordEpoch
+	if ms < 0 {
+		return 0
+	}
+	return uint64(ms) << 22
+}
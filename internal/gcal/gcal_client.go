@@ -0,0 +1,127 @@
+package gcal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2/google"
+)
+
+const calendarReadonlyScope = "https://www.googleapis.com/auth/calendar.readonly"
+
+// Event is a scheduled calendar event used as context for the summary.
+type Event struct {
+	Summary  string
+	Location string
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+	Link     string
+}
+
+// Client reads events from a shared Google Calendar with a service account.
+type Client struct {
+	CalendarID string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Calendar client from a service account JSON key file.
+// The calendar must be shared with the service account's email address.
+func NewClient(calendarID, credentialsFile string) (*Client, error) {
+	key, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading google credentials: %v", err)
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(key, calendarReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing google credentials: %v", err)
+	}
+	return &Client{
+		CalendarID: calendarID,
+		HTTPClient: jwtConfig.Client(context.Background()),
+	}, nil
+}
+
+type eventTime struct {
+	Date     string    `json:"date"`
+	DateTime time.Time `json:"dateTime"`
+}
+
+type eventList struct {
+	Items []struct {
+		Status   string    `json:"status"`
+		Summary  string    `json:"summary"`
+		Location string    `json:"location"`
+		HTMLLink string    `json:"htmlLink"`
+		Start    eventTime `json:"start"`
+		End      eventTime `json:"end"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// FetchEvents lists events overlapping the window between from and to.
+func (c *Client) FetchEvents(from, to time.Time, logger *zap.Logger) ([]Event, error) {
+	params := url.Values{}
+	params.Set("timeMin", from.Format(time.RFC3339))
+	params.Set("timeMax", to.Format(time.RFC3339))
+	params.Set("singleEvents", "true")
+	params.Set("orderBy", "startTime")
+	params.Set("maxResults", "250")
+
+	var events []Event
+	for {
+		endpoint := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events?%s",
+			url.PathEscape(c.CalendarID), params.Encode())
+		resp, err := c.HTTPClient.Get(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("error calling google calendar: %v", err)
+		}
+
+		var page eventList
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("google calendar returned status %s", resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding google calendar response: %v", err)
+		}
+
+		for _, item := range page.Items {
+			if item.Status == "cancelled" {
+				continue
+			}
+			event := Event{
+				Summary:  item.Summary,
+				Location: item.Location,
+				Start:    item.Start.DateTime,
+				End:      item.End.DateTime,
+				Link:     item.HTMLLink,
+			}
+			if item.Start.Date != "" {
+				// All-day events only carry a date
+				event.AllDay = true
+				event.Start, _ = time.Parse("2006-01-02", item.Start.Date)
+				event.End, _ = time.Parse("2006-01-02", item.End.Date)
+			}
+			events = append(events, event)
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		params.Set("pageToken", page.NextPageToken)
+	}
+
+	logger.Info("Fetched calendar events",
+		zap.String("calendar_id", c.CalendarID),
+		zap.Int("events", len(events)))
+	return events, nil
+}
@@ -0,0 +1,272 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+// Client reads project activity from a GitLab instance's REST API.
+type Client struct {
+	BaseURL    string
+	Token      string
+	Projects   []string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a GitLab client for the given projects ("group/project" paths or numeric IDs).
+// A nil httpClient uses a default with a timeout.
+func NewClient(baseURL, token string, projects []string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		Projects:   projects,
+		HTTPClient: httpClient,
+	}
+}
+
+type mergeRequest struct {
+	IID      int        `json:"iid"`
+	Title    string     `json:"title"`
+	WebURL   string     `json:"web_url"`
+	MergedAt *time.Time `json:"merged_at"`
+	Author   struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+type release struct {
+	Name       string    `json:"name"`
+	TagName    string    `json:"tag_name"`
+	ReleasedAt time.Time `json:"released_at"`
+	Links      struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+type tag struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Commit  struct {
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"commit"`
+	Release *struct {
+		TagName string `json:"tag_name"`
+	} `json:"release"`
+}
+
+type projectInfo struct {
+	WebURL string `json:"web_url"`
+}
+
+type pipeline struct {
+	ID        int       `json:"id"`
+	Ref       string    `json:"ref"`
+	WebURL    string    `json:"web_url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FetchUpdates returns merged MRs, releases and tags, and failed pipelines since
+// the given time. Category is left empty so the caller can apply its usual categorization.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var updates []commontypes.Update
+	for _, project := range c.Projects {
+		projectUpdates, err := c.fetchProject(project, since)
+		if err != nil {
+			logger.Error("Failed to fetch GitLab project", zap.String("project", project), zap.Error(err))
+			continue
+		}
+		logger.Info("Fetched GitLab project",
+			zap.String("project", project),
+			zap.Int("updates", len(projectUpdates)))
+		updates = append(updates, projectUpdates...)
+	}
+	return updates, nil
+}
+
+func (c *Client) fetchProject(project string, since time.Time) ([]commontypes.Update, error) {
+	base := fmt.Sprintf("/projects/%s", url.PathEscape(project))
+	channel := "gitlab/" + project
+	after := since.UTC().Format(time.RFC3339)
+	var updates []commontypes.Update
+
+	var mrs []mergeRequest
+	if err := c.getAll(base+"/merge_requests?state=merged&updated_after="+url.QueryEscape(after), &mrs); err != nil {
+		return nil, err
+	}
+	for _, mr := range mrs {
+		if mr.MergedAt == nil || mr.MergedAt.Before(since) {
+			continue
+		}
+		updates = append(updates, commontypes.Update{
+			Text:      fmt.Sprintf("Merged MR !%d by %s: %s", mr.IID, mr.Author.Name, mr.Title),
+			Timestamp: commontypes.TimestampFromTime(*mr.MergedAt),
+			Link:      mr.WebURL,
+			Channel:   channel,
+		})
+	}
+
+	releases, err := getNewest(c, base+"/releases?order_by=released_at&sort=desc", since,
+		func(r release) time.Time { return r.ReleasedAt })
+	if err != nil {
+		return nil, err
+	}
+	released := make(map[string]bool)
+	for _, r := range releases {
+		released[r.TagName] = true
+		if r.ReleasedAt.Before(since) {
+			continue
+		}
+		updates = append(updates, commontypes.Update{
+			Text:      fmt.Sprintf("Release %s (%s) published", r.Name, r.TagName),
+			Timestamp: commontypes.TimestampFromTime(r.ReleasedAt),
+			Link:      r.Links.Self,
+			Channel:   channel,
+		})
+	}
+
+	tags, err := getNewest(c, base+"/repository/tags?order_by=updated&sort=desc", since,
+		func(t tag) time.Time { return t.Commit.CreatedAt })
+	if err != nil {
+		return nil, err
+	}
+	webURL := ""
+	for _, t := range tags {
+		// Tags with a release were already reported above
+		if t.Release != nil || released[t.Name] || t.Commit.CreatedAt.Before(since) {
+			continue
+		}
+		if webURL == "" {
+			// Projects configured by numeric ID have no path to build it from
+			var p projectInfo
+			if _, err := c.get(base, &p); err != nil {
+				return nil, err
+			}
+			webURL = strings.TrimSuffix(p.WebURL, "/")
+		}
+		text := fmt.Sprintf("Tag %s created", t.Name)
+		if t.Message != "" {
+			text += ": " + t.Message
+		}
+		updates = append(updates, commontypes.Update{
+			Text:      text,
+			Timestamp: commontypes.TimestampFromTime(t.Commit.CreatedAt),
+			Link:      fmt.Sprintf("%s/-/tags/%s", webURL, url.PathEscape(t.Name)),
+			Channel:   channel,
+		})
+	}
+
+	var pipelines []pipeline
+	if err := c.getAll(base+"/pipelines?status=failed&updated_after="+url.QueryEscape(after), &pipelines); err != nil {
+		return nil, err
+	}
+	for _, p := range pipelines {
+		updates = append(updates, commontypes.Update{
+			Text:      fmt.Sprintf("Pipeline #%d failed on %s", p.ID, p.Ref),
+			Timestamp: commontypes.TimestampFromTime(p.UpdatedAt),
+			Link:      p.WebURL,
+			Channel:   channel,
+		})
+	}
+
+	return updates, nil
+}
+
+// getAll follows GitLab's X-Next-Page pagination and appends every page into out,
+// which must point to a slice.
+func (c *Client) getAll(path string, out interface{}) error {
+	var all []json.RawMessage
+	err := c.eachPage(path, func(items []json.RawMessage) (bool, error) {
+		all = append(all, items...)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(all)
+	if err != nil {
+		return fmt.Errorf("error collecting gitlab pages: %v", err)
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// getNewest reads a list sorted newest first, as at dates its items, and
+// stops paging at the first page that reaches back before since.
+func getNewest[T any](c *Client, path string, since time.Time, at func(T) time.Time) ([]T, error) {
+	var all []T
+	err := c.eachPage(path, func(items []json.RawMessage) (bool, error) {
+		for _, raw := range items {
+			var item T
+			if err := json.Unmarshal(raw, &item); err != nil {
+				return false, fmt.Errorf("error decoding gitlab response: %v", err)
+			}
+			all = append(all, item)
+			if at(item).Before(since) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	return all, err
+}
+
+// eachPage calls page with each page of path's list, following GitLab's
+// X-Next-Page pagination until the last page or until page returns false.
+func (c *Client) eachPage(path string, page func(items []json.RawMessage) (bool, error)) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	next := "1"
+	for next != "" {
+		var items []json.RawMessage
+		var err error
+		next, err = c.get(fmt.Sprintf("%s%sper_page=100&page=%s", path, sep, next), &items)
+		if err != nil {
+			return err
+		}
+		more, err := page(items)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// get decodes the response to path into out, and returns the next page's
+// number for lists that have one.
+func (c *Client) get(path string, out interface{}) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/v4"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("error building gitlab request: %v", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling gitlab: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gitlab %s returned status %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("error decoding gitlab response: %v", err)
+	}
+	return resp.Header.Get("X-Next-Page"), nil
+}
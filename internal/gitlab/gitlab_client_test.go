@@ -0,0 +1,65 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestFetchUpdatesStopsPagingAtSince(t *testing.T) {
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) string { return since.AddDate(0, 0, d).Format(time.RFC3339) }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		switch r.URL.Path {
+		case "/api/v4/projects/42":
+			fmt.Fprint(w, `{"web_url":"https://gitlab.example.com/group/app"}`)
+		case "/api/v4/projects/42/releases":
+			switch page {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				fmt.Fprintf(w, `[{"name":"v3","tag_name":"v3","released_at":%q}]`, day(3))
+			case "2":
+				w.Header().Set("X-Next-Page", "3")
+				fmt.Fprintf(w, `[{"name":"v2","tag_name":"v2","released_at":%q},{"name":"v1","tag_name":"v1","released_at":%q}]`, day(2), day(-5))
+			default:
+				t.Errorf("releases page %s requested after reaching since", page)
+				fmt.Fprint(w, `[]`)
+			}
+		case "/api/v4/projects/42/repository/tags":
+			if page != "1" {
+				t.Errorf("tags page %s requested after reaching since", page)
+			}
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprintf(w, `[{"name":"v3","commit":{"created_at":%q}},{"name":"nightly/7","commit":{"created_at":%q}},{"name":"old","commit":{"created_at":%q}}]`,
+				day(3), day(1), day(-1))
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "token", []string{"42"}, nil)
+	updates, err := client.FetchUpdates(since, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []string
+	for _, u := range updates {
+		texts = append(texts, u.Text)
+	}
+	want := []string{"Release v3 (v3) published", "Release v2 (v2) published", "Tag nightly/7 created"}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Errorf("updates = %q, want %q", texts, want)
+	}
+	if link := updates[len(updates)-1].Link; link != "https://gitlab.example.com/group/app/-/tags/nightly%2F7" {
+		t.Errorf("tag link = %s, want it built on the project's web_url", link)
+	}
+}
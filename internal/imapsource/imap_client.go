@@ -0,0 +1,184 @@
+package imapsource
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/mail"
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+// maxBodyChars bounds how much of each email body is passed on to the digest.
+const maxBodyChars = 1500
+
+// Config describes the shared mailbox and which messages to ingest.
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Folders  []string
+	// SubjectFilters and FromFilters are case-insensitive substrings; when set,
+	// a message must match at least one entry of each list to be ingested.
+	SubjectFilters []string
+	FromFilters    []string
+}
+
+// Source ingests messages from IMAP folders.
+type Source struct {
+	config Config
+}
+
+// NewSource creates an IMAP source for the given mailbox configuration.
+func NewSource(config Config) *Source {
+	return &Source{config: config}
+}
+
+// FetchUpdates returns messages received since the given time in the configured folders.
+// Category is left empty so the caller can apply its usual categorization.
+func (s *Source) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	c, err := client.DialTLS(fmt.Sprintf("%s:%s", s.config.Host, s.config.Port), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to IMAP server: %v", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login(s.config.Username, s.config.Password); err != nil {
+		return nil, fmt.Errorf("error logging in to IMAP server: %v", err)
+	}
+
+	var updates []commontypes.Update
+	for _, folder := range s.config.Folders {
+		folderUpdates, err := s.fetchFolder(c, folder, since)
+		if err != nil {
+			logger.Error("Failed to fetch IMAP folder", zap.String("folder", folder), zap.Error(err))
+			continue
+		}
+		logger.Info("Fetched IMAP folder",
+			zap.String("folder", folder),
+			zap.Int("updates", len(folderUpdates)))
+		updates = append(updates, folderUpdates...)
+	}
+	return updates, nil
+}
+
+func (s *Source) fetchFolder(c *client.Client, folder string, since time.Time) ([]commontypes.Update, error) {
+	if _, err := c.Select(folder, true); err != nil {
+		return nil, fmt.Errorf("error selecting folder %s: %v", folder, err)
+	}
+
+	// SINCE only has day granularity, so exact filtering happens on the internal date below.
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("error searching folder %s: %v", folder, err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, items, messages)
+	}()
+
+	var updates []commontypes.Update
+	for msg := range messages {
+		if msg.Envelope == nil || msg.InternalDate.Before(since) {
+			continue
+		}
+		from := formatAddresses(msg.Envelope.From)
+		if !matchesAny(msg.Envelope.Subject, s.config.SubjectFilters) || !matchesAny(from, s.config.FromFilters) {
+			continue
+		}
+
+		text := fmt.Sprintf("Email from %s: %s", from, msg.Envelope.Subject)
+		if body := readPlainText(msg.GetBody(section)); body != "" {
+			text += "\n" + body
+		}
+
+		updates = append(updates, commontypes.Update{
+			Text:      text,
+			Timestamp: commontypes.TimestampFromTime(msg.InternalDate),
+			Link:      "N/A", // Mail has no shareable permalink
+			Channel:   "email/" + strings.ToLower(folder),
+		})
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("error fetching messages from %s: %v", folder, err)
+	}
+	return updates, nil
+}
+
+// readPlainText returns the first text/plain part of a message, truncated.
+func readPlainText(r io.Reader) string {
+	if r == nil {
+		return ""
+	}
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return ""
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+		header, ok := part.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+		contentType, _, _ := header.ContentType()
+		if contentType != "" && contentType != "text/plain" {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(part.Body, maxBodyChars*4))
+		if err != nil {
+			return ""
+		}
+		text := strings.TrimSpace(string(body))
+		if runes := []rune(text); len(runes) > maxBodyChars {
+			text = string(runes[:maxBodyChars]) + "…"
+		}
+		return text
+	}
+}
+
+func formatAddresses(addrs []*imap.Address) string {
+	var parts []string
+	for _, a := range addrs {
+		addr := a.Address()
+		if a.PersonalName != "" {
+			addr = fmt.Sprintf("%s <%s>", a.PersonalName, addr)
+		}
+		parts = append(parts, addr)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func matchesAny(value string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	lower := strings.ToLower(value)
+	for _, f := range filters {
+		if strings.Contains(lower, strings.ToLower(f)) {
+			return true
+		}
+	}
+	return false
+}
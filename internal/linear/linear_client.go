@@ -0,0 +1,184 @@
+package linear
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+const apiURL = "https://api.linear.app/graphql"
+
+// urgentPriority is Linear's numeric priority for "Urgent".
+const urgentPriority = 1
+
+// Client reads issue activity from Linear's GraphQL API.
+type Client struct {
+	APIKey     string
+	Teams      []string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Linear client for the given team keys (e.g. "ENG").
+// A nil httpClient uses a default with a timeout.
+func NewClient(apiKey string, teams []string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		APIKey:     apiKey,
+		Teams:      teams,
+		HTTPClient: httpClient,
+	}
+}
+
+const issuesQuery = `query Issues($teams: [String!], $since: DateTimeOrDuration!, $after: String) {
+  issues(first: 100, after: $after, filter: { team: { key: { in: $teams } }, updatedAt: { gte: $since } }) {
+    nodes {
+      identifier
+      title
+      url
+      createdAt
+      completedAt
+      team { key }
+      state { name }
+      history(first: 50) {
+        nodes { createdAt toPriority }
+      }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+type issue struct {
+	Identifier  string     `json:"identifier"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	Team        struct {
+		Key string `json:"key"`
+	} `json:"team"`
+	State struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	History struct {
+		Nodes []struct {
+			CreatedAt  time.Time `json:"createdAt"`
+			ToPriority *float64  `json:"toPriority"`
+		} `json:"nodes"`
+	} `json:"history"`
+}
+
+type issuesResponse struct {
+	Data struct {
+		Issues struct {
+			Nodes    []issue `json:"nodes"`
+			PageInfo struct {
+				HasNextPage bool   `json:"hasNextPage"`
+				EndCursor   string `json:"endCursor"`
+			} `json:"pageInfo"`
+		} `json:"issues"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// FetchUpdates returns issues created, completed, or moved to urgent since the
+// given time. Category is left empty so the caller can apply its usual categorization.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var updates []commontypes.Update
+	var after *string
+	for {
+		page, err := c.queryIssues(since, after)
+		if err != nil {
+			return nil, err
+		}
+		for _, iss := range page.Data.Issues.Nodes {
+			updates = append(updates, issueUpdates(iss, since)...)
+		}
+		if !page.Data.Issues.PageInfo.HasNextPage {
+			break
+		}
+		cursor := page.Data.Issues.PageInfo.EndCursor
+		after = &cursor
+	}
+
+	logger.Info("Fetched Linear issue activity",
+		zap.Strings("teams", c.Teams),
+		zap.Int("updates", len(updates)))
+	return updates, nil
+}
+
+func issueUpdates(iss issue, since time.Time) []commontypes.Update {
+	channel := "linear/" + iss.Team.Key
+	newUpdate := func(event string, at time.Time) commontypes.Update {
+		return commontypes.Update{
+			Text:      fmt.Sprintf("%s %s (%s): %s", iss.Identifier, event, iss.State.Name, iss.Title),
+			Timestamp: commontypes.TimestampFromTime(at),
+			Link:      iss.URL,
+			Channel:   channel,
+		}
+	}
+
+	var updates []commontypes.Update
+	if !iss.CreatedAt.Before(since) {
+		updates = append(updates, newUpdate("created", iss.CreatedAt))
+	}
+	if iss.CompletedAt != nil && !iss.CompletedAt.Before(since) {
+		updates = append(updates, newUpdate("completed", *iss.CompletedAt))
+	}
+	for _, h := range iss.History.Nodes {
+		if h.ToPriority != nil && int(*h.ToPriority) == urgentPriority && !h.CreatedAt.Before(since) {
+			updates = append(updates, newUpdate("moved to urgent", h.CreatedAt))
+			break
+		}
+	}
+	return updates
+}
+
+func (c *Client) queryIssues(since time.Time, after *string) (*issuesResponse, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": issuesQuery,
+		"variables": map[string]interface{}{
+			"teams": c.Teams,
+			"since": since.UTC().Format(time.RFC3339),
+			"after": after,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding linear query: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building linear request: %v", err)
+	}
+	req.Header.Set("Authorization", c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling linear: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("linear returned status %s", resp.Status)
+	}
+
+	var page issuesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decoding linear response: %v", err)
+	}
+	if len(page.Errors) > 0 {
+		return nil, fmt.Errorf("linear query error: %s", page.Errors[0].Message)
+	}
+	return &page, nil
+}
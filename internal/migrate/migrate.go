@@ -0,0 +1,152 @@
+// Package migrate creates and upgrades the shinbun database schema from
+// migrations embedded in the binary. PostgreSQL's are in migrations, and
+// SQLite's, which start from a baseline at version 16, in migrations/sqlite;
+// a schema change needs a file with the same number in each.
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/store"
+)
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var files embed.FS
+
+// lockID is the advisory lock held while migrating, so concurrent runs (e.g.
+// several job pods starting at once) apply each migration once.
+const lockID = 0x5368696e62756e
+
+// Migration is one numbered schema change, from migrations/NNNN_name.sql.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations returns the embedded migrations for a store.Store driver in
+// version order.
+func Migrations(driver string) ([]Migration, error) {
+	dir := "migrations"
+	if driver == store.SQLite {
+		dir = "migrations/sqlite"
+	}
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		number, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s, expected NNNN_name.sql", entry.Name())
+		}
+		content, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version the embedded migrations bring a database to,
+// which is the same for both backends.
+func Latest() int {
+	migrations, err := Migrations(store.Postgres)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Current returns the highest applied version, 0 for an empty database.
+func Current(db *sql.DB) (int, error) {
+	exists, err := store.For(db).TableExists(db, "schema_version")
+	if err != nil {
+		return 0, fmt.Errorf("error checking schema version: %v", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return int(version.Int64), nil
+}
+
+// Up applies the migrations newer than the database's version, each in its
+// own transaction, and returns the ones it applied.
+func Up(db *sql.DB, logger *zap.Logger) ([]Migration, error) {
+	migrations, err := Migrations(store.For(db).Driver())
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		done, err := apply(db, m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		if done {
+			logger.Info("Applied migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// apply runs m unless the database already has it. The version is checked
+// again under the lock, since another process may have just applied it.
+func apply(db *sql.DB, m Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := store.For(db).LockMigrations(tx, lockID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return false, err
+	}
+	var current sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&current); err != nil {
+		return false, err
+	}
+	if int64(m.Version) <= current.Int64 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES ($1) ON CONFLICT DO NOTHING`, m.Version); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,174 @@
+-- Baseline: the schema as of version 13, when migrations were introduced. It
+-- is safe to apply over any earlier version, and still works with psql -f.
+-- Later changes go in new files numbered from 0014.
+
+CREATE TABLE IF NOT EXISTS channels (
+    id SERIAL PRIMARY KEY,
+    slack_id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    last_fetched TIMESTAMP WITH TIME ZONE,
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    topic TEXT,
+    purpose TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id SERIAL PRIMARY KEY,
+    slack_id TEXT NOT NULL,
+    channel_id INTEGER REFERENCES channels(id),
+    text TEXT NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    permalink TEXT,
+    category TEXT,
+    priority INTEGER,
+    translation TEXT,
+    author TEXT,
+    reaction_count INTEGER NOT NULL DEFAULT 0,
+    status TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(channel_id, timestamp),
+    UNIQUE(slack_id)
+);
+
+CREATE TABLE IF NOT EXISTS digests (
+    id SERIAL PRIMARY KEY,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    content TEXT NOT NULL,
+    issue INTEGER,
+    title TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(focus, digest_date)
+);
+
+-- Optional email tracking (EMAIL_TRACKING=true): one row per recipient per digest
+CREATE TABLE IF NOT EXISTS email_deliveries (
+    token TEXT PRIMARY KEY,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    recipient TEXT NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS email_events (
+    id SERIAL PRIMARY KEY,
+    token TEXT NOT NULL REFERENCES email_deliveries(token),
+    event TEXT NOT NULL,
+    url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE OR REPLACE VIEW digest_engagement AS
+SELECT d.focus,
+       d.digest_date,
+       d.recipient,
+       COUNT(e.id) FILTER (WHERE e.event = 'open') AS opens,
+       COUNT(e.id) FILTER (WHERE e.event = 'click') AS clicks,
+       MIN(e.created_at) AS first_seen
+FROM email_deliveries d
+LEFT JOIN email_events e ON e.token = d.token
+GROUP BY d.focus, d.digest_date, d.recipient;
+
+-- Risks and blockers raised in messages (TRACK_BLOCKERS=true)
+CREATE TABLE IF NOT EXISTS blockers (
+    link TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    owner TEXT,
+    text TEXT NOT NULL,
+    posted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Queued digest runs; each "shinbun runs next" claims and processes one
+CREATE TABLE IF NOT EXISTS runs (
+    id SERIAL PRIMARY KEY,
+    focus TEXT NOT NULL,
+    from_date TEXT,
+    as_of TEXT,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    no_llm BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    enqueued_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Stages of staged runs ("shinbun runs enqueue --staged"): a fetch job per
+-- channel, then summarize, then deliver. Failed jobs are queued again after
+-- run_after; after JOB_MAX_ATTEMPTS they are dead until retried by hand
+CREATE TABLE IF NOT EXISTS jobs (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    stage TEXT NOT NULL,
+    channel TEXT,
+    payload TEXT,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    run_after TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Digests posted to Slack, whose reactions are collected as feedback
+CREATE TABLE IF NOT EXISTS digest_posts (
+    channel_id TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    reaction_value REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, ts)
+);
+
+-- Channel and category weights learned from feedback (LEARN_WEIGHTS=true)
+CREATE TABLE IF NOT EXISTS learned_weights (
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    weight REAL NOT NULL DEFAULT 0,
+    samples INTEGER NOT NULL DEFAULT 0,
+    feedback REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, name)
+);
+
+-- Topic subscriptions saved from the preferences page (TOPIC_PREFERENCES=true);
+-- they replace the recipient's TOPIC_SUBSCRIPTIONS
+CREATE TABLE IF NOT EXISTS topic_subscriptions (
+    recipient TEXT PRIMARY KEY,
+    topics TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per applied schema version; shinbun db check compares the highest
+-- against the version it expects
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Columns added after the initial release; safe to re-run on existing databases
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS translation TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS author TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reaction_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS status TEXT;
+ALTER TABLE digests ADD COLUMN IF NOT EXISTS issue INTEGER;
+ALTER TABLE digests ADD COLUMN IF NOT EXISTS title TEXT;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS topic TEXT;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS purpose TEXT;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS usage TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_messages_channel_timestamp ON messages(channel_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_slack_id ON messages(slack_id);
+CREATE INDEX IF NOT EXISTS idx_runs_status ON runs(status, enqueued_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, run_after);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_run_stage ON jobs(run_id, stage, COALESCE(channel, ''));
+CREATE INDEX IF NOT EXISTS idx_digests_search ON digests USING GIN (to_tsvector('english', content));
+
+INSERT INTO schema_version (version) VALUES (1), (2), (3), (4), (5), (6), (7), (8), (9), (10), (11), (12), (13) ON CONFLICT DO NOTHING;
@@ -0,0 +1,24 @@
+-- Incidents tracked across digests (TRACK_INCIDENTS=true): opened by an
+-- incident ID or an urgent alert, kept open until a resolution is seen.
+CREATE TABLE IF NOT EXISTS incidents (
+    id TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    link TEXT NOT NULL,
+    title TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'opened', -- opened, referenced or resolved
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution_link TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_open ON incidents(opened_at) WHERE resolved_at IS NULL;
+
+-- Messages that mention each incident, so re-reading a week of messages on
+-- the next run doesn't count them twice
+CREATE TABLE IF NOT EXISTS incident_mentions (
+    incident_id TEXT NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    link TEXT NOT NULL,
+    posted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (incident_id, link)
+);
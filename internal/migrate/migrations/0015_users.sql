@@ -0,0 +1,8 @@
+-- Slack user names, for rewriting <@U123> mentions; refreshed from users.info
+-- once a week
+CREATE TABLE IF NOT EXISTS users (
+    slack_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    real_name TEXT,
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
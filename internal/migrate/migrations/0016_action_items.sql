@@ -0,0 +1,15 @@
+-- Action items raised in messages (TRACK_ACTION_ITEMS=true), listed as still
+-- outstanding until a completion signal is seen
+CREATE TABLE IF NOT EXISTS action_items (
+    link TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    owner TEXT,
+    text TEXT NOT NULL,
+    posted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    done_at TIMESTAMP WITH TIME ZONE,
+    done_reason TEXT,
+    reminded_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_action_items_open ON action_items(posted_at) WHERE done_at IS NULL;
@@ -0,0 +1,11 @@
+-- Files, link unfurls and app attachments shared with stored messages, by
+-- their position in the message
+CREATE TABLE IF NOT EXISTS message_attachments (
+    slack_id TEXT NOT NULL REFERENCES messages(slack_id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    title TEXT,
+    name TEXT,
+    url TEXT,
+    PRIMARY KEY (slack_id, position)
+);
@@ -0,0 +1,6 @@
+-- Structured action items extracted by the LLM (EXTRACT_ACTION_ITEMS=true):
+-- what is to be done, an owner who isn't a Slack user, and the deadline as
+-- written
+ALTER TABLE action_items ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE action_items ADD COLUMN IF NOT EXISTS owner_name TEXT;
+ALTER TABLE action_items ADD COLUMN IF NOT EXISTS due_hint TEXT;
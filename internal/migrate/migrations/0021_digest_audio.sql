@@ -0,0 +1,9 @@
+-- MP3 narrations of archived digests (AUDIO_EDITION=link), served at
+-- /digests/{focus}/{date}/audio.mp3
+CREATE TABLE IF NOT EXISTS digest_audio (
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    audio BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (focus, digest_date)
+);
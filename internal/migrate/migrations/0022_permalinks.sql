@@ -0,0 +1,11 @@
+-- Message permalinks by channel and timestamp, so messages fetched again
+-- aren't looked up again. channel_name is the name when the link was fetched;
+-- entries for another name are stale.
+CREATE TABLE IF NOT EXISTS permalinks (
+    channel_id TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    channel_name TEXT NOT NULL,
+    permalink TEXT NOT NULL,
+    fetched_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, ts)
+);
@@ -0,0 +1,3 @@
+-- The OpenAI batch a run's summary was submitted in, so a run restarted
+-- while the batch is pending picks it up rather than submitting another.
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS batch_id TEXT;
@@ -0,0 +1,195 @@
+-- Baseline: the SQLite schema as of version 16, when SQLite support was added.
+-- It matches the PostgreSQL migrations up to 0016_action_items.sql, with
+-- TIMESTAMP and DATE column types so the driver reads them back as times, and
+-- without the full-text index on digests. Later changes go in new files
+-- numbered like their PostgreSQL counterparts.
+
+CREATE TABLE IF NOT EXISTS channels (
+    id INTEGER PRIMARY KEY,
+    slack_id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    last_fetched TIMESTAMP,
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    topic TEXT,
+    purpose TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id INTEGER PRIMARY KEY,
+    slack_id TEXT NOT NULL,
+    channel_id INTEGER REFERENCES channels(id),
+    text TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    permalink TEXT,
+    category TEXT,
+    priority INTEGER,
+    translation TEXT,
+    author TEXT,
+    reaction_count INTEGER NOT NULL DEFAULT 0,
+    status TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(channel_id, timestamp),
+    UNIQUE(slack_id)
+);
+
+CREATE TABLE IF NOT EXISTS digests (
+    id INTEGER PRIMARY KEY,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    content TEXT NOT NULL,
+    issue INTEGER,
+    title TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(focus, digest_date)
+);
+
+-- Optional email tracking (EMAIL_TRACKING=true): one row per recipient per digest
+CREATE TABLE IF NOT EXISTS email_deliveries (
+    token TEXT PRIMARY KEY,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    recipient TEXT NOT NULL,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS email_events (
+    id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL REFERENCES email_deliveries(token),
+    event TEXT NOT NULL,
+    url TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE VIEW IF NOT EXISTS digest_engagement AS
+SELECT d.focus,
+       d.digest_date,
+       d.recipient,
+       COUNT(e.id) FILTER (WHERE e.event = 'open') AS opens,
+       COUNT(e.id) FILTER (WHERE e.event = 'click') AS clicks,
+       MIN(e.created_at) AS first_seen
+FROM email_deliveries d
+LEFT JOIN email_events e ON e.token = d.token
+GROUP BY d.focus, d.digest_date, d.recipient;
+
+-- Risks and blockers raised in messages (TRACK_BLOCKERS=true)
+CREATE TABLE IF NOT EXISTS blockers (
+    link TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    owner TEXT,
+    text TEXT NOT NULL,
+    posted_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Queued digest runs; each "shinbun runs next" claims and processes one
+CREATE TABLE IF NOT EXISTS runs (
+    id INTEGER PRIMARY KEY,
+    focus TEXT NOT NULL,
+    from_date TEXT,
+    as_of TEXT,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    no_llm BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    usage TEXT,
+    enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Stages of staged runs ("shinbun runs enqueue --staged")
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    stage TEXT NOT NULL,
+    channel TEXT,
+    payload TEXT,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    run_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Digests posted to Slack, whose reactions are collected as feedback
+CREATE TABLE IF NOT EXISTS digest_posts (
+    channel_id TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    focus TEXT NOT NULL,
+    digest_date DATE NOT NULL,
+    reaction_value REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, ts)
+);
+
+-- Channel and category weights learned from feedback (LEARN_WEIGHTS=true)
+CREATE TABLE IF NOT EXISTS learned_weights (
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    weight REAL NOT NULL DEFAULT 0,
+    samples INTEGER NOT NULL DEFAULT 0,
+    feedback REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, name)
+);
+
+-- Topic subscriptions saved from the preferences page (TOPIC_PREFERENCES=true)
+CREATE TABLE IF NOT EXISTS topic_subscriptions (
+    recipient TEXT PRIMARY KEY,
+    topics TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Incidents tracked across digests (TRACK_INCIDENTS=true)
+CREATE TABLE IF NOT EXISTS incidents (
+    id TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    link TEXT NOT NULL,
+    title TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'opened', -- opened, referenced or resolved
+    opened_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    resolution_link TEXT
+);
+
+CREATE TABLE IF NOT EXISTS incident_mentions (
+    incident_id TEXT NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    link TEXT NOT NULL,
+    posted_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (incident_id, link)
+);
+
+-- Slack user names, for rewriting <@U123> mentions
+CREATE TABLE IF NOT EXISTS users (
+    slack_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    real_name TEXT,
+    fetched_at TIMESTAMP NOT NULL
+);
+
+-- Action items raised in messages (TRACK_ACTION_ITEMS=true)
+CREATE TABLE IF NOT EXISTS action_items (
+    link TEXT PRIMARY KEY,
+    channel TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    owner TEXT,
+    text TEXT NOT NULL,
+    posted_at TIMESTAMP NOT NULL,
+    done_at TIMESTAMP,
+    done_reason TEXT,
+    reminded_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_channel_timestamp ON messages(channel_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_slack_id ON messages(slack_id);
+CREATE INDEX IF NOT EXISTS idx_runs_status ON runs(status, enqueued_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, run_after);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_run_stage ON jobs(run_id, stage, COALESCE(channel, ''));
+CREATE INDEX IF NOT EXISTS idx_incidents_open ON incidents(opened_at) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_action_items_open ON action_items(posted_at) WHERE done_at IS NULL;
@@ -0,0 +1,11 @@
+-- Reactions on stored messages by emoji, for trend queries; messages keeps
+-- their total in reaction_count
+CREATE TABLE IF NOT EXISTS message_reactions (
+    slack_id TEXT NOT NULL REFERENCES messages(slack_id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    count INTEGER NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (slack_id, emoji)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reactions_emoji ON message_reactions(emoji);
@@ -0,0 +1,6 @@
+-- Monitored channels the operator was told the bot can't read (OPERATOR_NOTIFY);
+-- a row is removed once the channel is read again
+CREATE TABLE IF NOT EXISTS channel_notices (
+    channel TEXT PRIMARY KEY,
+    notified_at TIMESTAMP NOT NULL
+);
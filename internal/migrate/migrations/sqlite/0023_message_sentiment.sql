@@ -0,0 +1,3 @@
+-- Sentiment of support messages from -1 (angry) to 1 (pleased)
+-- (SENTIMENT_SCORING), scored once and kept for the week-on-week trend
+ALTER TABLE messages ADD COLUMN sentiment REAL;
@@ -0,0 +1,5 @@
+-- The scheduled time of runs started by the --serve scheduler. The unique
+-- index keeps a scheduled time from being run twice when leadership of the
+-- scheduler changes hands around it.
+ALTER TABLE runs ADD COLUMN scheduled_at TIMESTAMP;
+CREATE UNIQUE INDEX IF NOT EXISTS runs_focus_scheduled_at ON runs (focus, scheduled_at);
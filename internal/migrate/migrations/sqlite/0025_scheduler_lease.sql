@@ -0,0 +1,8 @@
+-- The --serve replica that leads the scheduler, while its lease hasn't
+-- expired. The leader renews the lease; when it stops, another replica takes
+-- it over.
+CREATE TABLE IF NOT EXISTS scheduler_lease (
+    id INTEGER PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
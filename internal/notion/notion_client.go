@@ -0,0 +1,206 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+const (
+	apiBase       = "https://api.notion.com/v1"
+	notionVersion = "2022-06-28"
+	// maxSynopsisChars bounds the page text used as a synopsis.
+	maxSynopsisChars = 300
+)
+
+// Client reads page changes from Notion databases with an integration token.
+type Client struct {
+	APIKey      string
+	DatabaseIDs []string
+	HTTPClient  *http.Client
+}
+
+// NewClient creates a Notion client for the given databases. The databases must
+// be shared with the integration. A nil httpClient uses a default with a timeout.
+func NewClient(apiKey string, databaseIDs []string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		APIKey:      apiKey,
+		DatabaseIDs: databaseIDs,
+		HTTPClient:  httpClient,
+	}
+}
+
+type richText struct {
+	PlainText string `json:"plain_text"`
+}
+
+type page struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	CreatedTime    time.Time `json:"created_time"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+	Properties     map[string]struct {
+		Type  string     `json:"type"`
+		Title []richText `json:"title"`
+	} `json:"properties"`
+}
+
+type queryResponse struct {
+	Results    []page `json:"results"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// FetchUpdates returns pages created or edited since the given time. Notion does
+// not expose edit size, so every edit in the window is reported.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var updates []commontypes.Update
+	for _, databaseID := range c.DatabaseIDs {
+		pages, err := c.queryDatabase(databaseID, since)
+		if err != nil {
+			logger.Error("Failed to query Notion database", zap.String("database_id", databaseID), zap.Error(err))
+			continue
+		}
+
+		for _, p := range pages {
+			event, when := "edited", p.LastEditedTime
+			if !p.CreatedTime.Before(since) {
+				event, when = "created", p.CreatedTime
+			}
+			text := fmt.Sprintf("Page %q %s", pageTitle(p), event)
+			if synopsis := c.pageSynopsis(p.ID); synopsis != "" {
+				text += ": " + synopsis
+			}
+			updates = append(updates, commontypes.Update{
+				Text:      text,
+				Timestamp: commontypes.TimestampFromTime(when),
+				Link:      p.URL,
+				Channel:   "notion",
+				Category:  "docs",
+				Priority:  1,
+			})
+		}
+	}
+
+	logger.Info("Fetched Notion page changes", zap.Int("updates", len(updates)))
+	return updates, nil
+}
+
+func (c *Client) queryDatabase(databaseID string, since time.Time) ([]page, error) {
+	var pages []page
+	var cursor string
+	for {
+		body := map[string]interface{}{
+			"filter": map[string]interface{}{
+				"timestamp":        "last_edited_time",
+				"last_edited_time": map[string]string{"on_or_after": since.UTC().Format(time.RFC3339)},
+			},
+			"page_size": 100,
+		}
+		if cursor != "" {
+			body["start_cursor"] = cursor
+		}
+
+		var resp queryResponse
+		if err := c.do(http.MethodPost, fmt.Sprintf("/databases/%s/query", databaseID), body, &resp); err != nil {
+			return nil, err
+		}
+		pages = append(pages, resp.Results...)
+		if !resp.HasMore {
+			return pages, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// pageSynopsis returns the text of the first non-empty block on the page.
+func (c *Client) pageSynopsis(pageID string) string {
+	var resp struct {
+		Results []map[string]json.RawMessage `json:"results"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/blocks/%s/children?page_size=10", pageID), nil, &resp); err != nil {
+		return ""
+	}
+	for _, block := range resp.Results {
+		var blockType string
+		if err := json.Unmarshal(block["type"], &blockType); err != nil {
+			continue
+		}
+		var content struct {
+			RichText []richText `json:"rich_text"`
+		}
+		if err := json.Unmarshal(block[blockType], &content); err != nil {
+			continue
+		}
+		var sb strings.Builder
+		for _, t := range content.RichText {
+			sb.WriteString(t.PlainText)
+		}
+		if text := strings.TrimSpace(sb.String()); text != "" {
+			if runes := []rune(text); len(runes) > maxSynopsisChars {
+				text = string(runes[:maxSynopsisChars]) + "…"
+			}
+			return text
+		}
+	}
+	return ""
+}
+
+func pageTitle(p page) string {
+	for _, prop := range p.Properties {
+		if prop.Type != "title" {
+			continue
+		}
+		var sb strings.Builder
+		for _, t := range prop.Title {
+			sb.WriteString(t.PlainText)
+		}
+		return sb.String()
+	}
+	return "Untitled"
+}
+
+func (c *Client) do(method, path string, body interface{}, out interface{}) error {
+	var reqBody *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding notion request: %v", err)
+		}
+		reqBody = bytes.NewReader(raw)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, apiBase+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("error building notion request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling notion: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notion returned status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding notion response: %v", err)
+	}
+	return nil
+}
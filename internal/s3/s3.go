@@ -0,0 +1,155 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client uploads objects to an S3 bucket, or an S3-compatible store when
+// Endpoint is set, with Signature Version 4.
+type Client struct {
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint is e.g. "http://minio:9000"; buckets are then addressed by path
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewClient creates an S3 client for bucket. An empty region means
+// us-east-1; a nil httpClient uses a default with a timeout.
+func NewClient(bucket, region, accessKeyID, secretAccessKey, sessionToken, endpoint string, httpClient *http.Client) *Client {
+	if region == "" {
+		region = "us-east-1"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Client{
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		HTTPClient:      httpClient,
+	}
+}
+
+// PutObject stores body under key, replacing any existing object.
+func (c *Client) PutObject(key, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building s3 request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	c.sign(req, body, time.Now().UTC())
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling s3: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 returned status %s for %s: %s", resp.Status, key, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (c *Client) objectURL(key string) string {
+	path := escapePath(strings.TrimPrefix(key, "/"))
+	if c.Endpoint != "" {
+		return c.Endpoint + "/" + c.Bucket + "/" + path
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.Bucket, c.Region, path)
+}
+
+// escapePath URI-encodes an object key as SigV4 expects: every byte but
+// unreserved characters and the slashes between segments.
+func escapePath(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' ||
+			'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", b)
+	}
+	return sb.String()
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := hashHex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := []string{"content-length", "content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if c.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		switch name {
+		case "content-length":
+			value = strconv.FormatInt(req.ContentLength, 10)
+		case "host":
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), day)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
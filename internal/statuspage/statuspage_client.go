@@ -0,0 +1,229 @@
+package statuspage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+// Supported status page providers.
+const (
+	ProviderStatuspage = "statuspage"
+	ProviderIncidentIO = "incidentio"
+)
+
+// Client reads the public API of a hosted status page.
+type Client struct {
+	Provider   string
+	PageURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a status page client. A nil httpClient uses a default with a timeout.
+func NewClient(provider, pageURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		Provider:   provider,
+		PageURL:    strings.TrimSuffix(pageURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// FetchUpdates returns published incidents and maintenance windows touching the window.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var (
+		updates []commontypes.Update
+		err     error
+	)
+	switch c.Provider {
+	case ProviderIncidentIO:
+		updates, err = c.fetchIncidentIO(since)
+	case ProviderStatuspage, "":
+		updates, err = c.fetchStatuspage(since)
+	default:
+		return nil, fmt.Errorf("unknown status page provider %q", c.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Fetched status page events",
+		zap.String("provider", c.Provider),
+		zap.String("page_url", c.PageURL),
+		zap.Int("updates", len(updates)))
+	return updates, nil
+}
+
+type statuspageIncident struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	Impact          string     `json:"impact"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+	Shortlink       string     `json:"shortlink"`
+	IncidentUpdates []struct {
+		Body string `json:"body"`
+	} `json:"incident_updates"`
+}
+
+type statuspageMaintenance struct {
+	Name           string    `json:"name"`
+	Status         string    `json:"status"`
+	ScheduledFor   time.Time `json:"scheduled_for"`
+	ScheduledUntil time.Time `json:"scheduled_until"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Shortlink      string    `json:"shortlink"`
+}
+
+func (c *Client) fetchStatuspage(since time.Time) ([]commontypes.Update, error) {
+	var incidents struct {
+		Incidents []statuspageIncident `json:"incidents"`
+	}
+	if err := c.getJSON(c.PageURL+"/api/v2/incidents.json", &incidents); err != nil {
+		return nil, err
+	}
+
+	var maintenances struct {
+		ScheduledMaintenances []statuspageMaintenance `json:"scheduled_maintenances"`
+	}
+	if err := c.getJSON(c.PageURL+"/api/v2/scheduled-maintenances.json", &maintenances); err != nil {
+		return nil, err
+	}
+
+	var updates []commontypes.Update
+	for _, inc := range incidents.Incidents {
+		if inc.UpdatedAt.Before(since) {
+			continue
+		}
+		text := fmt.Sprintf("Status page incident (%s, impact: %s): %s", inc.Status, inc.Impact, inc.Name)
+		if len(inc.IncidentUpdates) > 0 {
+			// Updates are returned newest first
+			text += " - Latest update: " + inc.IncidentUpdates[0].Body
+		}
+		updates = append(updates, commontypes.Update{
+			Text:      text,
+			Timestamp: commontypes.TimestampFromTime(inc.CreatedAt),
+			Link:      inc.Shortlink,
+			Channel:   "statuspage",
+			Category:  "alert",
+			Priority:  impactPriority(inc.Impact),
+		})
+	}
+
+	for _, m := range maintenances.ScheduledMaintenances {
+		if m.ScheduledUntil.Before(since) && m.UpdatedAt.Before(since) {
+			continue
+		}
+		updates = append(updates, commontypes.Update{
+			Text: fmt.Sprintf("Maintenance window (%s): %s, scheduled %s to %s",
+				m.Status, m.Name, m.ScheduledFor.Format(time.RFC3339), m.ScheduledUntil.Format(time.RFC3339)),
+			Timestamp: commontypes.TimestampFromTime(m.ScheduledFor),
+			Link:      m.Shortlink,
+			Channel:   "statuspage",
+			Category:  "alert",
+			Priority:  2,
+		})
+	}
+	return updates, nil
+}
+
+type incidentIOSummary struct {
+	OngoingIncidents []struct {
+		Name               string    `json:"name"`
+		Status             string    `json:"status"`
+		URL                string    `json:"url"`
+		LastUpdateAt       time.Time `json:"last_update_at"`
+		LastUpdateMessage  string    `json:"last_update_message"`
+		CurrentWorstImpact string    `json:"current_worst_impact"`
+	} `json:"ongoing_incidents"`
+	InProgressMaintenances []incidentIOMaintenance `json:"in_progress_maintenances"`
+	ScheduledMaintenances  []incidentIOMaintenance `json:"scheduled_maintenances"`
+}
+
+type incidentIOMaintenance struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	URL      string    `json:"url"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// fetchIncidentIO reads the incident.io public widget API. It only exposes
+// ongoing and upcoming items, so resolved incidents are not reported.
+func (c *Client) fetchIncidentIO(since time.Time) ([]commontypes.Update, error) {
+	var summary incidentIOSummary
+	if err := c.getJSON(c.PageURL+"/api/v1/summary", &summary); err != nil {
+		return nil, err
+	}
+
+	var updates []commontypes.Update
+	for _, inc := range summary.OngoingIncidents {
+		text := fmt.Sprintf("Status page incident (%s, impact: %s): %s", inc.Status, inc.CurrentWorstImpact, inc.Name)
+		if inc.LastUpdateMessage != "" {
+			text += " - Latest update: " + inc.LastUpdateMessage
+		}
+		updates = append(updates, commontypes.Update{
+			Text:      text,
+			Timestamp: commontypes.TimestampFromTime(inc.LastUpdateAt),
+			Link:      inc.URL,
+			Channel:   "statuspage",
+			Category:  "alert",
+			Priority:  impactPriority(inc.CurrentWorstImpact),
+		})
+	}
+
+	maintenances := append(summary.InProgressMaintenances, summary.ScheduledMaintenances...)
+	for _, m := range maintenances {
+		if !m.EndsAt.IsZero() && m.EndsAt.Before(since) {
+			continue
+		}
+		updates = append(updates, commontypes.Update{
+			Text: fmt.Sprintf("Maintenance window (%s): %s, scheduled %s to %s",
+				m.Status, m.Name, m.StartsAt.Format(time.RFC3339), m.EndsAt.Format(time.RFC3339)),
+			Timestamp: commontypes.TimestampFromTime(m.StartsAt),
+			Link:      m.URL,
+			Channel:   "statuspage",
+			Category:  "alert",
+			Priority:  2,
+		})
+	}
+	return updates, nil
+}
+
+func (c *Client) getJSON(url string, out interface{}) error {
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("error calling status page: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status page %s returned status %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding status page response: %v", err)
+	}
+	return nil
+}
+
+// impactPriority maps a published impact level onto shinbun's priority scale,
+// starting from the alert category's base priority of 3.
+func impactPriority(impact string) int {
+	switch strings.ToLower(impact) {
+	case "major", "critical", "full_outage":
+		return 4
+	case "none", "maintenance":
+		return 2
+	default:
+		return 3
+	}
+}
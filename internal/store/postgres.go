@@ -0,0 +1,51 @@
+package store
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+type postgresStore struct{}
+
+func (postgresStore) Driver() string { return Postgres }
+
+func (postgresStore) Open(dsn string) (*sql.DB, error) {
+	return sql.Open("postgres", dsn)
+}
+
+func (postgresStore) ForUpdate(skipLocked bool) string {
+	if skipLocked {
+		return "FOR UPDATE SKIP LOCKED"
+	}
+	return "FOR UPDATE"
+}
+
+func (postgresStore) SecondsFromNow(seconds string) string {
+	return "CURRENT_TIMESTAMP + CAST(" + seconds + " AS INTEGER) * INTERVAL '1 second'"
+}
+
+func (postgresStore) TableExists(db *sql.DB, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	return exists, err
+}
+
+func (postgresStore) IndexExists(db *sql.DB, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = $1)`, name).Scan(&exists)
+	return exists, err
+}
+
+func (postgresStore) TableSize(db *sql.DB, table string) (string, error) {
+	var size string
+	err := db.QueryRow(`SELECT pg_size_pretty(pg_total_relation_size($1))`, table).Scan(&size)
+	return size, err
+}
+
+// LockMigrations takes an advisory lock, so concurrent runs (e.g. several job
+// pods starting at once) apply each migration once.
+func (postgresStore) LockMigrations(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, id)
+	return err
+}
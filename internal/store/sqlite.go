@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqlitePragmas are set on every connection: WAL lets readers run alongside a
+// writer, and writers wait for each other instead of failing at once.
+// Transactions take the write lock when they begin (_txlock=immediate), since
+// one that reads first can't wait for it later.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"}
+
+type sqliteStore struct{}
+
+func (sqliteStore) Driver() string { return SQLite }
+
+// Open opens the SQLite database file at path, creating it if needed.
+func (sqliteStore) Open(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no SQLite database file given")
+	}
+	query := url.Values{"_time_format": {"sqlite"}, "_txlock": {"immediate"}}
+	for _, pragma := range sqlitePragmas {
+		query.Add("_pragma", pragma)
+	}
+	return sql.OpenDB(sqliteConnector{dsn: "file:" + path + "?" + query.Encode()}), nil
+}
+
+// ForUpdate is empty: SQLite locks the whole database for a writing
+// transaction, so there are no row locks to take.
+func (sqliteStore) ForUpdate(bool) string { return "" }
+
+// SecondsFromNow is in CURRENT_TIMESTAMP's format, so the two compare as text.
+func (sqliteStore) SecondsFromNow(seconds string) string {
+	return "datetime('now', '+' || " + seconds + " || ' seconds')"
+}
+
+func (sqliteStore) TableExists(db *sql.DB, name string) (bool, error) {
+	return sqliteObjectExists(db, "table", name)
+}
+
+func (sqliteStore) IndexExists(db *sql.DB, name string) (bool, error) {
+	return sqliteObjectExists(db, "index", name)
+}
+
+func sqliteObjectExists(db *sql.DB, kind, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = $1 AND name = $2)`, kind, name).Scan(&exists)
+	return exists, err
+}
+
+// TableSize is unknown: SQLite keeps every table in the one database file.
+func (sqliteStore) TableSize(*sql.DB, string) (string, error) { return "", nil }
+
+// LockMigrations does nothing: the migration's first write locks the
+// database until the transaction ends.
+func (sqliteStore) LockMigrations(*sql.Tx, int64) error { return nil }
+
+// sqliteConn is what the SQLite driver's connections implement.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+// utcConn stores times in UTC. SQLite compares timestamps as text, so times
+// written in different zones, or by CURRENT_TIMESTAMP, only sort correctly
+// when they share one.
+type utcConn struct{ sqliteConn }
+
+func (utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if valuer, ok := nv.Value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = v
+	}
+	if t, ok := nv.Value.(time.Time); ok {
+		nv.Value = t.UTC()
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// sqliteDriver opens utcConns; For recognizes SQLite databases by it.
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := conn.(sqliteConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected SQLite connection type %T", conn)
+	}
+	return utcConn{c}, nil
+}
+
+type sqliteConnector struct{ dsn string }
+
+func (c sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return sqliteDriver{}.Open(c.dsn)
+}
+
+func (sqliteConnector) Driver() driver.Driver { return sqliteDriver{} }
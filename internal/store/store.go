@@ -0,0 +1,61 @@
+// Package store opens the database shinbun keeps its state in, PostgreSQL or
+// a SQLite file, and supplies the SQL the two spell differently.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Backends, by their DB_DRIVER name.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Store is a database backend. Queries are written once, in the SQL both
+// backends accept with $N placeholders; a Store covers what they don't share.
+type Store interface {
+	// Driver is the backend's DB_DRIVER name.
+	Driver() string
+	// Open returns a connection pool for dsn, without connecting yet.
+	Open(dsn string) (*sql.DB, error)
+
+	// ForUpdate is the clause that locks the rows a SELECT returns until
+	// the transaction ends. With skipLocked, rows another transaction holds
+	// are skipped rather than waited for.
+	ForUpdate(skipLocked bool) string
+	// SecondsFromNow is the database's current time plus the whole seconds
+	// in the expression seconds, e.g. a placeholder, for times that every
+	// process must read off the same clock.
+	SecondsFromNow(seconds string) string
+
+	// TableExists and IndexExists look the name up in the catalog.
+	TableExists(db *sql.DB, name string) (bool, error)
+	IndexExists(db *sql.DB, name string) (bool, error)
+	// TableSize is the table's size on disk for display, or "" when the
+	// backend can't tell.
+	TableSize(db *sql.DB, table string) (string, error)
+	// LockMigrations keeps other processes from migrating until tx ends.
+	LockMigrations(tx *sql.Tx, id int64) error
+}
+
+// New returns the backend a DB_DRIVER value names; "" is PostgreSQL.
+func New(driver string) (Store, error) {
+	switch driver {
+	case "", Postgres, "postgresql":
+		return postgresStore{}, nil
+	case SQLite, "sqlite3":
+		return sqliteStore{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q, expected %s or %s", driver, Postgres, SQLite)
+}
+
+// For returns the backend db was opened with. Connections opened elsewhere,
+// e.g. by a program embedding the pipeline, are taken to be PostgreSQL.
+func For(db *sql.DB) Store {
+	if _, ok := db.Driver().(sqliteDriver); ok {
+		return sqliteStore{}
+	}
+	return postgresStore{}
+}
@@ -0,0 +1,161 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"shinbun/internal/commontypes"
+)
+
+const graphBase = "https://graph.microsoft.com/v1.0"
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// ChannelRef identifies a channel within a team.
+type ChannelRef struct {
+	TeamID    string
+	ChannelID string
+}
+
+// ParseChannelRef parses a "teamID/channelID" pair.
+func ParseChannelRef(s string) (ChannelRef, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ChannelRef{}, fmt.Errorf("invalid teams channel %q, expected teamID/channelID", s)
+	}
+	return ChannelRef{TeamID: parts[0], ChannelID: parts[1]}, nil
+}
+
+// Client reads channel messages through Microsoft Graph with app-only credentials.
+// The app registration needs the ChannelMessage.Read.All and Channel.ReadBasic.All
+// application permissions.
+type Client struct {
+	Channels   []ChannelRef
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Graph client using the OAuth client credentials flow.
+func NewClient(tenantID, clientID, clientSecret string, channels []ChannelRef) *Client {
+	creds := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID),
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+	return &Client{
+		Channels:   channels,
+		HTTPClient: creds.Client(context.Background()),
+	}
+}
+
+type channelMessage struct {
+	ID              string     `json:"id"`
+	MessageType     string     `json:"messageType"`
+	CreatedDateTime time.Time  `json:"createdDateTime"`
+	DeletedDateTime *time.Time `json:"deletedDateTime"`
+	WebURL          string     `json:"webUrl"`
+	From            *struct {
+		User *struct {
+			DisplayName string `json:"displayName"`
+		} `json:"user"`
+	} `json:"from"`
+	Body struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	} `json:"body"`
+}
+
+type messagePage struct {
+	Value    []channelMessage `json:"value"`
+	NextLink string           `json:"@odata.nextLink"`
+}
+
+// FetchUpdates returns user messages posted since the given time. Category is
+// left empty so the caller can apply its usual categorization.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	var updates []commontypes.Update
+	for _, ref := range c.Channels {
+		channelUpdates, err := c.fetchChannel(ref, since)
+		if err != nil {
+			logger.Error("Failed to fetch Teams channel",
+				zap.String("team_id", ref.TeamID),
+				zap.String("channel_id", ref.ChannelID),
+				zap.Error(err))
+			continue
+		}
+		logger.Info("Fetched Teams channel",
+			zap.String("channel_id", ref.ChannelID),
+			zap.Int("updates", len(channelUpdates)))
+		updates = append(updates, channelUpdates...)
+	}
+	return updates, nil
+}
+
+func (c *Client) fetchChannel(ref ChannelRef, since time.Time) ([]commontypes.Update, error) {
+	var info struct {
+		DisplayName string `json:"displayName"`
+	}
+	channelPath := fmt.Sprintf("/teams/%s/channels/%s", url.PathEscape(ref.TeamID), url.PathEscape(ref.ChannelID))
+	if err := c.get(graphBase+channelPath, &info); err != nil {
+		return nil, err
+	}
+
+	filter := url.Values{}
+	filter.Set("$filter", "lastModifiedDateTime gt "+since.UTC().Format(time.RFC3339))
+	next := graphBase + channelPath + "/messages/delta?" + filter.Encode()
+
+	var updates []commontypes.Update
+	for next != "" {
+		var page messagePage
+		if err := c.get(next, &page); err != nil {
+			return nil, err
+		}
+		for _, msg := range page.Value {
+			// Skip system events, bot/app posts, deletions and edits of older messages
+			if msg.MessageType != "message" || msg.DeletedDateTime != nil || msg.From == nil || msg.From.User == nil {
+				continue
+			}
+			if msg.CreatedDateTime.Before(since) {
+				continue
+			}
+			text := msg.Body.Content
+			if msg.Body.ContentType == "html" {
+				text = strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(text, " ")))
+			}
+			updates = append(updates, commontypes.Update{
+				Text:      fmt.Sprintf("%s: %s", msg.From.User.DisplayName, text),
+				Timestamp: commontypes.TimestampFromTime(msg.CreatedDateTime),
+				Link:      msg.WebURL,
+				Channel:   info.DisplayName,
+			})
+		}
+		next = page.NextLink
+	}
+	return updates, nil
+}
+
+func (c *Client) get(endpoint string, out interface{}) error {
+	resp, err := c.HTTPClient.Get(endpoint)
+	if err != nil {
+		return fmt.Errorf("error calling microsoft graph: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("microsoft graph returned status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding microsoft graph response: %v", err)
+	}
+	return nil
+}
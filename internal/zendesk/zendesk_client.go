@@ -0,0 +1,163 @@
+package zendesk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+// Client talks to the Zendesk Support API using an API token.
+type Client struct {
+	Subdomain  string
+	Email      string
+	APIToken   string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Zendesk client. A nil httpClient uses a default with a timeout.
+func NewClient(subdomain, email, apiToken string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		Subdomain:  subdomain,
+		Email:      email,
+		APIToken:   apiToken,
+		HTTPClient: httpClient,
+	}
+}
+
+type ticket struct {
+	ID        int64     `json:"id"`
+	Subject   string    `json:"subject"`
+	Status    string    `json:"status"`
+	Priority  string    `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SLAs      *struct {
+		PolicyMetrics []struct {
+			BreachAt *time.Time `json:"breach_at"`
+			Stage    string     `json:"stage"`
+			Metric   string     `json:"metric"`
+		} `json:"policy_metrics"`
+	} `json:"slas"`
+}
+
+type ticketPage struct {
+	Tickets     []ticket `json:"tickets"`
+	AfterURL    string   `json:"after_url"`
+	EndOfStream bool     `json:"end_of_stream"`
+}
+
+// FetchUpdates returns support updates for tickets that were created, solved,
+// or breached an SLA since the given time.
+func (c *Client) FetchUpdates(since time.Time, logger *zap.Logger) ([]commontypes.Update, error) {
+	params := url.Values{}
+	params.Set("start_time", fmt.Sprintf("%d", since.Unix()))
+	params.Set("include", "slas")
+	next := fmt.Sprintf("https://%s.zendesk.com/api/v2/incremental/tickets/cursor.json?%s", c.Subdomain, params.Encode())
+
+	var updates []commontypes.Update
+	now := time.Now()
+	for next != "" {
+		page, err := c.getPage(next)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range page.Tickets {
+			event, eventTime := ticketEvent(t, since, now)
+			if event == "" {
+				continue
+			}
+			updates = append(updates, commontypes.Update{
+				Text:      fmt.Sprintf("[%s] Ticket #%d (%s priority, %s): %s", event, t.ID, orDefault(t.Priority, "no"), t.Status, t.Subject),
+				Timestamp: commontypes.TimestampFromTime(eventTime),
+				Link:      fmt.Sprintf("https://%s.zendesk.com/agent/tickets/%d", c.Subdomain, t.ID),
+				Channel:   "zendesk",
+				Category:  "support",
+				Priority:  ticketPriority(t, event),
+			})
+		}
+
+		if page.EndOfStream {
+			break
+		}
+		next = page.AfterURL
+	}
+
+	logger.Info("Fetched Zendesk ticket events",
+		zap.String("subdomain", c.Subdomain),
+		zap.Int("updates", len(updates)))
+	return updates, nil
+}
+
+func (c *Client) getPage(pageURL string) (*ticketPage, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building zendesk request: %v", err)
+	}
+	req.SetBasicAuth(c.Email+"/token", c.APIToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling zendesk: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("zendesk returned status %s", resp.Status)
+	}
+
+	var page ticketPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decoding zendesk response: %v", err)
+	}
+	return &page, nil
+}
+
+// ticketEvent classifies what happened to a ticket inside the window.
+// Breaches take precedence because they need attention regardless of age.
+func ticketEvent(t ticket, since, now time.Time) (string, time.Time) {
+	if t.SLAs != nil && t.Status != "solved" && t.Status != "closed" {
+		for _, m := range t.SLAs.PolicyMetrics {
+			if m.Stage == "active" && m.BreachAt != nil && m.BreachAt.Before(now) {
+				return "SLA breached", *m.BreachAt
+			}
+		}
+	}
+	switch {
+	case t.Status == "solved" && !t.UpdatedAt.Before(since):
+		return "Solved", t.UpdatedAt
+	case !t.CreatedAt.Before(since):
+		return "New", t.CreatedAt
+	}
+	return "", time.Time{}
+}
+
+func ticketPriority(t ticket, event string) int {
+	priority := 2 // Same base as Slack support channels
+	switch strings.ToLower(t.Priority) {
+	case "high", "urgent":
+		priority++
+	}
+	if event == "SLA breached" {
+		priority++
+	}
+	return priority
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
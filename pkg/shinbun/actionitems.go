@@ -0,0 +1,239 @@
+package shinbun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"go.uber.org/zap"
+)
+
+const (
+	// actionItemsMaxTokens bounds the extraction response.
+	actionItemsMaxTokens = 2000
+	// maxExtractedActionItems bounds the Action Items section.
+	maxExtractedActionItems = 25
+)
+
+// extractedActionItem is an action item the LLM found in the week's messages.
+// Link is the message it was raised in; Owner is a person's name as written,
+// and Due the deadline as written, e.g. "by Friday", either possibly empty.
+type extractedActionItem struct {
+	Owner       string `json:"owner"`
+	Description string `json:"description"`
+	Link        string `json:"link"`
+	Due         string `json:"due"`
+}
+
+// actionItemsSchema is the structured output the extraction asks for.
+var actionItemsSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"action_items": {
+			Type: jsonschema.Array,
+			Items: &jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"owner":       {Type: jsonschema.String, Description: "Name of the person or team expected to do it, empty if nobody is named"},
+					"description": {Type: jsonschema.String, Description: "What needs to be done, as a short imperative sentence"},
+					"link":        {Type: jsonschema.String, Description: "Link of the message that raised it, copied exactly"},
+					"due":         {Type: jsonschema.String, Description: "The deadline as written, e.g. \"by Friday\", empty if none"},
+				},
+				Required:             []string{"owner", "description", "link", "due"},
+				AdditionalProperties: false,
+			},
+		},
+	},
+	Required:             []string{"action_items"},
+	AdditionalProperties: false,
+}
+
+// extractActionItems asks the model for the action items raised in updates.
+// Items that don't cite one of the updates' links are dropped.
+func (p *pipeline) extractActionItems(client *openai.Client, model string, updates []Update) ([]extractedActionItem, error) {
+	type message struct {
+		Link        string `json:"link"`
+		Channel     string `json:"channel"`
+		Author      string `json:"author,omitempty"`
+		Text        string `json:"text"`
+		Translation string `json:"translation,omitempty"`
+	}
+	messages := make([]message, 0, len(updates))
+	for _, u := range updates {
+		if u.Link == "" {
+			continue
+		}
+		messages = append(messages, message{Link: u.Link, Channel: u.Channel, Author: p.authorName(u), Text: u.Text, Translation: u.Translation})
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	input, err := json.Marshal(map[string]any{"messages": messages})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding messages: %v", err)
+	}
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role: openai.ChatMessageRoleSystem,
+					Content: `You extract action items from a week of team chat messages. You receive a JSON object {"messages": [...]}. ` +
+						`An action item is a concrete task someone committed to or was asked to do; skip questions, completed work and vague intentions. ` +
+						`For each one give the owner by name (the person asked, or the author if they committed to it), a short description, ` +
+						`the link of the message it was raised in, and the deadline as written. Write descriptions in English. Return an empty list when there are none.`,
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: string(input),
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:   "action_items",
+					Schema: &actionItemsSchema,
+					Strict: true,
+				},
+			},
+			MaxTokens:   actionItemsMaxTokens,
+			Temperature: 0,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting action items: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("openai returned no choices")
+	}
+
+	var result struct {
+		ActionItems []extractedActionItem `json:"action_items"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
+		return nil, fmt.Errorf("error decoding action items: %v", err)
+	}
+
+	links := make(map[string]bool)
+	for _, u := range updates {
+		links[u.Link] = true
+	}
+	var items []extractedActionItem
+	for _, item := range result.ActionItems {
+		item.Owner = strings.TrimPrefix(strings.TrimSpace(item.Owner), "@")
+		item.Description = strings.TrimSpace(item.Description)
+		item.Due = strings.TrimSpace(item.Due)
+		if item.Description == "" || item.Link == "" || !links[item.Link] {
+			p.logger.Debug("Dropping action item without a known source", zap.String("link", item.Link), zap.String("description", item.Description))
+			continue
+		}
+		items = append(items, item)
+		if len(items) == maxExtractedActionItems {
+			break
+		}
+	}
+	return items, nil
+}
+
+// authorName is an update's author as shown to the model: a Slack user's
+// name, or the name other sources report.
+func (p *pipeline) authorName(u Update) string {
+	if u.Source != "" || u.Author == "" {
+		return u.Author
+	}
+	return p.users.name(u.Author)
+}
+
+// ownerID resolves an extracted owner to the Slack user ID of the message's
+// author or of someone it mentions, or "" when it names someone else.
+func (p *pipeline) ownerID(owner string, u Update) string {
+	if owner == "" || u.Source != "" {
+		return ""
+	}
+	for _, id := range append([]string{u.Author}, u.Mentions...) {
+		if id != "" && strings.EqualFold(p.users.name(id), owner) {
+			return id
+		}
+	}
+	return ""
+}
+
+// actionItemsSection extracts the action items raised in updates, records
+// the Slack ones in action_items so follow-ups track them, and renders the
+// Action Items section. It returns "" when there are none or extraction fails.
+func (p *pipeline) actionItemsSection(client *openai.Client, updates []Update) string {
+	items, err := p.extractActionItems(client, p.config.OpenAICheapModel, updates)
+	if err != nil {
+		p.logger.Warn("Failed to extract action items", zap.Error(err))
+		return ""
+	}
+	p.logger.Info("Extracted action items", zap.Int("items", len(items)))
+	if len(items) == 0 {
+		return ""
+	}
+
+	byLink := make(map[string]Update)
+	for _, u := range updates {
+		byLink[u.Link] = u
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Action Items\n\n")
+	saved := make(map[string]bool)
+	for _, item := range items {
+		u := byLink[item.Link]
+		ownerID := p.ownerID(item.Owner, u)
+		owner := ""
+		if ownerID != "" {
+			owner = " " + p.ownerName(ownerID) + ":"
+		} else if item.Owner != "" {
+			owner = " " + item.Owner + ":"
+		}
+		due := ""
+		if item.Due != "" {
+			due = " (due " + item.Due + ")"
+		}
+		sb.WriteString(fmt.Sprintf("- #%s%s [%s](%s)%s\n", strings.TrimPrefix(u.Channel, "#"), owner, item.Description, item.Link, due))
+
+		// One row per message; follow-ups check completion on the message
+		if u.Source != "" || saved[item.Link] {
+			continue
+		}
+		saved[item.Link] = true
+		if err := p.saveExtractedActionItem(item, ownerID, u); err != nil {
+			p.logger.Error("Failed to record action item", zap.String("link", item.Link), zap.Error(err))
+		}
+	}
+	return sb.String()
+}
+
+// saveExtractedActionItem records an extracted item, adding its description,
+// owner and due hint to the row pattern detection may have recorded.
+func (p *pipeline) saveExtractedActionItem(item extractedActionItem, ownerID string, u Update) error {
+	posted, err := formatTimestamp(u.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid message timestamp: %v", err)
+	}
+	ownerName := ""
+	if ownerID == "" {
+		ownerName = item.Owner
+	}
+	_, err = p.db.Exec(`
+		INSERT INTO action_items (link, channel, ts, owner, owner_name, text, description, due_hint, posted_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, NULLIF($8, ''), $9)
+		ON CONFLICT (link) DO UPDATE SET
+			owner = COALESCE(EXCLUDED.owner, action_items.owner),
+			owner_name = EXCLUDED.owner_name,
+			description = EXCLUDED.description,
+			due_hint = EXCLUDED.due_hint`,
+		item.Link, u.Channel, u.Timestamp, ownerID, ownerName, u.Text, item.Description, item.Due, posted)
+	if err != nil {
+		return fmt.Errorf("error saving action item: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package shinbun
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// afterHoursCalloutLimit bounds the urgent after-hours messages listed in the
+// digest callout.
+const afterHoursCalloutLimit = 5
+
+// businessHours are the working hours messages are measured against, e.g.
+// Monday to Friday 09:00-18:00 in Tokyo. End before Start spans midnight.
+type businessHours struct {
+	Days       [7]bool // by time.Weekday
+	Start, End int     // minutes after midnight
+	Location   *time.Location
+}
+
+// parseBusinessHours parses BUSINESS_DAYS ("mon-fri" or "mon,tue,sat"),
+// BUSINESS_HOURS ("09:00-18:00") and BUSINESS_TIMEZONE (an IANA name).
+func parseBusinessHours(days, hours, timezone string) (businessHours, error) {
+	var b businessHours
+	for _, part := range splitList(days) {
+		from, to, isRange := strings.Cut(part, "-")
+		lo, err := parseWeekday(from)
+		if err != nil {
+			return b, err
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parseWeekday(to); err != nil {
+				return b, err
+			}
+		}
+		for d := lo; ; d = (d + 1) % 7 {
+			b.Days[d] = true
+			if d == hi {
+				break
+			}
+		}
+	}
+
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return b, fmt.Errorf("invalid hours %q, expected HH:MM-HH:MM", hours)
+	}
+	var err error
+	if b.Start, err = parseClockTime(from); err != nil {
+		return b, err
+	}
+	if b.End, err = parseClockTime(to); err != nil {
+		return b, err
+	}
+
+	if b.Location, err = time.LoadLocation(timezone); err != nil {
+		return b, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+	}
+	return b, nil
+}
+
+func parseWeekday(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range cronDays {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q, expected mon, tue, ...", s)
+}
+
+// parseClockTime returns the minutes after midnight of "HH:MM"; "24:00" is
+// the end of the day.
+func parseClockTime(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// contains reports whether t falls within business hours. Hours that span
+// midnight belong to the day they start on.
+func (b businessHours) contains(t time.Time) bool {
+	t = t.In(b.Location)
+	minute := t.Hour()*60 + t.Minute()
+	if b.Start <= b.End {
+		return b.Days[t.Weekday()] && minute >= b.Start && minute < b.End
+	}
+	if minute >= b.Start {
+		return b.Days[t.Weekday()]
+	}
+	return minute < b.End && b.Days[(t.Weekday()+6)%7]
+}
+
+// String describes the hours, e.g. "Mon-Fri 09:00-18:00 Asia/Tokyo".
+func (b businessHours) String() string {
+	var days []string
+	for i := 1; i <= 7; i++ {
+		if b.Days[i%7] {
+			days = append(days, weekdayNames[i])
+		}
+	}
+	daysStr := strings.Join(days, ", ")
+	if daysStr == "Mon, Tue, Wed, Thu, Fri" {
+		daysStr = "Mon-Fri"
+	}
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d %s", daysStr, b.Start/60, b.Start%60, b.End/60, b.End%60, b.Location)
+}
+
+// flagAfterHours marks the updates posted outside business hours and returns
+// how many there are.
+func flagAfterHours(updates []Update, b businessHours, logger *zap.Logger) int {
+	flagged := 0
+	for i := range updates {
+		t, err := formatTimestamp(updates[i].Timestamp)
+		if err != nil {
+			continue
+		}
+		updates[i].AfterHours = !b.contains(t)
+		if updates[i].AfterHours {
+			flagged++
+		}
+	}
+	logger.Info("Flagged after-hours activity", zap.Int("after_hours", flagged), zap.Int("total", len(updates)), zap.Stringer("business_hours", b))
+	return flagged
+}
+
+// afterHoursCallout is the digest section on activity outside business
+// hours: how much there was, where, and the urgent messages posted then,
+// which may have gone unnoticed. It is empty when there was none.
+func afterHoursCallout(updates []Update, b businessHours) string {
+	var flagged []Update
+	perChannel := make(map[string]int)
+	for _, u := range updates {
+		if u.AfterHours {
+			flagged = append(flagged, u)
+			perChannel["#"+strings.TrimPrefix(u.Channel, "#")]++
+		}
+	}
+	if len(flagged) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## After-Hours Activity\n\n")
+	sb.WriteString(fmt.Sprintf("%d of %d messages (%s) were posted outside business hours (%s).\n", len(flagged), len(updates), percent(len(flagged), len(updates)), b))
+
+	channels := sortedKeys(perChannel)
+	sort.SliceStable(channels, func(i, j int) bool { return perChannel[channels[i]] > perChannel[channels[j]] })
+	parts := make([]string, len(channels))
+	for i, channel := range channels {
+		parts[i] = fmt.Sprintf("%s %d", channel, perChannel[channel])
+	}
+	sb.WriteString(fmt.Sprintf("\n- **By channel:** %s\n", strings.Join(parts, ", ")))
+
+	var urgent []Update
+	for _, u := range flagged {
+		if u.Priority >= 3 || u.Category == "alert" {
+			urgent = append(urgent, u)
+		}
+	}
+	if len(urgent) == 0 {
+		return sb.String()
+	}
+	sortByScore(urgent)
+	if len(urgent) > afterHoursCalloutLimit {
+		urgent = urgent[:afterHoursCalloutLimit]
+	}
+	sb.WriteString("\nUrgent messages posted after hours:\n\n")
+	for _, u := range urgent {
+		when := ""
+		if t, err := formatTimestamp(u.Timestamp); err == nil {
+			when = t.In(b.Location).Format("Mon 15:04") + " · "
+		}
+		sb.WriteString(fmt.Sprintf("- %s#%s: [%s](%s)\n", when, strings.TrimPrefix(u.Channel, "#"), excerpt(u.Text, 140), u.Link))
+	}
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package shinbun
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+func TestBusinessHoursContains(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		// January 2025 starts on a Wednesday; the 6th is a Monday
+		return time.Date(2025, 1, day, hour, minute, 0, 0, tokyo)
+	}
+
+	tests := []struct {
+		name  string
+		days  string
+		hours string
+		t     time.Time
+		want  bool
+	}{
+		{"weekday morning", "mon-fri", "09:00-18:00", at(6, 9, 0), true},
+		{"before opening", "mon-fri", "09:00-18:00", at(6, 8, 59), false},
+		{"closing time is outside", "mon-fri", "09:00-18:00", at(6, 18, 0), false},
+		{"weekend", "mon-fri", "09:00-18:00", at(11, 12, 0), false},
+		{"other zone converted", "mon-fri", "09:00-18:00", time.Date(2025, 1, 6, 1, 0, 0, 0, time.UTC), true},
+		{"night shift evening", "mon-fri", "22:00-06:00", at(10, 23, 0), true},
+		{"night shift after midnight belongs to the day before", "mon-fri", "22:00-06:00", at(11, 5, 0), true},
+		{"night shift doesn't start on Saturday", "mon-fri", "22:00-06:00", at(11, 23, 0), false},
+		{"night shift after Sunday midnight", "mon-fri", "22:00-06:00", at(6, 5, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := parseBusinessHours(tt.days, tt.hours, "Asia/Tokyo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := b.contains(tt.t); got != tt.want {
+				t.Errorf("contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagAfterHours(t *testing.T) {
+	b, err := parseBusinessHours("mon-fri", "09:00-18:00", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	updates := []Update{
+		{Timestamp: commontypes.TimestampFromTime(monday.Add(10 * time.Hour))},
+		{Timestamp: commontypes.TimestampFromTime(monday.Add(20 * time.Hour))},
+		{Timestamp: commontypes.TimestampFromTime(monday.Add(-12 * time.Hour))},
+	}
+	if n := flagAfterHours(updates, b, zap.NewNop()); n != 2 {
+		t.Errorf("flagged %d, want 2", n)
+	}
+	if updates[0].AfterHours || !updates[1].AfterHours || !updates[2].AfterHours {
+		t.Errorf("flags %v %v %v, want false true true", updates[0].AfterHours, updates[1].AfterHours, updates[2].AfterHours)
+	}
+}
+
+func TestParseBusinessHoursErrors(t *testing.T) {
+	tests := []struct{ days, hours, zone string }{
+		{"mon-fri", "9-18", "UTC"},
+		{"someday", "09:00-18:00", "UTC"},
+		{"mon-fri", "09:00-25:00", "UTC"},
+		{"mon-fri", "09:00-18:00", "Mars/Olympus"},
+	}
+	for _, tt := range tests {
+		if _, err := parseBusinessHours(tt.days, tt.hours, tt.zone); err == nil {
+			t.Errorf("parseBusinessHours(%q, %q, %q): want an error", tt.days, tt.hours, tt.zone)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package shinbun fetches messages from Slack and other sources, categorizes
+// and scores them, summarizes them into a digest and delivers it. The shinbun
+// command is a thin wrapper around Main; other Go programs can run the same
+// pipeline with LoadConfig and Run.
+package shinbun
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options selects what a Run covers. The zero value runs the default focus
+// from each channel's last fetch time and delivers the digest.
+type Options struct {
+	// Focus picks the channels and prompt, e.g. "default" or "support"
+	Focus string
+	// From overrides the per-channel fetch watermarks when set
+	From time.Time
+	// AsOf runs the pipeline as if it were this time when set
+	AsOf time.Time
+	// DryRun generates the digest without archiving or delivering it
+	DryRun bool
+	// NoLLM renders the digest from the template without calling OpenAI
+	NoLLM bool
+	// Sample, when positive, summarizes a stratified sample of this many
+	// messages as a labelled preview that is not archived
+	Sample int
+}
+
+// Result is the outcome of a Run.
+type Result struct {
+	// Summary is the digest markdown, without the masthead; "" when there was nothing new
+	Summary string
+}
+
+// LoadConfig reads the configuration from the environment and a .env file in
+// the working directory, as the command does.
+func LoadConfig() (*Config, error) {
+	return loadConfig()
+}
+
+// Run fetches, summarizes and delivers one digest. Nothing is written to
+// stdout; progress goes to logger. The config must come from LoadConfig; it
+// can be used for any number of Runs.
+func Run(config *Config, opts Options, logger *zap.Logger) (Result, error) {
+	if config == nil || config.Clock == nil {
+		return Result{}, errors.New("config must come from LoadConfig")
+	}
+	// The run adjusts its config (e.g. the clock by AsOf, the focus's
+	// weights, --no-llm's settings); keep that to this run
+	runConfig := *config
+	config = &runConfig
+	config.Usage = newAPIUsage()
+	if opts.Focus == "" {
+		opts.Focus = "default"
+	}
+	if !opts.AsOf.IsZero() {
+		config.Clock = newAsOfClock(opts.AsOf)
+	}
+	from := opts.From
+	if from.IsZero() && !opts.AsOf.IsZero() {
+		from = opts.AsOf.AddDate(0, 0, -7)
+	}
+
+	db, err := connectDB(config)
+	if err != nil {
+		return Result{}, err
+	}
+	defer db.Close()
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		return Result{}, err
+	}
+
+	flags := Flags{
+		Focus:  opts.Focus,
+		DryRun: opts.DryRun,
+		NoLLM:  opts.NoLLM,
+		Sample: opts.Sample,
+		Output: cliOutput{Quiet: true},
+	}
+	summary, err := runDigest(api, db, config, flags, from, opts.AsOf, logger)
+	return Result{Summary: summary}, err
+}
+
+// Categorize returns the category ("alert", "support" or "general")
+// and base priority shinbun gives a message posted in a channel, using the
+// default term lists.
+func Categorize(channel, text string) (category string, priority int) {
+	return termSet(nil).categorize(channel, text)
+}
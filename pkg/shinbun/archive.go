@@ -0,0 +1,180 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// digestPathPrefix is where archived digests are served: /digests/{focus}/{date}.
+const digestPathPrefix = "/digests/"
+
+// digestURL returns the stable archive URL of a digest, or "" when no public
+// base URL is configured.
+func digestURL(baseURL, focus string, date time.Time) string {
+	if baseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(baseURL, "/") + digestPathPrefix + url.PathEscape(focus) + "/" + date.Format("2006-01-02")
+}
+
+// saveDigest archives a digest. A focus has one digest per day; a later run on
+// the same day replaces it and keeps its issue number.
+func saveDigest(db *sql.DB, focus string, date time.Time, issue digestIssue, content string, logger *zap.Logger) error {
+	query := `
+		INSERT INTO digests (focus, digest_date, content, issue, title)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''))
+		ON CONFLICT (focus, digest_date)
+		DO UPDATE SET content = EXCLUDED.content, issue = COALESCE(digests.issue, EXCLUDED.issue),
+		    title = EXCLUDED.title, created_at = CURRENT_TIMESTAMP`
+
+	logger.Debug("Archiving digest", zap.String("focus", focus), zap.Time("date", date), zap.Int("issue", issue.Number))
+	if _, err := db.Exec(query, focus, date.Format("2006-01-02"), content, issue.Number, issue.Title); err != nil {
+		return fmt.Errorf("error saving digest: %v", err)
+	}
+	return nil
+}
+
+// getDigest returns the archived digest markdown, or sql.ErrNoRows.
+func getDigest(db *sql.DB, focus string, date time.Time) (string, error) {
+	var content string
+	err := db.QueryRow(`SELECT content FROM digests WHERE focus = $1 AND digest_date = $2`,
+		focus, date.Format("2006-01-02")).Scan(&content)
+	return content, err
+}
+
+// serve runs the archive server and the scheduled digests until SIGINT or
+// SIGTERM, then lets runs in progress finish. A second signal exits at once.
+func serve(db *sql.DB, config *Config, flags Flags, logger *zap.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Nobody is watching a terminal for scheduled runs
+	flags.Stream, flags.Pager = false, false
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runScheduler(ctx, db, config, flags, logger)
+	}()
+	err := serveArchive(ctx, db, config, logger)
+	if ctx.Err() == nil {
+		logger.Error("Digest archive server failed, stopping the scheduler", zap.Error(err))
+	}
+	// Stopping also cancels ctx for the scheduler when the server failed
+	stop()
+	logger.Info("Shutting down, waiting for scheduled runs in progress")
+	wg.Wait()
+	logger.Info("Stopped")
+	return err
+}
+
+// serveArchive runs the HTTP server for archived digests and, when email
+// tracking is enabled, its endpoints, until it fails or ctx is done.
+func serveArchive(ctx context.Context, db *sql.DB, config *Config, logger *zap.Logger) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(digestPathPrefix, func(w http.ResponseWriter, r *http.Request) {
+		handleDigest(db, config.webBranding(), w, r, logger)
+	})
+	if config.EmailTracking {
+		mux.HandleFunc(trackOpenPrefix, func(w http.ResponseWriter, r *http.Request) {
+			handleOpen(db, w, r, logger)
+		})
+		mux.HandleFunc(trackClickPrefix, func(w http.ResponseWriter, r *http.Request) {
+			handleClick(db, config.PublicBaseURL, w, r, logger)
+		})
+		mux.HandleFunc(trackFeedbackPrefix, func(w http.ResponseWriter, r *http.Request) {
+			handleFeedback(db, config.PublicBaseURL, w, r, logger)
+		})
+		if config.TopicPreferences {
+			mux.HandleFunc(topicsPathPrefix, func(w http.ResponseWriter, r *http.Request) {
+				handleTopics(db, config, w, r, logger)
+			})
+		}
+	}
+
+	logger.Info("Serving digest archive", zap.String("addr", config.HTTPAddr), zap.Bool("email_tracking", config.EmailTracking))
+	server := &http.Server{
+		Addr:              config.HTTPAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil {
+			logger.Error("Failed to shut down the archive server", zap.Error(err))
+		}
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func handleDigest(db *sql.DB, brand branding, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, digestPathPrefix), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || len(parts) == 3 && parts[2] != audioFilename {
+		http.NotFound(w, r)
+		return
+	}
+	focus := parts[0]
+	date, err := time.Parse("2006-01-02", parts[1])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 3 {
+		handleDigestAudio(db, focus, date, w, r, logger)
+		return
+	}
+
+	content, err := getDigest(db, focus, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load digest", zap.String("focus", focus), zap.Time("date", date), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, renderHTMLPage(content, brand))
+}
+
+// handleDigestAudio serves a digest's narration (AUDIO_EDITION=link).
+func handleDigestAudio(db *sql.DB, focus string, date time.Time, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	audio, err := getDigestAudio(db, focus, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load digest audio", zap.String("focus", focus), zap.Time("date", date), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// ServeContent answers the range requests audio players make
+	w.Header().Set("Content-Type", "audio/mpeg")
+	http.ServeContent(w, r, audioFilename, time.Time{}, bytes.NewReader(audio))
+}
@@ -0,0 +1,154 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// maxAttachmentsPerMessage bounds what is kept of a message that shares a
+// whole folder of files.
+const maxAttachmentsPerMessage = 10
+
+// slackAttachments describes the files, link unfurls and app attachments of
+// a Slack message. Only titles, names and URLs are kept, never contents.
+func slackAttachments(msg slack.Message) []Attachment {
+	// Not nil, so saving the message clears attachments that were removed
+	attachments := []Attachment{}
+	for _, f := range msg.Files {
+		a := Attachment{Kind: "file", Name: f.Name, URL: f.Permalink}
+		if f.Title != f.Name {
+			a.Title = f.Title
+		}
+		if f.Mode == "tombstone" || a.Name == "" && a.Title == "" {
+			// Deleted, or hidden from the bot
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	for _, att := range msg.Attachments {
+		a := Attachment{Kind: "attachment", Title: att.Title, URL: att.TitleLink}
+		if url := firstNonEmpty(att.OriginalURL, att.FromURL); url != "" {
+			a = Attachment{Kind: "link", Title: att.Title, Name: att.ServiceName, URL: url}
+		}
+		if a.Title == "" {
+			a.Title = att.Fallback
+		}
+		if a.Title == "" && a.URL == "" {
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	if len(attachments) > maxAttachmentsPerMessage {
+		attachments = attachments[:maxAttachmentsPerMessage]
+	}
+	return attachments
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// formatAttachments renders attachments for the prompt, e.g.
+// `file "Q3 roadmap" (roadmap.pdf) <https://...>; link "Incident 42" (Statuspage) <https://...>`.
+func formatAttachments(attachments []Attachment) string {
+	parts := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		part := a.Kind
+		if a.Title != "" {
+			part += fmt.Sprintf(" %q", a.Title)
+		}
+		if a.Name != "" {
+			part += " (" + a.Name + ")"
+		}
+		if a.URL != "" {
+			part += " <" + a.URL + ">"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// attachmentsText describes what a message without text shared, e.g.
+// `Shared file "Q3 roadmap" (roadmap.pdf), link "Incident 42" (Statuspage)`,
+// so it isn't a blank entry in the prompt and the database. It returns ""
+// when there are no attachments.
+func attachmentsText(attachments []Attachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		part := a.Kind
+		if a.Title != "" {
+			part += fmt.Sprintf(" %q", a.Title)
+		}
+		if a.Name != "" {
+			part += " (" + a.Name + ")"
+		} else if a.Title == "" {
+			part += " " + a.URL
+		}
+		parts = append(parts, part)
+	}
+	return "Shared " + strings.Join(parts, ", ")
+}
+
+// attachmentTokens counts the tokens of the Attachments line of an update.
+func attachmentTokens(model string, update Update) int {
+	if len(update.Attachments) == 0 {
+		return 0
+	}
+	return countTokens(model, formatAttachments(update.Attachments))
+}
+
+// saveAttachments replaces the stored attachments of a message. Updates from
+// sources that don't report attachments (nil) leave them as they are.
+func saveAttachments(db execer, msg Update) error {
+	if msg.Attachments == nil {
+		return nil
+	}
+	if _, err := db.Exec(`DELETE FROM message_attachments WHERE slack_id = $1`, msg.Timestamp); err != nil {
+		return fmt.Errorf("error clearing attachments: %v", err)
+	}
+	for i, a := range msg.Attachments {
+		if _, err := db.Exec(`INSERT INTO message_attachments (slack_id, position, kind, title, name, url) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''))`,
+			msg.Timestamp, i, a.Kind, a.Title, a.Name, a.URL); err != nil {
+			return fmt.Errorf("error saving attachments: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadAttachments returns the stored attachments of the channel's messages
+// since the given time, by message timestamp.
+func loadAttachments(db *sql.DB, channelID int, since time.Time) (map[string][]Attachment, error) {
+	rows, err := db.Query(`
+		SELECT a.slack_id, a.kind, COALESCE(a.title, ''), COALESCE(a.name, ''), COALESCE(a.url, '')
+		FROM message_attachments a
+		JOIN messages m ON m.slack_id = a.slack_id
+		WHERE m.channel_id = $1 AND m.timestamp >= $2
+		ORDER BY a.slack_id, a.position`, channelID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachments: %v", err)
+	}
+	defer rows.Close()
+
+	attachments := make(map[string][]Attachment)
+	for rows.Next() {
+		var ts string
+		var a Attachment
+		if err := rows.Scan(&ts, &a.Kind, &a.Title, &a.Name, &a.URL); err != nil {
+			return nil, fmt.Errorf("error scanning attachment row: %v", err)
+		}
+		attachments[ts] = append(attachments[ts], a)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,261 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+const (
+	audioEditionAttach = "attach"
+	audioEditionLink   = "link"
+	// speechChunkChars keeps each request under the speech API's 4096
+	// character limit
+	speechChunkChars = 4000
+	// narrationMaxChars bounds the narration, about half an hour of speech
+	narrationMaxChars = 30000
+	// audioFilename is the narration's name in the archive and in email
+	audioFilename = "audio.mp3"
+)
+
+// audioSettings narrate each digest as an MP3 (AUDIO_EDITION, AUDIO_MODEL,
+// AUDIO_VOICE).
+type audioSettings struct {
+	// Mode is "attach" to attach it to the email, or "link" to store it with
+	// the archived digest and link it from the digest
+	Mode  string
+	Model string
+	Voice string
+}
+
+func (s audioSettings) validate(publicBaseURL string) error {
+	switch s.Mode {
+	case "", audioEditionAttach:
+	case audioEditionLink:
+		if publicBaseURL == "" {
+			return fmt.Errorf("AUDIO_EDITION=link requires PUBLIC_BASE_URL")
+		}
+	default:
+		return fmt.Errorf("AUDIO_EDITION must be %s or %s", audioEditionAttach, audioEditionLink)
+	}
+	return nil
+}
+
+var (
+	markdownHeadingPrefix = regexp.MustCompile(`^#{1,6}\s+`)
+	markdownListPrefix    = regexp.MustCompile(`^(\s*[-*+]|\s*\d+[.)])\s+`)
+	bareURLPattern        = regexp.MustCompile(`<?https?://\S+>?`)
+	emojiShortcodePattern = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+)
+
+// narrationText turns the digest markdown into text to be read aloud: an
+// introduction naming the issue, then the digest without link targets,
+// tables, rules or markup. Headings end in a full stop so the voice pauses.
+func narrationText(issue digestIssue, summary string) string {
+	var paragraphs []string
+	intro := fmt.Sprintf("%s, %s.", issue.label(), issue.Date.Format("Monday, January 2, 2006"))
+	if issue.Name != "" {
+		intro = issue.Name + ", " + intro
+	}
+	if issue.Title != "" {
+		intro += " " + issue.Title + "."
+	}
+	paragraphs = append(paragraphs, intro)
+
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(summary, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "---" || strings.HasPrefix(line, "|") || strings.HasPrefix(line, "```") {
+			flush()
+			continue
+		}
+		heading := markdownHeadingPrefix.MatchString(line)
+		line = markdownHeadingPrefix.ReplaceAllString(line, "")
+		line = markdownListPrefix.ReplaceAllString(line, "")
+		line = markdownLinkPattern.ReplaceAllString(line, "$1")
+		line = bareURLPattern.ReplaceAllString(line, "")
+		line = emojiShortcodePattern.ReplaceAllString(line, "")
+		line = strings.NewReplacer("**", "", "__", "", "`", "", "_", " ", "*", "").Replace(line)
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if last, _ := utf8.DecodeLastRuneInString(line); heading || !strings.ContainsRune(".!?:;。", last) {
+			line += "."
+		}
+		if heading {
+			flush()
+			paragraphs = append(paragraphs, line)
+			continue
+		}
+		// List items are read as separate sentences
+		current = append(current, line)
+	}
+	flush()
+
+	var sb strings.Builder
+	for _, p := range paragraphs {
+		if sb.Len()+len(p) > narrationMaxChars {
+			sb.WriteString("The rest of this edition is in the written digest.")
+			break
+		}
+		sb.WriteString(p + "\n\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// speechChunks splits text into pieces the speech API accepts, at paragraph
+// and then sentence boundaries.
+func speechChunks(text string, limit int) []string {
+	var chunks []string
+	var current strings.Builder
+	add := func(piece, sep string) {
+		if current.Len() > 0 && current.Len()+len(sep)+len(piece) > limit {
+			chunks = append(chunks, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString(sep)
+		}
+		current.WriteString(piece)
+	}
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if len(paragraph) <= limit {
+			add(paragraph, "\n\n")
+			continue
+		}
+		for _, sentence := range strings.SplitAfter(paragraph, ". ") {
+			for len(sentence) > limit {
+				cut := strings.LastIndex(sentence[:limit], " ")
+				if cut <= 0 {
+					cut = limit
+				}
+				add(sentence[:cut], "")
+				sentence = sentence[cut:]
+			}
+			add(sentence, "")
+		}
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, strings.TrimSpace(current.String()))
+	}
+	return chunks
+}
+
+// narrate reads text aloud with the speech API. MP3 streams can be
+// concatenated, so long digests are read in pieces and joined.
+func narrate(client *openai.Client, settings audioSettings, text string) ([]byte, error) {
+	var audio bytes.Buffer
+	for i, chunk := range speechChunks(text, speechChunkChars) {
+		resp, err := client.CreateSpeech(context.Background(), openai.CreateSpeechRequest{
+			Model:          openai.SpeechModel(settings.Model),
+			Voice:          openai.SpeechVoice(settings.Voice),
+			Input:          chunk,
+			ResponseFormat: openai.SpeechResponseFormatMp3,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error narrating part %d: %v", i+1, err)
+		}
+		_, err = io.Copy(&audio, resp)
+		resp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading narration part %d: %v", i+1, err)
+		}
+	}
+	return audio.Bytes(), nil
+}
+
+// digestAudioURL is where the archive serves a digest's narration.
+func digestAudioURL(archiveURL string) string {
+	return archiveURL + "/" + audioFilename
+}
+
+// listenLine is the markdown put above a digest whose narration is archived.
+func listenLine(archiveURL string) string {
+	return fmt.Sprintf("🎧 [Listen to this edition](%s)\n\n", digestAudioURL(archiveURL))
+}
+
+// saveDigestAudio stores a digest's narration, replacing an earlier one.
+func saveDigestAudio(db *sql.DB, focus string, date time.Time, audio []byte) error {
+	_, err := db.Exec(`
+		INSERT INTO digest_audio (focus, digest_date, audio)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (focus, digest_date)
+		DO UPDATE SET audio = EXCLUDED.audio, created_at = CURRENT_TIMESTAMP`,
+		focus, date.Format("2006-01-02"), audio)
+	if err != nil {
+		return fmt.Errorf("error saving digest audio: %v", err)
+	}
+	return nil
+}
+
+// getDigestAudio returns a digest's narration, or sql.ErrNoRows.
+func getDigestAudio(db *sql.DB, focus string, date time.Time) ([]byte, error) {
+	var audio []byte
+	err := db.QueryRow(`SELECT audio FROM digest_audio WHERE focus = $1 AND digest_date = $2`,
+		focus, date.Format("2006-01-02")).Scan(&audio)
+	return audio, err
+}
+
+// attachAudio wraps an email body in a multipart/mixed body with the
+// narration attached. It returns the Content-Type header and the body.
+func attachAudio(contentType string, body, audio []byte) (string, []byte, error) {
+	var mixed bytes.Buffer
+	w := multipart.NewWriter(&mixed)
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return "", nil, err
+	}
+	part.Write(body)
+
+	part, err = w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"audio/mpeg"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {"attachment; filename=" + audioFilename},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	part.Write([]byte(wrapBase64(audio)))
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return "multipart/mixed; boundary=" + w.Boundary(), mixed.Bytes(), nil
+}
+
+// narrateEdition produces the digest's narration, or nil when it fails.
+// Dry runs print what would be read instead.
+func narrateEdition(client *openai.Client, config *Config, flags Flags, issue digestIssue, summary string, logger *zap.Logger) []byte {
+	text := narrationText(issue, summary)
+	chunks := speechChunks(text, speechChunkChars)
+	if flags.DryRun {
+		flags.Output.event("audio", map[string]any{"mode": config.AudioEdition.Mode, "chars": len(text), "requests": len(chunks), "text": text},
+			fmt.Sprintf("\n--- DRY RUN: Audio edition (%d characters, %d requests) ---\n%s", len(text), len(chunks), text))
+		return nil
+	}
+	start := time.Now()
+	audio, err := narrate(client, config.AudioEdition, text)
+	if err != nil {
+		logger.Error("Failed to narrate digest, delivering it without audio", zap.Error(err))
+		return nil
+	}
+	logger.Info("Narrated digest", zap.Int("chars", len(text)), zap.Int("requests", len(chunks)), zap.Int("bytes", len(audio)), zap.Duration("took", time.Since(start)))
+	return audio
+}
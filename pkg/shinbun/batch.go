@@ -0,0 +1,262 @@
+package shinbun
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+const (
+	// batchPollInterval is how often a submitted batch is checked on.
+	batchPollInterval = time.Minute
+	// batchMaxWait gives up on a batch a little after OpenAI's 24h window.
+	batchMaxWait = 25 * time.Hour
+	// batchMaxPollErrors fails the summary after this many failed checks in a row.
+	batchMaxPollErrors = 10
+	// batchSummaryID is the custom_id of the summary request in the batch.
+	batchSummaryID = "summary"
+)
+
+// batchFocus reports whether focus is summarized through the Batch API.
+func (c *Config) batchFocus(focus string) bool {
+	for _, f := range c.OpenAIBatchFocuses {
+		if f == "*" || strings.EqualFold(f, focus) {
+			return true
+		}
+	}
+	return false
+}
+
+// batchOutputLine is one line of a batch's output or error file.
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                           `json:"status_code"`
+		Body       openai.ChatCompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// errBatchCheck is returned when a batch could not be checked on; the batch
+// itself may still complete.
+var errBatchCheck = errors.New("error checking summary batch")
+
+// runBatch keeps the summary batch of a run in runs.batch_id, so that a run
+// restarted while its batch is pending, e.g. after its lease expired, picks
+// the batch up instead of paying for another. The zero value, for runs that
+// aren't in the runs table, keeps nothing.
+type runBatch struct {
+	db    *sql.DB
+	runID int
+}
+
+func (b runBatch) load() (string, error) {
+	if b.db == nil || b.runID == 0 {
+		return "", nil
+	}
+	var id sql.NullString
+	if err := b.db.QueryRow(`SELECT batch_id FROM runs WHERE id = $1`, b.runID).Scan(&id); err != nil {
+		return "", fmt.Errorf("error loading run's summary batch: %v", err)
+	}
+	return id.String, nil
+}
+
+// save records the run's batch ID, or with "" forgets it so the next
+// attempt submits a new batch.
+func (b runBatch) save(id string) error {
+	if b.db == nil || b.runID == 0 {
+		return nil
+	}
+	if _, err := b.db.Exec(`UPDATE runs SET batch_id = NULLIF($2, '') WHERE id = $1`, b.runID, id); err != nil {
+		return fmt.Errorf("error saving run's summary batch: %v", err)
+	}
+	return nil
+}
+
+// generateBatchSummary submits the summary prompt through the OpenAI Batch
+// API, which costs half as much as a regular request, and waits for the
+// result: usually minutes, at most a day. model is the name the API knows
+// the model by. A batch the run submitted before is waited for instead of
+// submitting the prompt again.
+func generateBatchSummary(client *openai.Client, model string, updates []Update, focus string, background promptContext, saved runBatch, usage *apiUsage, logger *zap.Logger) (string, error) {
+	batch, err := resumeBatch(client, saved, logger)
+	if err != nil {
+		return "", err
+	}
+	if batch.ID == "" {
+		systemMessage, prompt := summaryPrompt(updates, focus, background)
+		file := openai.UploadBatchFileRequest{FileName: fmt.Sprintf("shinbun-%s.jsonl", focus)}
+		file.AddChatCompletion(batchSummaryID, summaryRequest(model, systemMessage, prompt))
+		submitted, err := client.CreateBatchWithUploadFile(context.Background(), openai.CreateBatchWithUploadFileRequest{
+			Endpoint:               openai.BatchEndpointChatCompletions,
+			CompletionWindow:       "24h",
+			Metadata:               map[string]any{"focus": focus},
+			UploadBatchFileRequest: file,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error submitting summary batch: %v", err)
+		}
+		batch = submitted.Batch
+		if err := saved.save(batch.ID); err != nil {
+			logger.Warn("Failed to save summary batch, a restarted run would submit another", zap.String("batch_id", batch.ID), zap.Error(err))
+		}
+		logger.Info("Submitted summary to the OpenAI Batch API, waiting for it to complete",
+			zap.String("focus", focus),
+			zap.String("model", model),
+			zap.Int("message_count", len(updates)),
+			zap.String("batch_id", batch.ID))
+	}
+
+	done, err := waitForBatch(client, batch, logger)
+	if err != nil {
+		if !errors.Is(err, errBatchCheck) {
+			// The batch is over; the next attempt submits a new one
+			if err := saved.save(""); err != nil {
+				logger.Warn("Failed to forget summary batch", zap.String("batch_id", batch.ID), zap.Error(err))
+			}
+		}
+		return "", err
+	}
+	if done.OutputFileID == nil || *done.OutputFileID == "" {
+		if err := saved.save(""); err != nil {
+			logger.Warn("Failed to forget summary batch", zap.String("batch_id", batch.ID), zap.Error(err))
+		}
+		if done.ErrorFileID != nil && *done.ErrorFileID != "" {
+			if _, err := readBatchResult(client, *done.ErrorFileID, usage); err != nil {
+				return "", err
+			}
+		}
+		return "", fmt.Errorf("batch %s completed without output", done.ID)
+	}
+	return readBatchResult(client, *done.OutputFileID, usage)
+}
+
+// resumeBatch returns the run's saved batch when it can still deliver the
+// summary, or an empty batch when there is none to wait for.
+func resumeBatch(client *openai.Client, saved runBatch, logger *zap.Logger) (openai.Batch, error) {
+	id, err := saved.load()
+	if err != nil || id == "" {
+		return openai.Batch{}, err
+	}
+	latest, err := client.RetrieveBatch(context.Background(), id)
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusNotFound {
+		logger.Warn("Saved summary batch not found, submitting a new one", zap.String("batch_id", id))
+		return openai.Batch{}, nil
+	}
+	if err != nil {
+		return openai.Batch{}, fmt.Errorf("%w %s: %v", errBatchCheck, id, err)
+	}
+	switch latest.Status {
+	case "failed", "expired", "cancelling", "cancelled":
+		logger.Info("Saved summary batch is over, submitting a new one", zap.String("batch_id", id), zap.String("status", latest.Status))
+		return openai.Batch{}, nil
+	}
+	logger.Info("Resuming the summary batch submitted by an earlier attempt", zap.String("batch_id", id), zap.String("status", latest.Status))
+	return latest.Batch, nil
+}
+
+// waitForBatch polls the batch until it completes, and fails when it fails,
+// expires or is cancelled, or is still running batchMaxWait after it was
+// submitted.
+func waitForBatch(client *openai.Client, batch openai.Batch, logger *zap.Logger) (openai.Batch, error) {
+	deadline := time.Now().Add(batchMaxWait)
+	if batch.CreatedAt > 0 {
+		deadline = time.Unix(int64(batch.CreatedAt), 0).Add(batchMaxWait)
+	}
+	pollErrors := 0
+	for {
+		switch batch.Status {
+		case "completed":
+			return batch, nil
+		case "failed", "expired", "cancelled":
+			reason := batch.Status
+			if batch.Errors != nil && len(batch.Errors.Data) > 0 {
+				reason += ": " + batch.Errors.Data[0].Message
+			}
+			return batch, fmt.Errorf("summary batch %s %s", batch.ID, reason)
+		}
+		if time.Now().After(deadline) {
+			if _, err := client.CancelBatch(context.Background(), batch.ID); err != nil {
+				logger.Warn("Failed to cancel summary batch", zap.String("batch_id", batch.ID), zap.Error(err))
+			}
+			return batch, fmt.Errorf("summary batch %s not done after %s", batch.ID, batchMaxWait)
+		}
+
+		time.Sleep(batchPollInterval)
+		latest, err := client.RetrieveBatch(context.Background(), batch.ID)
+		if err != nil {
+			pollErrors++
+			if pollErrors >= batchMaxPollErrors {
+				return batch, fmt.Errorf("%w %s: %v", errBatchCheck, batch.ID, err)
+			}
+			logger.Warn("Failed to check summary batch, retrying", zap.String("batch_id", batch.ID), zap.Error(err))
+			continue
+		}
+		pollErrors = 0
+		batch = latest.Batch
+		logger.Debug("Summary batch status", zap.String("batch_id", batch.ID), zap.String("status", batch.Status))
+	}
+}
+
+// readBatchResult returns the summary from a batch output file, or the error
+// the request failed with, and adds its tokens to usage.
+func readBatchResult(client *openai.Client, fileID string, usage *apiUsage) (string, error) {
+	content, err := client.GetFileContent(context.Background(), fileID)
+	if err != nil {
+		return "", fmt.Errorf("error downloading batch result: %v", err)
+	}
+	defer content.Close()
+
+	reader := bufio.NewReader(content)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var result batchOutputLine
+			if err := json.Unmarshal(line, &result); err != nil {
+				return "", fmt.Errorf("invalid batch result: %v", err)
+			}
+			if result.CustomID == batchSummaryID {
+				return batchSummary(result, usage)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading batch result: %v", err)
+		}
+	}
+	return "", errors.New("batch result has no summary")
+}
+
+func batchSummary(result batchOutputLine, usage *apiUsage) (string, error) {
+	if result.Error != nil {
+		return "", fmt.Errorf("error generating summary: %s: %s", result.Error.Code, result.Error.Message)
+	}
+	if result.Response == nil {
+		return "", errors.New("batch result has no response")
+	}
+	body := result.Response.Body
+	usage.tokens(body.Usage.PromptTokens, body.Usage.CompletionTokens)
+	if result.Response.StatusCode != 200 {
+		return "", fmt.Errorf("error generating summary: status %d", result.Response.StatusCode)
+	}
+	if len(body.Choices) == 0 {
+		return "", errors.New("openai returned no choices")
+	}
+	return body.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,99 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// fakeBatchAPI serves the Batch API calls of a summary: a saved batch with
+// savedStatus, and submitted batches with submitStatus.
+type fakeBatchAPI struct {
+	savedStatus  string
+	submitStatus string
+
+	mu        sync.Mutex
+	submitted int
+}
+
+func (f *fakeBatchAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	batch := func(id, status string) {
+		fmt.Fprintf(w, `{"id":%q,"status":%q,"output_file_id":"file_out"}`, id, status)
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/files":
+		fmt.Fprint(w, `{"id":"file_in"}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/batches":
+		f.mu.Lock()
+		f.submitted++
+		f.mu.Unlock()
+		batch("batch_new", f.submitStatus)
+	case r.URL.Path == "/batches/batch_saved":
+		batch("batch_saved", f.savedStatus)
+	case r.URL.Path == "/files/file_out/content":
+		fmt.Fprintln(w, `{"custom_id":"summary","response":{"status_code":200,"body":{"choices":[{"message":{"role":"assistant","content":"# Digest"}}]}}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"No such batch","type":"invalid_request_error"}}`)
+	}
+}
+
+func TestGenerateBatchSummaryResumesSavedBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		saved       string
+		savedStatus string
+		submit      string
+		wantErr     bool
+		wantSubmits int
+		wantSaved   string
+	}{
+		{name: "pending batch resumed", saved: "batch_saved", savedStatus: "completed", wantSubmits: 0, wantSaved: "batch_saved"},
+		{name: "no batch yet", submit: "completed", wantSubmits: 1, wantSaved: "batch_new"},
+		{name: "expired batch replaced", saved: "batch_saved", savedStatus: "expired", submit: "completed", wantSubmits: 1, wantSaved: "batch_new"},
+		{name: "unknown batch replaced", saved: "batch_gone", submit: "completed", wantSubmits: 1, wantSaved: "batch_new"},
+		{name: "failed batch forgotten", submit: "failed", wantErr: true, wantSubmits: 1, wantSaved: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			var runID int
+			if err := db.QueryRow(`INSERT INTO runs (focus, status, batch_id) VALUES ('default', 'running', NULLIF($1, '')) RETURNING id`, tt.saved).Scan(&runID); err != nil {
+				t.Fatal(err)
+			}
+			api := &fakeBatchAPI{savedStatus: tt.savedStatus, submitStatus: tt.submit}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			clientConfig := openai.DefaultConfig("test")
+			clientConfig.BaseURL = server.URL
+			client := openai.NewClientWithConfig(clientConfig)
+
+			summary, err := generateBatchSummary(client, "gpt-4o", nil, "default", promptContext{}, runBatch{db: db, runID: runID}, newAPIUsage(), zap.NewNop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !strings.HasPrefix(summary, "# Digest") {
+				t.Errorf("summary = %q, want the batch's", summary)
+			}
+			api.mu.Lock()
+			if api.submitted != tt.wantSubmits {
+				t.Errorf("submitted %d batches, want %d", api.submitted, tt.wantSubmits)
+			}
+			api.mu.Unlock()
+			var saved sql.NullString
+			if err := db.QueryRow(`SELECT batch_id FROM runs WHERE id = $1`, runID).Scan(&saved); err != nil {
+				t.Fatal(err)
+			}
+			if saved.String != tt.wantSaved {
+				t.Errorf("run's batch = %q, want %q", saved.String, tt.wantSaved)
+			}
+		})
+	}
+}
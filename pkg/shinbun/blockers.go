@@ -0,0 +1,194 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultBlockerPatterns are the phrases that mark a message as raising a risk
+// or blocker; BLOCKER_PATTERNS replaces them.
+var defaultBlockerPatterns = []string{"blocked on", "blocked by", "blocker", "at risk", "slipping", "can't proceed", "cannot proceed"}
+
+// blockerResolvedPatterns mark a later message from the blocker's owner as
+// resolving it.
+var blockerResolvedPatterns = []string{"unblocked", "no longer blocked", "back on track", "resolved", "fixed"}
+
+// blocker is a risk or blocker raised in a message.
+type blocker struct {
+	Link     string
+	Channel  string
+	Owner    string
+	Text     string
+	PostedAt time.Time
+	Resolved bool
+}
+
+// containsAny reports whether text contains one of the phrases, ignoring case.
+func containsAny(text string, phrases []string) bool {
+	lower := strings.ToLower(text)
+	for _, p := range phrases {
+		if strings.Contains(lower, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectBlockers returns the updates that raise a risk or blocker.
+func detectBlockers(updates []Update, patterns []string) []blocker {
+	var found []blocker
+	for _, u := range updates {
+		text := u.Text
+		if u.Translation != "" {
+			text = u.Translation
+		}
+		// "blocker on X is resolved" reports progress, not a new blocker
+		if !containsAny(text, patterns) || containsAny(text, blockerResolvedPatterns) || u.Link == "" {
+			continue
+		}
+		posted, err := formatTimestamp(u.Timestamp)
+		if err != nil {
+			continue
+		}
+		found = append(found, blocker{
+			Link:     u.Link,
+			Channel:  u.Channel,
+			Owner:    u.Author,
+			Text:     text,
+			PostedAt: posted,
+			Resolved: u.Status == statusResolved,
+		})
+	}
+	return found
+}
+
+// trackBlockers records the blockers raised in updates, marks earlier ones
+// resolved when a resolved reaction or a follow-up from their owner says so,
+// and renders the digest section: this period's blockers and how last week's
+// ended up. It returns "" when there is nothing to report.
+func trackBlockers(db *sql.DB, patterns []string, updates []Update, since time.Time, logger *zap.Logger) string {
+	current := detectBlockers(updates, patterns)
+	for _, b := range current {
+		_, err := db.Exec(`
+			INSERT INTO blockers (link, channel, owner, text, posted_at, resolved_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+			ON CONFLICT (link) DO UPDATE
+			SET text = EXCLUDED.text,
+			    resolved_at = COALESCE(blockers.resolved_at, EXCLUDED.resolved_at)`,
+			b.Link, b.Channel, b.Owner, b.Text, b.PostedAt, sql.NullTime{Time: time.Now(), Valid: b.Resolved})
+		if err != nil {
+			logger.Error("Failed to record blocker", zap.String("link", b.Link), zap.Error(err))
+		}
+	}
+
+	channels := make(map[string]bool)
+	for _, u := range updates {
+		channels[u.Channel] = true
+	}
+	previous, err := openBlockersBefore(db, since, since.AddDate(0, 0, -7))
+	if err != nil {
+		logger.Error("Failed to load last week's blockers", zap.Error(err))
+	}
+	var carried []blocker
+	for _, b := range previous {
+		if !channels[b.Channel] {
+			continue
+		}
+		b.Resolved = blockerResolvedBy(b, updates)
+		if b.Resolved {
+			if _, err := db.Exec(`UPDATE blockers SET resolved_at = CURRENT_TIMESTAMP WHERE link = $1`, b.Link); err != nil {
+				logger.Error("Failed to mark blocker resolved", zap.String("link", b.Link), zap.Error(err))
+			}
+		}
+		carried = append(carried, b)
+	}
+
+	return blockerSection(current, carried)
+}
+
+// openBlockersBefore returns blockers posted in [from, before) that were open
+// at the start of this run.
+func openBlockersBefore(db *sql.DB, before, from time.Time) ([]blocker, error) {
+	rows, err := db.Query(`
+		SELECT link, channel, COALESCE(owner, ''), text, posted_at FROM blockers
+		WHERE posted_at >= $1 AND posted_at < $2 AND resolved_at IS NULL
+		ORDER BY posted_at, link`, from, before)
+	if err != nil {
+		return nil, fmt.Errorf("error querying blockers: %v", err)
+	}
+	defer rows.Close()
+
+	var blockers []blocker
+	for rows.Next() {
+		var b blocker
+		if err := rows.Scan(&b.Link, &b.Channel, &b.Owner, &b.Text, &b.PostedAt); err != nil {
+			return nil, fmt.Errorf("error scanning blocker row: %v", err)
+		}
+		blockers = append(blockers, b)
+	}
+	return blockers, rows.Err()
+}
+
+// blockerResolvedBy reports whether updates resolve b: its own message now
+// carries a resolved reaction, or its owner later posted in the same channel
+// that it is resolved.
+func blockerResolvedBy(b blocker, updates []Update) bool {
+	for _, u := range updates {
+		if u.Link == b.Link {
+			if u.Status == statusResolved {
+				return true
+			}
+			continue
+		}
+		if b.Owner == "" || u.Author != b.Owner || u.Channel != b.Channel {
+			continue
+		}
+		posted, err := formatTimestamp(u.Timestamp)
+		if err == nil && posted.After(b.PostedAt) && containsAny(u.Text, blockerResolvedPatterns) {
+			return true
+		}
+	}
+	return false
+}
+
+func blockerSection(current, carried []blocker) string {
+	if len(current) == 0 && len(carried) == 0 {
+		return ""
+	}
+
+	line := func(b blocker) string {
+		owner := ""
+		if b.Owner != "" {
+			owner = " " + b.Owner + ":"
+		}
+		return fmt.Sprintf("#%s%s [%s](%s)", b.Channel, owner, excerpt(b.Text, 160), b.Link)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Risks and Blockers\n")
+	if len(current) > 0 {
+		sb.WriteString("\n**Raised this period**\n\n")
+		for _, b := range current {
+			state := ""
+			if b.Resolved {
+				state = " (resolved)"
+			}
+			sb.WriteString(fmt.Sprintf("- %s%s\n", line(b), state))
+		}
+	}
+	if len(carried) > 0 {
+		sb.WriteString("\n**Last week's blockers**\n\n")
+		for _, b := range carried {
+			state := "still open"
+			if b.Resolved {
+				state = "resolved"
+			}
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", state, line(b)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+package shinbun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// logoContentID is the Content-ID of an embedded logo file.
+const logoContentID = "logo@shinbun"
+
+var cssColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// branding customizes the HTML page around the digest.
+type branding struct {
+	// MastheadSrc is the edition's masthead image, "cid:..." in email only
+	MastheadSrc string
+	MastheadAlt string
+	// LogoSrc is the logo's img src: a URL, "cid:..." in email, or "" for none
+	LogoSrc      string
+	AccentColor  string
+	HeadingColor string
+	// Header and Footer are markdown blocks shown above and below the digest
+	Header string
+	Footer string
+}
+
+// headerHTML renders the masthead image, logo and header block, or "" when
+// none is set.
+func (b branding) headerHTML() string {
+	var header string
+	if b.MastheadSrc != "" {
+		header += fmt.Sprintf(`<div class="masthead"><img src="%s" alt="%s" width="%d" style="display: block; width: 100%%; max-width: %dpx; height: auto; margin: 0 auto 12px;"></div>`,
+			html.EscapeString(b.MastheadSrc), html.EscapeString(b.MastheadAlt), mastheadWidth, mastheadWidth) + "\n"
+	}
+	if b.LogoSrc != "" {
+		header += fmt.Sprintf(`<div class="logo"><img src="%s" alt="" style="max-height: 48px;"></div>`, html.EscapeString(b.LogoSrc)) + "\n"
+	}
+	if b.Header != "" {
+		header += `<div class="brand-header">` + markdownToHTML(b.Header) + "</div>\n"
+	}
+	return header
+}
+
+func (b branding) footerHTML() string {
+	if b.Footer == "" {
+		return ""
+	}
+	return `<div class="brand-footer">` + markdownToHTML(b.Footer) + "</div>\n"
+}
+
+// logoIsURL reports whether EMAIL_LOGO is a URL rather than a file to embed.
+func (c *Config) logoIsURL() bool {
+	return strings.HasPrefix(c.EmailLogo, "http://") || strings.HasPrefix(c.EmailLogo, "https://")
+}
+
+// editionMedia is what an edition's email carries besides its body and the
+// logo every email has. The zero value is for other emails, e.g. alerts.
+type editionMedia struct {
+	Masthead *editionMasthead
+	// Audio is the MP3 narration, attached to the first part of a split
+	// digest only
+	Audio []byte
+}
+
+// emailBranding is the branding for email; a logo file and the edition's
+// masthead image are referenced by Content-ID and attached by
+// buildEmailMessage.
+func (c *Config) emailBranding(media editionMedia) branding {
+	b := c.webBranding()
+	if c.EmailLogo != "" && !c.logoIsURL() {
+		b.LogoSrc = "cid:" + logoContentID
+	}
+	if media.Masthead != nil {
+		b.MastheadSrc = "cid:" + media.Masthead.Image.ContentID
+		b.MastheadAlt = media.Masthead.Alt
+	}
+	return b
+}
+
+// webBranding is the branding for archive pages, which can only show logos
+// given as URLs.
+func (c *Config) webBranding() branding {
+	b := branding{
+		AccentColor:  c.EmailAccentColor,
+		HeadingColor: c.EmailHeadingColor,
+		Header:       c.EmailHeaderText,
+		Footer:       c.EmailFooterText,
+	}
+	if c.logoIsURL() {
+		b.LogoSrc = c.EmailLogo
+	}
+	return b
+}
+
+// inlineImage is an image embedded in an email and referenced by Content-ID.
+type inlineImage struct {
+	ContentID   string
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// readLogo loads the EMAIL_LOGO file to embed.
+func readLogo(logoPath string) (inlineImage, error) {
+	logo, err := os.ReadFile(logoPath)
+	if err != nil {
+		return inlineImage{}, fmt.Errorf("error reading EMAIL_LOGO: %v", err)
+	}
+	logoType := mime.TypeByExtension(filepath.Ext(logoPath))
+	if logoType == "" {
+		logoType = "application/octet-stream"
+	}
+	return inlineImage{ContentID: logoContentID, ContentType: logoType, Filename: filepath.Base(logoPath), Data: logo}, nil
+}
+
+// attachInline wraps the HTML page in a multipart/related body with the
+// images attached inline. It returns the Content-Type header and the body.
+func attachInline(page string, images []inlineImage) (string, []byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	htmlPart, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	if err != nil {
+		return "", nil, err
+	}
+	htmlPart.Write([]byte(page))
+
+	for _, image := range images {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {image.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + image.ContentID + ">"},
+			"Content-Disposition":       {"inline; filename=" + image.Filename},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		part.Write([]byte(wrapBase64(image.Data)))
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return `multipart/related; type="text/html"; boundary=` + w.Boundary(), body.Bytes(), nil
+}
+
+// wrapBase64 encodes data as base64 in 76-character lines, as MIME requires.
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded + "\r\n")
+	return sb.String()
+}
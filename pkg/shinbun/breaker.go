@@ -0,0 +1,126 @@
+package shinbun
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// circuitBreaker stops calling a dependency after threshold consecutive
+// failures. Once cooldown has passed a single probe request is let through;
+// its outcome closes the circuit again or restarts the cooldown.
+type circuitBreaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+	logger    *zap.Logger
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration, logger *zap.Logger) *circuitBreaker {
+	return &circuitBreaker{Name: name, Threshold: threshold, Cooldown: cooldown, logger: logger}
+}
+
+// allow reports whether a request may be sent now.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.Threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.Threshold {
+		b.logger.Info("Circuit closed", zap.String("dependency", b.Name))
+	}
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= b.Threshold {
+		b.openUntil = time.Now().Add(b.Cooldown)
+		b.logger.Warn("Circuit open, failing fast",
+			zap.String("dependency", b.Name),
+			zap.Int("consecutive_failures", b.failures),
+			zap.Duration("cooldown", b.Cooldown))
+	}
+}
+
+// breakerTransport guards each host behind its own circuit breaker. Transport
+// errors and 5xx responses count as failures; anything else, including rate
+// limiting, counts as the dependency being up.
+type breakerTransport struct {
+	base      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// withCircuitBreakers wraps the client's transport with per-host circuit
+// breakers. A threshold of 0 leaves the client unchanged.
+func withCircuitBreakers(client *http.Client, threshold int, cooldown time.Duration, logger *zap.Logger) *http.Client {
+	if threshold <= 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &breakerTransport{
+		base:      base,
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+		breakers:  make(map[string]*circuitBreaker),
+	}
+	return &wrapped
+}
+
+func (t *breakerTransport) breaker(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = newCircuitBreaker(host, t.threshold, t.cooldown, t.logger)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	if !b.allow() {
+		return nil, fmt.Errorf("circuit open for %s after repeated failures", req.URL.Host)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 500 {
+		b.failure()
+	} else {
+		b.success()
+	}
+	return resp, err
+}
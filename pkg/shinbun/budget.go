@@ -0,0 +1,272 @@
+package shinbun
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// perUpdateOverheadTokens approximates the Channel/Time/Link lines written
+// around each message in the prompt.
+const perUpdateOverheadTokens = 40
+
+// defaultPromptTokenBudget caps messages sent to a model whose context window
+// isn't known.
+const defaultPromptTokenBudget = 60000
+
+func updateTokens(model string, update Update) int {
+	tokens := countTokens(model, update.Text) + countTokens(model, update.Link) + attachmentTokens(model, update) + perUpdateOverheadTokens
+	for _, link := range update.RelatedLinks {
+		tokens += countTokens(model, link)
+	}
+	return tokens
+}
+
+// promptBudget is the token budget for messages in the summary prompt: what
+// the model's context window leaves after the instructions, the background,
+// the channel instructions and the digest itself, capped at PROMPT_TOKEN_BUDGET when that is set. A
+// budget of 0 means no cap.
+func promptBudget(config *Config, background promptContext) int {
+	window, known := contextWindowFor(config.OpenAIModel)
+	fits := window - summaryPromptOverheadTokens - summaryOutputTokens -
+		countTokens(config.OpenAIModel, background.Calendar) - countTokens(config.OpenAIModel, background.Channels)
+	// A channel's instruction is repeated in the High Priority section
+	for _, instruction := range background.Instructions {
+		fits -= 2 * countTokens(config.OpenAIModel, instruction)
+	}
+	// Even when nothing fits, a cap of 0 would lift the cap
+	fits = max(fits, 1)
+	budget := config.PromptTokenBudget
+	switch {
+	case !known && budget < 0:
+		return defaultPromptTokenBudget
+	case !known:
+		return budget
+	case budget <= 0 || fits < budget:
+		return fits
+	}
+	return budget
+}
+
+// parseWeights parses "name=weight" lists such as "slack=70,github=20,other=10".
+// Names are lowercased; a trailing "%" on a weight is ignored.
+func parseWeights(value string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, entry := range splitList(value) {
+		name, weight, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected name=weight", entry)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(weight), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight in %q", entry)
+		}
+		weights[strings.ToLower(strings.TrimSpace(name))] = w
+	}
+	return weights, nil
+}
+
+// selectionDecision records whether an update made it into the prompt and why.
+type selectionDecision struct {
+	Update   Update
+	Included bool
+	Reason   string
+}
+
+// selectionReport explains which updates the prompt budget kept and dropped.
+type selectionReport struct {
+	Budget    int
+	Used      int
+	Decisions []selectionDecision
+	// Now is the time of the run, which update ages are measured from
+	Now time.Time
+}
+
+// selectWithinBudget keeps the highest-scoring updates that fit in the prompt
+// token budget, counting tokens as model does. With source shares configured,
+// each source first gets its share of the budget; capacity a source doesn't
+// use is then handed out by score across all sources. Sources without an
+// entry use the "other" share, which defaults to whatever the listed shares
+// leave of 100.
+func selectWithinBudget(updates []Update, totalBudget int, model string, shares map[string]float64, now time.Time, logger *zap.Logger) ([]Update, selectionReport) {
+	report := selectionReport{Budget: totalBudget, Now: now}
+	if totalBudget <= 0 {
+		for _, u := range updates {
+			report.Decisions = append(report.Decisions, selectionDecision{Update: u, Included: true, Reason: "no prompt budget cap"})
+		}
+		return updates, report
+	}
+
+	ordered := make([]Update, len(updates))
+	copy(ordered, updates)
+	sortByScore(ordered)
+
+	selected := make([]bool, len(ordered))
+	reasons := make([]string, len(ordered))
+	used := 0
+
+	if len(shares) > 0 {
+		otherShare, ok := shares["other"]
+		if !ok {
+			listed := 0.0
+			for _, source := range sortedKeys(shares) {
+				listed += shares[source]
+			}
+			otherShare = 100 - listed
+			if otherShare < 0 {
+				otherShare = 0
+			}
+		}
+		weightOf := func(source string) float64 {
+			if w, ok := shares[source]; ok {
+				return w
+			}
+			return otherShare
+		}
+
+		// Sources sharing the "other" bucket split it evenly
+		present := make(map[string]bool)
+		unlisted := 0
+		for _, u := range ordered {
+			source := sourceLabel(u)
+			if !present[source] {
+				present[source] = true
+				if _, ok := shares[source]; !ok {
+					unlisted++
+				}
+			}
+		}
+		totalWeight := 0.0
+		for _, source := range sortedKeys(present) {
+			if _, ok := shares[source]; ok {
+				totalWeight += weightOf(source)
+			}
+		}
+		if unlisted > 0 {
+			totalWeight += otherShare
+		}
+
+		if totalWeight > 0 {
+			sourceUsed := make(map[string]int)
+			for i, u := range ordered {
+				source := sourceLabel(u)
+				weight := weightOf(source)
+				if _, ok := shares[source]; !ok {
+					weight /= float64(unlisted)
+				}
+				allowance := int(float64(totalBudget) * weight / totalWeight)
+				tokens := updateTokens(model, u)
+				if sourceUsed[source]+tokens <= allowance {
+					selected[i] = true
+					reasons[i] = fmt.Sprintf("within %s share (%d tokens)", source, allowance)
+					sourceUsed[source] += tokens
+					used += tokens
+				} else {
+					reasons[i] = fmt.Sprintf("%s share of %d tokens used up", source, allowance)
+				}
+			}
+		}
+	}
+
+	// Fill any remaining budget by score regardless of source
+	for i, u := range ordered {
+		if selected[i] {
+			continue
+		}
+		tokens := updateTokens(model, u)
+		if used+tokens <= totalBudget {
+			selected[i] = true
+			reasons[i] = "fit in remaining budget"
+			used += tokens
+			continue
+		}
+		reason := fmt.Sprintf("prompt budget of %d tokens used up by higher-scoring messages", totalBudget)
+		if reasons[i] != "" {
+			reason = reasons[i] + "; " + reason
+		}
+		reasons[i] = reason
+	}
+
+	report.Used = used
+	var kept []Update
+	for i, u := range ordered {
+		if selected[i] {
+			kept = append(kept, u)
+		}
+		report.Decisions = append(report.Decisions, selectionDecision{Update: u, Included: selected[i], Reason: reasons[i]})
+	}
+
+	report.log(logger)
+	return kept, report
+}
+
+// excluded returns the decisions for updates that were dropped.
+func (r selectionReport) excluded() []selectionDecision {
+	var dropped []selectionDecision
+	for _, d := range r.Decisions {
+		if !d.Included {
+			dropped = append(dropped, d)
+		}
+	}
+	return dropped
+}
+
+// log writes a summary and one line per dropped update; kept updates are
+// logged at debug level.
+func (r selectionReport) log(logger *zap.Logger) {
+	dropped := r.excluded()
+	logger.Info("Message selection",
+		zap.Int("token_budget", r.Budget),
+		zap.Int("estimated_tokens", r.Used),
+		zap.Int("included", len(r.Decisions)-len(dropped)),
+		zap.Int("excluded", len(dropped)))
+
+	now := r.Now
+	for _, d := range r.Decisions {
+		fields := []zap.Field{
+			zap.String("source", sourceLabel(d.Update)),
+			zap.String("channel", d.Update.Channel),
+			zap.String("link", d.Update.Link),
+			zap.Float64("score", d.Update.Score),
+			zap.Duration("age", updateAge(d.Update, now)),
+			zap.String("reason", d.Reason),
+		}
+		if d.Included {
+			logger.Debug("Included message", fields...)
+		} else {
+			logger.Info("Excluded message", fields...)
+		}
+	}
+}
+
+// markdownAppendix renders the excluded updates as a digest appendix, or ""
+// when nothing was dropped.
+func (r selectionReport) markdownAppendix() string {
+	dropped := r.excluded()
+	if len(dropped) == 0 {
+		return ""
+	}
+
+	now := r.Now
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Message selection report\n\n")
+	sb.WriteString(fmt.Sprintf("%d of %d messages fit the prompt budget of %d tokens. These were left out of the summary:\n\n",
+		len(r.Decisions)-len(dropped), len(r.Decisions), r.Budget))
+	for _, d := range dropped {
+		sb.WriteString(fmt.Sprintf("- [%s %s](%s) — score %.2f, %s old: %s\n",
+			sourceLabel(d.Update), d.Update.Channel, d.Update.Link, d.Update.Score,
+			updateAge(d.Update, now).Round(time.Hour), d.Reason))
+	}
+	return sb.String()
+}
+
+func updateAge(update Update, now time.Time) time.Duration {
+	t, err := formatTimestamp(update.Timestamp)
+	if err != nil {
+		return 0
+	}
+	return now.Sub(t)
+}
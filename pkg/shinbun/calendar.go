@@ -0,0 +1,66 @@
+package shinbun
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/gcal"
+)
+
+// fetchCalendarContext returns the shared calendar's events for the window,
+// formatted as prompt context. It returns "" when no calendar is configured or
+// the calendar can't be read, since the digest is still useful without it.
+func fetchCalendarContext(config *Config, since time.Time, logger *zap.Logger) string {
+	if config.GoogleCalendarID == "" || config.GoogleCredentialsFile == "" {
+		return ""
+	}
+
+	client, err := gcal.NewClient(config.GoogleCalendarID, config.GoogleCredentialsFile)
+	if err != nil {
+		logger.Error("Failed to create Google Calendar client", zap.Error(err))
+		return ""
+	}
+
+	events, err := client.FetchEvents(since, config.Clock.Now(), logger)
+	if err != nil {
+		logger.Error("Failed to fetch calendar events", zap.Error(err))
+		return ""
+	}
+
+	return formatCalendarEvents(events)
+}
+
+func formatCalendarEvents(events []gcal.Event) string {
+	if len(events) == 0 {
+		return ""
+	}
+
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		jst = time.FixedZone("JST", 9*60*60)
+	}
+
+	var sb strings.Builder
+	for _, event := range events {
+		var when string
+		if event.AllDay {
+			when = event.Start.Format("2006-01-02") + " (all day)"
+		} else {
+			start, end := event.Start.In(jst), event.End.In(jst)
+			endLayout := "15:04 JST"
+			if start.YearDay() != end.YearDay() || start.Year() != end.Year() {
+				endLayout = "2006-01-02 15:04 JST"
+			}
+			when = fmt.Sprintf("%s to %s", start.Format("2006-01-02 15:04"), end.Format(endLayout))
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s", when, event.Summary))
+		if event.Location != "" {
+			sb.WriteString(fmt.Sprintf(" (%s)", event.Location))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
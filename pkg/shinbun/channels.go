@@ -0,0 +1,267 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// channelReport is the outcome of reconciling stored channels with Slack.
+type channelReport struct {
+	// Renamed maps old names to new ones
+	Renamed    map[string]string
+	Archived   []string
+	Unarchived []string
+	// Unresolved are configured channel names that match no open Slack channel
+	Unresolved []string
+}
+
+// listAllConversations returns every public and private channel the bot can
+// see, archived ones included.
+func listAllConversations(api *slack.Client) ([]slack.Channel, error) {
+	params := &slack.GetConversationsParameters{
+		Limit: 1000,
+		Types: []string{"public_channel", "private_channel"},
+	}
+
+	var all []slack.Channel
+	for {
+		channels, nextCursor, err := api.GetConversations(params)
+		if err != nil {
+			return nil, fmt.Errorf("error getting conversations: %v", err)
+		}
+		all = append(all, channels...)
+		if nextCursor == "" {
+			return all, nil
+		}
+		params.Cursor = nextCursor
+	}
+}
+
+// reconcileChannels brings stored channel names, archive state, topics and
+// purposes in line with Slack, so channels renamed in Slack are still found by
+// their new name, and reports configured names that no longer resolve.
+func reconcileChannels(api *slack.Client, db *sql.DB, configured []string, logger *zap.Logger) (channelReport, error) {
+	report := channelReport{Renamed: make(map[string]string)}
+
+	conversations, err := listAllConversations(api)
+	if err != nil {
+		return report, err
+	}
+	bySlackID := make(map[string]slack.Channel, len(conversations))
+	open := make(map[string]bool)
+	for _, c := range conversations {
+		bySlackID[c.ID] = c
+		if !c.IsArchived {
+			open[c.Name] = true
+		}
+	}
+
+	rows, err := db.Query(`SELECT id, slack_id, name, archived, COALESCE(topic, ''), COALESCE(purpose, '') FROM channels ORDER BY name`)
+	if err != nil {
+		return report, fmt.Errorf("error querying channels: %v", err)
+	}
+	type storedChannel struct {
+		id       int
+		slackID  string
+		name     string
+		archived bool
+		topic    string
+		purpose  string
+	}
+	var stored []storedChannel
+	for rows.Next() {
+		var c storedChannel
+		if err := rows.Scan(&c.id, &c.slackID, &c.name, &c.archived, &c.topic, &c.purpose); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("error scanning channel row: %v", err)
+		}
+		stored = append(stored, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating channel rows: %v", err)
+	}
+
+	for _, c := range stored {
+		current, ok := bySlackID[c.slackID]
+		if !ok {
+			// Deleted, or the bot was removed from a private channel
+			continue
+		}
+		if current.Name == c.name && current.IsArchived == c.archived &&
+			current.Topic.Value == c.topic && current.Purpose.Value == c.purpose {
+			continue
+		}
+
+		_, err := db.Exec(`
+			UPDATE channels SET name = $2, archived = $3, topic = NULLIF($4, ''), purpose = NULLIF($5, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`,
+			c.id, current.Name, current.IsArchived, current.Topic.Value, current.Purpose.Value)
+		if err != nil {
+			return report, fmt.Errorf("error updating channel %s: %v", c.name, err)
+		}
+		if current.Name != c.name {
+			report.Renamed[c.name] = current.Name
+			logger.Info("Channel renamed in Slack", zap.String("old_name", c.name), zap.String("new_name", current.Name))
+			if err := forgetPermalinks(db, c.slackID); err != nil {
+				logger.Warn("Failed to clear the renamed channel's permalinks", zap.String("channel", current.Name), zap.Error(err))
+			}
+		}
+		if current.IsArchived && !c.archived {
+			report.Archived = append(report.Archived, current.Name)
+			logger.Info("Channel archived in Slack", zap.String("channel", current.Name))
+		}
+		if !current.IsArchived && c.archived {
+			report.Unarchived = append(report.Unarchived, current.Name)
+		}
+	}
+
+	for _, name := range configured {
+		name = strings.TrimSpace(name)
+		if name != "" && !open[name] {
+			report.Unresolved = append(report.Unresolved, name)
+			logger.Warn("Configured channel not found in Slack (renamed, archived or bot not invited)",
+				zap.String("channel", name))
+		}
+	}
+	return report, nil
+}
+
+func runChannelsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New("usage: shinbun channels list [--json] | channels sync")
+	if len(args) == 0 {
+		return usage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("channels list", flag.ContinueOnError)
+		jsonOutput := fs.Bool("json", false, "Write the channels as JSON events, one per line")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		api, err := newSlackClient(config, logger)
+		if err != nil {
+			return err
+		}
+		return listChannels(api, cliOutput{JSON: *jsonOutput}, logger)
+	case "sync":
+		if len(args) != 1 {
+			return usage
+		}
+		return syncChannels(config, logger)
+	}
+	return usage
+}
+
+// syncChannels reconciles the configured channels with Slack and prints what
+// changed.
+func syncChannels(config *Config, logger *zap.Logger) error {
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		return err
+	}
+
+	report, err := reconcileChannels(api, db, config.configuredChannels(), logger)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range sortedKeys(report.Renamed) {
+		fmt.Printf("renamed     %s -> %s\n", old, report.Renamed[old])
+	}
+	for _, name := range report.Archived {
+		fmt.Printf("archived    %s\n", name)
+	}
+	for _, name := range report.Unarchived {
+		fmt.Printf("unarchived  %s\n", name)
+	}
+	for _, name := range report.Unresolved {
+		fmt.Printf("unresolved  %s (update DEFAULT_FOCUS_CHANNELS / SUPPORT_FOCUS_CHANNELS)\n", name)
+	}
+	if len(report.Renamed)+len(report.Archived)+len(report.Unarchived)+len(report.Unresolved) == 0 {
+		fmt.Println("Channels are in sync with Slack")
+	}
+	return nil
+}
+
+// fetchChannelContext describes the given channels for the prompt, one line
+// each from the stored purpose and topic. Channels with neither are left out.
+func fetchChannelContext(db *sql.DB, names []string, logger *zap.Logger) string {
+	var sb strings.Builder
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var topic, purpose string
+		err := db.QueryRow(`SELECT COALESCE(topic, ''), COALESCE(purpose, '') FROM channels WHERE name = $1`, name).Scan(&topic, &purpose)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logger.Warn("Failed to load channel description", zap.String("channel", name), zap.Error(err))
+			}
+			continue
+		}
+		description := describeChannel(topic, purpose)
+		if description != "" {
+			sb.WriteString(fmt.Sprintf("- #%s: %s\n", name, description))
+		}
+	}
+	return sb.String()
+}
+
+func describeChannel(topic, purpose string) string {
+	topic = strings.Join(strings.Fields(topic), " ")
+	purpose = strings.Join(strings.Fields(purpose), " ")
+	switch {
+	case purpose != "" && topic != "" && topic != purpose:
+		return fmt.Sprintf("%s (topic: %s)", purpose, topic)
+	case purpose != "":
+		return purpose
+	default:
+		return topic
+	}
+}
+
+// channelInstructionKey is how a channel's instruction is keyed: the
+// CHANNEL_INSTRUCTION_<CHANNEL> suffix, lowercase, with the characters
+// environment variable names can't hold as underscores.
+func channelInstructionKey(channel string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '/' {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#")))
+}
+
+// withInstructions returns a copy of instructions with overrides applied, keyed
+// by channelInstructionKey.
+func withInstructions(instructions, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return instructions
+	}
+	merged := make(map[string]string, len(instructions)+len(overrides))
+	for key, instruction := range instructions {
+		merged[key] = instruction
+	}
+	for channel, instruction := range overrides {
+		merged[channelInstructionKey(channel)] = strings.TrimSpace(instruction)
+	}
+	return merged
+}
@@ -0,0 +1,62 @@
+package shinbun
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock is the run's source of the current time. Fetch windows, the prompt's
+// current time and the digest date all come from it, so a run can be moved
+// into the past with --as-of.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// offsetClock runs at normal speed from a point in the past.
+type offsetClock struct {
+	offset time.Duration
+}
+
+func newAsOfClock(asOf time.Time) offsetClock {
+	return offsetClock{offset: time.Until(asOf)}
+}
+
+func (c offsetClock) Now() time.Time { return time.Now().Add(c.offset) }
+
+// fixedClock is stopped at one time, e.g. the date of a digest whose delivery
+// is retried.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// parseAsOf parses an --as-of value: a date (YYYY-MM-DD, the start of that
+// day in local time) or an RFC 3339 timestamp.
+func parseAsOf(value string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, fmt.Errorf("invalid --as-of %q: use YYYY-MM-DD or an RFC 3339 timestamp", value)
+		}
+	}
+	if t.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("--as-of %s is in the future", value)
+	}
+	return t, nil
+}
+
+// updatesBefore drops updates posted after until, which sources that can't
+// bound their fetch window return in backdated runs.
+func updatesBefore(updates []Update, until time.Time) []Update {
+	var kept []Update
+	for _, u := range updates {
+		if t, err := formatTimestamp(u.Timestamp); err == nil && t.After(until) {
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept
+}
@@ -0,0 +1,92 @@
+package shinbun
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/commontypes"
+)
+
+func TestResolveWindowFromClock(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	config := &Config{Clock: fixedClock(now)}
+
+	from, until, err := resolveWindow(config, "7d", "", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-7 * 24 * time.Hour); !from.Equal(want) {
+		t.Errorf("from = %v, want %v", from, want)
+	}
+	if !until.IsZero() {
+		t.Errorf("until = %v, want zero without --as-of", until)
+	}
+	if got := config.Clock.Now(); !got.Equal(now) {
+		t.Errorf("clock moved to %v without --as-of", got)
+	}
+}
+
+func TestResolveWindowAsOf(t *testing.T) {
+	asOf := time.Date(2024, 11, 4, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		fromDate string
+		wantFrom time.Time
+	}{
+		{"week before as-of by default", "", asOf.AddDate(0, 0, -7)},
+		{"duration counts back from as-of", "2d", asOf.Add(-48 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Clock: fixedClock(time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC))}
+			from, until, err := resolveWindow(config, tt.fromDate, asOf.Format(time.RFC3339), zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !until.Equal(asOf) {
+				t.Errorf("until = %v, want %v", until, asOf)
+			}
+			// The as-of clock keeps running, so allow for the test's own time
+			if d := from.Sub(tt.wantFrom); d < 0 || d > time.Minute {
+				t.Errorf("from = %v, want %v", from, tt.wantFrom)
+			}
+			if d := config.Clock.Now().Sub(asOf); d < 0 || d > time.Minute {
+				t.Errorf("clock at %v, want %v", config.Clock.Now(), asOf)
+			}
+		})
+	}
+}
+
+func TestResolveWindowRejectsFutureAsOf(t *testing.T) {
+	config := &Config{Clock: systemClock{}}
+	future := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	if _, _, err := resolveWindow(config, "", future, zap.NewNop()); err == nil {
+		t.Error("want an error for an --as-of time in the future")
+	}
+}
+
+func TestUpdatesBefore(t *testing.T) {
+	until := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	updates := []Update{
+		{Text: "before", Timestamp: commontypes.TimestampFromTime(until.Add(-time.Hour))},
+		{Text: "at", Timestamp: commontypes.TimestampFromTime(until)},
+		{Text: "after", Timestamp: commontypes.TimestampFromTime(until.Add(time.Minute))},
+		{Text: "unparsable", Timestamp: "not a timestamp"},
+	}
+	var got []string
+	for _, u := range updatesBefore(updates, until) {
+		got = append(got, u.Text)
+	}
+	want := []string{"before", "at", "unparsable"}
+	if len(got) != len(want) {
+		t.Fatalf("kept %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("kept %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package shinbun
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// codeFencePattern matches a fenced code block as Slack sends it: the fence
+// may open mid-line and close on the same or a later line.
+var codeFencePattern = regexp.MustCompile("(?s)```(.*?)```")
+
+// formatMessage cleans a message for the prompt. Emphasis and bullets are
+// stripped from the prose, while code spans are kept and code blocks are put
+// on fenced lines of their own, so snippets and stack traces stay readable.
+func formatMessage(text string) string {
+	blocks := codeFencePattern.FindAllStringSubmatchIndex(text, -1)
+	if len(blocks) == 0 {
+		return formatProse(text)
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range blocks {
+		sb.WriteString(strings.TrimRight(formatProse(text[last:m[0]]), " \n"))
+		sb.WriteString("\n```\n" + strings.Trim(text[m[2]:m[3]], "\n") + "\n```\n")
+		last = m[1]
+	}
+	sb.WriteString(strings.TrimLeft(formatProse(text[last:]), " \n"))
+	return strings.TrimSpace(sb.String())
+}
+
+// formatProse strips markup outside code spans and squeezes blank lines.
+func formatProse(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range markdownCodeSpan.FindAllStringIndex(text, -1) {
+		sb.WriteString(stripMarkup(text[last:m[0]]))
+		sb.WriteString(text[m[0]:m[1]])
+		last = m[1]
+	}
+	sb.WriteString(stripMarkup(text[last:]))
+	text = sb.String()
+
+	text = strings.ReplaceAll(text, "\n\n\n", "\n")
+	text = strings.ReplaceAll(text, "\n\n", "\n")
+	return text
+}
+
+func stripMarkup(text string) string {
+	text = strings.ReplaceAll(text, "*", "")
+	text = strings.ReplaceAll(text, "_", "")
+	text = strings.ReplaceAll(text, "`", "")
+	return strings.ReplaceAll(text, "•", "-")
+}
+
+// truncateCode shortens code blocks longer than maxChars at a line break,
+// saying how many lines were cut. maxChars 0 leaves them whole.
+func truncateCode(text string, maxChars int) string {
+	if maxChars <= 0 {
+		return text
+	}
+	return codeFencePattern.ReplaceAllStringFunc(text, func(block string) string {
+		code := strings.Trim(block[3:len(block)-3], "\n")
+		if len(code) <= maxChars {
+			return block
+		}
+		kept := code[:maxChars]
+		if i := strings.LastIndex(kept, "\n"); i > 0 {
+			kept = kept[:i]
+		} else {
+			kept = strings.ToValidUTF8(kept, "")
+		}
+		cut := strings.Count(code[len(kept):], "\n")
+		if !strings.HasPrefix(code[len(kept):], "\n") {
+			cut++
+		}
+		return fmt.Sprintf("```\n%s\n… (%d more lines)\n```", kept, cut)
+	})
+}
+
+// truncateCodeBlocks applies truncateCode to the text and translation of
+// each update.
+func truncateCodeBlocks(updates []Update, maxChars int) []Update {
+	if maxChars <= 0 {
+		return updates
+	}
+	for i := range updates {
+		updates[i].Text = truncateCode(updates[i].Text, maxChars)
+		updates[i].Translation = truncateCode(updates[i].Translation, maxChars)
+	}
+	return updates
+}
+
+// splitCode separates the first code block of text from the prose around it,
+// for digest templates.
+func splitCode(text string) (prose, code string) {
+	m := codeFencePattern.FindStringSubmatchIndex(text)
+	if m == nil {
+		return text, ""
+	}
+	prose = strings.TrimSpace(text[:m[0]] + " " + codeFencePattern.ReplaceAllString(text[m[1]:], " "))
+	return prose, strings.Trim(text[m[2]:m[3]], "\n")
+}
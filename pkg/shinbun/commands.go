@@ -0,0 +1,148 @@
+package shinbun
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// subcommands are dispatched on the first argument; without one, shinbun
+// generates a digest.
+var subcommands = map[string]func(args []string, logger *zap.Logger) error{
+	"channels":  runChannelsCommand,
+	"db":        runDBCommand,
+	"digests":   runDigestsCommand,
+	"email":     runEmailCommand,
+	"fetch":     runFetchCommand,
+	"incidents": runIncidentsCommand,
+	"jobs":      runJobsCommand,
+	"migrate":   runMigrateCommand,
+	"runs":      runRunsCommand,
+	"send":      runSendCommand,
+	"stats":     runStatsCommand,
+	"summarize": runSummarizeCommand,
+	"weights":   runWeightsCommand,
+}
+
+func runEmailCommand(args []string, logger *zap.Logger) error {
+	if len(args) == 0 || args[0] != "test" {
+		return errors.New("usage: shinbun email test [--to address] [--verbose]")
+	}
+
+	fs := flag.NewFlagSet("email test", flag.ContinueOnError)
+	to := fs.String("to", "", "Recipient of the test message (defaults to EMAIL_TO)")
+	verbose := fs.Bool("verbose", false, "Print the SMTP dialogue even when delivery succeeds")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if config.SMTPHost == "" || config.SMTPPort == "" {
+		return errors.New("SMTP_HOST and SMTP_PORT must be set")
+	}
+
+	addressing := emailAddressing{To: config.EmailTo, ReplyTo: config.EmailReplyTo}
+	if *to != "" {
+		addressing.To = splitList(*to)
+	}
+	if len(addressing.To) == 0 {
+		return errors.New("no recipient: pass --to or set EMAIL_TO")
+	}
+
+	subject := "Shinbun test message"
+	body := fmt.Sprintf("# Shinbun test message\n\nThis message was sent by `shinbun email test` at %s via %s:%s. If you can read it, email delivery works.\n",
+		time.Now().Format(time.RFC1123), config.SMTPHost, config.SMTPPort)
+	message, err := buildEmailMessage(config, addressing, subject, renderHTMLPage(body, config.emailBranding(editionMedia{})), editionMedia{})
+	if err != nil {
+		return err
+	}
+
+	var transcript bytes.Buffer
+	err = deliverSMTP(config, addressing.To, message, &transcript)
+	if err != nil || *verbose {
+		fmt.Println("SMTP dialogue:")
+		fmt.Print(transcript.String())
+	}
+	if err != nil {
+		return fmt.Errorf("test message not delivered: %v", err)
+	}
+
+	fmt.Printf("Test message sent to %s\n", strings.Join(addressing.To, ", "))
+	logger.Debug("Sent SMTP test message", zap.Strings("to", addressing.To))
+	return nil
+}
+
+// transcriptConn copies the plaintext SMTP dialogue to w as "C:" and "S:"
+// lines. After a successful STARTTLS reply the bytes are TLS records, so
+// logging stops; credentials in AUTH commands are redacted and the message
+// body is summarized.
+type transcriptConn struct {
+	net.Conn
+	mu         sync.Mutex
+	w          io.Writer
+	startedTLS bool
+	encrypted  bool
+	inData     bool
+}
+
+func newTranscriptConn(conn net.Conn, w io.Writer) *transcriptConn {
+	return &transcriptConn{Conn: conn, w: w}
+}
+
+func (c *transcriptConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > 0 && !c.encrypted {
+		c.log("S", string(p[:n]))
+		if c.startedTLS && strings.HasPrefix(string(p[:n]), "220") {
+			c.encrypted = true
+		}
+		if strings.HasPrefix(string(p[:n]), "354") {
+			c.inData = true
+		}
+	}
+	if err != nil && err != io.EOF && !c.encrypted {
+		fmt.Fprintf(c.w, "!! read error: %v\n", err)
+	}
+	return n, err
+}
+
+func (c *transcriptConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.inData {
+		if string(p) == ".\r\n" || strings.HasSuffix(string(p), "\r\n.\r\n") {
+			c.inData = false
+			c.log("C", ".")
+		}
+	} else if !c.encrypted {
+		text := string(p)
+		if strings.HasPrefix(strings.ToUpper(text), "AUTH ") {
+			fields := strings.Fields(text)
+			text = strings.Join(fields[:min(2, len(fields))], " ") + " <redacted>\r\n"
+		}
+		if strings.HasPrefix(strings.ToUpper(text), "STARTTLS") {
+			c.startedTLS = true
+		}
+		c.log("C", text)
+	}
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+func (c *transcriptConn) log(prefix, text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\r\n"), "\n") {
+		fmt.Fprintf(c.w, "%s: %s\n", prefix, strings.TrimRight(line, "\r"))
+	}
+}
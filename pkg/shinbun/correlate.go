@@ -0,0 +1,258 @@
+package shinbun
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// embeddingBatchSize bounds the number of inputs per embeddings request.
+	embeddingBatchSize = 100
+	// maxEmbeddingChars keeps each embedding input well inside the model limit.
+	maxEmbeddingChars = 2000
+	// minRelatedItemChars is the least each item of a merged entry keeps of
+	// its text when the entry is shortened to MESSAGE_MAX_CHARS.
+	minRelatedItemChars = 200
+)
+
+// ticketIDPattern matches ticket and incident identifiers such as INC-123 or PROJ-4567.
+var ticketIDPattern = regexp.MustCompile(`\b[A-Z][A-Z0-9]{1,9}-\d+\b`)
+
+// ignoredIDPrefixes are common tokens that look like ticket IDs but aren't.
+var ignoredIDPrefixes = map[string]bool{"UTF": true, "SHA": true, "ISO": true, "COVID": true, "TLS": true}
+
+// extractTicketIDs returns the distinct ticket-like IDs mentioned in text.
+func extractTicketIDs(text string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range ticketIDPattern.FindAllString(text, -1) {
+		prefix := id[:strings.Index(id, "-")]
+		if ignoredIDPrefixes[prefix] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// correlateUpdates merges updates from different sources that refer to the same
+// thing into a single entry carrying all links. Items are linked when they share
+// a ticket ID, or when their embeddings are at least minSimilarity apart (0 or
+// a nil embed disables the embedding pass). Merged entries are shortened to
+// about maxChars (0 leaves them whole). It does nothing unless several sources
+// are present.
+func correlateUpdates(embed embedFunc, updates []Update, minSimilarity float64, maxChars int, logger *zap.Logger) []Update {
+	sources := make(map[string]bool)
+	for _, u := range updates {
+		sources[sourceLabel(u)] = true
+	}
+	if len(sources) < 2 {
+		return updates
+	}
+
+	parent := make([]int, len(updates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(a, b int) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+
+	// 1. Shared ticket IDs, across sources: the first mention in each source
+	// is linked, so a busy channel's many mentions stay separate items
+	groupIDs := make(map[int][]string)
+	firstMention := make(map[string]int)
+	sourceMentions := make(map[string]map[string]bool)
+	for i, u := range updates {
+		source := sourceLabel(u)
+		for _, id := range extractTicketIDs(u.Text) {
+			first, ok := firstMention[id]
+			if !ok {
+				firstMention[id] = i
+				sourceMentions[id] = map[string]bool{source: true}
+				continue
+			}
+			if sourceMentions[id][source] {
+				continue
+			}
+			sourceMentions[id][source] = true
+			union(first, i)
+		}
+	}
+
+	// 2. Embedding similarity across sources
+	if minSimilarity > 0 && embed != nil {
+		embeddings, err := embedUpdates(embed, updates)
+		if err != nil {
+			logger.Warn("Failed to embed updates, correlating by ticket ID only", zap.Error(err))
+		} else {
+			for i := range updates {
+				for j := i + 1; j < len(updates); j++ {
+					if sourceLabel(updates[i]) == sourceLabel(updates[j]) {
+						continue
+					}
+					if cosineSimilarity(embeddings[i], embeddings[j]) >= minSimilarity {
+						union(i, j)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range updates {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+	for id, i := range firstMention {
+		root := find(i)
+		groupIDs[root] = append(groupIDs[root], id)
+	}
+
+	var correlated []Update
+	merged := 0
+	for _, root := range roots {
+		members := groups[root]
+		if len(members) == 1 {
+			correlated = append(correlated, updates[members[0]])
+			continue
+		}
+		ids := groupIDs[root]
+		sort.Strings(ids)
+		correlated = append(correlated, mergeUpdates(updates, members, ids, maxChars))
+		merged += len(members)
+	}
+
+	logger.Info("Correlated updates across sources",
+		zap.Int("input_updates", len(updates)),
+		zap.Int("merged_updates", merged),
+		zap.Int("output_updates", len(correlated)))
+	return correlated
+}
+
+// mergeUpdates combines the members of a correlation group. The highest-scoring
+// item (earliest on ties) supplies the category, source and primary link.
+// With maxChars, each item's text is excerpted to its share of it, and the
+// items that don't fit are only counted; their links are kept.
+func mergeUpdates(updates []Update, members []int, ids []string, maxChars int) Update {
+	sort.SliceStable(members, func(a, b int) bool {
+		ua, ub := updates[members[a]], updates[members[b]]
+		if ua.Score != ub.Score {
+			return ua.Score > ub.Score
+		}
+		if ua.Timestamp != ub.Timestamp {
+			return ua.Timestamp < ub.Timestamp
+		}
+		if ua.Channel != ub.Channel {
+			return ua.Channel < ub.Channel
+		}
+		return ua.Link < ub.Link
+	})
+
+	primary := updates[members[0]]
+	merged := primary
+
+	var sb strings.Builder
+	sb.WriteString("Related items")
+	if len(ids) > 0 {
+		sb.WriteString(fmt.Sprintf(" (%s)", strings.Join(ids, ", ")))
+	}
+	sb.WriteString(":")
+	length, omitted := utf8.RuneCountInString(sb.String()), 0
+	share := 0
+	if maxChars > 0 {
+		share = max((maxChars-length)/len(members), minRelatedItemChars)
+	}
+	for _, i := range members {
+		u := updates[i]
+		item := fmt.Sprintf("\n- [%s %s] ", sourceLabel(u), u.Channel)
+		if share > 0 {
+			// The excerpt's ellipsis counts towards the share too
+			item += excerpt(u.Text, max(share-utf8.RuneCountInString(item)-1, minRelatedItemChars))
+		} else {
+			item += u.Text
+		}
+		if maxChars > 0 && i != members[0] && length+utf8.RuneCountInString(item) > maxChars {
+			omitted++
+		} else {
+			sb.WriteString(item)
+			length += utf8.RuneCountInString(item)
+		}
+		if i != members[0] {
+			merged.RelatedLinks = append(merged.RelatedLinks, u.Link)
+		}
+		merged.RelatedLinks = append(merged.RelatedLinks, u.RelatedLinks...)
+		if u.Timestamp < merged.Timestamp {
+			merged.Timestamp = u.Timestamp
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "\n- and %d more related items", omitted)
+	}
+	merged.Text = sb.String()
+	return merged
+}
+
+func embedUpdates(embed embedFunc, updates []Update) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(updates))
+	for start := 0; start < len(updates); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(updates))
+		inputs := make([]string, 0, end-start)
+		for _, u := range updates[start:end] {
+			text := u.Text
+			if runes := []rune(text); len(runes) > maxEmbeddingChars {
+				text = string(runes[:maxEmbeddingChars])
+			}
+			if strings.TrimSpace(text) == "" {
+				text = u.Channel
+			}
+			inputs = append(inputs, text)
+		}
+
+		batch, err := embed(inputs)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != len(inputs) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(batch))
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,92 @@
+package shinbun
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+func TestCorrelateUpdatesByTicketID(t *testing.T) {
+	updates := []Update{
+		{Text: "INC-123 checkout is down", Channel: "incidents", Link: "slack/1", Timestamp: "1700000001.000000"},
+		{Text: "Still looking at INC-123", Channel: "incidents", Link: "slack/2", Timestamp: "1700000002.000000"},
+		{Text: "INC-123 mitigated", Channel: "support", Link: "slack/3", Timestamp: "1700000003.000000"},
+		{Text: "Checkout outage INC-123", Channel: "OPS", Source: "jira", Link: "jira/INC-123", Timestamp: "1700000004.000000"},
+		{Text: "Unrelated deploy", Channel: "deploys", Link: "slack/4", Timestamp: "1700000005.000000"},
+	}
+	correlated := correlateUpdates(nil, updates, 0, 0, zap.NewNop())
+	if len(correlated) != 4 {
+		t.Fatalf("got %d updates, want the first Slack mention merged with the Jira issue and 3 left alone", len(correlated))
+	}
+	merged := correlated[0]
+	if !strings.HasPrefix(merged.Text, "Related items (INC-123):") {
+		t.Fatalf("first update = %q, want the merged entry", merged.Text)
+	}
+	if merged.Link != "slack/1" || len(merged.RelatedLinks) != 1 || merged.RelatedLinks[0] != "jira/INC-123" {
+		t.Errorf("merged links = %s + %v, want slack/1 + [jira/INC-123]", merged.Link, merged.RelatedLinks)
+	}
+	for _, u := range correlated[1:] {
+		if strings.HasPrefix(u.Text, "Related items") {
+			t.Errorf("%s merged with its own source's mentions", u.Link)
+		}
+	}
+}
+
+func TestCorrelateUpdatesSingleSource(t *testing.T) {
+	updates := []Update{
+		{Text: "INC-9 started", Link: "slack/1"},
+		{Text: "INC-9 resolved", Link: "slack/2"},
+	}
+	if got := correlateUpdates(nil, updates, 0, 0, zap.NewNop()); len(got) != 2 {
+		t.Errorf("got %d updates from one source, want both untouched", len(got))
+	}
+}
+
+func TestMergeUpdates(t *testing.T) {
+	long := strings.Repeat("word ", 1000)
+	updates := []Update{
+		{Text: "low " + long, Channel: "incidents", Link: "slack/1", Score: 1, Timestamp: "1700000001.000000"},
+		{Text: "high " + long, Channel: "OPS", Source: "jira", Link: "jira/1", Score: 3, Timestamp: "1700000002.000000", Category: "alert"},
+		{Text: "mid " + long, Channel: "status", Source: "statuspage", Link: "status/1", Score: 2, Timestamp: "1700000003.000000"},
+	}
+
+	whole := mergeUpdates(updates, []int{0, 1, 2}, []string{"INC-1"}, 0)
+	if whole.Link != "jira/1" || whole.Category != "alert" {
+		t.Errorf("primary = %s (%s), want the highest scoring jira/1 (alert)", whole.Link, whole.Category)
+	}
+	if whole.Timestamp != "1700000001.000000" {
+		t.Errorf("timestamp = %s, want the earliest member's", whole.Timestamp)
+	}
+	if want := []string{"status/1", "slack/1"}; strings.Join(whole.RelatedLinks, " ") != strings.Join(want, " ") {
+		t.Errorf("related links = %v, want %v in score order", whole.RelatedLinks, want)
+	}
+	if !strings.Contains(whole.Text, long) {
+		t.Errorf("merged text shortened without a limit")
+	}
+
+	capped := mergeUpdates(updates, []int{0, 1, 2}, []string{"INC-1"}, 1200)
+	if n := utf8.RuneCountInString(capped.Text); n > 1200 {
+		t.Errorf("merged text is %d characters, want at most 1200", n)
+	}
+	for _, prefix := range []string{"- [jira OPS] high", "- [statuspage status] mid", "- [slack incidents] low"} {
+		if !strings.Contains(capped.Text, prefix) {
+			t.Errorf("capped text lacks %q", prefix)
+		}
+	}
+
+	many := make([]Update, 30)
+	members := make([]int, len(many))
+	for i := range many {
+		many[i] = Update{Text: long, Channel: "incidents", Link: "slack/" + string(rune('a'+i))}
+		members[i] = i
+	}
+	crowded := mergeUpdates(many, members, nil, 1000)
+	if n := utf8.RuneCountInString(crowded.Text); n > 1000+50 {
+		t.Errorf("merged text of 30 items is %d characters, want about 1000", n)
+	}
+	if !strings.Contains(crowded.Text, "more related items") || len(crowded.RelatedLinks) != 29 {
+		t.Errorf("items past the limit aren't counted, or lost their links (%d related links)", len(crowded.RelatedLinks))
+	}
+}
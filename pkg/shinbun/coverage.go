@@ -0,0 +1,123 @@
+package shinbun
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fetchFailureReasons explain common Slack API errors to readers, by the
+// error code in the message.
+var fetchFailureReasons = []struct{ code, reason string }{
+	{"not_in_channel", "the bot isn't a member"},
+	{"channel_not_found", "channel not found or not visible to the bot"},
+	{"not found", "channel not found or not visible to the bot"},
+	{"missing_scope", "the Slack app lacks a permission"},
+	{"access_denied", "access denied"},
+	{"is_archived", "channel is archived"},
+	{"rate limit", "Slack rate limit"},
+	{"ratelimited", "Slack rate limit"},
+	{"invalid_auth", "invalid Slack token"},
+	{"token_revoked", "invalid Slack token"},
+	{"timeout", "timed out"},
+	{"deadline exceeded", "timed out"},
+	{"circuit open", "Slack unavailable"},
+}
+
+// channelFetch is how a channel's fetch for a digest went: the number of new
+// messages it brought in, or the error it failed with.
+type channelFetch struct {
+	Channel  string `json:"channel"`
+	Messages int    `json:"messages"`
+	Error    string `json:"error,omitempty"`
+}
+
+// saveFetchStats keeps a fetch job's statistics in its payload, for the
+// summarize job.
+func saveFetchStats(db *sql.DB, jobID int, fetch channelFetch) error {
+	encoded, err := json.Marshal(fetch)
+	if err != nil {
+		return fmt.Errorf("error encoding fetch statistics: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE jobs SET payload = $2 WHERE id = $1`, jobID, string(encoded)); err != nil {
+		return fmt.Errorf("error saving fetch statistics: %v", err)
+	}
+	return nil
+}
+
+// loadFetchStats returns the statistics of the run's succeeded fetch jobs,
+// and the errors of its dead ones.
+func loadFetchStats(db *sql.DB, runID int) ([]channelFetch, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(channel, ''), status, COALESCE(payload, ''), COALESCE(last_error, '') FROM jobs
+		WHERE run_id = $1 AND stage = $2 AND status IN ('succeeded', 'dead')
+		ORDER BY id`, runID, stageFetch)
+	if err != nil {
+		return nil, fmt.Errorf("error querying fetch jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var fetches []channelFetch
+	for rows.Next() {
+		var channel, status, payload, lastErr string
+		if err := rows.Scan(&channel, &status, &payload, &lastErr); err != nil {
+			return nil, fmt.Errorf("error scanning fetch job: %v", err)
+		}
+		if status == "dead" {
+			fetches = append(fetches, channelFetch{Channel: channel, Error: lastErr})
+			continue
+		}
+		if payload == "" {
+			continue
+		}
+		var fetch channelFetch
+		if err := json.Unmarshal([]byte(payload), &fetch); err != nil {
+			return nil, fmt.Errorf("invalid fetch statistics %q: %v", payload, err)
+		}
+		fetches = append(fetches, fetch)
+	}
+	return fetches, rows.Err()
+}
+
+// quietChannels renders a line naming the channels fetched without new
+// messages, so readers can tell a quiet channel from a broken fetch. It
+// returns "" when every channel had news.
+func quietChannels(fetches []channelFetch) string {
+	var quiet []string
+	for _, f := range fetches {
+		if f.Error == "" && f.Messages == 0 {
+			quiet = append(quiet, "#"+strings.TrimPrefix(f.Channel, "#"))
+		}
+	}
+	if len(quiet) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n---\n\n*Quiet channels (no new messages): %s*\n", strings.Join(quiet, ", "))
+}
+
+// fetchFailureReason is a short explanation of a fetch error for readers.
+func fetchFailureReason(err string) string {
+	lower := strings.ToLower(err)
+	for _, r := range fetchFailureReasons {
+		if strings.Contains(lower, r.code) {
+			return r.reason
+		}
+	}
+	return excerpt(err, 80)
+}
+
+// coverageNote warns that the channels whose fetch failed are missing from
+// the digest, and why. It returns "" when every channel was fetched.
+func coverageNote(fetches []channelFetch) string {
+	var failed []string
+	for _, f := range fetches {
+		if f.Error != "" {
+			failed = append(failed, fmt.Sprintf("#%s (%s)", strings.TrimPrefix(f.Channel, "#"), fetchFailureReason(f.Error)))
+		}
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("> **Incomplete coverage.** These channels couldn't be fetched, so their news may be missing: %s.\n\n", strings.Join(failed, ", "))
+}
@@ -0,0 +1,213 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/migrate"
+	"shinbun/internal/store"
+)
+
+// schemaVersion is the version the embedded migrations bring a database to.
+var schemaVersion = int64(migrate.Latest())
+
+// expectedIndexes are the indexes the migrations create, with their definitions
+// so --repair can recreate them.
+var expectedIndexes = map[string]string{
+	"idx_messages_channel_timestamp": `CREATE INDEX IF NOT EXISTS idx_messages_channel_timestamp ON messages(channel_id, timestamp)`,
+	"idx_messages_slack_id":          `CREATE INDEX IF NOT EXISTS idx_messages_slack_id ON messages(slack_id)`,
+	"idx_runs_status":                `CREATE INDEX IF NOT EXISTS idx_runs_status ON runs(status, enqueued_at)`,
+	"idx_digests_search":             `CREATE INDEX IF NOT EXISTS idx_digests_search ON digests USING GIN (to_tsvector('english', content))`,
+	"idx_jobs_status":                `CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, run_after)`,
+	"idx_incidents_open":             `CREATE INDEX IF NOT EXISTS idx_incidents_open ON incidents(opened_at) WHERE resolved_at IS NULL`,
+	"idx_action_items_open":          `CREATE INDEX IF NOT EXISTS idx_action_items_open ON action_items(posted_at) WHERE done_at IS NULL`,
+	"idx_jobs_run_stage":             `CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_run_stage ON jobs(run_id, stage, COALESCE(channel, ''))`,
+	"idx_message_reactions_emoji":    `CREATE INDEX IF NOT EXISTS idx_message_reactions_emoji ON message_reactions(emoji)`,
+	"runs_focus_scheduled_at":        `CREATE UNIQUE INDEX IF NOT EXISTS runs_focus_scheduled_at ON runs (focus, scheduled_at)`,
+}
+
+// postgresOnlyIndexes aren't expected on SQLite, which searches digests
+// without an index.
+var postgresOnlyIndexes = map[string]bool{"idx_digests_search": true}
+
+// checkTables are the tables whose sizes are reported: every table the
+// migrations create.
+var checkTables = []string{
+	"channels", "messages", "message_reactions", "message_attachments", "permalinks",
+	"digests", "digest_posts", "digest_audio", "users", "learned_weights", "topic_subscriptions",
+	"blockers", "incidents", "incident_mentions", "action_items", "channel_notices",
+	"email_deliveries", "email_events", "runs", "jobs", "scheduler_lease",
+}
+
+// dbProblem is one finding of db check. Repair is nil when there is no safe
+// automatic fix.
+type dbProblem struct {
+	Description string
+	Repair      func(db *sql.DB) error
+}
+
+func runDBCommand(args []string, logger *zap.Logger) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: shinbun db check [--repair]")
+	}
+
+	fs := flag.NewFlagSet("db check", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "Apply safe fixes: recreate missing indexes, delete orphaned messages and duplicate slack_ids")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := printTableSizes(db); err != nil {
+		return err
+	}
+
+	problems, err := checkDatabase(db)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Println("\nNo problems found")
+		return nil
+	}
+
+	fmt.Println("\nProblems:")
+	unrepaired := 0
+	for _, p := range problems {
+		fmt.Printf("  - %s\n", p.Description)
+		if !*repair || p.Repair == nil {
+			unrepaired++
+			continue
+		}
+		if err := p.Repair(db); err != nil {
+			logger.Error("Repair failed", zap.String("problem", p.Description), zap.Error(err))
+			unrepaired++
+			continue
+		}
+		fmt.Println("    repaired")
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("%d problem(s) left", unrepaired)
+	}
+	return nil
+}
+
+// checkSchemaVersion compares the database's schema version with this
+// build's, returning nil when they match.
+func checkSchemaVersion(db *sql.DB) *dbProblem {
+	var version sql.NullInt64
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version)
+	migrateRepair := func(db *sql.DB) error {
+		_, err := migrate.Up(db, zap.NewNop())
+		return err
+	}
+	switch {
+	case err != nil:
+		return &dbProblem{Description: "schema_version table missing; run shinbun --migrate", Repair: migrateRepair}
+	case !version.Valid || version.Int64 < schemaVersion:
+		return &dbProblem{Description: fmt.Sprintf("schema version %d, expected %d; run shinbun --migrate", version.Int64, schemaVersion), Repair: migrateRepair}
+	case version.Int64 > schemaVersion:
+		return &dbProblem{Description: fmt.Sprintf("schema version %d is newer than this build (%d)", version.Int64, schemaVersion)}
+	}
+	return nil
+}
+
+// checkDatabase looks for problems without changing anything.
+func checkDatabase(db *sql.DB) ([]dbProblem, error) {
+	var problems []dbProblem
+	s := store.For(db)
+
+	if problem := checkSchemaVersion(db); problem != nil {
+		problems = append(problems, *problem)
+	}
+
+	for _, name := range sortedKeys(expectedIndexes) {
+		if postgresOnlyIndexes[name] && s.Driver() != store.Postgres {
+			continue
+		}
+		definition := expectedIndexes[name]
+		exists, err := s.IndexExists(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking index %s: %v", name, err)
+		}
+		if !exists {
+			problems = append(problems, dbProblem{
+				Description: fmt.Sprintf("index %s missing", name),
+				Repair: func(db *sql.DB) error {
+					_, err := db.Exec(definition)
+					return err
+				},
+			})
+		}
+	}
+
+	var orphaned int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM messages m LEFT JOIN channels c ON c.id = m.channel_id
+		WHERE c.id IS NULL`).Scan(&orphaned)
+	if err != nil {
+		return nil, fmt.Errorf("error counting orphaned messages: %v", err)
+	}
+	if orphaned > 0 {
+		problems = append(problems, dbProblem{
+			Description: fmt.Sprintf("%d message(s) belong to no channel", orphaned),
+			Repair: func(db *sql.DB) error {
+				_, err := db.Exec(`DELETE FROM messages WHERE NOT EXISTS (SELECT 1 FROM channels c WHERE c.id = messages.channel_id)`)
+				return err
+			},
+		})
+	}
+
+	var duplicates int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM (SELECT slack_id FROM messages GROUP BY slack_id HAVING COUNT(*) > 1) d`).Scan(&duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("error counting duplicate slack_ids: %v", err)
+	}
+	if duplicates > 0 {
+		problems = append(problems, dbProblem{
+			Description: fmt.Sprintf("%d slack_id(s) stored more than once", duplicates),
+			// Keep the first copy of each message
+			Repair: func(db *sql.DB) error {
+				_, err := db.Exec(`DELETE FROM messages WHERE id NOT IN (SELECT MIN(id) FROM messages GROUP BY slack_id)`)
+				return err
+			},
+		})
+	}
+
+	return problems, nil
+}
+
+func printTableSizes(db *sql.DB) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Table\tRows\tSize")
+	s := store.For(db)
+	for _, table := range checkTables {
+		var rows int64
+		if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table)).Scan(&rows); err != nil {
+			fmt.Fprintf(tw, "%s\t-\tmissing\n", table)
+			continue
+		}
+		size, err := s.TableSize(db, table)
+		if err != nil || size == "" {
+			size = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", table, rows, size)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,76 @@
+package shinbun
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// schemaNames returns the names of the tables or indexes a migrated SQLite
+// database has, leaving out SQLite's own and the migrations' bookkeeping.
+func schemaNames(t *testing.T, db *sql.DB, kind string) []string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT name FROM sqlite_master
+		WHERE type = $1 AND name NOT LIKE 'sqlite_%' AND name <> 'schema_version'
+		ORDER BY name`, kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestDBCheckCoversMigratedSchema(t *testing.T) {
+	db := openTestDB(t)
+
+	checked := make(map[string]bool)
+	for _, table := range checkTables {
+		checked[table] = true
+	}
+	for _, table := range schemaNames(t, db, "table") {
+		if !checked[table] {
+			t.Errorf("table %s is missing from checkTables", table)
+		}
+	}
+	for _, index := range schemaNames(t, db, "index") {
+		if _, ok := expectedIndexes[index]; !ok {
+			t.Errorf("index %s is missing from expectedIndexes", index)
+		}
+	}
+
+	problems, err := checkDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("freshly migrated database has a problem: %s", p.Description)
+	}
+}
+
+func TestDBCheckRepairsMissingIndex(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec(`DROP INDEX runs_focus_scheduled_at`); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := checkDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Description != "index runs_focus_scheduled_at missing" {
+		t.Fatalf("problems = %+v, want the missing index", problems)
+	}
+	if err := problems[0].Repair(db); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := checkDatabase(db); err != nil || len(problems) != 0 {
+		t.Errorf("after repair: problems %+v, err %v", problems, err)
+	}
+}
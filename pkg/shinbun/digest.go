@@ -0,0 +1,228 @@
+package shinbun
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// fallbackDigestLimit is the number of top-scoring messages listed in a
+// degraded digest.
+const fallbackDigestLimit = 30
+
+// defaultDigestTemplate renders the digest as markdown; DIGEST_TEMPLATE replaces it.
+const defaultDigestTemplate = `# Shinbun digest [{{.Focus}}] - {{.Date}}
+{{if .Note}}
+_{{.Note}}_
+{{end}}{{range .Sections}}
+## {{.Title}}
+
+{{range .Items}}- **{{.Source}} {{.Channel}}** ({{.Time}}, priority {{.Priority}}{{if .Status}}, {{.Status}}{{end}}): {{excerpt (or .Translation .Prose) 280}} [link]({{.Link}}){{range $i, $link := .RelatedLinks}} [related {{inc $i}}]({{$link}}){{end}}
+{{if .Code}}
+    ` + "```" + `
+{{indent 4 .Code}}
+    ` + "```" + `
+{{end}}{{end}}{{end}}`
+
+// digestData is what digest templates are executed with.
+type digestData struct {
+	Focus    string
+	Date     string
+	Note     string
+	Count    int
+	Sections []digestSection
+}
+
+type digestSection struct {
+	Title string
+	Items []digestItem
+}
+
+type digestItem struct {
+	Source      string
+	Channel     string
+	Category    string
+	Time        string
+	Text        string
+	Translation string
+	// Prose is Text without code blocks, and Code its first code block
+	Prose        string
+	Code         string
+	Link         string
+	RelatedLinks []string
+	Priority     int
+	Score        float64
+	Status       string
+}
+
+var digestFuncs = template.FuncMap{
+	"excerpt": excerpt,
+	"inc":     func(i int) int { return i + 1 },
+	"indent": func(n int, text string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+	},
+}
+
+// loadDigestTemplate parses the template file at path, or the default template
+// when path is empty.
+func loadDigestTemplate(path string) (*template.Template, error) {
+	text := defaultDigestTemplate
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading digest template: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("digest").Funcs(digestFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing digest template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// newDigestData groups updates into high priority (3 and above), alert,
+// support, general and documentation sections, each ordered by score. A
+// positive limit keeps only that many top-scoring updates.
+func newDigestData(updates []Update, focus string, date time.Time, note string, limit int) digestData {
+	ordered := make([]Update, len(updates))
+	copy(ordered, updates)
+	sortByScore(ordered)
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+
+	sections := []digestSection{
+		{Title: "Escalated"},
+		{Title: "High Priority"},
+		{Title: "Alerts"},
+		{Title: "Support"},
+		{Title: "General"},
+		{Title: "Documentation Updates"},
+		{Title: "Resolved"},
+	}
+	for _, u := range ordered {
+		section := 4
+		switch {
+		case u.Status == statusEscalated:
+			section = 0
+		case u.Status == statusResolved:
+			section = 6
+		case u.Priority >= 3:
+			section = 1
+		case u.Category == "alert":
+			section = 2
+		case u.Category == "support":
+			section = 3
+		case u.Category == "docs":
+			section = 5
+		}
+		sections[section].Items = append(sections[section].Items, newDigestItem(u))
+	}
+
+	data := digestData{
+		Focus: focus,
+		Date:  date.Format("2006-01-02"),
+		Note:  note,
+		Count: len(ordered),
+	}
+	for _, section := range sections {
+		if len(section.Items) > 0 {
+			data.Sections = append(data.Sections, section)
+		}
+	}
+	return data
+}
+
+func newDigestItem(u Update) digestItem {
+	when := "unknown time"
+	if t, err := formatTimestamp(u.Timestamp); err == nil {
+		when = t.Format("Jan 2 15:04")
+	}
+	prose, code := splitCode(u.Text)
+	return digestItem{
+		Source:       sourceLabel(u),
+		Channel:      u.Channel,
+		Category:     u.Category,
+		Time:         when,
+		Text:         u.Text,
+		Translation:  u.Translation,
+		Prose:        prose,
+		Code:         code,
+		Link:         u.Link,
+		RelatedLinks: u.RelatedLinks,
+		Priority:     u.Priority,
+		Score:        u.Score,
+		Status:       u.Status,
+	}
+}
+
+// renderDigest executes tmpl for the updates without involving the LLM.
+func renderDigest(tmpl *template.Template, updates []Update, focus string, date time.Time, note string, limit int) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, newDigestData(updates, focus, date, note, limit)); err != nil {
+		return "", fmt.Errorf("error rendering digest template: %v", err)
+	}
+	return sb.String(), nil
+}
+
+// renderFallbackDigest lists the top-priority updates with links for runs where
+// the LLM summary is unavailable. If the configured template fails, the
+// default one is used so something is always delivered.
+func renderFallbackDigest(tmpl *template.Template, updates []Update, focus string, date time.Time, reason string) string {
+	note := fmt.Sprintf("The AI summary was unavailable for this run (%s). These are the %d highest-priority messages, unsummarized.",
+		reason, min(len(updates), fallbackDigestLimit))
+	digest, err := renderDigest(tmpl, updates, focus, date, note, fallbackDigestLimit)
+	if err != nil {
+		defaultTmpl, _ := loadDigestTemplate("")
+		digest, _ = renderDigest(defaultTmpl, updates, focus, date, note, fallbackDigestLimit)
+	}
+	return digest
+}
+
+// excerpt collapses whitespace and shortens text to n runes.
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n]) + "…"
+	}
+	return text
+}
+
+// communityHighlights renders the most-reacted updates, whatever their
+// category, as a digest section. Only updates with at least minReactions
+// reactions are listed; it returns "" when none qualify or limit is 0.
+func communityHighlights(updates []Update, minReactions, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	var reacted []Update
+	for _, u := range updates {
+		if u.ReactionCount >= minReactions && u.ReactionCount > 0 {
+			reacted = append(reacted, u)
+		}
+	}
+	if len(reacted) == 0 {
+		return ""
+	}
+	sort.SliceStable(reacted, func(i, j int) bool {
+		if reacted[i].ReactionCount != reacted[j].ReactionCount {
+			return reacted[i].ReactionCount > reacted[j].ReactionCount
+		}
+		return newerFirst(reacted[i], reacted[j])
+	})
+	if len(reacted) > limit {
+		reacted = reacted[:limit]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Community Highlights\n\nThe most-reacted messages of the period:\n\n")
+	for _, u := range reacted {
+		sb.WriteString(fmt.Sprintf("- **%d reactions** · #%s: [%s](%s)\n", u.ReactionCount, u.Channel, excerpt(u.Text, 140), u.Link))
+	}
+	return sb.String()
+}
@@ -0,0 +1,408 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	discordFormatText   = "text"
+	discordFormatEmbeds = "embeds"
+	discordAPIBase      = "https://discord.com/api/v10"
+	// Discord's limits: characters per message, per embed title and
+	// description, and embeds and their characters per message
+	discordMessageChars     = 2000
+	discordEmbedTitleChars  = 256
+	discordEmbedChars       = 4096
+	discordEmbedsPerMessage = 10
+	discordEmbedTotalChars  = 6000
+	// discordSuppressEmbeds keeps every link of a text digest from unfurling
+	discordSuppressEmbeds = 1 << 2
+	// discordMaxAttempts bounds the posts of one message while rate limited
+	discordMaxAttempts = 3
+)
+
+// discordSettings post digests to a Discord channel (DISCORD_WEBHOOK_URL, or
+// DISCORD_DIGEST_CHANNEL with DISCORD_BOT_TOKEN, and DISCORD_DIGEST_FORMAT).
+type discordSettings struct {
+	WebhookURL string
+	ChannelID  string
+	// Format is "text" for plain messages or "embeds" for an embed per section
+	Format string
+}
+
+func (s discordSettings) enabled() bool {
+	return s.WebhookURL != "" || s.ChannelID != ""
+}
+
+func (s discordSettings) validate(botToken string) error {
+	switch s.Format {
+	case discordFormatText, discordFormatEmbeds:
+	default:
+		return fmt.Errorf("DISCORD_DIGEST_FORMAT must be %s or %s", discordFormatText, discordFormatEmbeds)
+	}
+	if s.WebhookURL != "" && s.ChannelID != "" {
+		return fmt.Errorf("set DISCORD_WEBHOOK_URL or DISCORD_DIGEST_CHANNEL, not both")
+	}
+	if s.ChannelID != "" && botToken == "" {
+		return fmt.Errorf("DISCORD_DIGEST_CHANNEL requires DISCORD_BOT_TOKEN")
+	}
+	return nil
+}
+
+// discordEmbed is a rich embed; only the fields digests use.
+type discordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+}
+
+// discordMessage is the body of a webhook execution or a bot's message.
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+	Flags   int            `json:"flags,omitempty"`
+	// AllowedMentions is left empty so "@everyone" in a digest pings nobody
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+// discordMarkdown adapts digest markdown to what Discord renders: headings of
+// the first three levels, bold, italics, lists, links and code. Deeper
+// headings become bold lines, rules are dropped, images become links and
+// __bold__, which Discord underlines, becomes **bold**.
+func discordMarkdown(md string) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			out = append(out, line)
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+		switch {
+		case markdownRulePattern.MatchString(line):
+			out = append(out, "")
+		case markdownHeadingPattern.MatchString(line):
+			marks := strings.TrimSpace(line)
+			level := len(marks) - len(strings.TrimLeft(marks, "#"))
+			text := discordInline(markdownHeadingPattern.FindStringSubmatch(line)[1])
+			if level <= 3 {
+				out = append(out, strings.Repeat("#", level)+" "+text)
+			} else {
+				out = append(out, "**"+text+"**")
+			}
+		default:
+			out = append(out, discordInline(line))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func discordInline(text string) string {
+	text = markdownImagePattern.ReplaceAllString(text, "[$1]($2)")
+	return strings.ReplaceAll(text, "__", "**")
+}
+
+// discordChunks splits text into pieces of at most limit characters at line
+// breaks, long lines at spaces. A code block cut in two is closed at the end
+// of one piece and reopened at the start of the next.
+func discordChunks(text string, limit int) []string {
+	const fence = "```"
+	var chunks []string
+	var lines []string
+	size := 0
+	inFence := false
+	flush := func() {
+		if inFence {
+			lines = append(lines, fence)
+		}
+		if chunk := strings.TrimSpace(strings.Join(lines, "\n")); chunk != "" && chunk != fence+"\n"+fence {
+			chunks = append(chunks, chunk)
+		}
+		lines, size = nil, 0
+		if inFence {
+			lines, size = []string{fence}, len(fence)
+		}
+	}
+	add := func(line string) {
+		n := utf8.RuneCountInString(line)
+		// Room is kept for closing a code block
+		if len(lines) > 0 && size+1+n > limit-len("\n"+fence) {
+			flush()
+		}
+		if len(lines) > 0 {
+			size++
+		}
+		lines = append(lines, line)
+		size += n
+	}
+	// A line always fits between a reopened and a closing fence
+	maxLine := limit - 2*len(fence+"\n")
+	for _, line := range strings.Split(text, "\n") {
+		for utf8.RuneCountInString(line) > maxLine {
+			cut := splitAtSpace(line, maxLine)
+			add(line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		add(line)
+		if strings.HasPrefix(strings.TrimSpace(line), fence) {
+			inFence = !inFence
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitAtSpace returns the byte offset to cut line at so the first part has
+// at most n characters, at the last space if there is one.
+func splitAtSpace(line string, n int) int {
+	offset := 0
+	for i := 0; i < n; i++ {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	if space := strings.LastIndex(line[:offset], " "); space > 0 {
+		return space
+	}
+	return offset
+}
+
+// truncateRunes cuts text to at most n characters, ending in "…" when cut.
+func truncateRunes(text string, n int) string {
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
+
+// buildDiscordText renders the digest as plain messages: the title as a
+// heading, a link to the archive when archiveURL is set, then the digest,
+// split into messages Discord accepts.
+func buildDiscordText(title, summary, archiveURL string) []discordMessage {
+	content := "# " + title + "\n"
+	if archiveURL != "" {
+		content += fmt.Sprintf("[View full digest](%s)\n", archiveURL)
+	}
+	content += "\n" + discordMarkdown(summary)
+
+	var messages []discordMessage
+	for _, chunk := range discordChunks(content, discordMessageChars) {
+		messages = append(messages, discordMessage{Content: chunk, Flags: discordSuppressEmbeds})
+	}
+	return messages
+}
+
+// buildDiscordEmbeds renders the digest as a series of embeds: one titled
+// with the digest title and linking to the archive, then one per top-level
+// section, titled with its heading. Long sections continue in further
+// embeds, and the embeds are spread over as many messages as Discord needs.
+func buildDiscordEmbeds(title, summary, archiveURL string, color int) []discordMessage {
+	type section struct {
+		title string
+		lines []string
+	}
+	sections := []section{{title: title}}
+	inFence := false
+	for _, line := range strings.Split(discordMarkdown(summary), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if !inFence && (strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "## ")) {
+			sections = append(sections, section{title: strings.TrimLeft(line, "# ")})
+			continue
+		}
+		if !inFence && strings.HasPrefix(line, "### ") {
+			// Embed descriptions don't render headings
+			line = "**" + strings.TrimPrefix(line, "### ") + "**"
+		}
+		last := &sections[len(sections)-1]
+		last.lines = append(last.lines, line)
+	}
+
+	var embeds []discordEmbed
+	for i, s := range sections {
+		chunks := discordChunks(strings.Join(s.lines, "\n"), discordEmbedChars)
+		if len(chunks) == 0 {
+			if i > 0 {
+				continue
+			}
+			chunks = []string{""}
+		}
+		for j, chunk := range chunks {
+			embedTitle := s.title
+			if j > 0 {
+				embedTitle += " (continued)"
+			}
+			embed := discordEmbed{Title: truncateRunes(embedTitle, discordEmbedTitleChars), Description: chunk, Color: color}
+			if i == 0 && j == 0 {
+				embed.URL = archiveURL
+			}
+			embeds = append(embeds, embed)
+		}
+	}
+
+	var messages []discordMessage
+	var current []discordEmbed
+	size := 0
+	for _, e := range embeds {
+		n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+		if len(current) == discordEmbedsPerMessage || len(current) > 0 && size+n > discordEmbedTotalChars {
+			messages = append(messages, discordMessage{Embeds: current})
+			current, size = nil, 0
+		}
+		current = append(current, e)
+		size += n
+	}
+	if len(current) > 0 {
+		messages = append(messages, discordMessage{Embeds: current})
+	}
+	return messages
+}
+
+// discordColor converts a CSS hex color to an embed color.
+func discordColor(hex string) int {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	color, err := strconv.ParseInt(hex, 16, 32)
+	if err != nil {
+		return 0
+	}
+	return int(color)
+}
+
+// buildDiscordMessages renders the digest in the configured format.
+func buildDiscordMessages(config *Config, title, summary, archiveURL string) []discordMessage {
+	if config.Discord.Format == discordFormatEmbeds {
+		return buildDiscordEmbeds(title, summary, archiveURL, discordColor(config.EmailAccentColor))
+	}
+	return buildDiscordText(title, summary, archiveURL)
+}
+
+// discordEndpoint is where messages are posted, and the Authorization header
+// a bot needs: the webhook, waiting for the result so failures are reported,
+// or the digest channel.
+func discordEndpoint(config *Config) (endpoint, authorization string, err error) {
+	if config.Discord.WebhookURL == "" {
+		return discordAPIBase + "/channels/" + url.PathEscape(config.Discord.ChannelID) + "/messages", "Bot " + config.DiscordBotToken, nil
+	}
+	u, err := url.Parse(config.Discord.WebhookURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid DISCORD_WEBHOOK_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("wait", "true")
+	u.RawQuery = q.Encode()
+	return u.String(), "", nil
+}
+
+// postDigestToDiscord posts the digest's messages in order.
+func postDigestToDiscord(client *http.Client, config *Config, title, summary, archiveURL string, logger *zap.Logger) error {
+	endpoint, authorization, err := discordEndpoint(config)
+	if err != nil {
+		return err
+	}
+	messages := buildDiscordMessages(config, title, summary, archiveURL)
+	for i, msg := range messages {
+		if err := postDiscordMessage(client, endpoint, authorization, msg, logger); err != nil {
+			return fmt.Errorf("error posting message %d of %d to Discord: %v", i+1, len(messages), err)
+		}
+	}
+	return nil
+}
+
+// postDiscordMessage posts one message, waiting out rate limits as Discord
+// asks.
+func postDiscordMessage(client *http.Client, endpoint, authorization string, msg discordMessage, logger *zap.Logger) error {
+	msg.AllowedMentions.Parse = []string{}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %v", err)
+	}
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTargetTimeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			cancel()
+			return fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			return err
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		cancel()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < discordMaxAttempts {
+			var limited struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.Unmarshal(body, &limited)
+			wait := time.Duration(limited.RetryAfter * float64(time.Second))
+			if wait <= 0 || wait > 30*time.Second {
+				wait = 5 * time.Second
+			}
+			logger.Warn("Rate limited by Discord, retrying", zap.Duration("wait", wait))
+			time.Sleep(wait)
+			continue
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("Discord returned %s: %s", resp.Status, excerpt(string(body), 200))
+		}
+		return nil
+	}
+}
+
+// deliverToDiscord posts the digest to the Discord channel, or prints the
+// messages on a dry run, recording the outcome under "discord".
+func deliverToDiscord(config *Config, flags Flags, title, summary, archiveURL string, outcome map[string]string, logger *zap.Logger) {
+	if flags.DryRun {
+		outcome["discord"] = "dry_run"
+		for _, msg := range buildDiscordMessages(config, title, summary, archiveURL) {
+			msg.AllowedMentions.Parse = []string{}
+			payload, err := json.MarshalIndent(msg, "", "  ")
+			if err != nil {
+				logger.Error("Failed to render Discord message", zap.Error(err))
+				return
+			}
+			flags.Output.event("discord_message", map[string]any{"payload": json.RawMessage(payload)},
+				fmt.Sprintf("\n--- Discord Message ---\n%s", payload))
+		}
+		return
+	}
+
+	outcome["discord"] = "sent"
+	client, err := newHTTPClient(config.networkFor(""), 30*time.Second)
+	if err == nil {
+		err = postDigestToDiscord(client, config, title, summary, archiveURL, logger)
+	}
+	if err != nil {
+		logger.Error("Failed to post digest to Discord", zap.Error(err))
+		outcome["discord"] = "failed"
+	}
+}
@@ -0,0 +1,62 @@
+package shinbun
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// loadDKIMKey reads a PEM private key (PKCS#1 RSA, or PKCS#8 RSA or Ed25519).
+func loadDKIMKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading DKIM key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in DKIM key %s", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DKIM key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported DKIM key type %T", key)
+	}
+	return signer, nil
+}
+
+// signDKIM prepends a DKIM-Signature header to the message when DKIM is
+// configured, and returns it unchanged otherwise.
+func signDKIM(config *Config, message []byte) ([]byte, error) {
+	if config.DKIMDomain == "" {
+		return message, nil
+	}
+	key, err := loadDKIMKey(config.DKIMPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed bytes.Buffer
+	options := &dkim.SignOptions{
+		Domain:   config.DKIMDomain,
+		Selector: config.DKIMSelector,
+		Signer:   key,
+		// Relaxed canonicalization survives header folding by relays
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+	}
+	if err := dkim.Sign(&signed, bytes.NewReader(message), options); err != nil {
+		return nil, fmt.Errorf("error signing email with DKIM: %v", err)
+	}
+	return signed.Bytes(), nil
+}
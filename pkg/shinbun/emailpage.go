@@ -0,0 +1,193 @@
+package shinbun
+
+import (
+	"strings"
+	"text/template"
+)
+
+// htmlPageTemplate is the page around a rendered digest, for email clients and
+// browsers alike. The layout is a single centered table so Outlook's Word
+// engine keeps the width; everything else is progressive:
+//   - color-scheme metas and a prefers-color-scheme block switch Apple Mail,
+//     iOS Mail, Outlook for Mac and browsers to dark colors,
+//   - the [data-ogsc] selectors do the same for Outlook.com and Outlook apps,
+//     which rewrite colors on their own otherwise,
+//   - Gmail ignores both and inverts the light colors itself,
+//   - below 620px the padding and headings shrink for phones.
+var htmlPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="color-scheme" content="light dark">
+<meta name="supported-color-schemes" content="light dark">
+<meta name="x-apple-disable-message-reformatting">
+<style>
+	:root {
+		color-scheme: light dark;
+		supported-color-schemes: light dark;
+	}
+	body {
+		margin: 0;
+		padding: 0;
+		width: 100%;
+		background-color: #f4f5f7;
+		-webkit-text-size-adjust: 100%;
+		-ms-text-size-adjust: 100%;
+	}
+	.wrapper {
+		width: 100%;
+		background-color: #f4f5f7;
+	}
+	.container {
+		width: 100%;
+		max-width: 760px;
+		background-color: #ffffff;
+		border-radius: 6px;
+	}
+	.content {
+		padding: 28px 32px;
+		font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+		font-size: 16px;
+		line-height: 1.6;
+		color: #333333;
+		word-wrap: break-word;
+		overflow-wrap: break-word;
+	}
+	h1, h2, h3 {
+		color: {{.Brand.HeadingColor}};
+		line-height: 1.3;
+		margin-top: 24px;
+		margin-bottom: 12px;
+	}
+	h1 { font-size: 26px; }
+	h2 { font-size: 22px; }
+	h3 { font-size: 18px; }
+	a {
+		color: {{.Brand.AccentColor}};
+		text-decoration: none;
+		word-break: break-word;
+	}
+	a:hover {
+		text-decoration: underline;
+	}
+	ul, ol {
+		padding-left: 22px;
+	}
+	li {
+		margin: 8px 0;
+	}
+	img {
+		max-width: 100%;
+		height: auto;
+		border: 0;
+	}
+	hr {
+		border: 0;
+		border-top: 1px solid #e1e4e8;
+		margin: 24px 0;
+	}
+	code {
+		background-color: #f1f3f5;
+		padding: 2px 4px;
+		border-radius: 3px;
+		font-family: Monaco, Menlo, Consolas, monospace;
+		font-size: 0.9em;
+	}
+	pre {
+		white-space: pre-wrap;
+		word-wrap: break-word;
+		background-color: #f1f3f5;
+		padding: 8px 12px;
+		border-radius: 3px;
+	}
+	pre code {
+		padding: 0;
+		background-color: transparent;
+	}
+	blockquote {
+		border-left: 4px solid #e1e4e8;
+		margin: 0;
+		padding-left: 16px;
+		color: #6a737d;
+	}
+	.content table {
+		border-collapse: collapse;
+	}
+	.content td, .content th {
+		border: 1px solid #e1e4e8;
+		padding: 4px 8px;
+	}
+	.logo {
+		margin-bottom: 8px;
+	}
+	.brand-header {
+		border-bottom: 3px solid {{.Brand.AccentColor}};
+		margin-bottom: 16px;
+	}
+	.brand-footer {
+		border-top: 1px solid #e1e4e8;
+		margin-top: 32px;
+		padding-top: 8px;
+		font-size: 13px;
+		color: #6a737d;
+	}
+
+	@media (max-width: 620px) {
+		.content { padding: 20px 16px !important; font-size: 15px !important; }
+		.container { border-radius: 0 !important; }
+		h1 { font-size: 22px !important; }
+		h2 { font-size: 19px !important; }
+		h3 { font-size: 17px !important; }
+	}
+
+	@media (prefers-color-scheme: dark) {
+		body, .wrapper { background-color: #111315 !important; }
+		.container { background-color: #1c1f23 !important; }
+		.content, blockquote, .brand-footer { color: #d7dadf !important; }
+		h1, h2, h3 { color: #f0f2f5 !important; }
+		code, pre { background-color: #2a2e33 !important; }
+		pre code { background-color: transparent !important; }
+		hr, blockquote, .brand-footer { border-color: #3a3f45 !important; }
+	}
+	[data-ogsc] body, [data-ogsc] .wrapper { background-color: #111315 !important; }
+	[data-ogsc] .container { background-color: #1c1f23 !important; }
+	[data-ogsc] .content { color: #d7dadf !important; }
+	[data-ogsc] h1, [data-ogsc] h2, [data-ogsc] h3 { color: #f0f2f5 !important; }
+</style>
+</head>
+<body>
+<table role="presentation" class="wrapper" width="100%" cellpadding="0" cellspacing="0" border="0" bgcolor="#f4f5f7">
+<tr>
+<td align="center" style="padding: 16px 0;">
+<!--[if mso]><table role="presentation" width="760" cellpadding="0" cellspacing="0" border="0"><tr><td><![endif]-->
+<table role="presentation" class="container" width="100%" cellpadding="0" cellspacing="0" border="0" bgcolor="#ffffff" style="max-width: 760px;">
+<tr>
+<td class="content">
+{{.Header}}{{.Body}}
+{{.Footer}}</td>
+</tr>
+</table>
+<!--[if mso]></td></tr></table><![endif]-->
+</td>
+</tr>
+</table>
+</body>
+</html>`))
+
+// renderHTMLPage converts markdown to a standalone HTML page, as used for email
+// bodies and the digest archive.
+func renderHTMLPage(md string, brand branding) string {
+	return renderHTMLDocument(markdownToHTML(md), brand)
+}
+
+// renderHTMLDocument puts already rendered HTML into the page.
+func renderHTMLDocument(body string, brand branding) string {
+	var sb strings.Builder
+	// The template is fixed and its data are plain strings, so this can't fail
+	htmlPageTemplate.Execute(&sb, struct {
+		Brand                branding
+		Header, Body, Footer string
+	}{brand, brand.headerHTML(), body, brand.footerHTML()})
+	return sb.String()
+}
@@ -0,0 +1,95 @@
+package shinbun
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultEmailMaxBytes keeps emails under the 102 KB Gmail clips them at.
+const defaultEmailMaxBytes = 100_000
+
+// emailPart is one email of a digest too large to send in one.
+type emailPart struct {
+	Subject string
+	Body    string
+}
+
+// splitEmail fits the digest email into bodies of at most maxBytes once
+// rendered to HTML. A digest that fits is sent as is. One that doesn't is cut
+// short with a link to the rest in the archive when there is one, or else
+// split into numbered emails that each say where the digest continues.
+func splitEmail(subject, body, archiveURL string, maxBytes int, brand branding) []emailPart {
+	if len(renderHTMLPage(body, brand)) <= maxBytes {
+		return []emailPart{{Subject: subject, Body: body}}
+	}
+
+	if archiveURL != "" {
+		note := fmt.Sprintf("\n\n---\n\n*This digest is too long for one email.* [Continue reading in your browser](%s)\n", archiveURL)
+		parts := splitMarkdown(body, func(md string) bool { return len(renderHTMLPage(md+note, brand)) <= maxBytes })
+		return []emailPart{{Subject: subject, Body: parts[0] + note}}
+	}
+
+	// Leave room for the longest note the parts can get
+	longest := continuedNote(99, 99)
+	parts := splitMarkdown(body, func(md string) bool { return len(renderHTMLPage(md+longest, brand)) <= maxBytes })
+	emails := make([]emailPart, len(parts))
+	for i, part := range parts {
+		emails[i] = emailPart{Subject: fmt.Sprintf("%s (%d/%d)", subject, i+1, len(parts)), Body: part}
+		if i < len(parts)-1 {
+			emails[i].Body += continuedNote(i+2, len(parts))
+		}
+	}
+	return emails
+}
+
+func continuedNote(next, total int) string {
+	return fmt.Sprintf("\n\n---\n\n*Continued in the next email (part %d of %d).*\n", next, total)
+}
+
+// splitMarkdown splits md at line breaks into parts that fit, preferring to
+// break before a heading or at a blank line. A line too long to fit on its own
+// is a part by itself.
+func splitMarkdown(md string, fits func(string) bool) []string {
+	lines := strings.Split(md, "\n")
+	var parts []string
+	for start := 0; start < len(lines); {
+		// The most lines from start that fit; rendering is costly, so search
+		end := start + sort.Search(len(lines)-start, func(n int) bool {
+			return !fits(strings.Join(lines[start:start+n+1], "\n"))
+		})
+		if end == start {
+			end = start + 1
+		}
+		if end < len(lines) {
+			end = breakBefore(lines, start, end)
+		}
+		part := strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+		// A section's rule belongs with the section
+		part = strings.TrimSpace(strings.TrimSuffix(part, "---"))
+		if part != "" {
+			parts = append(parts, part)
+		}
+		start = end
+	}
+	if len(parts) == 0 {
+		parts = append(parts, md)
+	}
+	return parts
+}
+
+// breakBefore backs end up to the start of a section, or failing that of a
+// paragraph, unless it is more than halfway back to start.
+func breakBefore(lines []string, start, end int) int {
+	for _, isBreak := range []func(string) bool{
+		func(line string) bool { return strings.HasPrefix(line, "#") },
+		func(line string) bool { return strings.TrimSpace(line) == "" },
+	} {
+		for i := end; i > start+(end-start)/2; i-- {
+			if isBreak(lines[i]) {
+				return i
+			}
+		}
+	}
+	return end
+}
@@ -0,0 +1,105 @@
+package shinbun
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sampleDigest is a digest of sections sized so that a few fit in one email.
+func sampleDigest(sections int) string {
+	var sb strings.Builder
+	for i := 1; i <= sections; i++ {
+		fmt.Fprintf(&sb, "## Section %d\n\n", i)
+		for j := 1; j <= 5; j++ {
+			fmt.Fprintf(&sb, "- Item %d.%d: %s\n", i, j, strings.Repeat("news ", 40))
+		}
+		sb.WriteString("\n---\n\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func TestSplitMarkdownBreaksBeforeHeadings(t *testing.T) {
+	md := sampleDigest(6)
+	limit := len(md) / 3
+	parts := splitMarkdown(md, func(s string) bool { return len(s) <= limit })
+	if len(parts) < 3 {
+		t.Fatalf("got %d parts, want at least 3", len(parts))
+	}
+	for i, part := range parts {
+		if len(part) > limit {
+			t.Errorf("part %d is %d bytes, over %d", i+1, len(part), limit)
+		}
+		if !strings.HasPrefix(part, "## Section") {
+			t.Errorf("part %d starts %q, want a heading", i+1, firstLine(part))
+		}
+		if strings.HasSuffix(part, "---") {
+			t.Errorf("part %d ends with the next section's rule", i+1)
+		}
+	}
+	for i := 1; i <= 6; i++ {
+		heading := fmt.Sprintf("## Section %d\n", i)
+		if n := strings.Count(strings.Join(parts, "\n"), heading); n != 1 {
+			t.Errorf("%q appears %d times in the parts, want once", strings.TrimSpace(heading), n)
+		}
+	}
+}
+
+func TestSplitMarkdownLongLine(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	parts := splitMarkdown("short\n"+long+"\nend", func(s string) bool { return len(s) <= 20 })
+	want := []string{"short", long, "end"}
+	if strings.Join(parts, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", parts, want)
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func TestSplitEmail(t *testing.T) {
+	brand := branding{}
+	body := sampleDigest(8)
+	maxBytes := len(renderHTMLPage(body, brand)) / 3
+
+	t.Run("fits", func(t *testing.T) {
+		parts := splitEmail("Digest", body, "", len(renderHTMLPage(body, brand)), brand)
+		if len(parts) != 1 || parts[0].Subject != "Digest" || parts[0].Body != body {
+			t.Errorf("a digest that fits was changed: %d parts", len(parts))
+		}
+	})
+
+	t.Run("cut short with an archive link", func(t *testing.T) {
+		parts := splitEmail("Digest", body, "https://shinbun.example.com/digests/default/2025-01-06", maxBytes, brand)
+		if len(parts) != 1 {
+			t.Fatalf("got %d parts, want 1", len(parts))
+		}
+		if !strings.Contains(parts[0].Body, "(https://shinbun.example.com/digests/default/2025-01-06)") {
+			t.Error("the email doesn't link to the rest in the archive")
+		}
+		if size := len(renderHTMLPage(parts[0].Body, brand)); size > maxBytes {
+			t.Errorf("email renders to %d bytes, over %d", size, maxBytes)
+		}
+	})
+
+	t.Run("numbered parts without an archive", func(t *testing.T) {
+		parts := splitEmail("Digest", body, "", maxBytes, brand)
+		if len(parts) < 3 {
+			t.Fatalf("got %d parts, want at least 3", len(parts))
+		}
+		for i, part := range parts {
+			if want := fmt.Sprintf("Digest (%d/%d)", i+1, len(parts)); part.Subject != want {
+				t.Errorf("part %d subject %q, want %q", i+1, part.Subject, want)
+			}
+			if size := len(renderHTMLPage(part.Body, brand)); size > maxBytes {
+				t.Errorf("part %d renders to %d bytes, over %d", i+1, size, maxBytes)
+			}
+			continued := strings.Contains(part.Body, fmt.Sprintf("part %d of %d", i+2, len(parts)))
+			if last := i == len(parts)-1; continued == last {
+				t.Errorf("part %d: continued note %v, want %v", i+1, continued, !last)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package shinbun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"shinbun/internal/cohere"
+)
+
+// defaultCohereEmbeddingModel is used with EMBEDDING_PROVIDER=cohere unless
+// EMBEDDING_MODEL is set.
+const defaultCohereEmbeddingModel = "embed-v4.0"
+
+// embedFunc returns an embedding of each text, preserving order.
+type embedFunc func(texts []string) ([][]float32, error)
+
+// newEmbedder returns the configured embedding provider, or nil when
+// embeddings are not used.
+func newEmbedder(config *Config, client *openai.Client, httpClient *http.Client) (embedFunc, error) {
+	if config.CorrelationSimilarity == 0 {
+		return nil, nil
+	}
+	model := config.EmbeddingModel
+	switch config.EmbeddingProvider {
+	case "", "openai":
+		if model == "" {
+			model = string(openai.SmallEmbedding3)
+		}
+		return func(texts []string) ([][]float32, error) {
+			return embedWithOpenAI(client, model, texts)
+		}, nil
+	case "local":
+		// Any server with an OpenAI-compatible embeddings endpoint, e.g.
+		// Ollama, llama.cpp or text-embeddings-inference
+		if config.EmbeddingBaseURL == "" || model == "" {
+			return nil, fmt.Errorf("EMBEDDING_BASE_URL and EMBEDDING_MODEL are required for EMBEDDING_PROVIDER=local")
+		}
+		localConfig := openai.DefaultConfig("")
+		localConfig.BaseURL = strings.TrimSuffix(config.EmbeddingBaseURL, "/")
+		localConfig.HTTPClient = httpClient
+		local := openai.NewClientWithConfig(localConfig)
+		return func(texts []string) ([][]float32, error) {
+			return embedWithOpenAI(local, model, texts)
+		}, nil
+	case "cohere":
+		if config.CohereAPIKey == "" {
+			return nil, fmt.Errorf("COHERE_API_KEY is required for EMBEDDING_PROVIDER=cohere")
+		}
+		if model == "" {
+			model = defaultCohereEmbeddingModel
+		}
+		co := cohere.NewClient(config.CohereAPIKey, config.EmbeddingBaseURL, httpClient)
+		return func(texts []string) ([][]float32, error) {
+			return co.Embed(texts, model, "clustering")
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q (use openai, local or cohere)", config.EmbeddingProvider)
+	}
+}
+
+func embedWithOpenAI(client *openai.Client, model string, texts []string) ([][]float32, error) {
+	resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating embeddings: %v", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+	embeddings := make([][]float32, 0, len(texts))
+	for _, d := range resp.Data {
+		embeddings = append(embeddings, d.Embedding)
+	}
+	return embeddings, nil
+}
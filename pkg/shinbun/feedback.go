@@ -0,0 +1,500 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	weightKindChannel  = "channel"
+	weightKindCategory = "category"
+
+	// feedbackWindow is how far back feedback is learned from.
+	feedbackWindow = 30 * 24 * time.Hour
+	// feedbackMinSamples is how often a channel or category must have been in
+	// digests before its weight moves.
+	feedbackMinSamples = 5
+	// learnedWeightLimit bounds a learned weight, in priority points.
+	learnedWeightLimit = 1.0
+	// learnInterval is the least time between two automatic learning passes.
+	learnInterval = 20 * time.Hour
+)
+
+// feedbackValues is what each reader signal on a digest item is worth.
+var feedbackValues = map[string]float64{
+	"click":       1,
+	"thumbs_up":   3,
+	"thumbs_down": -3,
+}
+
+// Reactions to the digest posted in Slack count for every item of the digest:
+// thumbs as explicit votes, any other reaction as a click.
+var slackReactionValues = map[string]float64{
+	"+1":         3,
+	"thumbsup":   3,
+	"-1":         -3,
+	"thumbsdown": -3,
+}
+
+// learnedWeights are the channel and category weights learned from feedback,
+// keyed by lower-case name.
+type learnedWeights struct {
+	Channel  map[string]float64
+	Category map[string]float64
+}
+
+// channelWeight is CHANNEL_WEIGHTS' value for the channel if set, otherwise
+// the learned one.
+func (l learnedWeights) channelWeight(config *Config, channel string) float64 {
+	channel = strings.ToLower(channel)
+	if w, ok := config.ChannelWeights[channel]; ok {
+		return w
+	}
+	return l.Channel[channel]
+}
+
+// categoryWeight is CATEGORY_WEIGHTS' value for the category if set,
+// otherwise the learned one.
+func (l learnedWeights) categoryWeight(config *Config, category string) float64 {
+	category = strings.ToLower(category)
+	if w, ok := config.CategoryWeights[category]; ok {
+		return w
+	}
+	return l.Category[category]
+}
+
+func loadLearnedWeights(db *sql.DB) (learnedWeights, error) {
+	learned := learnedWeights{Channel: make(map[string]float64), Category: make(map[string]float64)}
+	rows, err := db.Query(`SELECT kind, name, weight FROM learned_weights`)
+	if err != nil {
+		return learned, fmt.Errorf("error loading learned weights: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, name string
+		var weight float64
+		if err := rows.Scan(&kind, &name, &weight); err != nil {
+			return learned, fmt.Errorf("error scanning learned weight: %v", err)
+		}
+		switch kind {
+		case weightKindChannel:
+			learned.Channel[name] = weight
+		case weightKindCategory:
+			learned.Category[name] = weight
+		}
+	}
+	return learned, rows.Err()
+}
+
+// maybeLearnWeights runs a learning pass unless one ran within learnInterval,
+// so weights move once a day however often digests run.
+func maybeLearnWeights(api *slack.Client, db *sql.DB, config *Config, logger *zap.Logger) {
+	var last sql.NullTime
+	err := db.QueryRow(`SELECT updated_at FROM learned_weights WHERE updated_at IS NOT NULL ORDER BY updated_at DESC LIMIT 1`).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("Failed to check learned weights", zap.Error(err))
+		return
+	}
+	if last.Valid && config.Clock.Now().Sub(last.Time) < learnInterval {
+		return
+	}
+	if err := learnWeights(api, db, config, logger); err != nil {
+		logger.Error("Failed to learn weights from feedback", zap.Error(err))
+	}
+}
+
+// feedbackTally is the feedback on the digest items of one channel or category.
+type feedbackTally struct {
+	Samples int
+	Value   float64
+}
+
+// learnWeights moves each channel's and category's weight a step (LEARNING_RATE)
+// towards what the last 30 days of feedback suggest. The feedback on an item
+// is its clicks and thumbs from tracked emails plus its share of the reactions
+// to the digest's Slack post; a channel or category whose items earn more
+// feedback per appearance than the average moves up, one that earns less
+// moves down, by at most learnedWeightLimit.
+func learnWeights(api *slack.Client, db *sql.DB, config *Config, logger *zap.Logger) error {
+	since := config.Clock.Now().Add(-feedbackWindow)
+	if api != nil {
+		if err := collectSlackReactions(api, db, since, logger); err != nil {
+			logger.Warn("Failed to collect reactions to posted digests", zap.Error(err))
+		}
+	}
+
+	itemFeedback, err := emailFeedback(db, since)
+	if err != nil {
+		return err
+	}
+	postFeedback, err := digestPostFeedback(db, since)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT focus, digest_date, content FROM digests WHERE digest_date >= $1 ORDER BY digest_date, focus`, since.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("error loading digests: %v", err)
+	}
+	type digestItems struct {
+		Key   string
+		Links []string
+	}
+	var digests []digestItems
+	for rows.Next() {
+		var focus, content string
+		var date time.Time
+		if err := rows.Scan(&focus, &date, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning digest: %v", err)
+		}
+		digests = append(digests, digestItems{Key: feedbackKey(focus, date, ""), Links: itemLinks(content)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error loading digests: %v", err)
+	}
+
+	tallies := map[string]map[string]*feedbackTally{weightKindChannel: {}, weightKindCategory: {}}
+	tally := func(kind, name string, value float64) {
+		t := tallies[kind][name]
+		if t == nil {
+			t = &feedbackTally{}
+			tallies[kind][name] = t
+		}
+		t.Samples++
+		t.Value += value
+	}
+	sources := make(map[string]*[2]string)
+	for _, d := range digests {
+		var items [][2]string
+		var itemValues []float64
+		for _, link := range d.Links {
+			source, ok := sources[link]
+			if !ok {
+				source = linkSource(db, config.CategoryTerms, link)
+				sources[link] = source
+			}
+			if source == nil {
+				continue
+			}
+			items = append(items, *source)
+			itemValues = append(itemValues, itemFeedback[d.Key+link])
+		}
+		for i, item := range items {
+			value := itemValues[i] + postFeedback[d.Key]/float64(len(items))
+			tally(weightKindChannel, item[0], value)
+			tally(weightKindCategory, item[1], value)
+		}
+	}
+
+	current, err := loadLearnedWeights(db)
+	if err != nil {
+		return err
+	}
+	for _, kind := range sortedKeys(tallies) {
+		old := current.Channel
+		if kind == weightKindCategory {
+			old = current.Category
+		}
+		targets := feedbackTargets(tallies[kind])
+		for _, name := range sortedKeys(tallies[kind]) {
+			weight := old[name]
+			if target, ok := targets[name]; ok {
+				weight += config.LearningRate * (target - weight)
+			}
+			_, err := db.Exec(`
+				INSERT INTO learned_weights (kind, name, weight, samples, feedback, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (kind, name) DO UPDATE SET weight = EXCLUDED.weight, samples = EXCLUDED.samples,
+				    feedback = EXCLUDED.feedback, updated_at = EXCLUDED.updated_at`,
+				kind, name, weight, tallies[kind][name].Samples, tallies[kind][name].Value, config.Clock.Now())
+			if err != nil {
+				return fmt.Errorf("error saving learned weight: %v", err)
+			}
+			if weight != old[name] {
+				logger.Info("Learned weight", zap.String("kind", kind), zap.String("name", name),
+					zap.Float64("from", old[name]), zap.Float64("to", weight))
+			}
+		}
+	}
+	return nil
+}
+
+// feedbackTargets returns the weight each channel or category with enough
+// samples is moving towards: its feedback per appearance against the average
+// of all of them, squashed into ±learnedWeightLimit.
+func feedbackTargets(tallies map[string]*feedbackTally) map[string]float64 {
+	samples, value := 0, 0.0
+	for _, t := range tallies {
+		if t.Samples >= feedbackMinSamples {
+			samples += t.Samples
+			value += t.Value
+		}
+	}
+	targets := make(map[string]float64)
+	if samples == 0 {
+		return targets
+	}
+	mean := value / float64(samples)
+	scale := math.Max(math.Abs(mean), 0.1)
+	for name, t := range tallies {
+		if t.Samples < feedbackMinSamples {
+			continue
+		}
+		rate := t.Value / float64(t.Samples)
+		targets[name] = learnedWeightLimit * math.Tanh((rate-mean)/scale)
+	}
+	return targets
+}
+
+func feedbackKey(focus string, date time.Time, link string) string {
+	return focus + "|" + date.Format("2006-01-02") + "|" + link
+}
+
+// itemLinks returns the links of a digest's list items.
+func itemLinks(content string) []string {
+	var links []string
+	for _, line := range strings.Split(content, "\n") {
+		if !markdownListPattern.MatchString(line) {
+			continue
+		}
+		for _, m := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(m[2], "https://") || strings.HasPrefix(m[2], "http://") {
+				links = append(links, m[2])
+				break
+			}
+		}
+	}
+	return links
+}
+
+// linkSource returns the channel and category of the stored message a digest
+// links to, or nil for links to anything else.
+func linkSource(db *sql.DB, terms termSet, link string) *[2]string {
+	var channel, text string
+	err := db.QueryRow(`
+		SELECT c.name, m.text FROM messages m JOIN channels c ON m.channel_id = c.id
+		WHERE m.permalink = $1 LIMIT 1`, link).Scan(&channel, &text)
+	if err != nil {
+		return nil
+	}
+	category, _ := terms.categorize(channel, text)
+	return &[2]string{strings.ToLower(channel), category}
+}
+
+// emailFeedback sums the clicks and thumbs on each item of the tracked emails
+// sent since, keyed by feedbackKey.
+func emailFeedback(db *sql.DB, since time.Time) (map[string]float64, error) {
+	rows, err := db.Query(`
+		SELECT d.focus, d.digest_date, e.event, e.url, COUNT(*)
+		FROM email_events e JOIN email_deliveries d ON e.token = d.token
+		WHERE d.digest_date >= $1 AND e.event IN ('click', 'thumbs_up', 'thumbs_down') AND e.url IS NOT NULL
+		GROUP BY d.focus, d.digest_date, e.event, e.url`, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading email feedback: %v", err)
+	}
+	defer rows.Close()
+	feedback := make(map[string]float64)
+	for rows.Next() {
+		var focus, event, link string
+		var date time.Time
+		var count int
+		if err := rows.Scan(&focus, &date, &event, &link, &count); err != nil {
+			return nil, fmt.Errorf("error scanning email feedback: %v", err)
+		}
+		feedback[feedbackKey(focus, date, link)] += feedbackValues[event] * float64(count)
+	}
+	return feedback, rows.Err()
+}
+
+// digestPostFeedback returns the reaction value of each digest posted to
+// Slack since, keyed by feedbackKey without a link.
+func digestPostFeedback(db *sql.DB, since time.Time) (map[string]float64, error) {
+	rows, err := db.Query(`SELECT focus, digest_date, reaction_value FROM digest_posts WHERE digest_date >= $1`, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading digest reactions: %v", err)
+	}
+	defer rows.Close()
+	feedback := make(map[string]float64)
+	for rows.Next() {
+		var focus string
+		var date time.Time
+		var value float64
+		if err := rows.Scan(&focus, &date, &value); err != nil {
+			return nil, fmt.Errorf("error scanning digest reactions: %v", err)
+		}
+		feedback[feedbackKey(focus, date, "")] += value
+	}
+	return feedback, rows.Err()
+}
+
+// recordDigestPost remembers a digest posted to Slack so reactions to it can
+// be collected as feedback.
+func recordDigestPost(db *sql.DB, channelID, ts, focus string, date time.Time) error {
+	_, err := db.Exec(`INSERT INTO digest_posts (channel_id, ts, focus, digest_date) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+		channelID, ts, focus, date.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("error recording digest post: %v", err)
+	}
+	return nil
+}
+
+// collectSlackReactions stores the current reaction value of each digest
+// posted since. It needs the reactions:read scope.
+func collectSlackReactions(api *slack.Client, db *sql.DB, since time.Time, logger *zap.Logger) error {
+	rows, err := db.Query(`SELECT channel_id, ts FROM digest_posts WHERE digest_date >= $1`, since.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("error loading digest posts: %v", err)
+	}
+	var posts [][2]string
+	for rows.Next() {
+		var post [2]string
+		if err := rows.Scan(&post[0], &post[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning digest post: %v", err)
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error loading digest posts: %v", err)
+	}
+
+	for _, post := range posts {
+		reactions, err := api.GetReactions(slack.NewRefToMessage(post[0], post[1]), slack.GetReactionsParameters{})
+		if err != nil {
+			return fmt.Errorf("error getting reactions: %v", err)
+		}
+		value := 0.0
+		for _, r := range reactions {
+			perReaction, ok := slackReactionValues[r.Name]
+			if !ok {
+				perReaction = feedbackValues["click"]
+			}
+			value += perReaction * float64(r.Count)
+		}
+		if _, err := db.Exec(`UPDATE digest_posts SET reaction_value = $3 WHERE channel_id = $1 AND ts = $2`, post[0], post[1], value); err != nil {
+			return fmt.Errorf("error saving reactions: %v", err)
+		}
+		logger.Debug("Collected digest reactions", zap.String("channel", post[0]), zap.String("ts", post[1]), zap.Float64("value", value))
+	}
+	return nil
+}
+
+func runWeightsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New("usage: shinbun weights [list] | weights learn | weights reset [--kind channel|category] [name]")
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		return listWeights(db, config)
+
+	case "learn":
+		api, err := newSlackClient(config, logger)
+		if err != nil {
+			return err
+		}
+		if err := learnWeights(api, db, config, logger); err != nil {
+			return err
+		}
+		return listWeights(db, config)
+
+	case "reset":
+		fs := flag.NewFlagSet("weights reset", flag.ContinueOnError)
+		kind := fs.String("kind", "", "Only reset weights of this kind, channel or category")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 1 {
+			return usage
+		}
+		name := strings.ToLower(fs.Arg(0))
+		result, err := db.Exec(`DELETE FROM learned_weights WHERE ($1 = '' OR kind = $1) AND ($2 = '' OR name = $2)`, *kind, name)
+		if err != nil {
+			return fmt.Errorf("error resetting learned weights: %v", err)
+		}
+		n, _ := result.RowsAffected()
+		fmt.Printf("reset %d learned weights\n", n)
+		return nil
+	}
+	return usage
+}
+
+// listWeights prints the learned weights next to the configured overrides,
+// and the weight scoring uses.
+func listWeights(db *sql.DB, config *Config) error {
+	rows, err := db.Query(`SELECT kind, name, weight, samples, feedback, updated_at FROM learned_weights ORDER BY kind, name`)
+	if err != nil {
+		return fmt.Errorf("error listing learned weights: %v", err)
+	}
+	defer rows.Close()
+
+	if !config.LearnWeights {
+		fmt.Println("LEARN_WEIGHTS is off: learned weights are not used for scoring.")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tLEARNED\tCONFIGURED\tUSED\tSAMPLES\tFEEDBACK\tUPDATED")
+	seen := map[string]map[string]bool{weightKindChannel: {}, weightKindCategory: {}}
+	overrides := map[string]map[string]float64{weightKindChannel: config.ChannelWeights, weightKindCategory: config.CategoryWeights}
+	used := func(kind, name string, learned float64) float64 {
+		if w, ok := overrides[kind][name]; ok {
+			return w
+		}
+		if !config.LearnWeights {
+			return 0
+		}
+		return learned
+	}
+	configured := func(kind, name string) string {
+		if w, ok := overrides[kind][name]; ok {
+			return fmt.Sprintf("%.2f", w)
+		}
+		return "-"
+	}
+	for rows.Next() {
+		var kind, name string
+		var weight, feedback float64
+		var samples int
+		var updated time.Time
+		if err := rows.Scan(&kind, &name, &weight, &samples, &feedback, &updated); err != nil {
+			return fmt.Errorf("error scanning learned weight: %v", err)
+		}
+		if seen[kind] != nil {
+			seen[kind][name] = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\t%.2f\t%d\t%.1f\t%s\n", kind, name, weight, configured(kind, name), used(kind, name, weight), samples, feedback, updated.Format(time.DateTime))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error listing learned weights: %v", err)
+	}
+	for _, kind := range sortedKeys(overrides) {
+		for _, name := range sortedKeys(overrides[kind]) {
+			if !seen[kind][name] {
+				fmt.Fprintf(w, "%s\t%s\t-\t%s\t%.2f\t0\t-\t-\n", kind, name, configured(kind, name), used(kind, name, 0))
+			}
+		}
+	}
+	return w.Flush()
+}
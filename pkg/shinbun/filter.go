@@ -0,0 +1,214 @@
+package shinbun
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// ingestionFilter decides which Slack messages are ingested. Shinbun's own
+// posts are always excluded so posted digests are never summarized again.
+type ingestionFilter struct {
+	OwnUserID      string
+	OwnBotID       string
+	OwnAppID       string
+	IncludeBots    bool
+	ExcludedAppIDs map[string]bool // App or bot IDs whose messages are never ingested
+
+	MinChars      int
+	SkipEmojiOnly bool
+	SkipJoinLeave bool
+	// Author lists for the focus; an entry is a user, bot or app ID, or an
+	// @handle. With an allow list only its authors are ingested.
+	AllowAuthors map[string]bool
+	DenyAuthors  map[string]bool
+	// Signals maps reaction emoji to workflow states; a message with at least
+	// ReactionBoost reactions gains priority (0 disables)
+	Signals       map[string]string
+	ReactionBoost int
+	// Skipped counts filtered messages by reason across all channels
+	Skipped map[string]int
+}
+
+// emojiCodePattern matches Slack emoji shortcodes such as :tada: or :+1::skin-tone-2:.
+var emojiCodePattern = regexp.MustCompile(`:[a-z0-9_+'-]+:`)
+
+// joinLeaveSubtypes are the message subtypes Slack posts when members come and go.
+var joinLeaveSubtypes = map[string]bool{
+	"channel_join":  true,
+	"channel_leave": true,
+	"group_join":    true,
+	"group_leave":   true,
+}
+
+// newIngestionFilter identifies the bot behind the Slack token with auth.test and
+// bots.info. Lookup failures are logged and leave the own-ID checks partially empty.
+func newIngestionFilter(api *slack.Client, config *Config, focus string, logger *zap.Logger) ingestionFilter {
+	filter := ingestionFilter{
+		IncludeBots:    config.IngestBotMessages,
+		ExcludedAppIDs: make(map[string]bool),
+		MinChars:       config.MinMessageChars,
+		SkipEmojiOnly:  config.SkipEmojiOnly,
+		SkipJoinLeave:  config.SkipJoinLeave,
+		Signals:        config.ReactionSignals,
+		ReactionBoost:  config.ReactionPriorityThreshold,
+		Skipped:        make(map[string]int),
+	}
+	for _, id := range config.ExcludedAppIDs {
+		filter.ExcludedAppIDs[id] = true
+	}
+	allow := config.AuthorAllow[strings.ToLower(focus)]
+	deny := config.AuthorDeny[strings.ToLower(focus)]
+	if len(allow)+len(deny) > 0 {
+		handles := resolveHandles(api, append(append([]string{}, allow...), deny...), logger)
+		filter.AllowAuthors = authorSet(allow, handles)
+		filter.DenyAuthors = authorSet(deny, handles)
+	}
+
+	auth, err := api.AuthTest()
+	if err != nil {
+		logger.Warn("Failed to identify Slack bot with auth.test; own posts are excluded by bot flag only", zap.Error(err))
+		return filter
+	}
+	filter.OwnUserID = auth.UserID
+	filter.OwnBotID = auth.BotID
+
+	if auth.BotID != "" {
+		bot, err := api.GetBotInfo(auth.BotID)
+		if err != nil {
+			logger.Warn("Failed to look up Slack app ID", zap.String("bot_id", auth.BotID), zap.Error(err))
+		} else {
+			filter.OwnAppID = bot.AppID
+		}
+	}
+
+	logger.Debug("Identified Slack bot for self-exclusion",
+		zap.String("user_id", filter.OwnUserID),
+		zap.String("bot_id", filter.OwnBotID),
+		zap.String("app_id", filter.OwnAppID))
+	return filter
+}
+
+// excludes reports whether a message was posted by shinbun itself or by an
+// excluded (or, unless bots are included, any) bot.
+func (f ingestionFilter) excludes(msg slack.Message) bool {
+	appID := ""
+	if msg.BotProfile != nil {
+		appID = msg.BotProfile.AppID
+	}
+
+	if f.OwnUserID != "" && msg.User == f.OwnUserID {
+		return true
+	}
+	if f.OwnBotID != "" && msg.BotID == f.OwnBotID {
+		return true
+	}
+	if f.OwnAppID != "" && appID == f.OwnAppID {
+		return true
+	}
+
+	if msg.BotID == "" {
+		return false
+	}
+	return !f.IncludeBots || f.ExcludedAppIDs[appID] || f.ExcludedAppIDs[msg.BotID]
+}
+
+// excludesAuthor applies the focus's author deny and allow lists.
+func (f ingestionFilter) excludesAuthor(msg slack.Message) bool {
+	if len(f.AllowAuthors) == 0 && len(f.DenyAuthors) == 0 {
+		return false
+	}
+	keys := []string{msg.User, msg.BotID, "@" + strings.ToLower(msg.Username)}
+	if msg.BotProfile != nil {
+		keys = append(keys, msg.BotProfile.AppID, "@"+strings.ToLower(msg.BotProfile.Name))
+	}
+
+	allowed := len(f.AllowAuthors) == 0
+	for _, key := range keys {
+		if key == "" || key == "@" {
+			continue
+		}
+		if f.DenyAuthors[key] {
+			return true
+		}
+		if f.AllowAuthors[key] {
+			allowed = true
+		}
+	}
+	return !allowed
+}
+
+// resolveHandles maps the @handles among entries to user IDs with users.list
+// (users:read scope). Handles that don't resolve still match bot names.
+func resolveHandles(api *slack.Client, entries []string, logger *zap.Logger) map[string]string {
+	handles := make(map[string]string)
+	needed := false
+	for _, e := range entries {
+		needed = needed || strings.HasPrefix(e, "@")
+	}
+	if !needed {
+		return handles
+	}
+
+	users, err := api.GetUsers()
+	if err != nil {
+		logger.Warn("Failed to list Slack users; @handles in author lists only match bot names", zap.Error(err))
+		return handles
+	}
+	for _, u := range users {
+		handles["@"+strings.ToLower(u.Name)] = u.ID
+		if u.Profile.DisplayName != "" {
+			handles["@"+strings.ToLower(u.Profile.DisplayName)] = u.ID
+		}
+	}
+	return handles
+}
+
+func authorSet(entries []string, handles map[string]string) map[string]bool {
+	set := make(map[string]bool)
+	for _, e := range entries {
+		if !strings.HasPrefix(e, "@") {
+			set[e] = true
+			continue
+		}
+		handle := strings.ToLower(e)
+		set[handle] = true
+		if id, ok := handles[handle]; ok {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// lowQuality returns why a message is too low in content to be worth
+// summarizing ("join_leave", "emoji_only" or "too_short"), or "" to keep it.
+func (f ingestionFilter) lowQuality(msg slack.Message) string {
+	if f.SkipJoinLeave && joinLeaveSubtypes[msg.SubType] {
+		return "join_leave"
+	}
+	text := strings.TrimSpace(msg.Text)
+	if f.SkipEmojiOnly && text != "" && isEmojiOnly(text) {
+		return "emoji_only"
+	}
+	if f.MinChars > 0 && len([]rune(text)) < f.MinChars && len(msg.Files) == 0 && len(msg.Attachments) == 0 {
+		return "too_short"
+	}
+	return ""
+}
+
+// isEmojiOnly reports whether text is nothing but emoji shortcodes, Unicode
+// emoji and whitespace.
+func isEmojiOnly(text string) bool {
+	for _, r := range emojiCodePattern.ReplaceAllString(text, "") {
+		switch {
+		case unicode.IsSpace(r), unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r):
+		case r == '\u200d' || r == '\ufe0f': // zero-width joiner, emoji presentation selector
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package shinbun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// focusProfile is one focus defined in FOCUS_CONFIG: its channels and,
+// optionally, its own prompt, schedule, recipients, author filters, scoring
+// weights and channel instructions.
+type focusProfile struct {
+	Name     string   `yaml:"name"`
+	Channels []string `yaml:"channels"`
+	// Prompt names the built-in prompt to use ("default" or "support");
+	// PromptFile is a prompt template of the focus's own instead
+	Prompt       string `yaml:"prompt"`
+	PromptFile   string `yaml:"prompt_file"`
+	SystemPrompt string `yaml:"system_prompt"`
+	Schedule     string `yaml:"schedule"`
+	Email        struct {
+		To      []string `yaml:"to"`
+		CC      []string `yaml:"cc"`
+		BCC     []string `yaml:"bcc"`
+		ReplyTo string   `yaml:"reply_to"`
+	} `yaml:"email"`
+	Authors struct {
+		Allow []string `yaml:"allow"`
+		Deny  []string `yaml:"deny"`
+	} `yaml:"authors"`
+	// Weights replace the SCORE_WEIGHTS, AUTHOR_WEIGHTS, CHANNEL_WEIGHTS and
+	// CATEGORY_WEIGHTS entries they name for this focus
+	Weights struct {
+		Scores     map[string]float64 `yaml:"scores"`
+		Authors    map[string]float64 `yaml:"authors"`
+		Channels   map[string]float64 `yaml:"channels"`
+		Categories map[string]float64 `yaml:"categories"`
+	} `yaml:"weights"`
+	// Instructions replace the CHANNEL_INSTRUCTION_ entries of the channels
+	// they name for this focus
+	Instructions map[string]string `yaml:"instructions"`
+
+	prompt *focusPrompt
+}
+
+// focusPrompt is the prompt a profile configures. Builtin picks one of the
+// promptFocuses; Template, when set, renders the user prompt instead.
+type focusPrompt struct {
+	Builtin  string
+	System   string
+	Template *template.Template
+}
+
+// promptTemplateData is what a focus's prompt template is rendered with.
+type promptTemplateData struct {
+	Focus string
+	// Now is the run's time, e.g. "2025-01-06 09:00 JST"
+	Now string
+	// Instructions are the built-in notes on documentation updates and code
+	// excerpts, when the messages have any
+	Instructions string
+	// Context is the calendar and channel background, when there is any
+	Context  string
+	Messages string
+}
+
+// loadFocusProfiles reads the focus profiles from the YAML file at path,
+// keyed by lowercase focus name. An empty path defines none.
+func loadFocusProfiles(path string) (map[string]*focusProfile, error) {
+	profiles := make(map[string]*focusProfile)
+	if path == "" {
+		return profiles, nil
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Focuses map[string]*focusProfile `yaml:"focuses"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, profile := range file.Focuses {
+		focus := strings.ToLower(strings.TrimSpace(name))
+		if profile == nil || focus == "" {
+			return nil, fmt.Errorf("focus %q has no settings", name)
+		}
+		if _, ok := profiles[focus]; ok {
+			return nil, fmt.Errorf("focus %q is defined twice", focus)
+		}
+		if err := profile.validate(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("focus %s: %v", focus, err)
+		}
+		profiles[focus] = profile
+	}
+	return profiles, nil
+}
+
+// validate checks the profile and loads its prompt, resolving a relative
+// prompt_file against dir.
+func (p *focusProfile) validate(dir string) error {
+	var channels []string
+	for _, c := range p.Channels {
+		if c = strings.TrimSpace(c); c != "" {
+			channels = append(channels, c)
+		}
+	}
+	if len(channels) == 0 {
+		return errors.New("channels is required")
+	}
+	p.Channels = channels
+
+	if p.Schedule != "" {
+		if _, err := parseCron(p.Schedule); err != nil {
+			return fmt.Errorf("schedule %q: %v", p.Schedule, err)
+		}
+	}
+
+	if p.Prompt != "" && !slices.Contains(promptFocuses, p.Prompt) {
+		return fmt.Errorf("prompt must be one of %s", strings.Join(promptFocuses, ", "))
+	}
+	if p.Prompt != "" && p.PromptFile != "" {
+		return errors.New("prompt and prompt_file are mutually exclusive")
+	}
+	if p.Prompt == "" && p.PromptFile == "" && p.SystemPrompt == "" {
+		return nil
+	}
+	p.prompt = &focusPrompt{Builtin: p.Prompt, System: p.SystemPrompt}
+	if p.PromptFile == "" {
+		return nil
+	}
+	path := p.PromptFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return fmt.Errorf("prompt_file: %v", err)
+	}
+	// Fail now rather than mid-run on a misspelled field
+	if err := tmpl.Execute(io.Discard, promptTemplateData{}); err != nil {
+		return fmt.Errorf("prompt_file: %v", err)
+	}
+	p.prompt.Template = tmpl
+	return nil
+}
+
+// applyFocusProfiles adds the profiles' names, schedules, recipients and
+// author filters to the per-focus settings, replacing those set by
+// environment variables for the same focus.
+func (c *Config) applyFocusProfiles(profiles map[string]*focusProfile) {
+	c.FocusProfiles = profiles
+	for focus, profile := range profiles {
+		if profile.Name != "" {
+			c.DigestNames[focus] = profile.Name
+		}
+		if profile.Schedule != "" {
+			c.Schedules[focus], _ = parseCron(profile.Schedule)
+		}
+		email := profile.Email
+		if email.To != nil || email.CC != nil || email.BCC != nil || email.ReplyTo != "" {
+			c.EmailOverrides[focus] = emailAddressing{To: email.To, CC: email.CC, BCC: email.BCC, ReplyTo: strings.TrimSpace(email.ReplyTo)}
+		}
+		if profile.Authors.Allow != nil {
+			c.AuthorAllow[focus] = profile.Authors.Allow
+		}
+		if profile.Authors.Deny != nil {
+			c.AuthorDeny[focus] = profile.Authors.Deny
+		}
+	}
+}
+
+// useFocusWeights applies the focus profile's scoring weights and channel
+// instructions for the run.
+func (c *Config) useFocusWeights(focus string) {
+	profile, ok := c.FocusProfiles[strings.ToLower(focus)]
+	if !ok {
+		return
+	}
+	c.ScoreWeights = withWeights(c.ScoreWeights, profile.Weights.Scores)
+	c.AuthorWeights = withWeights(c.AuthorWeights, profile.Weights.Authors)
+	c.ChannelWeights = withWeights(c.ChannelWeights, profile.Weights.Channels)
+	c.CategoryWeights = withWeights(c.CategoryWeights, profile.Weights.Categories)
+	c.ChannelInstructions = withInstructions(c.ChannelInstructions, profile.Instructions)
+}
+
+// withWeights returns a copy of weights with overrides applied, keyed by
+// lowercase name like the parsed settings.
+func withWeights(weights, overrides map[string]float64) map[string]float64 {
+	if len(overrides) == 0 {
+		return weights
+	}
+	merged := make(map[string]float64, len(weights)+len(overrides))
+	for name, w := range weights {
+		merged[name] = w
+	}
+	for name, w := range overrides {
+		merged[strings.ToLower(strings.TrimSpace(name))] = w
+	}
+	return merged
+}
+
+// focusPromptFor returns the prompt the focus's profile configures, or nil
+// for the built-in prompt of the focus.
+func (c *Config) focusPromptFor(focus string) *focusPrompt {
+	if profile, ok := c.FocusProfiles[strings.ToLower(focus)]; ok {
+		return profile.prompt
+	}
+	return nil
+}
+
+// render renders the prompt template, falling back to prompt, the built-in
+// one, if it fails.
+func (fp *focusPrompt) render(data promptTemplateData, prompt string) string {
+	var sb strings.Builder
+	if err := fp.Template.Execute(&sb, data); err != nil {
+		return prompt
+	}
+	return sb.String()
+}
+
+// configuredChannels are the channels of every focus, without duplicates.
+func (c *Config) configuredChannels() []string {
+	var channels []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, channel := range list {
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+	add(c.DefaultFocusChannels)
+	add(c.SupportFocusChannels)
+	for _, focus := range sortedKeys(c.FocusProfiles) {
+		add(c.FocusProfiles[focus].Channels)
+	}
+	return channels
+}
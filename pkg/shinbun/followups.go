@@ -0,0 +1,295 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	// actionItemMaxAge is how long an action item without a completion signal
+	// is followed up before it is let go.
+	actionItemMaxAge = 30 * 24 * time.Hour
+	// reminderInterval is how often an owner is reminded of their outstanding
+	// action items.
+	reminderInterval = 7 * 24 * time.Hour
+)
+
+// defaultActionItemPatterns are the phrases that mark a message as raising an
+// action item; ACTION_ITEM_PATTERNS replaces them.
+var defaultActionItemPatterns = []string{"action item", "todo", "to-do", "follow up on", "follow-up:", "can you", "could you", "i'll", "i will", "next step"}
+
+// actionItemDonePatterns mark a thread reply or a later mention of a linked
+// ticket as completing an action item.
+var actionItemDonePatterns = []string{"done", "completed", "finished", "fixed", "closed", "merged", "shipped", "resolved", "完了", "対応済"}
+
+// actionItemDoneReactions complete an action item when added to its message,
+// besides the reactions REACTION_SIGNALS maps to resolved.
+var actionItemDoneReactions = map[string]bool{"white_check_mark": true, "heavy_check_mark": true, "ballot_box_with_check": true}
+
+// actionItem is an action item raised in a Slack message. Owner is the user
+// it was asked of, or its author, as a Slack user ID. Extracted items also
+// have a Description, may name an OwnerName who isn't a Slack user, and may
+// have a DueHint.
+type actionItem struct {
+	Link        string
+	Channel     string
+	TS          string
+	Owner       string
+	OwnerName   string
+	Text        string
+	Description string
+	DueHint     string
+	PostedAt    time.Time
+	RemindedAt  sql.NullTime
+}
+
+// summary is how an action item is listed: its description, or an excerpt of
+// its message.
+func (item actionItem) summary(n int) string {
+	if item.Description != "" {
+		return excerpt(item.Description, n)
+	}
+	return excerpt(item.Text, n)
+}
+
+// detectActionItems returns the Slack messages among updates that raise an
+// action item. A message that mentions someone is taken as asking them.
+func detectActionItems(updates []Update, patterns []string) []actionItem {
+	var items []actionItem
+	for _, u := range updates {
+		if u.Source != "" || u.Link == "" || !containsAny(u.Text, patterns) || containsAny(u.Text, actionItemDonePatterns) {
+			continue
+		}
+		posted, err := formatTimestamp(u.Timestamp)
+		if err != nil {
+			continue
+		}
+		owner := u.Author
+		if len(u.Mentions) > 0 {
+			owner = u.Mentions[0]
+		}
+		items = append(items, actionItem{Link: u.Link, Channel: u.Channel, TS: u.Timestamp, Owner: owner, Text: u.Text, PostedAt: posted})
+	}
+	return items
+}
+
+// trackActionItems records the action items raised in updates, checks the
+// ones from previous digests for a completion signal, reminds their owners
+// when ACTION_ITEM_REMINDERS is set, and renders the Still Outstanding
+// section. It returns "" when nothing is outstanding.
+func (p *pipeline) trackActionItems(updates []Update, since time.Time) string {
+	config, db, logger := p.config, p.db, p.logger
+
+	for _, item := range detectActionItems(updates, config.ActionItemPatterns) {
+		_, err := db.Exec(`
+			INSERT INTO action_items (link, channel, ts, owner, text, posted_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+			ON CONFLICT (link) DO NOTHING`,
+			item.Link, item.Channel, item.TS, item.Owner, item.Text, item.PostedAt)
+		if err != nil {
+			logger.Error("Failed to record action item", zap.String("link", item.Link), zap.Error(err))
+		}
+	}
+
+	channels := make(map[string]bool)
+	for _, c := range p.channels {
+		channels[normalizeChannel(c)] = true
+	}
+	previous, err := outstandingActionItems(db, since, config.Clock.Now().Add(-actionItemMaxAge))
+	if err != nil {
+		logger.Error("Failed to load outstanding action items", zap.Error(err))
+		return ""
+	}
+	names, err := channelNames(db)
+	if err != nil {
+		logger.Warn("Failed to load channel names, checking action items by message only", zap.Error(err))
+	}
+	channelIDs := make(map[string]string)
+	for id, name := range names {
+		channelIDs[name] = id
+	}
+
+	var outstanding []actionItem
+	for _, item := range previous {
+		if !channels[normalizeChannel(item.Channel)] {
+			continue
+		}
+		if reason := p.actionItemDone(item, channelIDs[normalizeChannel(item.Channel)], updates); reason != "" {
+			if _, err := db.Exec(`UPDATE action_items SET done_at = $2, done_reason = $3 WHERE link = $1`, item.Link, config.Clock.Now(), reason); err != nil {
+				logger.Error("Failed to mark action item done", zap.String("link", item.Link), zap.Error(err))
+			}
+			logger.Debug("Action item done", zap.String("link", item.Link), zap.String("reason", reason))
+			continue
+		}
+		outstanding = append(outstanding, item)
+	}
+	logger.Info("Checked action items", zap.Int("previous", len(previous)), zap.Int("outstanding", len(outstanding)))
+
+	if config.ActionItemReminders && p.flags.Sample == 0 {
+		p.remindOwners(outstanding)
+	}
+	return p.outstandingSection(outstanding)
+}
+
+// outstandingActionItems returns the action items posted in [from, before)
+// that weren't done at the start of this run.
+func outstandingActionItems(db *sql.DB, before, from time.Time) ([]actionItem, error) {
+	rows, err := db.Query(`
+		SELECT link, channel, ts, COALESCE(owner, ''), COALESCE(owner_name, ''), text, COALESCE(description, ''), COALESCE(due_hint, ''), posted_at, reminded_at
+		FROM action_items
+		WHERE posted_at >= $1 AND posted_at < $2 AND done_at IS NULL
+		ORDER BY posted_at, link`, from, before)
+	if err != nil {
+		return nil, fmt.Errorf("error querying action items: %v", err)
+	}
+	defer rows.Close()
+
+	var items []actionItem
+	for rows.Next() {
+		var item actionItem
+		if err := rows.Scan(&item.Link, &item.Channel, &item.TS, &item.Owner, &item.OwnerName, &item.Text, &item.Description, &item.DueHint, &item.PostedAt, &item.RemindedAt); err != nil {
+			return nil, fmt.Errorf("error scanning action item row: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// actionItemDone returns why an action item is complete, or "" when it
+// isn't: a done reaction on its message, a thread reply from its owner or
+// saying it is done, or a later message saying a ticket it links is done.
+// Slack is only asked when the channel ID is known.
+func (p *pipeline) actionItemDone(item actionItem, channelID string, updates []Update) string {
+	for _, id := range extractTicketIDs(item.Text) {
+		for _, u := range updates {
+			posted, err := formatTimestamp(u.Timestamp)
+			if err != nil || !posted.After(item.PostedAt) {
+				continue
+			}
+			if slices.Contains(extractTicketIDs(u.Text), id) && containsAny(u.Text, actionItemDonePatterns) {
+				return "ticket " + id + " closed"
+			}
+		}
+	}
+	for _, u := range updates {
+		if u.Link == item.Link && u.Status == statusResolved {
+			return "reaction"
+		}
+	}
+	if channelID == "" {
+		return ""
+	}
+
+	reactions, err := p.api.GetReactions(slack.NewRefToMessage(channelID, item.TS), slack.GetReactionsParameters{})
+	if err != nil {
+		p.logger.Warn("Failed to get action item reactions", zap.String("link", item.Link), zap.Error(err))
+	}
+	for _, r := range reactions {
+		name, _, _ := strings.Cut(r.Name, "::")
+		if actionItemDoneReactions[name] || p.config.ReactionSignals[name] == statusResolved {
+			return "reaction"
+		}
+	}
+
+	replies, _, _, err := p.api.GetConversationReplies(&slack.GetConversationRepliesParameters{ChannelID: channelID, Timestamp: item.TS})
+	if err != nil {
+		p.logger.Warn("Failed to get action item replies", zap.String("link", item.Link), zap.Error(err))
+		return ""
+	}
+	for _, reply := range replies {
+		if reply.Timestamp == item.TS {
+			continue
+		}
+		if (item.Owner != "" && reply.User == item.Owner) || containsAny(reply.Text, actionItemDonePatterns) {
+			return "thread reply"
+		}
+	}
+	return ""
+}
+
+// ownerName is how an action item's owner is shown: @name, or "" when
+// unknown.
+func (p *pipeline) ownerName(owner string) string {
+	if owner == "" {
+		return ""
+	}
+	if name := p.users.name(owner); name != "" {
+		return "@" + name
+	}
+	return "<@" + owner + ">"
+}
+
+func (p *pipeline) outstandingSection(items []actionItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	now := p.config.Clock.Now()
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Still Outstanding\n\nAction items from previous digests with no sign of completion yet:\n\n")
+	for _, item := range items {
+		owner := ""
+		if name := p.ownerName(item.Owner); name != "" {
+			owner = " " + name + ":"
+		} else if item.OwnerName != "" {
+			owner = " " + item.OwnerName + ":"
+		}
+		days := int(now.Sub(item.PostedAt).Hours() / 24)
+		due := ""
+		if item.DueHint != "" {
+			due = ", due " + item.DueHint
+		}
+		sb.WriteString(fmt.Sprintf("- #%s%s [%s](%s) (%d days ago%s)\n", strings.TrimPrefix(item.Channel, "#"), owner, item.summary(160), item.Link, days, due))
+	}
+	return sb.String()
+}
+
+// remindOwners sends each owner of outstanding action items a direct message
+// listing them, at most once per reminderInterval. Dry runs print the
+// reminders instead.
+func (p *pipeline) remindOwners(items []actionItem) {
+	now := p.config.Clock.Now()
+	byOwner := make(map[string][]actionItem)
+	for _, item := range items {
+		if item.Owner == "" {
+			continue
+		}
+		if item.RemindedAt.Valid && now.Sub(item.RemindedAt.Time) < reminderInterval {
+			continue
+		}
+		byOwner[item.Owner] = append(byOwner[item.Owner], item)
+	}
+
+	owners := sortedKeys(byOwner)
+	sort.Strings(owners)
+	for _, owner := range owners {
+		var sb strings.Builder
+		sb.WriteString("These action items are still open. Reply in the thread or react with :white_check_mark: once they are done:\n")
+		for _, item := range byOwner[owner] {
+			sb.WriteString(fmt.Sprintf("• <%s|%s> (#%s)\n", item.Link, escapeMrkdwn(item.summary(120)), strings.TrimPrefix(item.Channel, "#")))
+		}
+		text := sb.String()
+
+		if p.flags.DryRun {
+			p.flags.Output.event("reminder", map[string]any{"owner": owner, "text": text},
+				fmt.Sprintf("\n--- DRY RUN: Reminder to %s ---\n%s", p.ownerName(owner), text))
+			continue
+		}
+		if _, _, err := p.api.PostMessage(owner, slack.MsgOptionText(text, false), slack.MsgOptionDisableLinkUnfurl()); err != nil {
+			p.logger.Error("Failed to send action item reminder", zap.String("owner", owner), zap.Error(err))
+			continue
+		}
+		for _, item := range byOwner[owner] {
+			if _, err := p.db.Exec(`UPDATE action_items SET reminded_at = $2 WHERE link = $1`, item.Link, now); err != nil {
+				p.logger.Error("Failed to record reminder", zap.String("link", item.Link), zap.Error(err))
+			}
+		}
+		p.logger.Info("Sent action item reminder", zap.String("owner", owner), zap.Int("items", len(byOwner[owner])))
+	}
+}
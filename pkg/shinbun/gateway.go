@@ -0,0 +1,123 @@
+package shinbun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// parseHeaders parses "Name=value" lists such as
+// "X-Gateway-Team=digest,X-Api-Key=secret". Names are canonicalized.
+func parseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, entry := range splitList(value) {
+		name, val, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("invalid entry %q, expected Name=value", entry)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// parseModelAliases parses "model=alias" lists such as
+// "gpt-4o-mini=corp-small,text-embedding-3-small=corp-embed".
+func parseModelAliases(value string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, entry := range splitList(value) {
+		model, alias, ok := strings.Cut(entry, "=")
+		model, alias = strings.TrimSpace(model), strings.TrimSpace(alias)
+		if !ok || model == "" || alias == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected model=alias", entry)
+		}
+		aliases[model] = alias
+	}
+	return aliases, nil
+}
+
+// openAIModelID is the name model is requested by, its alias at the gateway
+// if it has one.
+func (c *Config) openAIModelID(model string) string {
+	if alias, ok := c.OpenAIModelAliases[model]; ok {
+		return alias
+	}
+	return model
+}
+
+// gatewayTransport adapts OpenAI requests to an LLM gateway: it adds the
+// gateway's headers and requests models by their aliases. Everything else in
+// shinbun, prices and tokenizers included, keeps using the real model names.
+type gatewayTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	aliases map[string]string
+	// bearer is false without an API key, when the gateway authenticates by
+	// its own headers
+	bearer bool
+}
+
+// withGateway wraps client for the configured gateway, or returns it as is
+// when there is nothing to adapt.
+func withGateway(client *http.Client, config *Config) *http.Client {
+	if len(config.OpenAIHeaders) == 0 && len(config.OpenAIModelAliases) == 0 && config.OpenAIToken != "" {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &gatewayTransport{
+		base:    base,
+		headers: config.OpenAIHeaders,
+		aliases: config.OpenAIModelAliases,
+		bearer:  config.OpenAIToken != "",
+	}
+	return &wrapped
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if !t.bearer {
+		req.Header.Del("Authorization")
+	}
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	if len(t.aliases) > 0 && req.Body != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = t.aliasModel(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+	}
+	return t.base.RoundTrip(req)
+}
+
+// aliasModel replaces the request's model with its alias; bodies without an
+// aliased model are passed on untouched.
+func (t *gatewayTransport) aliasModel(body []byte) []byte {
+	var request map[string]json.RawMessage
+	var model string
+	if json.Unmarshal(body, &request) != nil || json.Unmarshal(request["model"], &model) != nil {
+		return body
+	}
+	alias, ok := t.aliases[model]
+	if !ok {
+		return body
+	}
+	request["model"], _ = json.Marshal(alias)
+	aliased, err := json.Marshal(request)
+	if err != nil {
+		return body
+	}
+	return aliased
+}
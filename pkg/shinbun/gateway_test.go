@@ -0,0 +1,135 @@
+package shinbun
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"x-gateway-team=digest, X-API-KEY = secret ", map[string]string{"X-Gateway-Team": "digest", "X-Api-Key": "secret"}, false},
+		{"X-Token=a=b", map[string]string{"X-Token": "a=b"}, false},
+		{"X-Empty=", map[string]string{"X-Empty": ""}, false},
+		{"X-Gateway-Team", nil, true},
+		{"=value", nil, true},
+		{"X Team=digest", nil, true},
+		{"X-Team:=digest", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseHeaders(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHeaders(%q) error = %v, want error: %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeaders(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseModelAliases(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"gpt-4o-mini=corp-small, text-embedding-3-small = corp-embed", map[string]string{"gpt-4o-mini": "corp-small", "text-embedding-3-small": "corp-embed"}, false},
+		{"gpt-4o-mini", nil, true},
+		{"gpt-4o-mini=", nil, true},
+		{"=corp-small", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseModelAliases(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseModelAliases(%q) error = %v, want error: %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseModelAliases(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayAliasModel(t *testing.T) {
+	transport := &gatewayTransport{aliases: map[string]string{"gpt-4o-mini": "corp-small"}}
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"aliased", `{"model":"gpt-4o-mini","temperature":0.2}`, `{"model":"corp-small","temperature":0.2}`},
+		{"no alias", `{"model":"gpt-4o","temperature":0.2}`, `{"model":"gpt-4o","temperature":0.2}`},
+		{"no model", `{"input":"text"}`, `{"input":"text"}`},
+		{"model isn't a string", `{"model":4}`, `{"model":4}`},
+		{"not JSON", `model=gpt-4o-mini`, `model=gpt-4o-mini`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(transport.aliasModel([]byte(tt.body))); got != tt.want {
+				t.Errorf("aliasModel(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// roundTripFunc records the request a transport passes on.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestGatewayTransport(t *testing.T) {
+	var sent *http.Request
+	var sentBody string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		body, _ := io.ReadAll(req.Body)
+		sentBody = string(body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	config := &Config{
+		OpenAIHeaders:      map[string]string{"X-Gateway-Team": "digest"},
+		OpenAIModelAliases: map[string]string{"gpt-4o-mini": "corp-small"},
+	}
+	client := withGateway(&http.Client{Transport: base}, config)
+
+	body := `{"model":"gpt-4o-mini"}`
+	req, _ := http.NewRequest(http.MethodPost, "https://gateway.example.com/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := sent.Header.Get("X-Gateway-Team"); got != "digest" {
+		t.Errorf("X-Gateway-Team = %q, want digest", got)
+	}
+	if got := sent.Header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want none without an API key", got)
+	}
+	if want := `{"model":"corp-small"}`; sentBody != want || sent.ContentLength != int64(len(want)) {
+		t.Errorf("sent %s (%d bytes), want %s", sentBody, sent.ContentLength, want)
+	}
+	if got := req.Header.Get("X-Gateway-Team"); got != "" {
+		t.Errorf("the caller's request was modified")
+	}
+
+	config.OpenAIToken = "sk-test"
+	config.OpenAIHeaders, config.OpenAIModelAliases = nil, nil
+	plain := &http.Client{}
+	if withGateway(plain, config) != plain {
+		t.Errorf("client wrapped with nothing to adapt")
+	}
+}
@@ -0,0 +1,86 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	hookPreRun       = "pre_run"
+	hookPostSummary  = "post_summary"
+	hookPostDelivery = "post_delivery"
+)
+
+// hookContext is the JSON a hook command gets on stdin. Fields that don't
+// apply to a hook are left out.
+type hookContext struct {
+	Hook       string            `json:"hook"`
+	Focus      string            `json:"focus"`
+	Time       time.Time         `json:"time"`
+	DryRun     bool              `json:"dry_run"`
+	Channels   []string          `json:"channels,omitempty"`
+	Summary    string            `json:"summary,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+	Issue      int               `json:"issue,omitempty"`
+	ArchiveURL string            `json:"archive_url,omitempty"`
+	Delivery   map[string]string `json:"delivery,omitempty"`
+}
+
+// hookCommand returns the command configured for the hook, or "".
+func (c *Config) hookCommand(hook string) string {
+	switch hook {
+	case hookPreRun:
+		return c.HookPreRun
+	case hookPostSummary:
+		return c.HookPostSummary
+	case hookPostDelivery:
+		return c.HookPostDelivery
+	}
+	return ""
+}
+
+// runHook runs the hook's command, if one is configured, through sh with the
+// context as JSON on stdin. Its output goes to the log. A non-zero exit or a
+// run longer than HOOK_TIMEOUT is an error.
+func runHook(config *Config, hctx hookContext, logger *zap.Logger) error {
+	command := config.hookCommand(hctx.Hook)
+	if command == "" {
+		return nil
+	}
+	input, err := json.Marshal(hctx)
+	if err != nil {
+		return fmt.Errorf("error encoding %s hook context: %v", hctx.Hook, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.HookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "SHINBUN_HOOK="+hctx.Hook, "SHINBUN_FOCUS="+hctx.Focus)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait on children of the shell that hold on to its output
+	cmd.WaitDelay = time.Second
+
+	logger.Info("Running hook", zap.String("hook", hctx.Hook), zap.String("command", command))
+	err = cmd.Run()
+	if out := strings.TrimSpace(output.String()); out != "" {
+		logger.Info("Hook output", zap.String("hook", hctx.Hook), zap.String("output", out))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s hook timed out after %s", hctx.Hook, config.HookTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %v", hctx.Hook, err)
+	}
+	return nil
+}
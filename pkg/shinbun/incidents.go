@@ -0,0 +1,389 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Incident states: opened when first seen, referenced once a later message
+// mentions it again, resolved when a resolution is seen.
+const (
+	incidentOpened     = "opened"
+	incidentReferenced = "referenced"
+	incidentResolved   = "resolved"
+)
+
+// defaultIncidentResolvedPatterns mark a message as resolving the incidents
+// it mentions; INCIDENT_RESOLVED_PATTERNS replaces them.
+var defaultIncidentResolvedPatterns = []string{"resolved", "mitigated", "recovered", "all clear", "back to normal", "fixed", "closed", "復旧", "解消"}
+
+// incidentSettings configure incident tracking.
+type incidentSettings struct {
+	// IDPrefixes are the ticket prefixes of incident IDs, e.g. INC
+	IDPrefixes []string
+	// MinPriority is the priority at which an alert without an incident ID
+	// opens an incident of its own
+	MinPriority      int
+	ResolvedPatterns []string
+}
+
+// incident is an incident as stored, keyed by its ID or, for an alert
+// without one, the alert's link.
+type incident struct {
+	ID             string
+	Channel        string
+	Link           string
+	Title          string
+	State          string
+	OpenedAt       time.Time
+	LastSeenAt     time.Time
+	Mentions       int
+	ResolvedAt     sql.NullTime
+	ResolutionLink string
+}
+
+// incidentSighting is a message that mentions, opens or resolves an incident.
+type incidentSighting struct {
+	ID       string
+	Update   Update
+	Posted   time.Time
+	Resolves bool
+}
+
+// detectIncidents returns what updates say about incidents: each mention of
+// an incident ID, and each urgent alert without one.
+func detectIncidents(updates []Update, s incidentSettings) []incidentSighting {
+	prefixes := make(map[string]bool)
+	for _, p := range s.IDPrefixes {
+		prefixes[strings.ToUpper(p)] = true
+	}
+	var sightings []incidentSighting
+	for _, u := range updates {
+		if u.Link == "" {
+			continue
+		}
+		posted, err := formatTimestamp(u.Timestamp)
+		if err != nil {
+			continue
+		}
+		text := u.Text
+		if u.Translation != "" {
+			text = u.Translation
+		}
+		resolves := u.Status == statusResolved || containsAny(text, s.ResolvedPatterns)
+
+		var ids []string
+		for _, id := range extractTicketIDs(u.Text) {
+			prefix, _, _ := strings.Cut(id, "-")
+			if prefixes[prefix] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 && u.Category == "alert" && u.Priority >= s.MinPriority && !resolves {
+			ids = []string{u.Link}
+		}
+		for _, id := range ids {
+			sightings = append(sightings, incidentSighting{ID: id, Update: u, Posted: posted, Resolves: resolves})
+		}
+	}
+	return sightings
+}
+
+// trackIncidents records the incidents updates open, mention and resolve,
+// resolves open alert incidents whose channel has since reported a
+// resolution, and renders the digest section. Open incidents stay in the
+// section, whatever their age, until they are resolved. It returns "" when
+// there is nothing to report.
+func trackIncidents(db *sql.DB, s incidentSettings, updates []Update, channels []string, since time.Time, logger *zap.Logger) string {
+	for _, sighting := range detectIncidents(updates, s) {
+		if err := recordIncidentSighting(db, sighting); err != nil {
+			logger.Error("Failed to record incident", zap.String("incident", sighting.ID), zap.Error(err))
+		}
+	}
+
+	inFocus := make(map[string]bool)
+	for _, c := range channels {
+		inFocus[normalizeChannel(c)] = true
+	}
+	for _, u := range updates {
+		inFocus[normalizeChannel(u.Channel)] = true
+	}
+	incidents, err := loadIncidents(db, since)
+	if err != nil {
+		logger.Error("Failed to load incidents", zap.Error(err))
+		return ""
+	}
+	var shown []incident
+	for _, inc := range incidents {
+		if !inFocus[normalizeChannel(inc.Channel)] {
+			continue
+		}
+		if !inc.ResolvedAt.Valid && strings.HasPrefix(inc.ID, "http") {
+			if link, at, ok := alertResolvedBy(inc, updates, s); ok {
+				if err := resolveIncident(db, inc.ID, link, at); err != nil {
+					logger.Error("Failed to mark incident resolved", zap.String("incident", inc.ID), zap.Error(err))
+				}
+				inc.State = incidentResolved
+				inc.ResolvedAt = sql.NullTime{Time: at, Valid: true}
+				inc.ResolutionLink = link
+			}
+		}
+		shown = append(shown, inc)
+	}
+	return incidentSection(shown, since)
+}
+
+// recordIncidentSighting adds the sighting's message to the incident,
+// opening the incident if it is new. The earliest message seen opens it, and
+// a resolving message resolves it. Messages already recorded are ignored, so
+// overlapping runs count each once.
+func recordIncidentSighting(db *sql.DB, s incidentSighting) error {
+	text := s.Update.Text
+	if s.Update.Translation != "" {
+		text = s.Update.Translation
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO incidents (id, channel, link, title, opened_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET channel = CASE WHEN EXCLUDED.opened_at < incidents.opened_at THEN EXCLUDED.channel ELSE incidents.channel END,
+		    link = CASE WHEN EXCLUDED.opened_at < incidents.opened_at THEN EXCLUDED.link ELSE incidents.link END,
+		    title = CASE WHEN EXCLUDED.opened_at < incidents.opened_at THEN EXCLUDED.title ELSE incidents.title END,
+		    opened_at = CASE WHEN EXCLUDED.opened_at < incidents.opened_at THEN EXCLUDED.opened_at ELSE incidents.opened_at END,
+		    last_seen_at = CASE WHEN EXCLUDED.last_seen_at > incidents.last_seen_at THEN EXCLUDED.last_seen_at ELSE incidents.last_seen_at END`,
+		s.ID, s.Update.Channel, s.Update.Link, excerpt(text, 160), s.Posted)
+	if err != nil {
+		return fmt.Errorf("error saving incident: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO incident_mentions (incident_id, link, posted_at) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, s.ID, s.Update.Link, s.Posted)
+	if err != nil {
+		return fmt.Errorf("error saving incident mention: %v", err)
+	}
+	if s.Resolves {
+		_, err = tx.Exec(`
+			UPDATE incidents SET resolved_at = $2, resolution_link = $3
+			WHERE id = $1 AND resolved_at IS NULL`, s.ID, s.Posted, s.Update.Link)
+		if err != nil {
+			return fmt.Errorf("error resolving incident: %v", err)
+		}
+	}
+	if err := updateIncidentState(tx, s.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateIncidentState derives the incident's state from its resolution and
+// mentions.
+func updateIncidentState(tx *sql.Tx, id string) error {
+	_, err := tx.Exec(`
+		UPDATE incidents SET state = CASE
+			WHEN resolved_at IS NOT NULL THEN $2
+			WHEN (SELECT COUNT(*) FROM incident_mentions WHERE incident_id = $1) > 1 THEN $3
+			ELSE $4 END
+		WHERE id = $1`, id, incidentResolved, incidentReferenced, incidentOpened)
+	if err != nil {
+		return fmt.Errorf("error updating incident state: %v", err)
+	}
+	return nil
+}
+
+// resolveIncident marks an open incident resolved at the given time, by the
+// message at link ("" when resolved by hand).
+func resolveIncident(db *sql.DB, id, link string, at time.Time) error {
+	result, err := db.Exec(`
+		UPDATE incidents SET resolved_at = $3, resolution_link = NULLIF($2, ''), state = $4
+		WHERE id = $1 AND resolved_at IS NULL`, id, link, at, incidentResolved)
+	if err != nil {
+		return fmt.Errorf("error resolving incident: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no open incident %s", id)
+	}
+	return nil
+}
+
+// alertResolvedBy returns the link and time of the message that resolves an
+// alert incident: the alert itself getting a resolved reaction, or a later
+// message in its channel that reports a resolution and names no incident ID
+// of its own.
+func alertResolvedBy(inc incident, updates []Update, s incidentSettings) (string, time.Time, bool) {
+	for _, u := range updates {
+		posted, err := formatTimestamp(u.Timestamp)
+		if err != nil {
+			continue
+		}
+		if u.Link == inc.Link {
+			if u.Status == statusResolved {
+				return u.Link, posted, true
+			}
+			continue
+		}
+		if normalizeChannel(u.Channel) != normalizeChannel(inc.Channel) || len(extractTicketIDs(u.Text)) > 0 {
+			continue
+		}
+		if posted.After(inc.OpenedAt) && (u.Status == statusResolved || containsAny(u.Text, s.ResolvedPatterns)) {
+			return u.Link, posted, true
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// loadIncidents returns the incidents that are open, or were opened or
+// resolved since the given time, oldest first.
+func loadIncidents(db *sql.DB, since time.Time) ([]incident, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.channel, i.link, i.title, i.state, i.opened_at, i.last_seen_at,
+		       (SELECT COUNT(*) FROM incident_mentions m WHERE m.incident_id = i.id),
+		       i.resolved_at, COALESCE(i.resolution_link, '')
+		FROM incidents i
+		WHERE i.resolved_at IS NULL OR i.resolved_at >= $1 OR i.opened_at >= $1
+		ORDER BY i.opened_at, i.id`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying incidents: %v", err)
+	}
+	defer rows.Close()
+
+	var incidents []incident
+	for rows.Next() {
+		var inc incident
+		if err := rows.Scan(&inc.ID, &inc.Channel, &inc.Link, &inc.Title, &inc.State, &inc.OpenedAt, &inc.LastSeenAt,
+			&inc.Mentions, &inc.ResolvedAt, &inc.ResolutionLink); err != nil {
+			return nil, fmt.Errorf("error scanning incident row: %v", err)
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// label names the incident by its ID, or "Alert" for an alert without one.
+func (inc incident) label() string {
+	if strings.HasPrefix(inc.ID, "http") {
+		return "Alert"
+	}
+	return inc.ID
+}
+
+func incidentSection(incidents []incident, since time.Time) string {
+	var opened, stillOpen, resolved []incident
+	for _, inc := range incidents {
+		switch {
+		case !inc.OpenedAt.Before(since):
+			opened = append(opened, inc)
+		case !inc.ResolvedAt.Valid:
+			stillOpen = append(stillOpen, inc)
+		default:
+			resolved = append(resolved, inc)
+		}
+	}
+	if len(opened) == 0 && len(stillOpen) == 0 && len(resolved) == 0 {
+		return ""
+	}
+
+	line := func(inc incident) string {
+		return fmt.Sprintf("**%s** · #%s: [%s](%s)", inc.label(), strings.TrimPrefix(inc.Channel, "#"), inc.Title, inc.Link)
+	}
+	resolution := func(inc incident) string {
+		if inc.ResolutionLink != "" {
+			return fmt.Sprintf(" ([resolved](%s))", inc.ResolutionLink)
+		}
+		return " (resolved)"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Incidents\n")
+	if len(opened) > 0 {
+		sb.WriteString("\n**Opened this period**\n\n")
+		for _, inc := range opened {
+			state := " (open)"
+			if inc.State == incidentReferenced {
+				state = fmt.Sprintf(" (open, %d mentions)", inc.Mentions)
+			}
+			if inc.ResolvedAt.Valid {
+				state = resolution(inc)
+			}
+			sb.WriteString(fmt.Sprintf("- %s%s\n", line(inc), state))
+		}
+	}
+	if len(stillOpen) > 0 {
+		sb.WriteString("\n**Still open from previous weeks**\n\n")
+		for _, inc := range stillOpen {
+			sb.WriteString(fmt.Sprintf("- %s — opened %s, last mentioned %s\n", line(inc), inc.OpenedAt.Format("2006-01-02"), inc.LastSeenAt.Format("2006-01-02")))
+		}
+	}
+	if len(resolved) > 0 {
+		sb.WriteString("\n**Resolved this period**\n\n")
+		for _, inc := range resolved {
+			sb.WriteString(fmt.Sprintf("- %s — opened %s%s\n", line(inc), inc.OpenedAt.Format("2006-01-02"), resolution(inc)))
+		}
+	}
+	return sb.String()
+}
+
+func runIncidentsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New("usage: shinbun incidents [--all] | incidents resolve <id>")
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(args) > 0 && args[0] == "resolve" {
+		if len(args) != 2 {
+			return usage
+		}
+		if err := resolveIncident(db, args[1], "", time.Now()); err != nil {
+			return err
+		}
+		logger.Info("Resolved incident", zap.String("incident", args[1]))
+		return nil
+	}
+
+	fs := flag.NewFlagSet("incidents", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Also list incidents resolved in the last 30 days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usage
+	}
+	since := time.Now()
+	if *all {
+		since = since.AddDate(0, 0, -30)
+	}
+	incidents, err := loadIncidents(db, since)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tCHANNEL\tOPENED\tLAST SEEN\tMENTIONS\tTITLE")
+	for _, inc := range incidents {
+		if inc.ResolvedAt.Valid && !*all {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t#%s\t%s\t%s\t%d\t%s\n", inc.ID, inc.State, strings.TrimPrefix(inc.Channel, "#"),
+			inc.OpenedAt.Format("2006-01-02 15:04"), inc.LastSeenAt.Format("2006-01-02 15:04"), inc.Mentions, excerpt(inc.Title, 60))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+package shinbun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// editionTitleMaxTokens bounds the LLM-generated edition title.
+const editionTitleMaxTokens = 30
+
+// digestIssue identifies one digest of a focus's newsletter.
+type digestIssue struct {
+	Number int
+	// Name is the newsletter's name, e.g. "Support Weekly"
+	Name string
+	// Title is the optional edition title
+	Title string
+	Date  time.Time
+}
+
+// issueNumber returns the issue number of the focus's digest for date: the
+// number it was archived with when the day is re-run, otherwise one more than
+// the focus's latest issue.
+func issueNumber(db *sql.DB, focus string, date time.Time) (int, error) {
+	var number int
+	err := db.QueryRow(`SELECT issue FROM digests WHERE focus = $1 AND digest_date = $2 AND issue IS NOT NULL`,
+		focus, date.Format("2006-01-02")).Scan(&number)
+	if err == nil {
+		return number, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("error looking up issue number: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COALESCE(MAX(issue), 0) + 1 FROM digests WHERE focus = $1`, focus).Scan(&number); err != nil {
+		return 0, fmt.Errorf("error computing issue number: %v", err)
+	}
+	return number, nil
+}
+
+// newsletterName returns DIGEST_NAME_<FOCUS>, or "<Focus> Digest".
+func (c *Config) newsletterName(focus string) string {
+	if name := c.DigestNames[strings.ToLower(focus)]; name != "" {
+		return name
+	}
+	if focus == "" {
+		return "Digest"
+	}
+	return strings.ToUpper(focus[:1]) + focus[1:] + " Digest"
+}
+
+// label is "Shinbun #42", or just "Shinbun" when the issue couldn't be numbered.
+func (i digestIssue) label() string {
+	if i.Number == 0 {
+		return "Shinbun"
+	}
+	return fmt.Sprintf("Shinbun #%d", i.Number)
+}
+
+// subject is the email subject and Slack title, e.g.
+// "Shinbun #42 — Support Weekly: Payments migration lands".
+func (i digestIssue) subject() string {
+	subject := i.label() + " — " + i.Name
+	if i.Title != "" {
+		subject += ": " + i.Title
+	}
+	return subject
+}
+
+// masthead is the markdown header put above the digest.
+func (i digestIssue) masthead() string {
+	header := fmt.Sprintf("**%s — %s** · %s\n\n", i.label(), i.Name, i.Date.Format("January 2, 2006"))
+	if i.Title != "" {
+		header += fmt.Sprintf("_%s_\n\n", i.Title)
+	}
+	return header
+}
+
+// generateEditionTitle asks the model for a short headline for the digest.
+func generateEditionTitle(client *openai.Client, model string, summary string) (string, error) {
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role: openai.ChatMessageRoleSystem,
+					Content: "You write headlines for an internal newsletter. Reply with one headline of at most eight words " +
+						"capturing the most important story of the issue. No quotes, no trailing punctuation, no emoji.",
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: summary,
+				},
+			},
+			MaxTokens:   editionTitleMaxTokens,
+			Temperature: 0.5,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("openai returned no choices")
+	}
+	title := strings.TrimSpace(resp.Choices[0].Message.Content)
+	title = strings.Trim(title, `"'`)
+	return strings.Join(strings.Fields(title), " "), nil
+}
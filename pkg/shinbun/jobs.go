@@ -0,0 +1,510 @@
+package shinbun
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/store"
+)
+
+// A staged run is carried out by jobs: one fetch job per channel, then, once
+// every fetch job has succeeded or died, a summarize job over the stored
+// messages, then a deliver job with the summary. Each job is retried with
+// backoff on its own, so a failed email doesn't mean fetching Slack again.
+const (
+	stageFetch     = "fetch"
+	stageSummarize = "summarize"
+	stageDeliver   = "deliver"
+)
+
+// A job that has failed JOB_MAX_ATTEMPTS times is dead: it stays in the
+// table, with its last error, until shinbun jobs retry requeues it.
+const (
+	jobBaseBackoff = 30 * time.Second
+	jobMaxBackoff  = time.Hour
+)
+
+type job struct {
+	ID       int
+	RunID    int
+	Stage    string
+	Channel  string
+	Payload  string
+	Attempts int
+}
+
+// deliverPayload is a deliver job's input. Outcome records the steps done so
+// far, so a retry doesn't archive or email the digest twice; Time pins the
+// digest date across retries.
+type deliverPayload struct {
+	Summary      string            `json:"summary"`
+	EditionTitle string            `json:"edition_title,omitempty"`
+	Time         time.Time         `json:"time"`
+	Outcome      map[string]string `json:"outcome,omitempty"`
+}
+
+func runJobsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New("usage: shinbun jobs next [--lease 1h] | jobs work [--lease 1h] [--poll 30s] | jobs list [--run id] [--dead] [--limit 50] | jobs retry <id>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "next":
+		fs := flag.NewFlagSet("jobs next", flag.ContinueOnError)
+		lease := fs.Duration("lease", time.Hour, "Take over jobs that have been running this long, whose worker presumably died")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := checkLease(*lease); err != nil {
+			return err
+		}
+		_, err := processNextJob(db, config, *lease, logger)
+		return err
+
+	case "work":
+		fs := flag.NewFlagSet("jobs work", flag.ContinueOnError)
+		lease := fs.Duration("lease", time.Hour, "Take over jobs that have been running this long, whose worker presumably died")
+		poll := fs.Duration("poll", 30*time.Second, "How long to wait when no job is due")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := checkLease(*lease); err != nil {
+			return err
+		}
+		for {
+			// A failed job has been recorded for retry; the worker carries on
+			found, err := processNextJob(db, config, *lease, logger)
+			if err != nil {
+				logger.Error("Job failed", zap.Error(err))
+			}
+			if !found {
+				time.Sleep(*poll)
+			}
+		}
+
+	case "list":
+		fs := flag.NewFlagSet("jobs list", flag.ContinueOnError)
+		runID := fs.Int("run", 0, "Only show the jobs of this run")
+		dead := fs.Bool("dead", false, "Only show dead jobs")
+		limit := fs.Int("limit", 50, "Number of most recent jobs to show")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return listJobs(db, *runID, *dead, *limit)
+
+	case "retry":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid job ID %q", args[1])
+		}
+		if err := retryJob(db, id); err != nil {
+			return err
+		}
+		fmt.Printf("requeued job %d\n", id)
+		return nil
+	}
+	return usage
+}
+
+func enqueueFetchJobs(db execer, runID int, channels []string) error {
+	for _, channel := range channels {
+		channel = strings.TrimSpace(channel)
+		if channel == "" {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO jobs (run_id, stage, channel) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			runID, stageFetch, channel); err != nil {
+			return fmt.Errorf("error queuing fetch job for %s: %v", channel, err)
+		}
+	}
+	return nil
+}
+
+// claimJob marks the oldest due job, or one whose lease has expired, as
+// running and returns it. It returns sql.ErrNoRows when there is none.
+func claimJob(db *sql.DB, lease time.Duration) (job, error) {
+	var j job
+	err := db.QueryRow(`
+		UPDATE jobs SET status = 'running', started_at = CURRENT_TIMESTAMP, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'queued' AND run_after <= CURRENT_TIMESTAMP)
+				OR (status = 'running' AND started_at < $1)
+			ORDER BY run_after, id
+			LIMIT 1
+			`+store.For(db).ForUpdate(true)+`)
+		RETURNING id, run_id, stage, COALESCE(channel, ''), COALESCE(payload, ''), attempts`,
+		time.Now().Add(-lease)).Scan(&j.ID, &j.RunID, &j.Stage, &j.Channel, &j.Payload, &j.Attempts)
+	return j, err
+}
+
+func loadRun(db *sql.DB, id int) (queuedRun, error) {
+	run := queuedRun{ID: id, Staged: true}
+	err := db.QueryRow(`SELECT focus, COALESCE(from_date, ''), COALESCE(as_of, ''), dry_run, no_llm FROM runs WHERE id = $1`, id).
+		Scan(&run.Focus, &run.FromDate, &run.AsOf, &run.DryRun, &run.NoLLM)
+	if err != nil {
+		return run, fmt.Errorf("error loading run %d: %v", id, err)
+	}
+	return run, nil
+}
+
+// jobBackoff is the wait before retrying a job that has failed attempts
+// times: 30s, doubling up to an hour.
+func jobBackoff(attempts int) time.Duration {
+	backoff := jobBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= jobMaxBackoff {
+			return jobMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// processNextJob runs one due job, if there is one, records its result and
+// queues the run's next stage. It reports whether there was a job, and fails
+// when the job does.
+func processNextJob(db *sql.DB, config *Config, lease time.Duration, logger *zap.Logger) (bool, error) {
+	j, err := claimJob(db, lease)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Info("No due jobs")
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error claiming job: %v", err)
+	}
+
+	logger = logger.With(zap.Int("job_id", j.ID), zap.Int("run_id", j.RunID), zap.String("stage", j.Stage))
+	logger.Info("Processing job", zap.String("channel", j.Channel), zap.Int("attempt", j.Attempts))
+
+	var next string
+	usage := newAPIUsage()
+	run, jobErr := loadRun(db, j.RunID)
+	if jobErr == nil {
+		stopLease := keepLease(db, "jobs", j.ID, lease, logger)
+		next, jobErr = executeJob(db, config, run, j, usage, logger)
+		stopLease()
+		usage.log(logger)
+	}
+
+	dead, err := finishJob(db, config, j, next, usage, jobErr)
+	if err != nil {
+		return true, err
+	}
+
+	// The run is over once it has been delivered, has nothing to deliver, or
+	// a stage it can't do without has died
+	runOver := jobErr == nil && (j.Stage == stageDeliver || (j.Stage == stageSummarize && next == ""))
+	if dead && j.Stage != stageFetch {
+		runOver = true
+	}
+	if runOver {
+		var runErr error
+		if dead {
+			runErr = fmt.Errorf("%s job %d dead: %v", j.Stage, j.ID, jobErr)
+		}
+		if err := finishRun(db, j.RunID, runErr, nil); err != nil {
+			logger.Error("Failed to record run result", zap.Error(err))
+		}
+	}
+
+	if jobErr != nil {
+		if dead {
+			return true, fmt.Errorf("job %d dead after %d attempts: %v", j.ID, j.Attempts, jobErr)
+		}
+		return true, fmt.Errorf("job %d failed, retrying in %s: %v", j.ID, jobBackoff(j.Attempts), jobErr)
+	}
+	logger.Info("Job finished")
+	return true, nil
+}
+
+// executeJob carries out one stage of the run, counting its API calls into
+// usage. A summarize job returns the deliver job's payload, or "" when there
+// was nothing to summarize.
+func executeJob(db *sql.DB, config *Config, run queuedRun, j job, usage *apiUsage, logger *zap.Logger) (string, error) {
+	// The run's --as-of and --no-llm adjust the config; keep that to this job
+	runConfig := *config
+	config = &runConfig
+	config.Usage = usage
+
+	flags := run.flags()
+	flags.Output = cliOutput{Quiet: true}
+	fromDate, until, err := resolveWindow(config, flags.FromDateStr, flags.AsOfStr, logger)
+	if err != nil {
+		return "", err
+	}
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		return "", err
+	}
+	p, err := newPipeline(api, db, config, flags, logger)
+	if err != nil {
+		return "", err
+	}
+
+	switch j.Stage {
+	case stageFetch:
+		if _, err := reconcileChannels(api, db, []string{j.Channel}, logger); err != nil {
+			logger.Warn("Failed to reconcile channel with Slack", zap.Error(err))
+		}
+		_, saved, err := p.fetchChannel(j.Channel, fromDate, until, false)
+		if err != nil && channelNeedsInvite(err) {
+			// Retrying won't help until someone invites the bot
+			logger.Warn("Bot can't read channel, skipping it", zap.String("channel", j.Channel), zap.Error(err))
+			return "", saveFetchStats(db, j.ID, channelFetch{Channel: j.Channel, Error: err.Error()})
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", saveFetchStats(db, j.ID, channelFetch{Channel: j.Channel, Messages: saved})
+	case stageSummarize:
+		if p.fetches, err = loadFetchStats(db, j.RunID); err != nil {
+			logger.Warn("Failed to load fetch statistics", zap.Error(err))
+		}
+		return p.summarizeStored(fromDate, until)
+	case stageDeliver:
+		return "", p.deliverJob(j)
+	}
+	return "", fmt.Errorf("unknown stage %q", j.Stage)
+}
+
+// summarizeStored summarizes the messages the run's fetch jobs stored, and
+// returns the deliver job's payload.
+func (p *pipeline) summarizeStored(fromDate, until time.Time) (string, error) {
+	summary, editionTitle, err := p.digestStored(fromDate, until)
+	if err != nil || summary == "" {
+		return "", err
+	}
+	payload, err := json.Marshal(deliverPayload{Summary: summary, EditionTitle: editionTitle, Time: p.config.Clock.Now()})
+	if err != nil {
+		return "", fmt.Errorf("error encoding summary: %v", err)
+	}
+	return string(payload), nil
+}
+
+// digestStored writes the digest from the messages already stored for the
+// focus's channels, without fetching. It returns "" when there is nothing to
+// summarize.
+func (p *pipeline) digestStored(fromDate, until time.Time) (summary, editionTitle string, err error) {
+	preRun := hookContext{Hook: hookPreRun, Focus: p.flags.Focus, Time: p.config.Clock.Now(), DryRun: p.flags.DryRun, Channels: p.channels}
+	if err := runHook(p.config, preRun, p.logger); err != nil {
+		return "", "", fmt.Errorf("not running: %v", err)
+	}
+	if p.config.LearnWeights && !p.flags.DryRun {
+		maybeLearnWeights(p.api, p.db, p.config, p.logger)
+	}
+
+	since := p.config.Clock.Now().AddDate(0, 0, -7)
+	if !fromDate.IsZero() && fromDate.Before(since) {
+		since = fromDate
+	}
+	var updates []Update
+	for _, channelName := range p.channels {
+		channelName = strings.TrimSpace(channelName)
+		if channelName == "" {
+			continue
+		}
+		_, channelDbID, err := getChannelID(p.api, p.db, channelName, p.logger)
+		if err != nil {
+			p.logger.Error("Failed to get channel ID", zap.String("channel", channelName), zap.Error(err))
+			continue
+		}
+		stored, err := getMessagesFromDB(p.db, channelDbID, since, until, p.config.MaxChannelMessages, p.logger)
+		if err != nil {
+			return "", "", err
+		}
+		updates = append(updates, stored...)
+	}
+	return p.summarize(updates, fromDate, until, 0)
+}
+
+// deliverJob delivers the summary in the job's payload and saves the outcome
+// back to it. It fails when any step did, so the retry does the rest.
+func (p *pipeline) deliverJob(j job) error {
+	var payload deliverPayload
+	if err := json.Unmarshal([]byte(j.Payload), &payload); err != nil {
+		return fmt.Errorf("invalid deliver payload: %v", err)
+	}
+	p.config.Clock = fixedClock(payload.Time)
+
+	outcome := deliverSummary(p.api, p.client, p.db, p.config, p.flags, p.targets, payload.Summary, payload.EditionTitle, payload.Outcome, p.logger)
+	if outcome == nil {
+		p.logger.Info("Delivery vetoed by the post-summary hook")
+		return nil
+	}
+	payload.Outcome = outcome
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding delivery outcome: %v", err)
+	}
+	if _, err := p.db.Exec(`UPDATE jobs SET payload = $2 WHERE id = $1`, j.ID, string(encoded)); err != nil {
+		return fmt.Errorf("error saving delivery outcome: %v", err)
+	}
+
+	var failed []string
+	for _, step := range sortedKeys(outcome) {
+		if outcome[step] == "failed" {
+			failed = append(failed, step)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("delivery failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// finishJob records the job's result: succeeded, queued again after a
+// backoff, or dead, and adds its API usage to the run's. When a stage is done
+// it queues the next one; the summarize job once no fetch job is left to run.
+// It reports whether the job died.
+func finishJob(db *sql.DB, config *Config, j job, next string, usage *apiUsage, jobErr error) (dead bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Serializes the jobs of a run finishing at once, so the last fetch job
+	// to finish sees the others done
+	var runUsageJSON sql.NullString
+	if err := tx.QueryRow(`SELECT usage FROM runs WHERE id = $1 `+store.For(db).ForUpdate(false), j.RunID).Scan(&runUsageJSON); err != nil {
+		return false, fmt.Errorf("error locking run: %v", err)
+	}
+	runUsage := newAPIUsage()
+	if runUsageJSON.Valid {
+		if err := json.Unmarshal([]byte(runUsageJSON.String), runUsage); err != nil {
+			return false, fmt.Errorf("invalid usage on run %d: %v", j.RunID, err)
+		}
+	}
+	runUsage.add(usage)
+	usageJSON, err := runUsage.json()
+	if err != nil {
+		return false, fmt.Errorf("error encoding run usage: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE runs SET usage = $2 WHERE id = $1`, j.RunID, usageJSON); err != nil {
+		return false, fmt.Errorf("error recording run usage: %v", err)
+	}
+
+	switch {
+	case jobErr == nil:
+		_, err = tx.Exec(`UPDATE jobs SET status = 'succeeded', last_error = NULL, finished_at = CURRENT_TIMESTAMP WHERE id = $1`, j.ID)
+	case j.Attempts >= config.JobMaxAttempts:
+		dead = true
+		_, err = tx.Exec(`UPDATE jobs SET status = 'dead', last_error = $2, finished_at = CURRENT_TIMESTAMP WHERE id = $1`, j.ID, jobErr.Error())
+	default:
+		_, err = tx.Exec(`
+			UPDATE jobs SET status = 'queued', last_error = $2, started_at = NULL,
+				run_after = $3
+			WHERE id = $1`, j.ID, jobErr.Error(), time.Now().Add(jobBackoff(j.Attempts)))
+	}
+	if err != nil {
+		return false, fmt.Errorf("error recording job result: %v", err)
+	}
+
+	if jobErr == nil || dead {
+		switch {
+		case j.Stage == stageFetch:
+			_, err = tx.Exec(`
+				INSERT INTO jobs (run_id, stage)
+				SELECT $1, $2
+				WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE run_id = $1 AND stage = $3 AND status IN ('queued', 'running'))
+				ON CONFLICT DO NOTHING`, j.RunID, stageSummarize, stageFetch)
+		case j.Stage == stageSummarize && next != "":
+			_, err = tx.Exec(`INSERT INTO jobs (run_id, stage, payload) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+				j.RunID, stageDeliver, next)
+		}
+		if err != nil {
+			return dead, fmt.Errorf("error queuing next stage: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dead, fmt.Errorf("error recording job result: %v", err)
+	}
+	return dead, nil
+}
+
+// retryJob requeues a dead job, and reopens its run if the job's death ended it.
+func retryJob(db *sql.DB, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var runID int
+	var stage string
+	err = tx.QueryRow(`
+		UPDATE jobs SET status = 'queued', attempts = 0, run_after = CURRENT_TIMESTAMP, started_at = NULL, finished_at = NULL
+		WHERE id = $1 AND status = 'dead' RETURNING run_id, stage`, id).Scan(&runID, &stage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no dead job %d", id)
+	}
+	if err != nil {
+		return fmt.Errorf("error requeuing job: %v", err)
+	}
+	if stage != stageFetch {
+		if _, err := tx.Exec(`UPDATE runs SET status = 'staged', error = NULL, finished_at = NULL WHERE id = $1 AND status = 'failed'`, runID); err != nil {
+			return fmt.Errorf("error reopening run: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error requeuing job: %v", err)
+	}
+	return nil
+}
+
+func listJobs(db *sql.DB, runID int, dead bool, limit int) error {
+	rows, err := db.Query(`
+		SELECT id, run_id, stage, COALESCE(channel, ''), status, attempts, run_after, COALESCE(last_error, '')
+		FROM jobs
+		WHERE ($1 = 0 OR run_id = $1) AND (NOT $2 OR status = 'dead')
+		ORDER BY id DESC LIMIT $3`, runID, dead, limit)
+	if err != nil {
+		return fmt.Errorf("error listing jobs: %v", err)
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRUN\tSTAGE\tCHANNEL\tSTATUS\tATTEMPTS\tDUE\tLAST ERROR")
+	for rows.Next() {
+		var id, run, attempts int
+		var stage, channel, status, lastErr string
+		var due time.Time
+		if err := rows.Scan(&id, &run, &stage, &channel, &status, &attempts, &due, &lastErr); err != nil {
+			return fmt.Errorf("error scanning job: %v", err)
+		}
+		if channel == "" {
+			channel = "-"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%d\t%s\t%s\n", id, run, stage, channel, status, attempts, due.Format(time.DateTime), excerpt(lastErr, 60))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error listing jobs: %v", err)
+	}
+	return w.Flush()
+}
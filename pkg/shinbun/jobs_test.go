@@ -0,0 +1,207 @@
+package shinbun
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stagedRun queues a staged run with a fetch job per channel.
+func stagedRun(t *testing.T, db *sql.DB, channels ...string) int {
+	t.Helper()
+	var id int
+	if err := db.QueryRow(`INSERT INTO runs (focus, status) VALUES ('default', 'staged') RETURNING id`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueFetchJobs(db, id, channels); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// stageJobs returns the status of each of the run's jobs of stage, in order.
+func stageJobs(t *testing.T, db *sql.DB, runID int, stage string) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT status FROM jobs WHERE run_id = $1 AND stage = $2 ORDER BY id`, runID, stage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var statuses []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func mustClaimJob(t *testing.T, db *sql.DB, lease time.Duration) job {
+	t.Helper()
+	j, err := claimJob(db, lease)
+	if err != nil {
+		t.Fatalf("claiming job: %v", err)
+	}
+	return j
+}
+
+func TestClaimJob(t *testing.T) {
+	db := openTestDB(t)
+	runID := stagedRun(t, db, "general", "support")
+	var later int
+	err := db.QueryRow(`INSERT INTO jobs (run_id, stage, channel, run_after) VALUES ($1, $2, 'random', $3) RETURNING id`,
+		runID, stageFetch, time.Now().Add(time.Hour)).Scan(&later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := mustClaimJob(t, db, time.Hour)
+	second := mustClaimJob(t, db, time.Hour)
+	if first.Channel != "general" || second.Channel != "support" || first.Attempts != 1 {
+		t.Errorf("claimed %+v then %+v, want general's then support's fetch job, on their first attempt", first, second)
+	}
+	if j, err := claimJob(db, time.Hour); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claimed %+v with the rest running or not due (err %v)", j, err)
+	}
+
+	// Renewed leases keep running jobs from being taken over
+	if _, err := db.Exec(`UPDATE jobs SET started_at = $1 WHERE status = 'running'`, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stop := keepLease(db, "jobs", first.ID, 30*time.Millisecond, zap.NewNop())
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	retaken := mustClaimJob(t, db, time.Hour)
+	if retaken.ID != second.ID || retaken.Attempts != 2 {
+		t.Errorf("took over %+v, want job %d, whose lease expired, on its second attempt", retaken, second.ID)
+	}
+	if j, err := claimJob(db, time.Hour); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("took over job %d whose lease was renewed (err %v)", j.ID, err)
+	}
+}
+
+func TestFinishJobQueuesNextStage(t *testing.T) {
+	db := openTestDB(t)
+	config := &Config{JobMaxAttempts: 2}
+	runID := stagedRun(t, db, "general", "support", "random")
+	usage := newAPIUsage()
+	usage.SlackCalls["conversations.history"] = 2
+
+	general := mustClaimJob(t, db, time.Hour)
+	support := mustClaimJob(t, db, time.Hour)
+	random := mustClaimJob(t, db, time.Hour)
+
+	if dead, err := finishJob(db, config, general, "", usage, nil); err != nil || dead {
+		t.Fatalf("finishing general's fetch: dead %v, err %v", dead, err)
+	}
+	// A failed attempt is queued again after a backoff
+	if dead, err := finishJob(db, config, support, "", usage, errors.New("rate limited")); err != nil || dead {
+		t.Fatalf("failing support's fetch: dead %v, err %v", dead, err)
+	}
+	if got := stageJobs(t, db, runID, stageFetch); got[1] != "queued" {
+		t.Errorf("failed fetch job is %s, want queued", got[1])
+	}
+	if j, err := claimJob(db, time.Hour); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claimed job %d before its backoff ended (err %v)", j.ID, err)
+	}
+	if _, err := finishJob(db, config, random, "", usage, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stageJobs(t, db, runID, stageSummarize); len(got) != 0 {
+		t.Fatalf("summarize queued with a fetch job still to retry: %v", got)
+	}
+
+	// The last try dies, and the run goes on without the channel
+	if _, err := db.Exec(`UPDATE jobs SET run_after = CURRENT_TIMESTAMP WHERE id = $1`, support.ID); err != nil {
+		t.Fatal(err)
+	}
+	support = mustClaimJob(t, db, time.Hour)
+	if dead, err := finishJob(db, config, support, "", usage, errors.New("rate limited")); err != nil || !dead {
+		t.Fatalf("failing support's last fetch: dead %v, err %v", dead, err)
+	}
+	if got := stageJobs(t, db, runID, stageSummarize); len(got) != 1 || got[0] != "queued" {
+		t.Fatalf("summarize jobs after the last fetch = %v, want one queued", got)
+	}
+
+	summarize := mustClaimJob(t, db, time.Hour)
+	if summarize.Stage != stageSummarize {
+		t.Fatalf("claimed a %s job, want summarize", summarize.Stage)
+	}
+	if _, err := finishJob(db, config, summarize, `{"summary":"# Digest"}`, usage, nil); err != nil {
+		t.Fatal(err)
+	}
+	deliver := mustClaimJob(t, db, time.Hour)
+	if deliver.Stage != stageDeliver || deliver.Payload != `{"summary":"# Digest"}` {
+		t.Errorf("claimed %+v, want the deliver job carrying the summary", deliver)
+	}
+
+	var usageJSON string
+	if err := db.QueryRow(`SELECT usage FROM runs WHERE id = $1`, runID).Scan(&usageJSON); err != nil {
+		t.Fatal(err)
+	}
+	runUsage := newAPIUsage()
+	if err := json.Unmarshal([]byte(usageJSON), runUsage); err != nil {
+		t.Fatal(err)
+	}
+	if got := runUsage.SlackCalls["conversations.history"]; got != 10 {
+		t.Errorf("run counts %d conversations.history calls, want the 10 of its 5 finished jobs", got)
+	}
+}
+
+func TestFinishJobWithoutSummary(t *testing.T) {
+	db := openTestDB(t)
+	runID := stagedRun(t, db, "general")
+	fetch := mustClaimJob(t, db, time.Hour)
+	if _, err := finishJob(db, &Config{JobMaxAttempts: 5}, fetch, "", newAPIUsage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	summarize := mustClaimJob(t, db, time.Hour)
+	if _, err := finishJob(db, &Config{JobMaxAttempts: 5}, summarize, "", newAPIUsage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stageJobs(t, db, runID, stageDeliver); len(got) != 0 {
+		t.Errorf("deliver jobs = %v, want none with nothing summarized", got)
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+	db := openTestDB(t)
+	runID := stagedRun(t, db, "general")
+	fetch := mustClaimJob(t, db, time.Hour)
+	if err := retryJob(db, fetch.ID); err == nil {
+		t.Errorf("retried job %d, which isn't dead", fetch.ID)
+	}
+
+	config := &Config{JobMaxAttempts: 1}
+	if _, err := finishJob(db, config, fetch, "", newAPIUsage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	summarize := mustClaimJob(t, db, time.Hour)
+	if dead, err := finishJob(db, config, summarize, "", newAPIUsage(), errors.New("context too long")); err != nil || !dead {
+		t.Fatalf("failing summarize: dead %v, err %v", dead, err)
+	}
+	if err := finishRun(db, runID, errors.New("summarize job dead"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := retryJob(db, summarize.ID); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	if err := db.QueryRow(`SELECT status FROM runs WHERE id = $1`, runID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "staged" {
+		t.Errorf("run is %s after retrying its summarize job, want staged", status)
+	}
+	retried := mustClaimJob(t, db, time.Hour)
+	if retried.ID != summarize.ID || retried.Attempts != 1 {
+		t.Errorf("claimed %+v, want job %d on a fresh first attempt", retried, summarize.ID)
+	}
+}
@@ -0,0 +1,92 @@
+package shinbun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/store"
+)
+
+// schedulerLeaseTTL is how long the scheduler's leader stays leader without
+// renewing its lease. It renews every third of it, so a leader that stopped
+// is replaced within this time.
+const schedulerLeaseTTL = 30 * time.Second
+
+// schedulerLeader elects the one --serve replica that runs the schedules,
+// through a lease row in scheduler_lease that the leader keeps renewing.
+type schedulerLeader struct {
+	db      *sql.DB
+	holder  string
+	leading atomic.Bool
+}
+
+func newSchedulerLeader(db *sql.DB) *schedulerLeader {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &schedulerLeader{db: db, holder: fmt.Sprintf("%s/%d", host, os.Getpid())}
+}
+
+// Leading reports whether this replica held the lease at its last renewal.
+func (l *schedulerLeader) Leading() bool {
+	return l.leading.Load()
+}
+
+// run takes the lease when it is free or expired and renews it until ctx is
+// done, then gives it up so another replica can lead at once.
+func (l *schedulerLeader) run(ctx context.Context, logger *zap.Logger) {
+	ticker := time.NewTicker(schedulerLeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		leading, err := l.renew()
+		if err != nil {
+			// Step down: the lease may expire before the database answers again
+			logger.Error("Failed to renew the scheduler lease", zap.Error(err))
+		}
+		if leading != l.leading.Swap(leading) {
+			if leading {
+				logger.Info("Leading the scheduler", zap.String("holder", l.holder))
+			} else {
+				logger.Info("No longer leading the scheduler", zap.String("holder", l.holder))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			l.leading.Store(false)
+			if _, err := l.db.Exec(`DELETE FROM scheduler_lease WHERE id = 1 AND holder = $1`, l.holder); err != nil {
+				logger.Warn("Failed to release the scheduler lease", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew extends the lease when this replica holds it or it has expired, and
+// reports whether this replica holds it now. Expiry is decided by the
+// database's clock, so replicas whose clocks disagree can't both lead.
+func (l *schedulerLeader) renew() (bool, error) {
+	var holder string
+	err := l.db.QueryRow(`
+		INSERT INTO scheduler_lease (id, holder, expires_at) VALUES (1, $1, `+store.For(l.db).SecondsFromNow("$2")+`)
+		ON CONFLICT (id) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE scheduler_lease.holder = EXCLUDED.holder OR scheduler_lease.expires_at < CURRENT_TIMESTAMP
+		RETURNING holder`,
+		l.holder, int(schedulerLeaseTTL/time.Second)).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error renewing scheduler lease: %v", err)
+	}
+	return true, nil
+}
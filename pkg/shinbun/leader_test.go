@@ -0,0 +1,139 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/migrate"
+	"shinbun/internal/store"
+)
+
+// openTestDB returns a migrated SQLite database in a temporary directory.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	backend, err := store.New(store.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := backend.Open(filepath.Join(t.TempDir(), "shinbun.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrate.Up(db, zap.NewNop()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+func TestSchedulerLeaderLease(t *testing.T) {
+	db := openTestDB(t)
+	a := &schedulerLeader{db: db, holder: "a"}
+	b := &schedulerLeader{db: db, holder: "b"}
+
+	steps := []struct {
+		name   string
+		leader *schedulerLeader
+		expire bool
+		want   bool
+	}{
+		{"first replica takes the free lease", a, false, true},
+		{"second replica waits", b, false, false},
+		{"holder renews", a, false, true},
+		{"second replica takes the expired lease", b, true, true},
+		{"former holder waits", a, false, false},
+	}
+	for _, step := range steps {
+		if step.expire {
+			if _, err := db.Exec(`UPDATE scheduler_lease SET expires_at = $1`, time.Now().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := step.leader.renew()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: leading = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// The lease runs for its TTL by the database's clock
+	var live bool
+	if err := db.QueryRow(`SELECT expires_at > CURRENT_TIMESTAMP FROM scheduler_lease`).Scan(&live); err != nil {
+		t.Fatal(err)
+	}
+	if !live {
+		t.Errorf("renewed lease has already expired by the database's clock")
+	}
+}
+
+func TestScheduledRunsAreRecordedOnceAndRetried(t *testing.T) {
+	db := openTestDB(t)
+	at := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	running, err := recordScheduledRun(db, "default", Flags{}, at, "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recordScheduledRun(db, "default", Flags{}, at, "running"); !errors.Is(err, errRunClaimed) {
+		t.Errorf("recording the same scheduled time again: got %v, want errRunClaimed", err)
+	}
+	queued, err := recordScheduledRun(db, "support", Flags{NoLLM: true}, at, "queued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO runs (focus, status) VALUES ('adhoc', 'queued')`); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := claimRun(db, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.ID != queued || !run.NoLLM {
+		t.Errorf("claimed %+v, want the queued scheduled run %d with no_llm", run, queued)
+	}
+	if _, err := claimRun(db, time.Hour, true); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claiming with the running run's lease unexpired: got %v, want sql.ErrNoRows", err)
+	}
+	// A lease in the future makes every running run stale
+	run, err = claimRun(db, -time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.ID != running {
+		t.Errorf("claimed run %d, want the oldest stale scheduled run %d", run.ID, running)
+	}
+}
+
+func TestKeepLeaseRenewsRunningRun(t *testing.T) {
+	db := openTestDB(t)
+	var id int
+	err := db.QueryRow(`INSERT INTO runs (focus, status, attempts, started_at) VALUES ('default', 'running', 1, $1) RETURNING id`,
+		time.Now().Add(-2*time.Hour)).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := keepLease(db, "runs", id, 30*time.Millisecond, zap.NewNop())
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	if run, err := claimRun(db, time.Hour, false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claimed run %d while its lease was renewed (err %v)", run.ID, err)
+	}
+}
+
+func TestCheckLease(t *testing.T) {
+	if err := checkLease(defaultRunLease); err != nil {
+		t.Errorf("checkLease(%s) = %v", defaultRunLease, err)
+	}
+	if err := checkLease(time.Second); err == nil {
+		t.Errorf("checkLease(1s) accepted a lease shorter than %s", minLease)
+	}
+}
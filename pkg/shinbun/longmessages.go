@@ -0,0 +1,109 @@
+package shinbun
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// defaultExcerptKeywords are the lines of a long message kept besides its
+// first and last ones: what usually matters in a pasted log.
+var defaultExcerptKeywords = []string{"error", "fatal", "panic", "exception", "failed", "failure", "critical", "timeout", "denied", "refused"}
+
+// maxExcerptLineChars bounds each line kept in an excerpt, for logs with
+// very long lines.
+const maxExcerptLineChars = 300
+
+// messageExcerpter shortens messages longer than MaxChars, such as pasted
+// logs, instead of letting them take the prompt budget or be dropped.
+type messageExcerpter struct {
+	MaxChars int
+	// EdgeLines are kept at each end of the message
+	EdgeLines int
+	Keywords  []string
+}
+
+// excerptLongMessages shortens the text and translation of long updates.
+func excerptLongMessages(updates []Update, e messageExcerpter, logger *zap.Logger) []Update {
+	if e.MaxChars <= 0 {
+		return updates
+	}
+	shortened := 0
+	for i := range updates {
+		text := e.excerpt(updates[i].Text)
+		if text != updates[i].Text {
+			shortened++
+		}
+		updates[i].Text = text
+		updates[i].Translation = e.excerpt(updates[i].Translation)
+	}
+	if shortened > 0 {
+		logger.Info("Excerpted long messages", zap.Int("messages", shortened), zap.Int("max_chars", e.MaxChars))
+	}
+	return updates
+}
+
+// excerpt keeps the first and last EdgeLines lines of text and, as far as
+// MaxChars allows, the lines in between that mention a keyword. Each run of
+// left-out lines is marked. A message of a few very long lines is cut in the
+// middle instead.
+func (e messageExcerpter) excerpt(text string) string {
+	if len([]rune(text)) <= e.MaxChars {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) <= 2*e.EdgeLines+1 {
+		runes := []rune(text)
+		head, tail := e.MaxChars*2/3, e.MaxChars/3
+		return fmt.Sprintf("%s\n[… %d characters omitted …]\n%s", string(runes[:head]), len(runes)-head-tail, string(runes[len(runes)-tail:]))
+	}
+
+	keep := make([]bool, len(lines))
+	used := 0
+	mark := func(i int) {
+		if !keep[i] {
+			keep[i] = true
+			used += len([]rune(lines[i])) + 1
+		}
+	}
+	for i := 0; i < e.EdgeLines; i++ {
+		mark(i)
+		mark(len(lines) - 1 - i)
+	}
+	for i, line := range lines {
+		if used >= e.MaxChars {
+			break
+		}
+		lower := strings.ToLower(line)
+		for _, keyword := range e.Keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				mark(i)
+				break
+			}
+		}
+	}
+
+	var out []string
+	omitted := 0
+	for i, line := range lines {
+		if !keep[i] {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			out = append(out, fmt.Sprintf("[… %d lines omitted …]", omitted))
+			omitted = 0
+		}
+		if runes := []rune(line); len(runes) > maxExcerptLineChars {
+			line = string(runes[:maxExcerptLineChars]) + "…"
+		}
+		out = append(out, line)
+	}
+	excerpt := strings.Join(out, "\n")
+	// Leaving out a closing fence would turn the rest of the prompt into code
+	if strings.Count(excerpt, "```")%2 == 1 {
+		excerpt += "\n```"
+	}
+	return excerpt
+}
@@ -0,0 +1,321 @@
+package shinbun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+const (
+	// mapMinNotesTokens is the least a chunk is condensed to, however many
+	// chunks share its section's allocation.
+	mapMinNotesTokens = 150
+	// mapMaxAttempts bounds retries of a chunk that keeps getting rate limited.
+	mapMaxAttempts = 5
+	// mapRateLimitBackoff is the initial pause after a 429, doubled per retry.
+	mapRateLimitBackoff = 2 * time.Second
+)
+
+// digestSections are the parts of the digest the map step condenses
+// separately, in the order their notes reach the final summary.
+var digestSections = []string{"highlights", "incidents", "support", "general"}
+
+// defaultSectionTokens are the notes tokens each section is condensed to
+// unless MAP_SECTION_TOKENS says otherwise.
+var defaultSectionTokens = map[string]int{
+	"highlights": 1500,
+	"incidents":  1500,
+	"support":    1000,
+	"general":    1000,
+}
+
+// parseSectionTokens parses "section=tokens" lists such as
+// "incidents=3000,general=500" over the defaultSectionTokens.
+func parseSectionTokens(value string) (map[string]int, error) {
+	weights, err := parseWeights(value)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]int, len(defaultSectionTokens))
+	for section, n := range defaultSectionTokens {
+		tokens[section] = n
+	}
+	for _, section := range sortedKeys(weights) {
+		if _, ok := defaultSectionTokens[section]; !ok {
+			return nil, fmt.Errorf("unknown section %q (use %s)", section, strings.Join(digestSections, ", "))
+		}
+		n := weights[section]
+		if n < 0 || n != float64(int(n)) {
+			return nil, fmt.Errorf("tokens for %s must be a non-negative integer", section)
+		}
+		tokens[section] = int(n)
+	}
+	return tokens, nil
+}
+
+// sectionOf is the digest section an update is condensed with: high-priority
+// messages are highlights whatever their category.
+func sectionOf(u Update) string {
+	switch {
+	case u.Priority >= 3:
+		return "highlights"
+	case u.Category == "alert":
+		return "incidents"
+	case u.Category == "support":
+		return "support"
+	}
+	return "general"
+}
+
+// sectionNotesTokens shares total notes tokens among the sections with
+// updates: each gets its allocation, and the allocations of empty sections
+// are split among them in proportion.
+func sectionNotesTokens(allocations map[string]int, present map[string]bool) map[string]int {
+	total, presentTotal := 0, 0
+	for _, section := range digestSections {
+		total += allocations[section]
+		if present[section] {
+			presentTotal += allocations[section]
+		}
+	}
+	tokens := make(map[string]int)
+	for _, section := range digestSections {
+		if !present[section] {
+			continue
+		}
+		if presentTotal == 0 {
+			tokens[section] = total / len(present)
+			continue
+		}
+		tokens[section] = allocations[section] * total / presentTotal
+	}
+	return tokens
+}
+
+// mapNotesTokens estimates the notes the map step produces from chunks
+// chunks.
+func mapNotesTokens(allocations map[string]int, chunks int) int {
+	total := 0
+	for _, section := range digestSections {
+		total += allocations[section]
+	}
+	return max(total, chunks*mapMinNotesTokens)
+}
+
+// sectionChunk is a chunk of one section's updates and the tokens its notes
+// may take.
+type sectionChunk struct {
+	Section   string
+	Updates   []Update
+	MaxTokens int
+}
+
+// chunkSections splits updates by digest section, then each section into
+// chunks of roughly chunkTokens, sharing the section's notes tokens among
+// its chunks. A flood of general chatter thus gets condensed harder rather
+// than crowding incidents out of the final prompt.
+func chunkSections(updates []Update, chunkTokens int, model string, allocations map[string]int) []sectionChunk {
+	bySection := make(map[string][]Update)
+	present := make(map[string]bool)
+	for _, u := range updates {
+		section := sectionOf(u)
+		bySection[section] = append(bySection[section], u)
+		present[section] = true
+	}
+	notesTokens := sectionNotesTokens(allocations, present)
+
+	var chunks []sectionChunk
+	for _, section := range digestSections {
+		if !present[section] {
+			continue
+		}
+		sectionChunks := chunkUpdates(bySection[section], chunkTokens, model)
+		perChunk := max(mapMinNotesTokens, notesTokens[section]/len(sectionChunks))
+		for _, chunk := range sectionChunks {
+			chunks = append(chunks, sectionChunk{Section: section, Updates: chunk, MaxTokens: perChunk})
+		}
+	}
+	return chunks
+}
+
+// chunkUpdates splits updates, highest score first, into chunks of roughly
+// chunkTokens tokens of model. An update larger than a chunk gets its own.
+func chunkUpdates(updates []Update, chunkTokens int, model string) [][]Update {
+	ordered := make([]Update, len(updates))
+	copy(ordered, updates)
+	sortByScore(ordered)
+
+	var chunks [][]Update
+	var current []Update
+	used := 0
+	for _, u := range ordered {
+		tokens := updateTokens(model, u)
+		if len(current) > 0 && used+tokens > chunkTokens {
+			chunks = append(chunks, current)
+			current, used = nil, 0
+		}
+		current = append(current, u)
+		used += tokens
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// generateMapReduceSummary condenses each section's chunks of updates into
+// notes with mapModel, then writes the digest from those notes with model. Up
+// to concurrency chunks are condensed at once; only the final step is streamed.
+func generateMapReduceSummary(client *openai.Client, mapModel, model string, chunkTokens, concurrency int, sectionTokens map[string]int, updates []Update, focus string, background promptContext, stream io.Writer, usage *apiUsage, logger *zap.Logger) (string, error) {
+	chunks := chunkSections(updates, chunkTokens, mapModel, sectionTokens)
+	logger.Info("Generating summary with map-reduce",
+		zap.String("focus", focus),
+		zap.String("map_model", mapModel),
+		zap.String("model", model),
+		zap.Int("message_count", len(updates)),
+		zap.Int("chunks", len(chunks)),
+		zap.Int("concurrency", concurrency))
+
+	hasDocs := false
+	formatted := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		messages, chunkHasDocs := formatUpdatesForPrompt(chunk.Updates, background.Instructions)
+		formatted[i] = messages
+		hasDocs = hasDocs || chunkHasDocs
+	}
+
+	condensed := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	gate := &rateLimitGate{usage: usage}
+	sem := make(chan struct{}, max(1, concurrency))
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			condensed[i], errs[i] = condenseWithRetry(client, mapModel, formatted[i], chunks[i].MaxTokens, gate, logger)
+		}(i)
+	}
+	wg.Wait()
+
+	var notes strings.Builder
+	batch := make(map[string]int)
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			return "", fmt.Errorf("error condensing chunk %d of %d: %v", i+1, len(chunks), errs[i])
+		}
+		batch[chunk.Section]++
+		notes.WriteString(fmt.Sprintf("Notes on %s, batch %d:\n%s\n\n", chunk.Section, batch[chunk.Section], condensed[i]))
+	}
+
+	systemMessage, prompt := buildSummaryPrompt(notes.String(), hasDocs, focus, background)
+	return completeSummary(client, model, systemMessage, prompt, focus, stream, logger)
+}
+
+// rateLimitGate makes all map workers pause together once any of them is rate
+// limited, instead of each hammering the API on its own schedule.
+type rateLimitGate struct {
+	mu    sync.Mutex
+	until time.Time
+	usage *apiUsage
+}
+
+func (g *rateLimitGate) wait() {
+	g.mu.Lock()
+	until := g.until
+	g.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (g *rateLimitGate) pause(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if until := now.Add(d); until.After(g.until) {
+		// Workers pause together, so only the extension is new waiting
+		from := now
+		if g.until.After(now) {
+			from = g.until
+		}
+		g.usage.backoff(until.Sub(from))
+		g.until = until
+	}
+}
+
+// isRateLimited reports whether err is an OpenAI 429 response.
+func isRateLimited(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// condenseWithRetry runs the map step for one chunk, backing off (for every
+// worker, via gate) when OpenAI reports a rate limit.
+func condenseWithRetry(client *openai.Client, model string, messages string, maxTokens int, gate *rateLimitGate, logger *zap.Logger) (string, error) {
+	backoff := mapRateLimitBackoff
+	for attempt := 1; ; attempt++ {
+		gate.wait()
+		notes, err := condenseUpdates(client, model, messages, maxTokens)
+		if err == nil || !isRateLimited(err) || attempt == mapMaxAttempts {
+			return notes, err
+		}
+		logger.Warn("Rate limited while condensing chunk, backing off",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff))
+		gate.pause(backoff)
+		backoff *= 2
+	}
+}
+
+// condenseUpdates is the map step: it shrinks a formatted block of messages
+// into at most maxTokens of notes that keep what the final summary needs.
+func condenseUpdates(client *openai.Client, model string, messages string, maxTokens int) (string, error) {
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role: openai.ChatMessageRoleSystem,
+					Content: "You condense batches of workplace messages into compact notes for a later summary. " +
+						"Keep the category headings. Write one bullet per topic with its Source, Channel and Time, " +
+						"and copy every Link and Related Links URL exactly as given, and the titles and URLs of Attachments that matter. Keep ticket IDs, names, numbers, " +
+						"decisions and anything urgent or unresolved; drop greetings and chit-chat. " +
+						"Follow the instructions a section gives for a channel in deciding what to keep from its messages. " +
+						fmt.Sprintf("Keep the notes under %d words, leaving out the least important topics first.", maxTokens*3/4),
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: messages,
+				},
+			},
+			MaxTokens:   maxTokens,
+			Temperature: 0.2,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("openai returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,85 @@
+package shinbun
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSectionTokens(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]int
+		wantErr bool
+	}{
+		{"", map[string]int{"highlights": 1500, "incidents": 1500, "support": 1000, "general": 1000}, false},
+		{"Incidents=3000, general=0", map[string]int{"highlights": 1500, "incidents": 3000, "support": 1000, "general": 0}, false},
+		{"sales=500", nil, true},
+		{"general=-1", nil, true},
+		{"general=2.5", nil, true},
+		{"general", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSectionTokens(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSectionTokens(%q) error = %v, want error: %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSectionTokens(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+	if defaultSectionTokens["incidents"] != 1500 {
+		t.Errorf("parseSectionTokens modified the defaults")
+	}
+}
+
+func TestSectionNotesTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations map[string]int
+		present     []string
+		want        map[string]int
+	}{
+		{
+			name:        "all sections present",
+			allocations: defaultSectionTokens,
+			present:     digestSections,
+			want:        defaultSectionTokens,
+		},
+		{
+			name:        "empty sections shared in proportion",
+			allocations: defaultSectionTokens,
+			present:     []string{"highlights", "general"},
+			want:        map[string]int{"highlights": 3000, "general": 2000},
+		},
+		{
+			name:        "one section takes it all",
+			allocations: defaultSectionTokens,
+			present:     []string{"support"},
+			want:        map[string]int{"support": 5000},
+		},
+		{
+			name:        "present sections without allocations share evenly",
+			allocations: map[string]int{"highlights": 0, "incidents": 3000, "support": 0, "general": 0},
+			present:     []string{"support", "general"},
+			want:        map[string]int{"support": 1500, "general": 1500},
+		},
+		{
+			name:        "no updates",
+			allocations: defaultSectionTokens,
+			want:        map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			present := make(map[string]bool)
+			for _, section := range tt.present {
+				present[section] = true
+			}
+			if got := sectionNotesTokens(tt.allocations, present); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sectionNotesTokens(%v) = %v, want %v", tt.present, got, tt.want)
+			}
+		})
+	}
+}
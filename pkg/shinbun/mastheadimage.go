@@ -0,0 +1,286 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+const (
+	mastheadImageTemplate = "template"
+	mastheadImageDallE    = "dalle"
+
+	// mastheadContentID is the Content-ID of the edition's masthead image.
+	mastheadContentID = "masthead@shinbun"
+	// mastheadWidth is the width the masthead is drawn and shown at, in pixels.
+	mastheadWidth = 600
+	// nameplateHeight is the height of the nameplate with the name, issue
+	// number and date.
+	nameplateHeight = 140
+	// mastheadArtHeight is the height of the DALL·E illustration above it.
+	mastheadArtHeight = 150
+)
+
+// mastheadPaper is the newsprint background of the nameplate.
+var mastheadPaper = color.RGBA{R: 0xf7, G: 0xf3, B: 0xe8, A: 0xff}
+
+// editionMasthead is the masthead image of the edition being emailed.
+type editionMasthead struct {
+	Alt   string
+	Image inlineImage
+}
+
+// newEditionMasthead draws the edition's masthead: a newspaper nameplate with
+// its name, issue number and date, in MASTHEAD_IMAGE=dalle below an
+// illustration by DALL·E. When DALL·E fails, or with --no-llm, the plain
+// nameplate is used; nil means no image could be made at all.
+func newEditionMasthead(client *openai.Client, config *Config, issue digestIssue, noLLM bool, logger *zap.Logger) *editionMasthead {
+	ink := parseHexColor(config.EmailHeadingColor)
+	nameplate := drawNameplate(issue, ink)
+	masthead := &editionMasthead{Alt: issue.label() + " — " + issue.Name + " · " + issue.Date.Format("January 2, 2006")}
+
+	if config.MastheadImage == mastheadImageDallE && !noLLM {
+		art, err := mastheadArt(client, issue.Name)
+		if err == nil {
+			combined := image.NewRGBA(image.Rect(0, 0, mastheadWidth, mastheadArtHeight+nameplateHeight))
+			draw.Draw(combined, image.Rect(0, 0, mastheadWidth, mastheadArtHeight), art, image.Point{}, draw.Src)
+			draw.Draw(combined, image.Rect(0, mastheadArtHeight, mastheadWidth, mastheadArtHeight+nameplateHeight), nameplate, image.Point{}, draw.Src)
+			var buf bytes.Buffer
+			if err = jpeg.Encode(&buf, combined, &jpeg.Options{Quality: 85}); err == nil {
+				masthead.Image = inlineImage{ContentID: mastheadContentID, ContentType: "image/jpeg", Filename: "masthead.jpg", Data: buf.Bytes()}
+				return masthead
+			}
+		}
+		logger.Warn("Failed to illustrate the masthead, using the plain nameplate", zap.Error(err))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, nameplate); err != nil {
+		logger.Error("Failed to draw the masthead image", zap.Error(err))
+		return nil
+	}
+	masthead.Image = inlineImage{ContentID: mastheadContentID, ContentType: "image/png", Filename: "masthead.png", Data: buf.Bytes()}
+	return masthead
+}
+
+// mastheadArt asks DALL·E for a banner illustration and crops and scales it
+// to the masthead's width.
+func mastheadArt(client *openai.Client, name string) (image.Image, error) {
+	resp, err := client.CreateImage(context.Background(), openai.ImageRequest{
+		Prompt: fmt.Sprintf("A wide decorative banner for the masthead of an internal newsletter called %q: "+
+			"a vintage newspaper engraving with ornaments and scenery suited to its theme, on cream paper. "+
+			"No text, letters or numbers anywhere.", name),
+		Model:          openai.CreateImageModelDallE3,
+		N:              1,
+		Size:           openai.CreateImageSize1792x1024,
+		Quality:        openai.CreateImageQualityStandard,
+		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating masthead image: %v", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("openai returned no image")
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid masthead image: %v", err)
+	}
+	art, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid masthead image: %v", err)
+	}
+
+	// Keep a horizontal band from the middle, in the masthead's proportions
+	bounds := art.Bounds()
+	bandHeight := bounds.Dx() * mastheadArtHeight / mastheadWidth
+	top := bounds.Min.Y + max(0, (bounds.Dy()-bandHeight)/2)
+	band := image.Rect(bounds.Min.X, top, bounds.Max.X, min(bounds.Max.Y, top+bandHeight))
+	return scaleImage(art, band, mastheadWidth, mastheadArtHeight), nil
+}
+
+// scaleImage scales the area of src to width×height, averaging the source
+// pixels under each destination pixel.
+func scaleImage(src image.Image, area image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := area.Min.Y + y*area.Dy()/height
+		y1 := max(y0+1, area.Min.Y+(y+1)*area.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := area.Min.X + x*area.Dx()/width
+			x1 := max(x0+1, area.Min.X+(x+1)*area.Dx()/width)
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := src.At(sx, sy).RGBA()
+					r, g, b, n = r+pr, g+pg, b+pb, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
+
+// drawNameplate draws the newsletter's name between double rules, with the
+// issue number and date underneath, in ink on newsprint.
+func drawNameplate(issue digestIssue, ink color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, mastheadWidth, nameplateHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(mastheadPaper), image.Point{}, draw.Src)
+	const margin = 24
+	rule := func(y, thickness int) {
+		draw.Draw(img, image.Rect(margin, y, mastheadWidth-margin, y+thickness), image.NewUniform(ink), image.Point{}, draw.Src)
+	}
+	rule(12, 3)
+	rule(18, 1)
+
+	name := mastheadText(issue.Name)
+	if name == "" {
+		name = "SHINBUN"
+	}
+	// As large as fits, centered between the rules
+	scale := max(1, min(7, (mastheadWidth-2*margin)/textWidth(name, 1)))
+	drawText(img, name, 55-glyphHeight*scale/2, scale, ink)
+
+	rule(90, 1)
+	rule(94, 3)
+
+	dateline := mastheadText(issue.Date.Format("Monday, January 2, 2006"))
+	if issue.Number > 0 {
+		dateline = "NO. " + strconv.Itoa(issue.Number) + " · " + dateline
+	}
+	scale = 2
+	if textWidth(dateline, scale) > mastheadWidth-2*margin {
+		scale = 1
+	}
+	drawText(img, dateline, 112-glyphHeight*scale/2, scale, ink)
+	rule(nameplateHeight-12, 1)
+	return img
+}
+
+// mastheadText uppercases s for the masthead font, dropping what it can't
+// draw, such as Japanese, and the separators that then lead nowhere.
+func mastheadText(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		switch r {
+		case '—', '–':
+			r = '-'
+		case '•':
+			r = '·'
+		}
+		if _, ok := mastheadFont[r]; ok {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Trim(strings.Join(strings.Fields(sb.String()), " "), " -·,:")
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// textWidth is the width of text in the masthead font at scale.
+func textWidth(text string, scale int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 1
+	}
+	return (n*(glyphWidth+1) - 1) * scale
+}
+
+// drawText draws text centered horizontally with its top at y.
+func drawText(img *image.RGBA, text string, y, scale int, ink color.Color) {
+	x := (img.Bounds().Dx() - textWidth(text, scale)) / 2
+	for _, r := range text {
+		glyph := mastheadFont[r]
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, px, image.NewUniform(ink), image.Point{}, draw.Src)
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// parseHexColor parses a validated #rgb or #rrggbb color.
+func parseHexColor(hex string) color.RGBA {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// mastheadFont is a 5×7 bitmap font, one byte per row with the leftmost
+// pixel in bit 4.
+var mastheadFont = map[rune][glyphHeight]uint8{
+	'A':  {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C':  {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D':  {0b11110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b11110},
+	'E':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G':  {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H':  {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I':  {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J':  {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K':  {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L':  {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M':  {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N':  {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S':  {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T':  {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W':  {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X':  {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y':  {0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100, 0b00100},
+	'Z':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0':  {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1':  {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3':  {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4':  {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5':  {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6':  {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8':  {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9':  {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	' ':  {},
+	'.':  {0, 0, 0, 0, 0, 0b01100, 0b01100},
+	',':  {0, 0, 0, 0, 0b01100, 0b00100, 0b01000},
+	':':  {0, 0b01100, 0b01100, 0, 0b01100, 0b01100, 0},
+	'·':  {0, 0, 0, 0b01100, 0b01100, 0, 0},
+	'-':  {0, 0, 0, 0b11111, 0, 0, 0},
+	'#':  {0b01010, 0b01010, 0b11111, 0b01010, 0b11111, 0b01010, 0b01010},
+	'&':  {0b01100, 0b10010, 0b10100, 0b01000, 0b10101, 0b10010, 0b01101},
+	'\'': {0b01100, 0b00100, 0b01000, 0, 0, 0, 0},
+	'/':  {0, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0},
+	'!':  {0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0, 0b00100},
+	'?':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0, 0b00100},
+	'(':  {0b00010, 0b00100, 0b01000, 0b01000, 0b01000, 0b00100, 0b00010},
+	')':  {0b01000, 0b00100, 0b00010, 0b00010, 0b00010, 0b00100, 0b01000},
+}
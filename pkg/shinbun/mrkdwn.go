@@ -0,0 +1,109 @@
+package shinbun
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownLinkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownImagePattern   = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	markdownBoldPattern    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	markdownItalicPattern  = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	markdownStrikePattern  = regexp.MustCompile(`~~(.+?)~~`)
+	markdownListPattern    = regexp.MustCompile(`^\s*(?:[-*+]|\d+\.)\s+`)
+	markdownHeadingPattern = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	markdownRulePattern    = regexp.MustCompile(`^\s{0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	markdownCodeSpan       = regexp.MustCompile("`[^`]+`")
+)
+
+// boldMarker stands in for mrkdwn bold while italics are converted, so the
+// single asterisks of converted bold aren't taken for italics.
+const boldMarker = "\x00"
+
+// markdownToMrkdwn converts a markdown document, as written by the model or
+// the digest template, to Slack mrkdwn. Slack has no headings, so they become
+// bold lines; lists become bullets keeping their nesting; code blocks and
+// spans are passed through untouched apart from escaping.
+func markdownToMrkdwn(md string) string {
+	var out []string
+	inFence := false
+	fenceIndent := ""
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			// Code nested in a list item loses the item's indentation
+			fenceIndent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			out = append(out, "```")
+			continue
+		}
+		if inFence {
+			out = append(out, escapeMrkdwn(strings.TrimPrefix(line, fenceIndent)))
+			continue
+		}
+		out = append(out, mrkdwnLine(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// mrkdwnLine converts one line outside a code block.
+func mrkdwnLine(line string) string {
+	if m := markdownHeadingPattern.FindStringSubmatch(line); m != nil {
+		return "*" + strings.ReplaceAll(mrkdwnMarked(m[1]), boldMarker, "") + "*"
+	}
+	if markdownRulePattern.MatchString(line) {
+		return "──────────"
+	}
+	if quoted, ok := strings.CutPrefix(strings.TrimSpace(line), ">"); ok {
+		return "> " + mrkdwnInline(strings.TrimSpace(quoted))
+	}
+	if loc := markdownListPattern.FindStringIndex(line); loc != nil {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		bullet := strings.TrimSpace(line[:loc[1]])
+		if !strings.HasSuffix(bullet, ".") {
+			bullet = "•"
+		}
+		return strings.Repeat("    ", indent/2) + bullet + " " + mrkdwnInline(line[loc[1]:])
+	}
+	return mrkdwnInline(line)
+}
+
+// mrkdwnInline converts inline markdown: links, images, bold, italics and
+// strikethrough. Code spans are left as they are.
+func mrkdwnInline(text string) string {
+	return strings.ReplaceAll(mrkdwnMarked(text), boldMarker, "*")
+}
+
+// mrkdwnMarked is mrkdwnInline with bold still marked by boldMarker.
+func mrkdwnMarked(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range markdownCodeSpan.FindAllStringIndex(text, -1) {
+		sb.WriteString(mrkdwnFormatting(text[last:loc[0]]))
+		sb.WriteString(escapeMrkdwn(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	sb.WriteString(mrkdwnFormatting(text[last:]))
+	return sb.String()
+}
+
+func mrkdwnFormatting(text string) string {
+	text = escapeMrkdwn(text)
+	text = markdownImagePattern.ReplaceAllString(text, "<$2|$1>")
+	text = markdownLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		m := markdownLinkPattern.FindStringSubmatch(link)
+		return "<" + m[2] + "|" + strings.ReplaceAll(m[1], "|", "¦") + ">"
+	})
+	text = markdownBoldPattern.ReplaceAllStringFunc(text, func(bold string) string {
+		m := markdownBoldPattern.FindStringSubmatch(bold)
+		return boldMarker + m[1] + m[2] + boldMarker
+	})
+	text = markdownItalicPattern.ReplaceAllString(text, "${1}_${2}_")
+	return markdownStrikePattern.ReplaceAllString(text, "~$1~")
+}
+
+// escapeMrkdwn escapes the characters Slack reserves for control sequences.
+func escapeMrkdwn(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,34 @@
+package shinbun
+
+import "testing"
+
+func TestMarkdownToMrkdwn(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"heading", "# Top highlights", "*Top highlights*"},
+		{"heading with bold", "## **Urgent** items ##", "*Urgent items*"},
+		{"bold and italics", "**bold**, __also bold__ and *italic*", "*bold*, *also bold* and _italic_"},
+		{"strikethrough", "~~cancelled~~", "~cancelled~"},
+		{"arithmetic isn't italic", "2 * 3 * 4", "2 * 3 * 4"},
+		{"link", "[Checkout down](https://example.slack.com/archives/C01/p1)", "<https://example.slack.com/archives/C01/p1|Checkout down>"},
+		{"link text with a pipe", "[a|b](https://example.com)", "<https://example.com|a¦b>"},
+		{"image", "![chart](https://example.com/chart.png)", "<https://example.com/chart.png|chart>"},
+		{"bullets keep nesting", "- item\n  * nested\n1. first", "• item\n    • nested\n1. first"},
+		{"rule", "---", "──────────"},
+		{"quote", "> quoted **text**", "> quoted *text*"},
+		{"control characters escaped", "a < b & c > d", "a &lt; b &amp; c &gt; d"},
+		{"code span untouched", "`**not bold** <x>` and **bold**", "`**not bold** &lt;x&gt;` and *bold*"},
+		{"code block in a list item", "- step\n  ```\n  if a < b {\n  ```", "• step\n```\nif a &lt; b {\n```"},
+		{"markdown inside code block", "```\n# not a heading\n- not a bullet\n```", "```\n# not a heading\n- not a bullet\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToMrkdwn(tt.md); got != tt.want {
+				t.Errorf("markdownToMrkdwn(%q)\n got %q\nwant %q", tt.md, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package shinbun
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// networkSettings are the egress settings for one outbound client. An empty
+// ProxyURL falls back to HTTPS_PROXY/NO_PROXY; "direct" bypasses any proxy.
+type networkSettings struct {
+	ProxyURL string
+	CABundle string
+}
+
+// networkFor returns the settings for the named client ("slack", "openai" or
+// "smtp"); per-client values override the shared CA_BUNDLE. Any other name
+// gets the shared settings.
+func (c *Config) networkFor(name string) networkSettings {
+	settings := networkSettings{CABundle: c.CABundle}
+	var proxyURL, caBundle string
+	switch name {
+	case "slack":
+		proxyURL, caBundle = c.SlackProxyURL, c.SlackCABundle
+	case "openai":
+		proxyURL, caBundle = c.OpenAIProxyURL, c.OpenAICABundle
+	case "smtp":
+		proxyURL, caBundle = c.SMTPProxyURL, c.SMTPCABundle
+	}
+	settings.ProxyURL = proxyURL
+	if caBundle != "" {
+		settings.CABundle = caBundle
+	}
+	return settings
+}
+
+// proxyFunc resolves the proxy for a request according to the settings.
+func (s networkSettings) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch s.ProxyURL {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(s.ProxyURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", s.ProxyURL)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// tlsConfig returns a TLS config trusting the system roots plus the CA bundle,
+// or nil when no bundle is configured.
+func (s networkSettings) tlsConfig(serverName string) (*tls.Config, error) {
+	if s.CABundle == "" {
+		if serverName == "" {
+			return nil, nil
+		}
+		return &tls.Config{ServerName: serverName}, nil
+	}
+	pem, err := os.ReadFile(s.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", s.CABundle)
+	}
+	return &tls.Config{RootCAs: pool, ServerName: serverName}, nil
+}
+
+// newHTTPClient builds an HTTP client that honors the proxy and CA settings.
+func newHTTPClient(settings networkSettings, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := settings.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	tlsConfig, err := settings.tlsConfig("")
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// dialThroughSettings opens a TCP connection to addr, tunnelling through the
+// configured proxy with HTTP CONNECT when one applies.
+func dialThroughSettings(settings networkSettings, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	proxy, err := settings.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	var proxyURL *url.URL
+	if proxy != nil {
+		// Resolve as if this were an HTTPS request so NO_PROXY applies
+		proxyURL, err = proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if proxyURL == nil {
+		return dialer.Dial("tcp", addr)
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := dialer.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy %s: %v", proxyURL.Host, err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT to proxy: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading CONNECT response from proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The server may already have sent its greeting into the buffer
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,90 @@
+package shinbun
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// channelNeedsInvite reports whether a fetch error means the bot can't see or
+// read the channel, which only inviting it, or dropping the channel from the
+// focus, fixes.
+func channelNeedsInvite(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not_in_channel") || strings.Contains(msg, "channel_not_found") || strings.HasSuffix(msg, " not found")
+}
+
+// checkChannelAccess tells the operator when the bot needs inviting to the
+// channel, once until the channel has been read again; err is the fetch's
+// outcome.
+func (p *pipeline) checkChannelAccess(channel string, err error) {
+	if err == nil {
+		if _, err := p.db.Exec(`DELETE FROM channel_notices WHERE channel = $1`, channel); err != nil {
+			p.logger.Warn("Failed to clear channel notice", zap.String("channel", channel), zap.Error(err))
+		}
+		return
+	}
+	if channelNeedsInvite(err) {
+		p.noticeChannelInvite(channel)
+	}
+}
+
+// noticeChannelInvite sends the operator an invite request for the channel,
+// unless one was already sent. Without OPERATOR_NOTIFY it is logged instead;
+// dry runs print it.
+func (p *pipeline) noticeChannelInvite(channel string) {
+	name := strings.TrimPrefix(channel, "#")
+	bot := "@shinbun"
+	if p.filter.OwnUserID != "" {
+		bot = "<@" + p.filter.OwnUserID + ">"
+	}
+	text := fmt.Sprintf("Shinbun can't read #%s. Invite %s to #%s (`/invite %s` in the channel), or remove it from %s.",
+		name, bot, name, bot, focusChannelsVariable(p.config, p.flags.Focus))
+
+	if p.flags.DryRun {
+		to := p.config.OperatorNotify
+		if to == "" {
+			to = "the log"
+		}
+		p.flags.Output.event("notice", map[string]any{"channel": channel, "text": text},
+			fmt.Sprintf("\n--- DRY RUN: Notice to %s ---\n%s", to, text))
+		return
+	}
+
+	res, err := p.db.Exec(`INSERT INTO channel_notices (channel, notified_at) VALUES ($1, $2) ON CONFLICT (channel) DO NOTHING`,
+		channel, p.config.Clock.Now())
+	if err != nil {
+		p.logger.Error("Failed to record channel notice", zap.String("channel", channel), zap.Error(err))
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return
+	}
+
+	if p.config.OperatorNotify == "" {
+		p.logger.Warn("Channel needs the bot invited (set OPERATOR_NOTIFY to be told in Slack)", zap.String("channel", channel), zap.String("notice", text))
+		return
+	}
+	if _, _, err := p.api.PostMessage(p.config.OperatorNotify, slack.MsgOptionText(text, false), slack.MsgOptionDisableLinkUnfurl()); err != nil {
+		p.logger.Error("Failed to send channel notice", zap.String("channel", channel), zap.Error(err))
+		// Try again next run
+		if _, err := p.db.Exec(`DELETE FROM channel_notices WHERE channel = $1`, channel); err != nil {
+			p.logger.Warn("Failed to clear channel notice", zap.String("channel", channel), zap.Error(err))
+		}
+		return
+	}
+	p.logger.Info("Sent channel invite notice", zap.String("channel", channel), zap.String("to", p.config.OperatorNotify))
+}
+
+// focusChannelsVariable is the setting that lists the focus's channels.
+func focusChannelsVariable(config *Config, focus string) string {
+	if _, ok := config.FocusProfiles[strings.ToLower(focus)]; ok {
+		return "FOCUS_CONFIG"
+	}
+	if focus == "support" {
+		return "SUPPORT_FOCUS_CHANNELS"
+	}
+	return "DEFAULT_FOCUS_CHANNELS"
+}
@@ -0,0 +1,127 @@
+package shinbun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Formats of the digest file written with --output.
+const (
+	outputFormatMarkdown = "md"
+	outputFormatHTML     = "html"
+	outputFormatJSON     = "json"
+)
+
+// cliOutput is how a run writes to stdout: human-readable text by default,
+// nothing with --quiet and one JSON object per line with --json. Logs go to
+// stderr either way.
+type cliOutput struct {
+	Quiet bool
+	JSON  bool
+}
+
+// event writes a JSON event with the given fields in --json mode, or text in
+// the default mode.
+func (o cliOutput) event(name string, fields map[string]any, text string) {
+	switch {
+	case o.JSON:
+		event := map[string]any{"event": name}
+		for k, v := range fields {
+			event[k] = v
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(event); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s event: %v\n", name, err)
+		}
+	case !o.Quiet:
+		fmt.Println(text)
+	}
+}
+
+// text writes a line in the default mode only, for headings and other output
+// that has no JSON event.
+func (o cliOutput) text(text string) {
+	if !o.JSON && !o.Quiet {
+		fmt.Println(text)
+	}
+}
+
+// summary writes the finished digest.
+func (o cliOutput) summary(focus, summary string, pager bool) {
+	if o.JSON || o.Quiet {
+		o.event("summary", map[string]any{"focus": focus, "text": summary}, "")
+		return
+	}
+	printSummary(summary, pager)
+}
+
+// digestOutput is the finished digest as written to the --output file.
+type digestOutput struct {
+	Focus      string `json:"focus"`
+	Date       string `json:"date"`
+	Issue      int    `json:"issue,omitempty"`
+	Subject    string `json:"subject"`
+	Title      string `json:"title,omitempty"`
+	ArchiveURL string `json:"archive_url,omitempty"`
+	Markdown   string `json:"markdown"`
+	HTML       string `json:"html"`
+}
+
+func newDigestOutput(config *Config, focus string, issue digestIssue, subject, summary, archiveURL string) digestOutput {
+	return digestOutput{
+		Focus:      focus,
+		Date:       issue.Date.Format("2006-01-02"),
+		Issue:      issue.Number,
+		Subject:    subject,
+		Title:      issue.Title,
+		ArchiveURL: archiveURL,
+		Markdown:   summary,
+		HTML:       renderHTMLPage(summary, config.webBranding()),
+	}
+}
+
+// checkOutputFormat validates --format, which only applies with --output.
+func checkOutputFormat(path, format string) error {
+	switch format {
+	case outputFormatMarkdown, outputFormatHTML, outputFormatJSON:
+	default:
+		return fmt.Errorf("--format must be %s, %s or %s", outputFormatMarkdown, outputFormatHTML, outputFormatJSON)
+	}
+	if path == "" && format != outputFormatMarkdown {
+		return fmt.Errorf("--format needs --output")
+	}
+	return nil
+}
+
+// write saves the digest to path as markdown, an HTML page, or a JSON object
+// with both and the digest's metadata. The file is replaced whole, so a
+// pipeline watching it never reads half a digest.
+func (d digestOutput) write(path, format string) error {
+	var data []byte
+	switch format {
+	case outputFormatHTML:
+		data = []byte(d.HTML)
+	case outputFormatJSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			return fmt.Errorf("error encoding digest: %v", err)
+		}
+		data = buf.Bytes()
+	default:
+		data = []byte(strings.TrimRight(d.Markdown, "\n") + "\n")
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
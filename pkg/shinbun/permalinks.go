@@ -0,0 +1,122 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// permalinkCache keeps message permalinks by channel and timestamp, so
+// messages fetched again, e.g. by a re-run or an overlapping --from-date,
+// aren't looked up with chat.getPermalink again. An entry only matches the
+// channel name it was stored under, so renaming a channel invalidates them.
+// With the workspace's archive URL, permalinks are built instead.
+type permalinkCache struct {
+	db     *sql.DB
+	logger *zap.Logger
+	// base is the archive URL permalinks are built on, e.g.
+	// "https://acme.slack.com/archives/", or "" to fetch them
+	base string
+	// verified is set once a built permalink matched Slack's
+	verified bool
+	// Hits, Misses and Built count lookups, for the channel's log line
+	Hits, Misses, Built int
+	// disabled stops using the cache after an error, e.g. before migrating
+	disabled bool
+}
+
+// permalink returns the message's permalink: built from the archive URL, or
+// from the cache or, failing that, from Slack, storing it for next time. The
+// first built permalink is checked against Slack's, which differs e.g. on
+// Enterprise Grid; on a mismatch permalinks are fetched from then on.
+func (c *permalinkCache) permalink(api *slack.Client, channelID, channelName, ts string) (string, error) {
+	if c.base != "" && c.verified {
+		c.Built++
+		return buildPermalink(c.base, channelID, ts), nil
+	}
+	if !c.disabled {
+		var link string
+		err := c.db.QueryRow(`SELECT permalink FROM permalinks WHERE channel_id = $1 AND ts = $2 AND channel_name = $3`,
+			channelID, ts, channelName).Scan(&link)
+		if err == nil {
+			c.Hits++
+			return link, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			c.disabled = true
+			c.logger.Warn("Failed to read the permalink cache, fetching permalinks from Slack", zap.Error(err))
+		}
+	}
+
+	link, err := c.fetch(api, channelID, channelName, ts)
+	if err != nil || c.base == "" {
+		return link, err
+	}
+	if built := buildPermalink(c.base, channelID, ts); built != link {
+		c.logger.Warn("Built permalink doesn't match Slack's, fetching permalinks from Slack",
+			zap.String("built", built), zap.String("permalink", link))
+		c.base = ""
+	} else {
+		c.verified = true
+	}
+	return link, nil
+}
+
+// fetch gets the message's permalink from Slack and stores it.
+func (c *permalinkCache) fetch(api *slack.Client, channelID, channelName, ts string) (string, error) {
+	c.Misses++
+	link, err := api.GetPermalink(&slack.PermalinkParameters{Channel: channelID, Ts: ts})
+	if err != nil {
+		return "", err
+	}
+	if !c.disabled {
+		_, err := c.db.Exec(`
+			INSERT INTO permalinks (channel_id, ts, channel_name, permalink)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (channel_id, ts)
+			DO UPDATE SET channel_name = EXCLUDED.channel_name, permalink = EXCLUDED.permalink, fetched_at = CURRENT_TIMESTAMP`,
+			channelID, ts, channelName, link)
+		if err != nil {
+			c.disabled = true
+			c.logger.Warn("Failed to store permalink, fetching permalinks from Slack", zap.Error(err))
+		}
+	}
+	return link, nil
+}
+
+// buildPermalink is the permalink of a top-level message: its timestamp
+// without the dot, under the channel's archive.
+func buildPermalink(base, channelID, ts string) string {
+	return base + channelID + "/p" + strings.Replace(ts, ".", "", 1)
+}
+
+// permalinkBase returns the archive URL permalinks are built on, from the
+// workspace's domain in team.info, looked up once per run. It is "" when the
+// lookup fails, e.g. without the team:read scope, and permalinks are then
+// fetched from Slack.
+func (p *pipeline) permalinkBase() string {
+	if !p.teamLooked {
+		p.teamLooked = true
+		team, err := p.api.GetTeamInfo()
+		switch {
+		case err != nil:
+			p.logger.Info("Couldn't look up the workspace domain, fetching permalinks from Slack", zap.Error(err))
+		case team.Domain != "":
+			p.archiveBase = "https://" + team.Domain + ".slack.com/archives/"
+		}
+	}
+	return p.archiveBase
+}
+
+// forgetPermalinks drops the cached permalinks of a channel, e.g. once it is
+// renamed.
+func forgetPermalinks(db execer, channelID string) error {
+	if _, err := db.Exec(`DELETE FROM permalinks WHERE channel_id = $1`, channelID); err != nil {
+		return fmt.Errorf("error clearing cached permalinks: %v", err)
+	}
+	return nil
+}
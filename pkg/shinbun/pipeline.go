@@ -0,0 +1,625 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// pipeline holds what the stages of a digest run share: clients, filters and
+// the run's flags. A run fetches each channel, summarizes everything fetched
+// and delivers the summary; queued runs do each as a separate job.
+type pipeline struct {
+	api      *slack.Client
+	db       *sql.DB
+	config   *Config
+	flags    Flags
+	logger   *zap.Logger
+	channels []string
+	// fetches are the channels fetched for this digest, by fetch stage
+	fetches []channelFetch
+
+	client     *openai.Client
+	sharedHTTP *http.Client
+	targets    []namedTarget
+	filter     ingestionFilter
+	users      *userDirectory
+	translate  translateFunc
+	embed      embedFunc
+	template   *template.Template
+	// archiveBase is the workspace's archive URL permalinks are built on,
+	// looked up on first use (teamLooked)
+	archiveBase string
+	teamLooked  bool
+}
+
+// channelsForFocus returns the Slack channels a focus covers.
+func channelsForFocus(config *Config, focus string, logger *zap.Logger) ([]string, error) {
+	if profile, ok := config.FocusProfiles[strings.ToLower(focus)]; ok {
+		return profile.Channels, nil
+	}
+	switch focus {
+	case "support":
+		if len(config.SupportFocusChannels) == 0 {
+			return nil, errors.New("focus 'support' selected, but SUPPORT_FOCUS_CHANNELS is not defined or empty in .env")
+		}
+		return config.SupportFocusChannels, nil
+	case "default":
+		return config.DefaultFocusChannels, nil
+	default:
+		logger.Warn("Unknown focus specified, using default channels", zap.String("focus", focus))
+		return config.DefaultFocusChannels, nil
+	}
+}
+
+// newPipeline validates the run's settings and sets up its clients.
+func newPipeline(api *slack.Client, db *sql.DB, config *Config, flags Flags, logger *zap.Logger) (*pipeline, error) {
+	if flags.NoLLM {
+		// Nothing may be sent to OpenAI or another hosted model: correlate by
+		// ticket ID only, unless embeddings are computed locally, and drop LLM
+		// translation
+		if config.EmbeddingProvider != "local" {
+			config.CorrelationSimilarity = 0
+		}
+		if config.TranslationProvider == "openai" {
+			logger.Info("Translation via OpenAI disabled in --no-llm mode")
+			config.TranslationProvider = ""
+		}
+		if config.SentimentScoring == sentimentLLM {
+			logger.Info("Scoring sentiment locally in --no-llm mode")
+			config.SentimentScoring = sentimentLocal
+		}
+		if flags.DumpPrompt != "" {
+			logger.Warn("--dump-prompt has no effect with --no-llm, there is no prompt")
+		}
+	} else if config.OpenAIToken == "" && config.OpenAIBaseURL == "" {
+		return nil, errors.New("OPENAI_API_KEY is required unless --no-llm or OPENAI_BASE_URL is set")
+	}
+	if config.batchFocus(flags.Focus) {
+		flags.Batch = true
+	}
+	if flags.Batch && flags.Stream {
+		logger.Info("--stream is ignored for Batch API summaries, which arrive whole")
+		flags.Stream = false
+	}
+
+	p := &pipeline{api: api, db: db, config: config, flags: flags, logger: logger}
+	var err error
+	if p.template, err = loadDigestTemplate(config.DigestTemplate); err != nil {
+		return nil, fmt.Errorf("invalid DIGEST_TEMPLATE: %v", err)
+	}
+	if p.channels, err = channelsForFocus(config, flags.Focus, logger); err != nil {
+		return nil, err
+	}
+	config.useFocusWeights(flags.Focus)
+
+	openAIHTTP, err := newHTTPClient(config.networkFor("openai"), 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAI network configuration: %v", err)
+	}
+	openAIConfig := openai.DefaultConfig(config.OpenAIToken)
+	if config.OpenAIBaseURL != "" {
+		openAIConfig.BaseURL = strings.TrimSuffix(config.OpenAIBaseURL, "/")
+	}
+	openAIHTTP = withGateway(openAIHTTP, config)
+	openAIHTTP = withUsage(openAIHTTP, config.Usage, usageOpenAI)
+	openAIConfig.HTTPClient = withCircuitBreakers(openAIHTTP, config.CircuitBreakerThreshold, config.CircuitBreakerCooldown, logger)
+	p.client = openai.NewClientWithConfig(openAIConfig)
+	if !flags.NoLLM {
+		// Encodings are downloaded once, like OpenAI calls through its proxy
+		tokenizerHTTP, err := newHTTPClient(config.networkFor("openai"), 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenAI network configuration: %v", err)
+		}
+		loadTokenizers([]string{config.OpenAIModel, config.OpenAICheapModel}, tokenizerHTTP, logger)
+	}
+
+	p.sharedHTTP, err = newHTTPClient(config.networkFor(""), 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network configuration: %v", err)
+	}
+	p.sharedHTTP = withCircuitBreakers(p.sharedHTTP, config.CircuitBreakerThreshold, config.CircuitBreakerCooldown, logger)
+
+	if p.targets, err = newDeliveryTargets(config, p.sharedHTTP, logger); err != nil {
+		return nil, err
+	}
+	p.filter = newIngestionFilter(api, config, flags.Focus, logger)
+	p.users = newUserDirectory(api, db, logger)
+	if p.translate, err = newTranslator(config, p.client, p.sharedHTTP); err != nil {
+		return nil, fmt.Errorf("invalid translation configuration: %v", err)
+	}
+	if p.embed, err = newEmbedder(config, p.client, p.sharedHTTP); err != nil {
+		return nil, fmt.Errorf("invalid embedding configuration: %v", err)
+	}
+	return p, nil
+}
+
+// runDigest fetches, summarizes and delivers one digest for the focus in
+// flags, and returns its markdown, which is "" when there was nothing new.
+func runDigest(api *slack.Client, db *sql.DB, config *Config, flags Flags, fromDate, until time.Time, logger *zap.Logger) (string, error) {
+	p, err := newPipeline(api, db, config, flags, logger)
+	if err != nil {
+		return "", err
+	}
+	defer config.Usage.log(logger)
+
+	logger.Info("Starting shinbun process",
+		zap.String("focus", flags.Focus),
+		zap.Strings("channels", p.channels),
+		zap.String("from_date_flag", flags.FromDateStr),
+		zap.Time("parsed_from_date", fromDate),
+		zap.Bool("dry_run", flags.DryRun),
+	)
+
+	preRun := hookContext{Hook: hookPreRun, Focus: flags.Focus, Time: config.Clock.Now(), DryRun: flags.DryRun, Channels: p.channels}
+	if err := runHook(config, preRun, logger); err != nil {
+		// A failing pre-run hook vetoes the run, e.g. on holidays
+		return "", fmt.Errorf("not running: %v", err)
+	}
+	if err := p.preflight(preflightStages{Fetch: true, Summarize: true, Deliver: true}); err != nil {
+		return "", err
+	}
+
+	if _, err := reconcileChannels(api, db, p.channels, logger); err != nil {
+		logger.Warn("Failed to reconcile channels with Slack", zap.Error(err))
+	}
+	if config.LearnWeights && !flags.DryRun {
+		maybeLearnWeights(api, db, config, logger)
+	}
+
+	var allUpdates []Update
+	var totalMessagesSaved int
+	for _, channelName := range p.channels {
+		channelName = strings.TrimSpace(channelName)
+		if channelName == "" {
+			continue
+		}
+		// On a failed save the fetched updates still come back for this digest
+		updates, saved, err := p.fetchChannel(channelName, fromDate, until, true)
+		switch {
+		case err == nil:
+			p.fetches = append(p.fetches, channelFetch{Channel: channelName, Messages: saved})
+		case updates == nil:
+			if channelNeedsInvite(err) {
+				logger.Warn("Bot can't read channel, skipping it", zap.String("channel", channelName), zap.Error(err))
+			} else {
+				logger.Error("Failed to fetch channel", zap.String("channel", channelName), zap.Error(err))
+			}
+			p.fetches = append(p.fetches, channelFetch{Channel: channelName, Error: err.Error()})
+		default:
+			// Fetched but not saved: the messages are in this digest all the same
+			logger.Error("Failed to fetch channel", zap.String("channel", channelName), zap.Error(err))
+		}
+		totalMessagesSaved += saved
+		allUpdates = append(allUpdates, updates...)
+	}
+
+	summary, editionTitle, err := p.summarize(allUpdates, fromDate, until, totalMessagesSaved)
+	if err != nil || summary == "" {
+		return "", err
+	}
+	deliverSummary(api, p.client, db, config, flags, p.targets, summary, editionTitle, nil, logger)
+	return summary, nil
+}
+
+// fetchChannel fetches the channel's new messages from Slack and saves them
+// page by page. With collect it returns them along with the channel's stored
+// messages of the past week; fetch-only runs don't hold them. Past
+// MaxChannelMessages the channel's highest-priority stored messages are
+// returned instead. When saving fails the updates are returned along with the
+// error.
+func (p *pipeline) fetchChannel(channelName string, fromDate, until time.Time, collect bool) (updates []Update, saved int, err error) {
+	config, db, logger := p.config, p.db, p.logger
+
+	logger.Info("Fetching channel ID", zap.String("channel", channelName))
+	channelSlackID, channelDbID, err := getChannelID(p.api, db, channelName, logger)
+	if err != nil {
+		err = fmt.Errorf("error getting channel ID: %v", err)
+		p.checkChannelAccess(channelName, err)
+		return nil, 0, err
+	}
+
+	var since time.Time
+	if !fromDate.IsZero() {
+		since = fromDate
+		logger.Info("Using --from-date flag for fetch start time",
+			zap.String("channel", channelName),
+			zap.Time("since", since))
+	} else {
+		lastFetch, err := getLastFetchTime(db, channelDbID, config.Clock.Now(), logger)
+		if err != nil {
+			logger.Error("Failed to get last fetch time", zap.String("channel", channelName), zap.Error(err))
+			lastFetch = config.Clock.Now().Add(-24 * time.Hour)
+			logger.Warn("Defaulting fetch time to 24 hours ago", zap.String("channel", channelName))
+		}
+		since = lastFetch
+		logger.Info("Using last fetch time from database for fetch start time",
+			zap.String("channel", channelName),
+			zap.Time("since", since))
+	}
+
+	logger.Info("Summarizing channel",
+		zap.String("channel", channelName),
+	)
+
+	// Pages are translated and stored while the next one is fetched, so a
+	// backfill holds one page at a time and a failure keeps what was stored
+	pages := make(chan []Update, 1)
+	stop := make(chan struct{})
+	fetched := make(chan error, 1)
+	permalinks := &permalinkCache{db: db, logger: logger, base: p.permalinkBase()}
+	go func() {
+		defer close(pages)
+		fetched <- summarizeChannel(p.api, permalinks, channelSlackID, channelName, since, until, p.filter, p.users, p.config.CategoryTerms, pages, stop, logger)
+	}()
+
+	limit := config.MaxChannelMessages
+	var slackUpdates []Update
+	var newest time.Time
+	var saveErr error
+	spilled := false
+	for page := range pages {
+		page = translateUpdates(p.translate, config.TranslationTargetLang, page, logger)
+		if saveErr == nil {
+			pageNewest, err := saveMessagePage(db, channelDbID, page, logger)
+			if err != nil {
+				saveErr = err
+				if !collect {
+					close(stop)
+				}
+			} else {
+				saved += len(page)
+				if pageNewest.After(newest) {
+					newest = pageNewest
+				}
+				logger.Debug("Saved page of messages", zap.String("channel", channelName), zap.Int("messages", len(page)))
+			}
+		}
+		if !collect {
+			continue
+		}
+		// Past the limit stored messages aren't held: the channel's
+		// highest-priority ones are loaded back from the database instead
+		if !spilled && saveErr == nil && limit > 0 && len(slackUpdates)+len(page) > limit {
+			logger.Info("Channel has more messages than MAX_CHANNEL_MESSAGES, loading its highest-priority ones from the database",
+				zap.String("channel", channelName),
+				zap.Int("limit", limit))
+			spilled = true
+			slackUpdates = nil
+		}
+		if !spilled || saveErr != nil {
+			slackUpdates = append(slackUpdates, page...)
+		}
+	}
+	err = <-fetched
+	if permalinks.base == "" {
+		// Built permalinks didn't match Slack's
+		p.archiveBase = ""
+	}
+	p.checkChannelAccess(channelName, err)
+	if err != nil {
+		// Stored pages are kept; last_fetched stays, so the next run fetches
+		// the rest again
+		return nil, saved, err
+	}
+	// History is paged newest first, so last_fetched only moves once every
+	// page is stored
+	if saveErr == nil && saved > 0 {
+		saveErr = updateLastFetchTime(db, channelDbID, newest, logger)
+	}
+	if saveErr != nil {
+		// The watermark wasn't moved either, so the next run fetches these again
+		saveErr = fmt.Errorf("error saving messages, channel will be fetched again next run: %v", saveErr)
+	} else {
+		logger.Info("Saved messages for channel",
+			zap.String("channel", channelName),
+			zap.Int("messages_saved", saved),
+		)
+	}
+	if !collect {
+		return nil, saved, saveErr
+	}
+
+	dbSince := config.Clock.Now().AddDate(0, 0, -7)
+	if spilled && since.Before(dbSince) {
+		dbSince = since
+	}
+	dbUpdates, err := getMessagesFromDB(db, channelDbID, dbSince, until, limit, logger)
+	if err != nil {
+		if saveErr != nil {
+			return slackUpdates, saved, saveErr
+		}
+		return nil, saved, err
+	}
+
+	seenMessages := make(map[string]bool)
+
+	for _, update := range slackUpdates {
+		if !seenMessages[update.Timestamp] {
+			seenMessages[update.Timestamp] = true
+			updates = append(updates, update)
+		}
+	}
+
+	for _, update := range dbUpdates {
+		if !seenMessages[update.Timestamp] {
+			seenMessages[update.Timestamp] = true
+			updates = append(updates, update)
+		}
+	}
+
+	logger.Info("Processing messages for channel",
+		zap.String("channel", channelName),
+		zap.Int("total_messages", len(updates)),
+		zap.Int("new_messages", len(slackUpdates)),
+		zap.Int("db_messages", len(dbUpdates)),
+	)
+	return updates, saved, saveErr
+}
+
+// summarize adds the external sources to the fetched updates and writes the
+// digest: with the LLM, or from the template with --no-llm. It returns "" when
+// there is nothing to summarize.
+func (p *pipeline) summarize(allUpdates []Update, fromDate, until time.Time, messagesSaved int) (summary string, editionTitle string, err error) {
+	config, db, flags, logger, client := p.config, p.db, p.flags, p.logger, p.client
+
+	sourceSince := fromDate
+	if sourceSince.IsZero() {
+		sourceSince = config.Clock.Now().AddDate(0, 0, -7)
+	}
+	externalUpdates := fetchExternalUpdates(config, flags.Focus, sourceSince, p.sharedHTTP, logger)
+	allUpdates = append(allUpdates, translateUpdates(p.translate, config.TranslationTargetLang, externalUpdates, logger)...)
+	if !until.IsZero() {
+		allUpdates = updatesBefore(allUpdates, until)
+	}
+	// Messages stored before mentions were resolved at fetch time
+	allUpdates = resolveMentions(p.users, allUpdates)
+	allUpdates = truncateCodeBlocks(allUpdates, config.CodeBlockMaxChars)
+	allUpdates = excerptLongMessages(allUpdates, messageExcerpter{MaxChars: config.MessageMaxChars, EdgeLines: config.MessageExcerptLines, Keywords: config.ExcerptKeywords}, logger)
+
+	logger.Info("Finished processing all channels",
+		zap.Int("total_messages_saved", messagesSaved),
+		zap.Int("total_updates", len(allUpdates)),
+		zap.Any("skipped", p.filter.Skipped),
+	)
+
+	if len(allUpdates) == 0 {
+		logger.Info("No updates found across monitored channels.")
+		flags.Output.event("no_updates", map[string]any{"focus": flags.Focus}, "\nNo new messages found in the last week.")
+		return "", "", nil
+	}
+
+	learned := learnedWeights{}
+	if config.LearnWeights {
+		if learned, err = loadLearnedWeights(db); err != nil {
+			logger.Error("Failed to load learned weights, scoring without them", zap.Error(err))
+		}
+	}
+	allUpdates = scoreUpdates(newScorers(config, learned, config.Clock.Now()), config.CategoryTerms, config.ReactionPriorityThreshold, allUpdates, logger)
+	flagAfterHours(allUpdates, config.BusinessHours, logger)
+	if config.FollowThreads {
+		names, err := channelNames(db)
+		if err != nil {
+			logger.Warn("Failed to load channel names, following named channel references only", zap.Error(err))
+		}
+		allUpdates = followThreads(allUpdates, names, logger)
+	}
+	var sampleBanner string
+	if flags.Sample > 0 {
+		// Sample before correlation, which embeds every update
+		total := len(allUpdates)
+		allUpdates = stratifiedSample(allUpdates, flags.Sample)
+		sampleBanner = sampleNote(len(allUpdates), total)
+		logger.Info("Summarizing a sample of the updates", zap.Int("sampled", len(allUpdates)), zap.Int("total", total))
+	}
+	allUpdates = correlateUpdates(p.embed, allUpdates, config.CorrelationSimilarity, config.MessageMaxChars, logger)
+
+	coverage := coverageNote(p.fetches)
+	if coverage != "" {
+		logger.Warn("Some channels couldn't be fetched, noting it in the digest")
+	}
+
+	var blockers string
+	if config.TrackBlockers {
+		blockers = trackBlockers(db, config.BlockerPatterns, allUpdates, sourceSince, logger)
+	}
+	var incidents string
+	if config.TrackIncidents {
+		incidents = trackIncidents(db, config.Incidents, allUpdates, p.channels, sourceSince, logger)
+	}
+	var followUps string
+	if config.TrackActionItems {
+		followUps = p.trackActionItems(allUpdates, sourceSince)
+	}
+	var sentiment string
+	if config.SentimentScoring != "" && p.supportFocus() {
+		sentiment = p.sentimentSection(allUpdates, sourceSince)
+	}
+
+	if flags.NoLLM {
+		summary, err := renderDigest(p.template, allUpdates, flags.Focus, config.Clock.Now(), "", 0)
+		if err != nil {
+			return "", "", err
+		}
+		summary += incidents
+		summary += followUps
+		summary += blockers
+		summary += sentiment
+		summary += communityHighlights(allUpdates, config.CommunityHighlightsMinReactions, config.CommunityHighlightsCount)
+		if config.AfterHoursCallout {
+			summary += afterHoursCallout(allUpdates, config.BusinessHours)
+		}
+		if config.QuietChannels {
+			summary += quietChannels(p.fetches)
+		}
+		summary = sampleBanner + coverage + summary
+		flags.Output.summary(flags.Focus, summary, flags.Pager)
+		return summary, "", nil
+	}
+
+	background := promptContext{
+		Calendar:     fetchCalendarContext(config, sourceSince, logger),
+		Channels:     fetchChannelContext(db, p.channels, logger),
+		Instructions: config.ChannelInstructions,
+		Now:          config.Clock.Now(),
+		Prompt:       config.focusPromptFor(flags.Focus),
+	}
+
+	selected, selection := selectWithinBudget(allUpdates, promptBudget(config, background), config.OpenAIModel, config.SourceBudgetShares, config.Clock.Now(), logger)
+
+	plan := planSummary(config, selected, background, logger)
+	if plan.TightenedBudget > 0 {
+		selected, selection = selectWithinBudget(allUpdates, plan.TightenedBudget, config.OpenAIModel, config.SourceBudgetShares, config.Clock.Now(), logger)
+	}
+	if flags.Batch && plan.MapModel != "" {
+		logger.Info("Map-reduce summaries don't use the Batch API, summarizing in real time")
+	} else if flags.Batch {
+		plan.BatchModel = config.openAIModelID(plan.Model)
+		plan.Batch = runBatch{db: db, runID: flags.RunID}
+	}
+
+	// Ticket IDs carry their URLs, so the model can cite them
+	promptUpdates := newTicketLinker(config.TicketURLTemplates).annotate(selected)
+
+	if flags.DumpPrompt != "" {
+		if plan.MapModel != "" {
+			logger.Warn("Map-reduce run: the dumped prompt is the single-call prompt, the final prompt is built from condensed notes")
+		}
+		systemMessage, prompt := summaryPrompt(promptUpdates, flags.Focus, background)
+		if err := writePromptDump(flags.DumpPrompt, systemMessage, prompt); err != nil {
+			logger.Error("Failed to dump prompt", zap.Error(err))
+		} else {
+			logger.Info("Wrote summary prompt", zap.String("path", flags.DumpPrompt))
+		}
+	}
+
+	var stream io.Writer
+	if flags.Stream {
+		fmt.Println("\nSummary:")
+		fmt.Print(sampleBanner + coverage)
+		stream = os.Stdout
+	}
+
+	summary, err = plan.run(client, promptUpdates, flags.Focus, background, stream, logger)
+	if err == nil {
+		summary = postProcess(newPostProcessors(config, selected), summary, logger)
+	}
+	if err == nil && config.EditionTitles {
+		if editionTitle, err = generateEditionTitle(client, config.OpenAICheapModel, summary); err != nil {
+			logger.Warn("Failed to generate edition title", zap.Error(err))
+			err = nil
+		}
+	}
+	var actionItems string
+	if err == nil && config.ExtractActionItems {
+		actionItems = p.actionItemsSection(client, selected)
+	}
+	if err != nil {
+		// Deliver what we have rather than losing the run after all the fetching
+		logger.Error("Failed to generate summary, sending degraded digest", zap.Error(err))
+		reason := "summarization failed"
+		if errors.Is(err, errRunCapTooLow) {
+			reason = err.Error()
+		}
+		summary = renderFallbackDigest(p.template, selected, flags.Focus, config.Clock.Now(), reason)
+		if flags.Stream {
+			fmt.Println(summary)
+		}
+	}
+
+	if actionItems != "" {
+		summary += actionItems
+		if flags.Stream {
+			fmt.Println(actionItems)
+		}
+	}
+
+	if config.SelectionReportAppendix {
+		appendix := selection.markdownAppendix()
+		summary += appendix
+		if flags.Stream && appendix != "" {
+			fmt.Println(appendix)
+		}
+	}
+
+	if incidents != "" {
+		summary += incidents
+		if flags.Stream {
+			fmt.Println(incidents)
+		}
+	}
+
+	if followUps != "" {
+		summary += followUps
+		if flags.Stream {
+			fmt.Println(followUps)
+		}
+	}
+
+	if blockers != "" {
+		summary += blockers
+		if flags.Stream {
+			fmt.Println(blockers)
+		}
+	}
+
+	if sentiment != "" {
+		summary += sentiment
+		if flags.Stream {
+			fmt.Println(sentiment)
+		}
+	}
+
+	if highlights := communityHighlights(allUpdates, config.CommunityHighlightsMinReactions, config.CommunityHighlightsCount); highlights != "" {
+		summary += highlights
+		if flags.Stream {
+			fmt.Println(highlights)
+		}
+	}
+
+	if config.AfterHoursCallout {
+		if callout := afterHoursCallout(allUpdates, config.BusinessHours); callout != "" {
+			summary += callout
+			if flags.Stream {
+				fmt.Println(callout)
+			}
+		}
+	}
+
+	if config.QuietChannels {
+		if quiet := quietChannels(p.fetches); quiet != "" {
+			summary += quiet
+			if flags.Stream {
+				fmt.Println(quiet)
+			}
+		}
+	}
+
+	if config.DigestStatistics {
+		stats, err := collectStats(db, sourceSince, config.BusinessHours)
+		if err != nil {
+			logger.Error("Failed to collect message statistics", zap.Error(err))
+		} else {
+			summary += stats.markdown()
+			if flags.Stream {
+				fmt.Println(stats.markdown())
+			}
+		}
+	}
+
+	summary = sampleBanner + coverage + summary
+	if !flags.Stream {
+		flags.Output.summary(flags.Focus, summary, flags.Pager)
+	}
+	return summary, editionTitle, nil
+}
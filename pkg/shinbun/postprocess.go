@@ -0,0 +1,218 @@
+package shinbun
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// postProcessor rewrites the summary the model produced before it is
+// delivered. SUMMARY_POSTPROCESSORS picks which ones run, in order.
+type postProcessor interface {
+	Name() string
+	Process(summary string) string
+}
+
+// postProcessorNames are the processors SUMMARY_POSTPROCESSORS may list.
+var postProcessorNames = []string{"links", "banned_words", "headings", "trim"}
+
+// newPostProcessors builds the configured chain. Link validation checks
+// against the links of the updates the summary was written from.
+func newPostProcessors(config *Config, updates []Update) []postProcessor {
+	var chain []postProcessor
+	for _, name := range config.SummaryPostProcessors {
+		switch name {
+		case "links":
+			validator := newLinkValidator(updates)
+			for _, link := range newTicketLinker(config.TicketURLTemplates).urls(updates) {
+				validator.known[link] = true
+			}
+			chain = append(chain, validator)
+		case "banned_words":
+			if len(config.BannedWords) > 0 {
+				chain = append(chain, newBannedWordFilter(config.BannedWords))
+			}
+		case "headings":
+			chain = append(chain, headingNormalizer{})
+		case "trim":
+			if config.SummaryMaxChars > 0 {
+				chain = append(chain, lengthTrimmer{MaxChars: config.SummaryMaxChars})
+			}
+		}
+	}
+	return chain
+}
+
+// postProcess runs summary through the chain, logging which processors
+// changed it.
+func postProcess(chain []postProcessor, summary string, logger *zap.Logger) string {
+	for _, p := range chain {
+		processed := p.Process(summary)
+		if processed != summary {
+			logger.Info("Post-processor changed the summary",
+				zap.String("processor", p.Name()),
+				zap.Int("chars_before", len([]rune(summary))),
+				zap.Int("chars_after", len([]rune(processed))))
+		}
+		summary = processed
+	}
+	return summary
+}
+
+// linkValidator unlinks web links the model didn't get from the input, which
+// are usually mangled or made up. The link text is kept.
+type linkValidator struct {
+	known map[string]bool
+}
+
+func newLinkValidator(updates []Update) linkValidator {
+	known := make(map[string]bool)
+	for _, u := range updates {
+		known[u.Link] = true
+		for _, link := range u.RelatedLinks {
+			known[link] = true
+		}
+	}
+	return linkValidator{known: known}
+}
+
+func (linkValidator) Name() string { return "links" }
+
+func (v linkValidator) Process(summary string) string {
+	return markdownLinkPattern.ReplaceAllStringFunc(summary, func(link string) string {
+		m := markdownLinkPattern.FindStringSubmatch(link)
+		if v.known[m[2]] || (!strings.HasPrefix(m[2], "http://") && !strings.HasPrefix(m[2], "https://")) {
+			return link
+		}
+		return m[1]
+	})
+}
+
+// bannedWordFilter replaces whole-word, case-insensitive matches of the
+// banned words with "[redacted]".
+type bannedWordFilter struct {
+	pattern *regexp.Regexp
+}
+
+func newBannedWordFilter(words []string) bannedWordFilter {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	// Longest first, so a phrase wins over a word it contains
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return bannedWordFilter{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+func (bannedWordFilter) Name() string { return "banned_words" }
+
+func (f bannedWordFilter) Process(summary string) string {
+	return f.pattern.ReplaceAllString(summary, "[redacted]")
+}
+
+// headingNormalizer makes heading levels consistent: a single leading
+// top-level heading stays the title, and the remaining levels become ##, ###
+// and so on without gaps. Emphasis and trailing colons are dropped from
+// heading text, and headings get blank lines around them.
+type headingNormalizer struct{}
+
+func (headingNormalizer) Name() string { return "headings" }
+
+var headingLevelPattern = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+func (headingNormalizer) Process(summary string) string {
+	lines := strings.Split(summary, "\n")
+	type heading struct {
+		index, level int
+		text         string
+	}
+	var headings []heading
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if m := headingLevelPattern.FindStringSubmatch(line); m != nil && !inFence {
+			text := strings.TrimSpace(stripMarkdownEmphasis(m[2]))
+			headings = append(headings, heading{index: i, level: len(m[1]), text: strings.TrimSuffix(text, ":")})
+		}
+	}
+	if len(headings) == 0 {
+		return summary
+	}
+
+	// A leading # heading is the title if it is the only one
+	title := -1
+	minRest := 7
+	for _, h := range headings[1:] {
+		minRest = min(minRest, h.level)
+	}
+	if headings[0].level == 1 && minRest > 1 {
+		title = headings[0].index
+	}
+
+	levels := make(map[int]bool)
+	for _, h := range headings {
+		if h.index != title {
+			levels[h.level] = true
+		}
+	}
+	var distinct []int
+	for level := range levels {
+		distinct = append(distinct, level)
+	}
+	sort.Ints(distinct)
+	normalized := make(map[int]int)
+	for i, level := range distinct {
+		normalized[level] = min(i+2, 6)
+	}
+
+	for _, h := range headings {
+		level := normalized[h.level]
+		if h.index == title {
+			level = 1
+		}
+		lines[h.index] = strings.Repeat("#", level) + " " + h.text
+	}
+
+	// Blank lines around headings, without doubling existing ones
+	var out []string
+	isHeading := make(map[int]bool)
+	for _, h := range headings {
+		isHeading[h.index] = true
+	}
+	for i, line := range lines {
+		if isHeading[i] && len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, line)
+		if isHeading[i] && i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// lengthTrimmer cuts the summary at the last line break before MaxChars and
+// says that it did.
+type lengthTrimmer struct {
+	MaxChars int
+}
+
+func (lengthTrimmer) Name() string { return "trim" }
+
+func (t lengthTrimmer) Process(summary string) string {
+	runes := []rune(summary)
+	if len(runes) <= t.MaxChars {
+		return summary
+	}
+	cut := string(runes[:t.MaxChars])
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \n") + fmt.Sprintf("\n\n_The summary was shortened to %d characters._\n", t.MaxChars)
+}
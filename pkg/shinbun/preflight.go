@@ -0,0 +1,157 @@
+package shinbun
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// preflightTimeout bounds the whole preflight, so a hanging service fails
+// the run in seconds rather than after the fetch.
+const preflightTimeout = 30 * time.Second
+
+// preflightCheck verifies one service the run depends on. Hint says what to
+// look at when it fails.
+type preflightCheck struct {
+	Name  string
+	Hint  string
+	Check func(ctx context.Context) error
+}
+
+// preflightStages says which parts of a run are ahead, and so which services
+// must work.
+type preflightStages struct {
+	Fetch, Summarize, Deliver bool
+}
+
+// preflightChecks are the checks for the stages ahead: the database always,
+// Slack to fetch or post the digest, OpenAI unless --no-llm, a local or Cohere
+// embedding provider to correlate, and SMTP to email the digest outside a dry
+// run.
+func (p *pipeline) preflightChecks(stages preflightStages) []preflightCheck {
+	checks := []preflightCheck{{
+		Name: "database",
+		Hint: "check the DB_ settings, or run shinbun db check",
+		Check: func(ctx context.Context) error {
+			if err := p.db.PingContext(ctx); err != nil {
+				return err
+			}
+			if problem := checkSchemaVersion(p.db); problem != nil {
+				return fmt.Errorf("%s", problem.Description)
+			}
+			return nil
+		},
+	}}
+
+	if stages.Fetch || (stages.Deliver && p.config.SlackDigestChannel != "") {
+		checks = append(checks, preflightCheck{
+			Name: "slack",
+			Hint: "check SLACK_BOT_TOKEN",
+			Check: func(ctx context.Context) error {
+				_, err := p.api.AuthTestContext(ctx)
+				return err
+			},
+		})
+	}
+
+	usesOpenAI := stages.Summarize || (stages.Fetch && p.config.TranslationProvider == "openai")
+	if usesOpenAI && !p.flags.NoLLM {
+		checks = append(checks, preflightCheck{
+			Name: "openai",
+			Hint: "check OPENAI_API_KEY, OPENAI_MODEL and, with a gateway, OPENAI_BASE_URL, OPENAI_HEADERS and OPENAI_MODEL_ALIASES",
+			Check: func(ctx context.Context) error {
+				models, err := p.client.ListModels(ctx)
+				if err != nil {
+					return err
+				}
+				id := p.config.openAIModelID(p.config.OpenAIModel)
+				for _, model := range models.Models {
+					if model.ID == id {
+						return nil
+					}
+				}
+				return fmt.Errorf("model %s is not available to this API key", id)
+			},
+		})
+	}
+
+	if stages.Summarize && p.embed != nil && p.config.EmbeddingProvider != "" && p.config.EmbeddingProvider != "openai" {
+		checks = append(checks, preflightCheck{
+			Name: "embeddings",
+			Hint: "check EMBEDDING_PROVIDER, EMBEDDING_BASE_URL, EMBEDDING_MODEL and COHERE_API_KEY",
+			Check: func(ctx context.Context) error {
+				_, err := p.embed([]string{"preflight"})
+				return err
+			},
+		})
+	}
+
+	if stages.Deliver && !p.flags.DryRun && p.config.SMTPHost != "" && p.config.SMTPPort != "" {
+		checks = append(checks, preflightCheck{
+			Name: "smtp",
+			Hint: "check SMTP_HOST, SMTP_PORT, SMTP_USER and SMTP_PASSWORD; shinbun email test shows the SMTP dialogue",
+			Check: func(ctx context.Context) error {
+				c, err := openSMTP(p.config, nil, func(string, ...any) {})
+				if err != nil {
+					return err
+				}
+				defer c.Close()
+				return c.Quit()
+			},
+		})
+	}
+	return checks
+}
+
+// preflight runs the checks for the stages ahead side by side and reports
+// every failure in one error, before any time is spent fetching.
+func (p *pipeline) preflight(stages preflightStages) error {
+	if p.config.SkipPreflight {
+		return nil
+	}
+	checks := p.preflightChecks(stages)
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	type result struct {
+		i   int
+		err error
+	}
+	start := time.Now()
+	results := make(chan result, len(checks))
+	for i, check := range checks {
+		go func(i int, check preflightCheck) {
+			results <- result{i, check.Check(ctx)}
+		}(i, check)
+	}
+
+	// Not every client honors ctx; a check still running at the deadline fails
+	errs := make([]error, len(checks))
+	for i := range errs {
+		errs[i] = fmt.Errorf("no answer within %s", preflightTimeout)
+	}
+wait:
+	for range checks {
+		select {
+		case r := <-results:
+			errs[r.i] = r.err
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	var failures []string
+	for i, check := range checks {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("  - %s: %v (%s)", check.Name, errs[i], check.Hint))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("preflight checks failed:\n%s", strings.Join(failures, "\n"))
+	}
+	p.logger.Debug("Preflight checks passed", zap.Int("checks", len(checks)), zap.Duration("duration", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,30 @@
+package shinbun
+
+import (
+	"fmt"
+	"os"
+)
+
+// promptFocuses are the focuses with their own summary prompt; any other focus
+// uses the default one.
+var promptFocuses = []string{"default", "support"}
+
+// summaryPrompt returns the system message and user prompt for summarizing
+// updates in a single completion.
+func summaryPrompt(updates []Update, focus string, background promptContext) (systemMessage string, prompt string) {
+	messages, hasDocs := formatUpdatesForPrompt(updates, background.Instructions)
+	return buildSummaryPrompt(messages, hasDocs, focus, background)
+}
+
+// formatPromptDump renders a prompt the way --dump-prompt writes it and the
+// golden files in testdata/prompts store it.
+func formatPromptDump(systemMessage, prompt string) string {
+	return "=== system ===\n" + systemMessage + "\n\n=== user ===\n" + prompt + "\n"
+}
+
+func writePromptDump(path, systemMessage, prompt string) error {
+	if err := os.WriteFile(path, []byte(formatPromptDump(systemMessage, prompt)), 0o644); err != nil {
+		return fmt.Errorf("error writing prompt dump: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package shinbun
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shinbun/internal/commontypes"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata from the current output")
+
+// goldenPromptInput is the fixed input the golden prompts are rendered from:
+// one update of each category, with background, at a fixed time.
+func goldenPromptInput() ([]Update, promptContext) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	at := func(hours int) string {
+		return commontypes.TimestampFromTime(now.Add(-time.Duration(hours) * time.Hour))
+	}
+
+	updates := []Update{
+		{Text: "Checkout API returning 500s since 08:10, investigating", Timestamp: at(1), Link: "https://example.slack.com/archives/C01/p1", Channel: "alerts", Category: "alert", Priority: 3, Score: 3.5, Status: statusEscalated},
+		{Text: "Customer ACME can't export invoices, ticket #4521", Timestamp: at(5), Link: "https://example.slack.com/archives/C02/p2", Channel: "support", Category: "support", Priority: 2, Score: 2.2,
+			RelatedLinks: []string{"https://example.zendesk.com/agent/tickets/4521"},
+			Attachments:  []Attachment{{Kind: "file", Title: "Export error", Name: "export-error.png", URL: "https://example.slack.com/files/U01/F01/export-error.png"}}},
+		{Text: "Quarterly planning moves to Thursday", Timestamp: at(26), Link: "https://example.slack.com/archives/C03/p3", Channel: "general", Category: "general", Priority: 1, Score: 1.1},
+		{Text: "Réunion d'équipe reportée à demain", Translation: "Team meeting moved to tomorrow", Timestamp: at(30), Link: "https://example.slack.com/archives/C04/p4", Channel: "paris", Category: "general", Priority: 1, Score: 1.0},
+		{Text: "Runbook for database failover updated", Timestamp: at(48), Link: "https://example.atlassian.net/wiki/spaces/OPS/pages/1", Channel: "OPS", Category: "docs", Priority: 1, Score: 0.9, Source: "confluence", Status: statusResolved},
+	}
+	background := promptContext{
+		Calendar:     "- 2025-01-07 10:00 JST: Release review",
+		Channels:     "- #alerts: Production alerts\n- #support: Customer escalations",
+		Instructions: map[string]string{"general": "Only mention company-wide announcements"},
+		Now:          now,
+	}
+	return updates, background
+}
+
+// TestSummaryPromptGolden compares the prompts of each focus with the golden
+// files in testdata/prompts. Run with -update to accept an intended change,
+// and commit the golden files with it so the review shows what the model
+// will see.
+func TestSummaryPromptGolden(t *testing.T) {
+	profiles, err := loadFocusProfiles(filepath.Join("testdata", "prompts", "focus.yaml"))
+	if err != nil {
+		t.Fatalf("loading focus profiles: %v", err)
+	}
+
+	tests := []string{"default", "support", "oncall"}
+	for _, focus := range tests {
+		t.Run(focus, func(t *testing.T) {
+			updates, background := goldenPromptInput()
+			config := &Config{FocusProfiles: profiles, ChannelInstructions: background.Instructions}
+			config.useFocusWeights(focus)
+			background.Instructions = config.ChannelInstructions
+			background.Prompt = config.focusPromptFor(focus)
+
+			got := formatPromptDump(summaryPrompt(updates, focus, background))
+			path := filepath.Join("testdata", "prompts", focus+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("prompt differs from %s; rerun with -update if this is intended\n%s", path, lineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// lineDiff describes the first line where want and got differ.
+func lineDiff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		wantLine, gotLine := "<end of file>", "<end of file>"
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if wantLine != gotLine {
+			return fmt.Sprintf("line %d\n  golden:  %q\n  current: %q", i+1, wantLine, gotLine)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package shinbun
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+const (
+	// summaryPromptOverheadTokens approximates the instructions and section
+	// headers wrapped around the messages in the summary prompt.
+	summaryPromptOverheadTokens = 1500
+	// summaryOutputTokens is the digest length assumed when estimating cost.
+	summaryOutputTokens = 2000
+	// mapPromptOverheadTokens approximates the map-step instructions per chunk.
+	mapPromptOverheadTokens = 300
+)
+
+// modelPrice is a model's list price in US dollars per million tokens.
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices covers the chat models shinbun is typically run with. Dated
+// snapshots are matched by prefix.
+var modelPrices = map[string]modelPrice{
+	"gpt-4o":        {Input: 2.50, Output: 10},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.60},
+	"gpt-4.1":       {Input: 2, Output: 8},
+	"gpt-4.1-mini":  {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":  {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+}
+
+// priceFor returns the price of the longest known model name prefixing model.
+func priceFor(model string) (modelPrice, bool) {
+	best := ""
+	for name := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
+
+// runEstimate is the projected OpenAI usage of a summary strategy. Cost is only
+// meaningful when every model involved has a known price.
+type runEstimate struct {
+	Tokens int
+	Cost   float64
+	Priced bool
+}
+
+func estimateCall(model string, inputTokens, outputTokens int) runEstimate {
+	price, ok := priceFor(model)
+	return runEstimate{
+		Tokens: inputTokens + outputTokens,
+		Cost:   (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6,
+		Priced: ok,
+	}
+}
+
+func (e runEstimate) add(other runEstimate) runEstimate {
+	return runEstimate{Tokens: e.Tokens + other.Tokens, Cost: e.Cost + other.Cost, Priced: e.Priced && other.Priced}
+}
+
+// within reports whether the estimate respects the configured caps. An unpriced
+// estimate can only be held to the token cap.
+func (e runEstimate) within(config *Config) bool {
+	if config.MaxTokensPerRun > 0 && e.Tokens > config.MaxTokensPerRun {
+		return false
+	}
+	if config.MaxCostPerRun > 0 && e.Priced && e.Cost > config.MaxCostPerRun {
+		return false
+	}
+	return true
+}
+
+func estimateSingleSummary(model string, messageTokens, contextTokens int) runEstimate {
+	return estimateCall(model, messageTokens+contextTokens+summaryPromptOverheadTokens, summaryOutputTokens)
+}
+
+func estimateMapReduceSummary(mapModel, model string, messageTokens, contextTokens, chunkTokens int, sectionTokens map[string]int) runEstimate {
+	chunks := max(1, (messageTokens+chunkTokens-1)/chunkTokens)
+	notesTokens := mapNotesTokens(sectionTokens, chunks)
+	mapStep := estimateCall(mapModel, messageTokens+chunks*mapPromptOverheadTokens, notesTokens)
+	return mapStep.add(estimateSingleSummary(model, notesTokens, contextTokens))
+}
+
+// errRunCapTooLow is returned when the per-run caps can't cover even an empty
+// summary prompt.
+var errRunCapTooLow = errors.New("the per-run cost cap is too low for a summary prompt")
+
+// summaryPlan is how the digest will be generated within the per-run caps.
+type summaryPlan struct {
+	Model string
+	// MapModel is set when messages are first condensed chunk by chunk.
+	MapModel       string
+	ChunkTokens    int
+	MapConcurrency int
+	SectionTokens  map[string]int
+	// TightenedBudget, when positive, is a smaller prompt token budget the
+	// messages must be reselected with.
+	TightenedBudget int
+	// Skip is set when the caps can't cover even an empty prompt.
+	Skip     bool
+	Estimate runEstimate
+	// Usage records the map step's rate-limit pauses.
+	Usage *apiUsage
+	// BatchModel, when set, is the name a single-call summary is submitted
+	// through the Batch API under.
+	BatchModel string
+	// Batch keeps the submitted batch on the run, for its retries.
+	Batch runBatch
+}
+
+// planSummary checks the estimated usage of summarizing updates against
+// MAX_COST_PER_RUN and MAX_TOKENS_PER_RUN. When a single call would exceed them
+// it switches to map-reduce with the cheaper model, and failing that shrinks the
+// prompt budget (and with it every source's share) until a single call fits.
+func planSummary(config *Config, updates []Update, background promptContext, logger *zap.Logger) summaryPlan {
+	plan := summaryPlan{Model: config.OpenAIModel, Usage: config.Usage}
+	if config.MaxCostPerRun <= 0 && config.MaxTokensPerRun <= 0 {
+		return plan
+	}
+
+	messageTokens := 0
+	for _, u := range updates {
+		messageTokens += updateTokens(config.OpenAIModel, u)
+	}
+	contextTokens := countTokens(config.OpenAIModel, background.Calendar) + countTokens(config.OpenAIModel, background.Channels)
+
+	plan.Estimate = estimateSingleSummary(config.OpenAIModel, messageTokens, contextTokens)
+	if config.MaxCostPerRun > 0 && !plan.Estimate.Priced {
+		logger.Warn("No price known for model, MAX_COST_PER_RUN can't be enforced", zap.String("model", config.OpenAIModel))
+	}
+	if plan.Estimate.within(config) {
+		plan.log("Run estimate within caps", config, logger)
+		return plan
+	}
+
+	if config.OpenAICheapModel != config.OpenAIModel {
+		mapReduce := estimateMapReduceSummary(config.OpenAICheapModel, config.OpenAIModel, messageTokens, contextTokens, config.MapChunkTokens, config.MapSectionTokens)
+		if mapReduce.within(config) {
+			plan.MapModel = config.OpenAICheapModel
+			plan.ChunkTokens = config.MapChunkTokens
+			plan.MapConcurrency = config.MapConcurrency
+			plan.SectionTokens = config.MapSectionTokens
+			plan.Estimate = mapReduce
+			plan.log("Run estimate exceeds caps, switching to map-reduce", config, logger)
+			return plan
+		}
+	}
+
+	budget := maxMessageTokens(config, background, contextTokens)
+	if budget <= 0 {
+		plan.Skip = true
+		logger.Error("Per-run caps are too low for even an empty summary prompt, skipping summary",
+			zap.Float64("max_cost_usd", config.MaxCostPerRun),
+			zap.Int("max_tokens", config.MaxTokensPerRun))
+		return plan
+	}
+	plan.TightenedBudget = budget
+	plan.Estimate = estimateSingleSummary(config.OpenAIModel, budget, contextTokens)
+	plan.log("Run estimate exceeds caps, tightening prompt budget", config, logger,
+		zap.Int("message_tokens", messageTokens),
+		zap.Int("tightened_budget", budget))
+	return plan
+}
+
+// maxMessageTokens is the largest message token count a single summary call
+// with the main model can take without exceeding the caps.
+func maxMessageTokens(config *Config, background promptContext, contextTokens int) int {
+	fixed := contextTokens + summaryPromptOverheadTokens
+	limit := -1
+	if config.MaxTokensPerRun > 0 {
+		limit = config.MaxTokensPerRun - summaryOutputTokens - fixed
+	}
+	if price, ok := priceFor(config.OpenAIModel); ok && config.MaxCostPerRun > 0 && price.Input > 0 {
+		remaining := config.MaxCostPerRun*1e6 - summaryOutputTokens*price.Output
+		byCost := int(remaining/price.Input) - fixed
+		if limit < 0 || byCost < limit {
+			limit = byCost
+		}
+	}
+	if budget := promptBudget(config, background); budget > 0 && limit > budget {
+		limit = budget
+	}
+	return limit
+}
+
+func (p summaryPlan) log(msg string, config *Config, logger *zap.Logger, fields ...zap.Field) {
+	fields = append(fields,
+		zap.String("model", p.Model),
+		zap.Int("estimated_tokens", p.Estimate.Tokens),
+		zap.Float64("estimated_cost_usd", p.Estimate.Cost),
+		zap.Int("max_tokens", config.MaxTokensPerRun),
+		zap.Float64("max_cost_usd", config.MaxCostPerRun))
+	if p.MapModel != "" {
+		fields = append(fields, zap.String("map_model", p.MapModel))
+	}
+	logger.Info(msg, fields...)
+}
+
+// run generates the digest according to the plan.
+func (p summaryPlan) run(client *openai.Client, updates []Update, focus string, background promptContext, stream io.Writer, logger *zap.Logger) (string, error) {
+	if p.Skip {
+		return "", errRunCapTooLow
+	}
+	if p.MapModel != "" {
+		return generateMapReduceSummary(client, p.MapModel, p.Model, p.ChunkTokens, p.MapConcurrency, p.SectionTokens, updates, focus, background, stream, p.Usage, logger)
+	}
+	if p.BatchModel != "" {
+		return generateBatchSummary(client, p.BatchModel, updates, focus, background, p.Batch, p.Usage, logger)
+	}
+	return generateSummary(client, p.Model, updates, focus, background, stream, logger)
+}
@@ -0,0 +1,305 @@
+package shinbun
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/store"
+)
+
+// queuedRun is a digest run waiting in the runs table, with the flags it
+// should run with. Staged runs are carried out as jobs, stage by stage.
+type queuedRun struct {
+	ID       int
+	Focus    string
+	FromDate string
+	AsOf     string
+	DryRun   bool
+	NoLLM    bool
+	Staged   bool
+}
+
+func (r queuedRun) flags() Flags {
+	return Flags{RunID: r.ID, Focus: r.Focus, FromDateStr: r.FromDate, AsOfStr: r.AsOf, DryRun: r.DryRun, NoLLM: r.NoLLM}
+}
+
+func runRunsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New("usage: shinbun runs enqueue --focus name [--from-date value] [--as-of value] [--dry-run] [--no-llm] [--staged] | runs next [--lease 1h] | runs list [--limit 20]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "enqueue":
+		fs := flag.NewFlagSet("runs enqueue", flag.ContinueOnError)
+		run := queuedRun{}
+		fs.StringVar(&run.Focus, "focus", "default", "Channel focus category of the run")
+		fs.StringVar(&run.FromDate, "from-date", "", "As for a digest run")
+		fs.StringVar(&run.AsOf, "as-of", "", "As for a digest run")
+		fs.BoolVar(&run.DryRun, "dry-run", false, "As for a digest run")
+		fs.BoolVar(&run.NoLLM, "no-llm", false, "As for a digest run")
+		fs.BoolVar(&run.Staged, "staged", false, "Queue the run as fetch, summarize and deliver jobs for shinbun jobs, retried independently")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		id, err := enqueueRun(db, config, run, logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("queued run %d\n", id)
+		return nil
+
+	case "next":
+		fs := flag.NewFlagSet("runs next", flag.ContinueOnError)
+		lease := fs.Duration("lease", defaultRunLease, "Take over runs that have been running this long, whose worker presumably died")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := checkLease(*lease); err != nil {
+			return err
+		}
+		return processNextRun(db, config, *lease, logger)
+
+	case "list":
+		fs := flag.NewFlagSet("runs list", flag.ContinueOnError)
+		limit := fs.Int("limit", 20, "Number of most recent runs to show")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return listRuns(db, *limit)
+	}
+	return usage
+}
+
+// enqueueRun validates the run's flags and queues it. A staged run is queued
+// with a fetch job per channel instead, which runs next leaves alone.
+func enqueueRun(db *sql.DB, config *Config, run queuedRun, logger *zap.Logger) (int, error) {
+	if run.Focus == "" {
+		return 0, errors.New("--focus is required")
+	}
+	if run.AsOf != "" {
+		if _, err := parseAsOf(run.AsOf); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := parseFromDate(run.FromDate, time.Now()); err != nil {
+		return 0, fmt.Errorf("invalid --from-date: %v", err)
+	}
+
+	status := "queued"
+	var channels []string
+	if run.Staged {
+		status = "staged"
+		var err error
+		if channels, err = channelsForFocus(config, run.Focus, logger); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO runs (focus, from_date, as_of, dry_run, no_llm, status)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6) RETURNING id`,
+		run.Focus, run.FromDate, run.AsOf, run.DryRun, run.NoLLM, status).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error queuing run: %v", err)
+	}
+	if err := enqueueFetchJobs(tx, id, channels); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error queuing run: %v", err)
+	}
+	return id, nil
+}
+
+// defaultRunLease is how long a run may be running before it is taken to have
+// been left by a worker that died, and is claimed again.
+const defaultRunLease = time.Hour
+
+// minLease is the shortest --lease accepted. A claimed run renews its lease
+// every third of it, which leaves the renewal time to land even when the
+// database is slow to answer.
+const minLease = time.Minute
+
+// checkLease rejects a --lease the heartbeat couldn't keep renewed.
+func checkLease(lease time.Duration) error {
+	if lease < minLease {
+		return fmt.Errorf("--lease must be at least %s, it is renewed every third of it", minLease)
+	}
+	return nil
+}
+
+// keepLease renews the lease on the running row id of table (runs or jobs)
+// every third of lease, by moving its started_at forward, until stop is
+// called. Work that outlives the lease is then only taken over once its
+// worker has stopped.
+func keepLease(db *sql.DB, table string, id int, lease time.Duration, logger *zap.Logger) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if _, err := db.Exec(`UPDATE `+table+` SET started_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'running'`, id); err != nil {
+				logger.Warn("Failed to renew lease", zap.String("table", table), zap.Error(err))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// claimRun marks the oldest queued run, or one whose lease has expired, as
+// running and returns it. SKIP LOCKED lets several workers claim at once
+// without taking the same run. With scheduledOnly it claims only runs of the
+// --serve scheduler. It returns sql.ErrNoRows when there is none.
+func claimRun(db *sql.DB, lease time.Duration, scheduledOnly bool) (queuedRun, error) {
+	scope := ""
+	if scheduledOnly {
+		scope = " AND scheduled_at IS NOT NULL"
+	}
+	var run queuedRun
+	err := db.QueryRow(`
+		UPDATE runs SET status = 'running', started_at = CURRENT_TIMESTAMP, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM runs
+			WHERE (status = 'queued' OR (status = 'running' AND started_at < $1))`+scope+`
+			ORDER BY enqueued_at, id
+			LIMIT 1
+			`+store.For(db).ForUpdate(true)+`)
+		RETURNING id, focus, COALESCE(from_date, ''), COALESCE(as_of, ''), dry_run, no_llm`,
+		time.Now().Add(-lease)).Scan(&run.ID, &run.Focus, &run.FromDate, &run.AsOf, &run.DryRun, &run.NoLLM)
+	return run, err
+}
+
+// finishRun records the run's result and, unless usage is nil, its API usage.
+func finishRun(db *sql.DB, id int, runErr error, usage *apiUsage) error {
+	status, message := "succeeded", ""
+	if runErr != nil {
+		status, message = "failed", runErr.Error()
+	}
+	usageJSON, err := usage.json()
+	if err != nil {
+		return fmt.Errorf("error encoding run usage: %v", err)
+	}
+	_, err = db.Exec(`
+		UPDATE runs SET status = $2, error = NULLIF($3, ''), finished_at = CURRENT_TIMESTAMP, usage = COALESCE(NULLIF($4, ''), usage)
+		WHERE id = $1`,
+		id, status, message, usageJSON)
+	if err != nil {
+		return fmt.Errorf("error recording run result: %v", err)
+	}
+	return nil
+}
+
+// processNextRun runs exactly one queued run, if there is one, so each
+// invocation can be a Kubernetes Job. It fails when the run does.
+func processNextRun(db *sql.DB, config *Config, lease time.Duration, logger *zap.Logger) error {
+	run, err := claimRun(db, lease, false)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Info("No queued runs")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error claiming run: %v", err)
+	}
+
+	logger = logger.With(zap.Int("run_id", run.ID))
+	logger.Info("Processing queued run", zap.String("focus", run.Focus), zap.Bool("dry_run", run.DryRun))
+	stopLease := keepLease(db, "runs", run.ID, lease, logger)
+	runErr := executeRun(db, config, run, logger)
+	stopLease()
+	if err := finishRun(db, run.ID, runErr, config.Usage); err != nil {
+		logger.Error("Failed to record run result", zap.Error(err))
+	}
+	if runErr != nil {
+		return fmt.Errorf("run %d failed: %v", run.ID, runErr)
+	}
+	logger.Info("Queued run finished")
+	return nil
+}
+
+func executeRun(db *sql.DB, config *Config, run queuedRun, logger *zap.Logger) error {
+	flags := run.flags()
+	fromDate, until, err := resolveWindow(config, flags.FromDateStr, flags.AsOfStr, logger)
+	if err != nil {
+		return err
+	}
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		return err
+	}
+	_, err = runDigest(api, db, config, flags, fromDate, until, logger)
+	return err
+}
+
+func listRuns(db *sql.DB, limit int) error {
+	rows, err := db.Query(`
+		SELECT id, focus, status, attempts, enqueued_at, finished_at, COALESCE(error, ''), COALESCE(usage, '')
+		FROM runs ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return fmt.Errorf("error listing runs: %v", err)
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFOCUS\tSTATUS\tATTEMPTS\tQUEUED\tFINISHED\tUSAGE\tERROR")
+	for rows.Next() {
+		var id, attempts int
+		var focus, status, runErr, usageJSON string
+		var enqueued time.Time
+		var finished sql.NullTime
+		if err := rows.Scan(&id, &focus, &status, &attempts, &enqueued, &finished, &runErr, &usageJSON); err != nil {
+			return fmt.Errorf("error scanning run: %v", err)
+		}
+		finishedAt := "-"
+		if finished.Valid {
+			finishedAt = finished.Time.Format(time.DateTime)
+		}
+		usage := "-"
+		if usageJSON != "" {
+			u := newAPIUsage()
+			if err := json.Unmarshal([]byte(usageJSON), u); err == nil {
+				usage = u.brief()
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", id, focus, status, attempts, enqueued.Format(time.DateTime), finishedAt, usage, excerpt(runErr, 60))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error listing runs: %v", err)
+	}
+	return w.Flush()
+}
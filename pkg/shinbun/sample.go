@@ -0,0 +1,94 @@
+package shinbun
+
+import (
+	"fmt"
+	"sort"
+)
+
+// stratifiedSample picks n of updates so that each channel, day and priority
+// keeps its share: every stratum gets one pick while n allows, the rest are
+// shared out in proportion to stratum size. Within a stratum the picks are
+// spread evenly over time. Updates keep their order.
+func stratifiedSample(updates []Update, n int) []Update {
+	if n <= 0 || len(updates) <= n {
+		return updates
+	}
+
+	strata := make(map[string][]int)
+	for i, u := range updates {
+		day := "unknown"
+		if t, err := formatTimestamp(u.Timestamp); err == nil {
+			day = t.Format("2006-01-02")
+		}
+		key := fmt.Sprintf("%s|%s|%d", u.Channel, day, u.Priority)
+		strata[key] = append(strata[key], i)
+	}
+	keys := sortedKeys(strata)
+	quotas := sampleQuotas(keys, strata, n)
+
+	var picked []int
+	for _, key := range keys {
+		members := strata[key]
+		sort.SliceStable(members, func(a, b int) bool {
+			return updates[members[a]].Timestamp < updates[members[b]].Timestamp
+		})
+		quota := quotas[key]
+		for i := 0; i < quota; i++ {
+			picked = append(picked, members[(2*i+1)*len(members)/(2*quota)])
+		}
+	}
+	sort.Ints(picked)
+
+	sample := make([]Update, 0, len(picked))
+	for _, i := range picked {
+		sample = append(sample, updates[i])
+	}
+	return sample
+}
+
+// sampleQuotas shares n picks out over the strata by largest remainder, after
+// a guaranteed pick each when there are no more strata than picks.
+func sampleQuotas(keys []string, strata map[string][]int, n int) map[string]int {
+	quotas := make(map[string]int, len(keys))
+	capacity := make(map[string]int, len(keys))
+	total := 0
+	for _, key := range keys {
+		capacity[key] = len(strata[key])
+		total += capacity[key]
+	}
+	if len(keys) <= n {
+		for _, key := range keys {
+			quotas[key] = 1
+			capacity[key]--
+		}
+		n -= len(keys)
+		total -= len(keys)
+	}
+	if n <= 0 || total <= 0 {
+		return quotas
+	}
+
+	remainders := make(map[string]float64, len(keys))
+	assigned := 0
+	for _, key := range keys {
+		share := float64(capacity[key]) * float64(n) / float64(total)
+		quotas[key] += int(share)
+		assigned += int(share)
+		remainders[key] = share - float64(int(share))
+	}
+	byRemainder := make([]string, len(keys))
+	copy(byRemainder, keys)
+	sort.SliceStable(byRemainder, func(a, b int) bool { return remainders[byRemainder[a]] > remainders[byRemainder[b]] })
+	for _, key := range byRemainder[:n-assigned] {
+		quotas[key]++
+	}
+	return quotas
+}
+
+// sampleNote is the label put above a digest summarized from a sample.
+func sampleNote(sampled, total int) string {
+	if sampled == total {
+		return fmt.Sprintf("> **Sample preview.** The window has only %d messages, so all of them were summarized.\n\n", total)
+	}
+	return fmt.Sprintf("> **Sample preview.** Summarized from a sample of %d of %d messages, stratified by channel, day and priority. Items and proportions are indicative; the full digest may differ.\n\n", sampled, total)
+}
@@ -0,0 +1,363 @@
+package shinbun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week, each a bit set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in cron, when both day fields are restricted a day matching either
+	// one matches
+	domStar, dowStar bool
+}
+
+// cronDescriptors are the @ shorthands cron accepts.
+var cronDescriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	cronMonths = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCron parses a cron expression such as "0 9 * * MON-FRI" or "@daily".
+// Fields take *, values, ranges, steps (*/15, 1-5/2), comma-separated lists,
+// and month and day names; day of week 7 is Sunday.
+func parseCron(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("expected 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return cronSchedule{}, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return cronSchedule{}, fmt.Errorf("day of week: %v", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	s.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+	return s, nil
+}
+
+// parseCronField returns the bit set of the values a field matches, within
+// min and max. names, when given, are the lowercase names of the values from
+// 0.
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if name != "" && strings.EqualFold(s, name) {
+				return i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value %q, expected %d-%d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay reports whether the schedule runs on t's day.
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t that the schedule matches, or the zero
+// time when there is none within five years (e.g. February 30th).
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = nextHour(t)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextHour returns the start of the local hour after t's. Truncating would
+// work in absolute time, off the local hour in zones with half-hour offsets.
+func nextHour(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	if !next.After(t) {
+		// The hour falls in a daylight saving gap and was normalized back
+		later := t.Add(time.Hour)
+		next = time.Date(later.Year(), later.Month(), later.Day(), later.Hour(), 0, 0, 0, later.Location())
+	}
+	return next
+}
+
+// parseSchedules parses the SCHEDULE_<FOCUS> settings into a schedule per
+// focus.
+func parseSchedules(specs map[string]string) (map[string]cronSchedule, error) {
+	schedules := make(map[string]cronSchedule)
+	for focus, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		schedule, err := parseCron(spec)
+		if err != nil {
+			return nil, fmt.Errorf("SCHEDULE_%s %q: %v", strings.ToUpper(focus), spec, err)
+		}
+		schedules[focus] = schedule
+	}
+	return schedules, nil
+}
+
+// staleRunCheckInterval is how often the leader looks for scheduled runs whose
+// replica stopped during the run.
+const staleRunCheckInterval = time.Minute
+
+// runScheduler runs each focus's digest on its schedule until ctx is done,
+// then waits for runs in progress to finish. A run that overlaps the next
+// scheduled time makes the focus skip it rather than run twice. With several
+// replicas serving, only the elected leader starts scheduled runs, and it
+// retries those a stopped replica left running. With --queue-scheduled the
+// leader queues them for runs next workers instead.
+func runScheduler(ctx context.Context, db *sql.DB, config *Config, flags Flags, logger *zap.Logger) {
+	var wg sync.WaitGroup
+	leader := newSchedulerLeader(db)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		leader.run(ctx, logger)
+	}()
+	if !flags.QueueScheduled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retryStaleScheduledRuns(ctx, db, config, flags, leader, logger)
+		}()
+	}
+
+	for _, focus := range sortedKeys(config.Schedules) {
+		schedule := config.Schedules[focus]
+		wg.Add(1)
+		go func(focus string) {
+			defer wg.Done()
+			for {
+				next := schedule.next(time.Now())
+				if next.IsZero() {
+					logger.Error("Schedule never runs", zap.String("focus", focus))
+					return
+				}
+				logger.Info("Next scheduled run", zap.String("focus", focus), zap.Time("at", next))
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				// Every line of the run carries its focus and scheduled time
+				runLogger := logger.With(zap.String("focus", focus), zap.Time("scheduled", next))
+				if !leader.Leading() {
+					runLogger.Info("Scheduled run left to the leading replica")
+					continue
+				}
+				start := time.Now()
+				runLogger.Info("Starting scheduled run")
+				if err := runScheduledDigest(db, config, flags, focus, next, runLogger); errors.Is(err, errRunClaimed) {
+					runLogger.Info("Scheduled run already recorded, e.g. by the previous leader")
+				} else if err != nil {
+					runLogger.Error("Scheduled run failed", zap.Duration("duration", time.Since(start)), zap.Error(err))
+				} else {
+					runLogger.Info("Scheduled run finished", zap.Duration("duration", time.Since(start)))
+				}
+			}
+		}(focus)
+	}
+	wg.Wait()
+}
+
+// errRunClaimed is returned for a scheduled run that is already recorded.
+var errRunClaimed = errors.New("scheduled run already recorded")
+
+// recordScheduledRun records the focus's run at the scheduled time in the
+// runs table with status, running when this replica carries it out and queued
+// for runs next. It returns errRunClaimed when the run is already recorded.
+func recordScheduledRun(db *sql.DB, focus string, flags Flags, at time.Time, status string) (int, error) {
+	attempts, startedAt := 0, sql.NullTime{}
+	if status == "running" {
+		attempts, startedAt = 1, sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO runs (focus, dry_run, no_llm, status, attempts, started_at, scheduled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (focus, scheduled_at) DO NOTHING RETURNING id`,
+		focus, flags.DryRun, flags.NoLLM, status, attempts, startedAt, at.UTC()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errRunClaimed
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error recording scheduled run: %v", err)
+	}
+	return id, nil
+}
+
+// runScheduledDigest records one scheduled digest and runs it, or with
+// --queue-scheduled leaves it queued for a runs next worker.
+func runScheduledDigest(db *sql.DB, config *Config, flags Flags, focus string, at time.Time, logger *zap.Logger) error {
+	if flags.QueueScheduled {
+		id, err := recordScheduledRun(db, focus, flags, at, "queued")
+		if err != nil {
+			return err
+		}
+		logger.Info("Queued scheduled run for a runs next worker", zap.Int("run_id", id))
+		return nil
+	}
+	id, err := recordScheduledRun(db, focus, flags, at, "running")
+	if err != nil {
+		return err
+	}
+	flags.Focus = focus
+	return runScheduledRun(db, config, flags, id, logger)
+}
+
+// runScheduledRun carries out the scheduled run id, claimed by this replica,
+// and records its result, renewing its lease until then. It runs with a copy of the server's config, so each
+// run has its own clock and usage counts and its adjustments (e.g. by
+// --no-llm) stay with it.
+func runScheduledRun(db *sql.DB, config *Config, flags Flags, id int, logger *zap.Logger) error {
+	runConfig := *config
+	config = &runConfig
+	config.Clock = systemClock{}
+	config.Usage = newAPIUsage()
+
+	flags.RunID = id
+	logger = logger.With(zap.Int("run_id", id))
+	stopLease := keepLease(db, "runs", id, flags.RunLease, logger)
+	runErr := func() error {
+		api, err := newSlackClient(config, logger)
+		if err != nil {
+			return err
+		}
+		_, err = runDigest(api, db, config, flags, time.Time{}, time.Time{}, logger)
+		return err
+	}()
+	stopLease()
+	if err := finishRun(db, id, runErr, config.Usage); err != nil {
+		logger.Error("Failed to record run result", zap.Error(err))
+	}
+	return runErr
+}
+
+// retryStaleScheduledRuns runs again, while this replica leads, the scheduled
+// runs left running past --lease by a replica that stopped, and those
+// queued by a leader that stopped before starting them.
+func retryStaleScheduledRuns(ctx context.Context, db *sql.DB, config *Config, flags Flags, leader *schedulerLeader, logger *zap.Logger) {
+	ticker := time.NewTicker(staleRunCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for leader.Leading() && ctx.Err() == nil {
+			run, err := claimRun(db, flags.RunLease, true)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				logger.Error("Failed to claim stale scheduled run", zap.Error(err))
+				break
+			}
+			runFlags := flags
+			runFlags.Focus, runFlags.DryRun, runFlags.NoLLM = run.Focus, run.DryRun, run.NoLLM
+			runLogger := logger.With(zap.String("focus", run.Focus))
+			runLogger.Info("Retrying scheduled run", zap.Int("run_id", run.ID))
+			if err := runScheduledRun(db, config, runFlags, run.ID, runLogger); err != nil {
+				runLogger.Error("Retried scheduled run failed", zap.Int("run_id", run.ID), zap.Error(err))
+			}
+		}
+	}
+}
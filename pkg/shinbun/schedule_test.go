@@ -0,0 +1,113 @@
+package shinbun
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0 9 * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * * someday",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q): want an error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// 2025-01-04 is a Saturday
+		{"next Monday", "0 9 * * MON", utc(1, 4, 10, 0), utc(1, 6, 9, 0)},
+		{"strictly after the given time", "0 9 * * MON", utc(1, 6, 9, 0), utc(1, 13, 9, 0)},
+		{"step", "*/15 * * * *", utc(1, 6, 10, 7), utc(1, 6, 10, 15)},
+		{"weekday range skips the weekend", "30 8 * * MON-FRI", utc(1, 10, 9, 0), utc(1, 13, 8, 30)},
+		{"7 is Sunday", "0 0 * * 7", utc(1, 6, 0, 0), utc(1, 12, 0, 0)},
+		{"either day field matches", "0 12 15 * FRI", utc(1, 6, 0, 0), utc(1, 10, 12, 0)},
+		{"day of month alone", "0 12 15 * *", utc(1, 16, 0, 0), utc(2, 15, 12, 0)},
+		{"descriptor", "@daily", utc(1, 6, 0, 0), utc(1, 7, 0, 0)},
+		{"month names", "0 0 1 jan,jul *", utc(1, 6, 0, 0), utc(7, 1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("%q after %v = %v, want %v", tt.spec, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextNeverMatches(t *testing.T) {
+	s, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.next(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("February 30th scheduled at %v, want the zero time", got)
+	}
+}
+
+func TestCronNextLocalHours(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip("no time zone database:", err)
+		}
+		return loc
+	}
+	kolkata := load("Asia/Kolkata")
+	newYork := load("America/New_York")
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"half-hour offset zone", "0 9 * * *",
+			time.Date(2025, 1, 6, 8, 10, 0, 0, kolkata), time.Date(2025, 1, 6, 9, 0, 0, 0, kolkata)},
+		// Clocks in New York went from 02:00 EST to 03:00 EDT on 2025-03-09
+		{"hourly across the spring gap", "0 * * * *",
+			time.Date(2025, 3, 9, 1, 30, 0, 0, newYork), time.Date(2025, 3, 9, 3, 0, 0, 0, newYork)},
+		{"daily after the spring gap", "0 9 * * *",
+			time.Date(2025, 3, 8, 9, 0, 0, 0, newYork), time.Date(2025, 3, 9, 9, 0, 0, 0, newYork)},
+		{"time in the spring gap is skipped that day", "30 2 * * *",
+			time.Date(2025, 3, 8, 12, 0, 0, 0, newYork), time.Date(2025, 3, 10, 2, 30, 0, 0, newYork)},
+		// and went back from 02:00 EDT to 01:00 EST on 2025-11-02
+		{"daily across the autumn overlap", "0 3 * * *",
+			time.Date(2025, 11, 2, 0, 30, 0, 0, newYork), time.Date(2025, 11, 2, 3, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("%q after %v = %v, want %v", tt.spec, tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package shinbun
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultScoreWeights are used for scorers not listed in SCORE_WEIGHTS.
+var defaultScoreWeights = map[string]float64{
+	"keywords":  1,
+	"reactions": 0.5,
+	"author":    1,
+	"channel":   1,
+	"category":  1,
+	"recency":   0.5,
+}
+
+// recencyWindow is the age at which the recency score reaches zero.
+const recencyWindow = 7 * 24 * time.Hour
+
+// scorer computes one independent component of a message's priority score.
+type scorer struct {
+	Name   string
+	Weight float64
+	Score  func(update Update) float64
+}
+
+// newScorers builds the scoring pipeline from configuration and the weights
+// learned from feedback.
+func newScorers(config *Config, learned learnedWeights, now time.Time) []scorer {
+	weight := func(name string) float64 {
+		if w, ok := config.ScoreWeights[name]; ok {
+			return w
+		}
+		return defaultScoreWeights[name]
+	}
+
+	return []scorer{
+		{
+			// Category base priority plus urgent-term bumps from the CategoryTerms
+			// or the priority assigned natively by a source
+			Name:   "keywords",
+			Weight: weight("keywords"),
+			Score:  func(u Update) float64 { return float64(u.Priority) },
+		},
+		{
+			Name:   "reactions",
+			Weight: weight("reactions"),
+			Score:  func(u Update) float64 { return math.Log2(1 + float64(u.ReactionCount)) },
+		},
+		{
+			Name:   "author",
+			Weight: weight("author"),
+			Score:  func(u Update) float64 { return config.AuthorWeights[strings.ToLower(u.Author)] },
+		},
+		{
+			Name:   "channel",
+			Weight: weight("channel"),
+			Score:  func(u Update) float64 { return learned.channelWeight(config, u.Channel) },
+		},
+		{
+			Name:   "category",
+			Weight: weight("category"),
+			Score:  func(u Update) float64 { return learned.categoryWeight(config, u.Category) },
+		},
+		{
+			Name:   "recency",
+			Weight: weight("recency"),
+			Score: func(u Update) float64 {
+				t, err := formatTimestamp(u.Timestamp)
+				if err != nil {
+					return 0
+				}
+				age := now.Sub(t)
+				if age < 0 {
+					age = 0
+				}
+				return math.Max(0, 1-float64(age)/float64(recencyWindow))
+			},
+		},
+	}
+}
+
+// scoreUpdates runs every update through the scorers and sets Score to the
+// weighted sum and Priority to its integer part. Updates that were never
+// categorized (e.g. stored before categories were) are categorized first,
+// with the status and reactionBoost adjustments of freshly fetched messages.
+func scoreUpdates(scorers []scorer, terms termSet, reactionBoost int, updates []Update, logger *zap.Logger) []Update {
+	for i := range updates {
+		u := &updates[i]
+		if u.Category == "" {
+			u.Category, u.Priority = terms.categorize(u.Channel, u.Text)
+			u.Priority = adjustPriorityForStatus(u.Priority, u.Status)
+			u.Priority = adjustPriorityForReactions(u.Priority, u.ReactionCount, reactionBoost)
+		}
+
+		total := 0.0
+		fields := []zap.Field{
+			zap.String("channel", u.Channel),
+			zap.String("timestamp", u.Timestamp),
+		}
+		for _, s := range scorers {
+			if s.Weight == 0 {
+				continue
+			}
+			component := s.Weight * s.Score(*u)
+			total += component
+			fields = append(fields, zap.Float64(s.Name, component))
+		}
+		fields = append(fields, zap.Float64("score", total))
+		logger.Debug("Scored message", fields...)
+
+		u.Score = total
+		u.Priority = int(math.Floor(total))
+	}
+	return updates
+}
+
+// sortByScore orders updates by descending score, newest first on ties, then
+// by channel and link so the order doesn't depend on how they were fetched.
+func sortByScore(updates []Update) {
+	sort.SliceStable(updates, func(i, j int) bool {
+		if updates[i].Score != updates[j].Score {
+			return updates[i].Score > updates[j].Score
+		}
+		return newerFirst(updates[i], updates[j])
+	})
+}
+
+// newerFirst orders updates newest first, breaking ties by channel and link.
+func newerFirst(a, b Update) bool {
+	if a.Timestamp != b.Timestamp {
+		return a.Timestamp > b.Timestamp
+	}
+	if a.Channel != b.Channel {
+		return a.Channel < b.Channel
+	}
+	return a.Link < b.Link
+}
@@ -0,0 +1,71 @@
+package shinbun
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// keywordScorer scores updates by their priority alone, so scoreUpdates'
+// Priority is the one categorization gave.
+var keywordScorer = []scorer{{Name: "keywords", Weight: 1, Score: func(u Update) float64 { return float64(u.Priority) }}}
+
+func TestScoreUpdatesStoredMessagesKeepFetchPriority(t *testing.T) {
+	db := openTestDB(t)
+	var channelID int
+	if err := db.QueryRow(`INSERT INTO channels (slack_id, name) VALUES ('C01', 'announcements') RETURNING id`).Scan(&channelID); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fetched := Update{
+		Text:          "New office opens Monday",
+		Timestamp:     fmt.Sprintf("%d.000100", now.Add(-time.Hour).Unix()),
+		Link:          "https://example.slack.com/archives/C01/p1",
+		Channel:       "announcements",
+		ReactionCount: 12,
+	}
+	fetched.Category, fetched.Priority = defaultCategoryTerms.categorize(fetched.Channel, fetched.Text)
+	fetched.Priority = adjustPriorityForReactions(fetched.Priority, fetched.ReactionCount, 10)
+	if _, err := saveMessagePage(db, channelID, []Update{fetched}, zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := getMessagesFromDB(db, channelID, now.Add(-24*time.Hour), time.Time{}, 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("loaded %d messages, want 1", len(stored))
+	}
+	fresh := scoreUpdates(keywordScorer, defaultCategoryTerms, 10, []Update{fetched}, zap.NewNop())
+	loaded := scoreUpdates(keywordScorer, defaultCategoryTerms, 10, stored, zap.NewNop())
+	if loaded[0].Category != fresh[0].Category || loaded[0].Priority != fresh[0].Priority {
+		t.Errorf("stored message scored %s/%d, fetched %s/%d", loaded[0].Category, loaded[0].Priority, fresh[0].Category, fresh[0].Priority)
+	}
+}
+
+func TestScoreUpdatesRecategorizes(t *testing.T) {
+	update := func(reactions int, status string) Update {
+		return Update{Text: "New office opens Monday", Channel: "announcements", ReactionCount: reactions, Status: status}
+	}
+	category, basePriority := defaultCategoryTerms.categorize("announcements", "New office opens Monday")
+	tests := []struct {
+		name   string
+		update Update
+		want   int
+	}{
+		{"few reactions", update(3, ""), basePriority},
+		{"reactions past the threshold", update(10, ""), basePriority + 1},
+		{"escalated", update(0, statusEscalated), basePriority + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreUpdates(keywordScorer, defaultCategoryTerms, 10, []Update{tt.update}, zap.NewNop())[0]
+			if got.Category != category || got.Priority != tt.want {
+				t.Errorf("scored %s/%d, want %s/%d", got.Category, got.Priority, category, tt.want)
+			}
+		})
+	}
+}
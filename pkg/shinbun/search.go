@@ -0,0 +1,224 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/store"
+)
+
+// Snippet highlights as ts_headline marks them; they are replaced for output.
+const (
+	searchHighlightStart = "\x02"
+	searchHighlightStop  = "\x03"
+)
+
+// digestMatch is an archived digest matching a search.
+type digestMatch struct {
+	Focus   string
+	Date    time.Time
+	Issue   int
+	Title   string
+	Snippet string
+}
+
+func runDigestsCommand(args []string, logger *zap.Logger) error {
+	usage := errors.New(`usage: shinbun digests search [--focus name] [--since value] [--limit 10] "query"
+       shinbun digests publish`)
+	if len(args) > 0 && args[0] == "publish" {
+		return runPublishCommand(args[1:], logger)
+	}
+	if len(args) == 0 || args[0] != "search" {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("digests search", flag.ContinueOnError)
+	focus := fs.String("focus", "", "Only search digests of this focus")
+	sinceStr := fs.String("since", "", "Date (YYYY-MM-DD) or duration (e.g. '90d') of the oldest digest to search")
+	limit := fs.Int("limit", 10, "Maximum number of digests to print")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		return usage
+	}
+	since, err := parseFromDate(*sinceStr, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --since: %v", err)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	matches, err := searchDigests(db, query, *focus, since, *limit)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Searched digests", zap.String("query", query), zap.Int("matches", len(matches)))
+	writeDigestMatches(os.Stdout, matches, config.PublicBaseURL, useANSI())
+	return nil
+}
+
+// searchDigests full-text searches archived digests, best match first. The
+// query takes web search syntax: quoted phrases, "or" and -excluded words.
+// On SQLite it finds the digests containing every word instead, newest first.
+func searchDigests(db *sql.DB, query, focus string, since time.Time, limit int) ([]digestMatch, error) {
+	if store.For(db).Driver() == store.SQLite {
+		return searchDigestWords(db, query, focus, since, limit)
+	}
+	var sinceDate interface{}
+	if !since.IsZero() {
+		sinceDate = since.Format("2006-01-02")
+	}
+	rows, err := db.Query(`
+		SELECT focus, digest_date, COALESCE(issue, 0), COALESCE(title, ''),
+		    ts_headline('english', content, q, $5)
+		FROM digests, websearch_to_tsquery('english', $1) q
+		WHERE to_tsvector('english', content) @@ q
+		    AND ($2 = '' OR focus = $2)
+		    AND ($3::date IS NULL OR digest_date >= $3::date)
+		ORDER BY ts_rank(to_tsvector('english', content), q) DESC, digest_date DESC
+		LIMIT $4`,
+		query, focus, sinceDate, limit,
+		"StartSel="+searchHighlightStart+", StopSel="+searchHighlightStop+", MaxFragments=2, MaxWords=25, MinWords=10, FragmentDelimiter=\" … \"")
+	if err != nil {
+		return nil, fmt.Errorf("error searching digests: %v", err)
+	}
+	defer rows.Close()
+
+	var matches []digestMatch
+	for rows.Next() {
+		var m digestMatch
+		if err := rows.Scan(&m.Focus, &m.Date, &m.Issue, &m.Title, &m.Snippet); err != nil {
+			return nil, fmt.Errorf("error scanning digest match: %v", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// searchDigestWords returns the digests containing every word of query,
+// case-insensitively, newest first, with a snippet around the first match.
+func searchDigestWords(db *sql.DB, query, focus string, since time.Time, limit int) ([]digestMatch, error) {
+	var sinceDate string
+	if !since.IsZero() {
+		sinceDate = since.Format("2006-01-02")
+	}
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(query, `"`, " ")))
+	args := []any{focus, sinceDate, limit}
+	var conditions strings.Builder
+	for _, word := range words {
+		args = append(args, "%"+strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(word)+"%")
+		conditions.WriteString(fmt.Sprintf(" AND content LIKE $%d ESCAPE '\\'", len(args)))
+	}
+	rows, err := db.Query(`
+		SELECT focus, digest_date, COALESCE(issue, 0), COALESCE(title, ''), content
+		FROM digests
+		WHERE ($1 = '' OR focus = $1) AND ($2 = '' OR digest_date >= $2)`+conditions.String()+`
+		ORDER BY digest_date DESC
+		LIMIT $3`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching digests: %v", err)
+	}
+	defer rows.Close()
+
+	var matches []digestMatch
+	for rows.Next() {
+		var m digestMatch
+		var content string
+		if err := rows.Scan(&m.Focus, &m.Date, &m.Issue, &m.Title, &content); err != nil {
+			return nil, fmt.Errorf("error scanning digest match: %v", err)
+		}
+		m.Snippet = wordSnippet(content, words)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// wordSnippet is about 25 words of content around the first one containing
+// one of words, with the matching words highlighted as ts_headline would.
+func wordSnippet(content string, words []string) string {
+	fields := strings.Fields(content)
+	matches := func(field string) bool {
+		field = strings.ToLower(field)
+		for _, word := range words {
+			if strings.Contains(field, word) {
+				return true
+			}
+		}
+		return false
+	}
+	first := 0
+	for i, field := range fields {
+		if matches(field) {
+			first = i
+			break
+		}
+	}
+	start := max(first-10, 0)
+	end := min(start+25, len(fields))
+
+	snippet := make([]string, 0, end-start+2)
+	if start > 0 {
+		snippet = append(snippet, "…")
+	}
+	for _, field := range fields[start:end] {
+		if matches(field) {
+			field = searchHighlightStart + field + searchHighlightStop
+		}
+		snippet = append(snippet, field)
+	}
+	if end < len(fields) {
+		snippet = append(snippet, "…")
+	}
+	return strings.Join(snippet, " ")
+}
+
+// writeDigestMatches prints each match's date, focus and title with its
+// snippet, highlighted in bold on a terminal and with asterisks otherwise.
+func writeDigestMatches(w io.Writer, matches []digestMatch, baseURL string, ansi bool) {
+	if len(matches) == 0 {
+		fmt.Fprintln(w, "No digests match.")
+		return
+	}
+	start, stop := "*", "*"
+	if ansi {
+		start, stop = ansiBold, ansiReset
+	}
+	for i, m := range matches {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		heading := m.Date.Format("2006-01-02") + "  " + m.Focus
+		if m.Issue > 0 {
+			heading += fmt.Sprintf("  #%d", m.Issue)
+		}
+		if m.Title != "" {
+			heading += "  " + m.Title
+		}
+		fmt.Fprintln(w, heading)
+
+		snippet := strings.Join(strings.Fields(m.Snippet), " ")
+		snippet = strings.NewReplacer(searchHighlightStart, start, searchHighlightStop, stop).Replace(snippet)
+		fmt.Fprintln(w, "  "+snippet)
+		if link := digestURL(baseURL, m.Focus, m.Date); link != "" {
+			fmt.Fprintln(w, "  "+link)
+		}
+	}
+}
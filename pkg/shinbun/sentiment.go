@@ -0,0 +1,329 @@
+package shinbun
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"go.uber.org/zap"
+)
+
+const (
+	sentimentLLM   = "llm"
+	sentimentLocal = "local"
+	// sentimentBatchSize bounds the number of messages per scoring request
+	sentimentBatchSize = 20
+	// sentimentTrendDrop is how far a channel's average must fall below last
+	// week's to be called out
+	sentimentTrendDrop = 0.15
+	// sentimentMinMessages is the fewest scored messages, this week and last,
+	// a channel needs for a trend
+	sentimentMinMessages = 3
+	// angryScore is the highest score listed among the angriest threads
+	angryScore      = -0.4
+	maxAngryThreads = 3
+)
+
+// negativeSentimentTerms and positiveSentimentTerms are what the local
+// classifier counts, matched as lower-case substrings of the English text.
+var (
+	negativeSentimentTerms = []string{
+		"frustrat", "angry", "annoy", "upset", "furious", "disappoint", "unacceptable", "ridiculous",
+		"terrible", "awful", "horrible", "worst", "useless", "waste of", "still not", "still broken",
+		"still waiting", "no response", "nobody", "again", "escalat", "cancel", "refund", "complain",
+		"asap", "urgent", "not working", "doesn't work", "broken",
+	}
+	positiveSentimentTerms = []string{
+		"thank", "appreciate", "great", "awesome", "excellent", "perfect", "love", "happy",
+		"resolved", "works now", "working now", "fixed", "quick response", "helpful",
+	}
+)
+
+// localSentiment scores text from -1 (angry) to 1 (pleased) by counting
+// negative and positive terms. Repeated exclamation marks strengthen a
+// negative message.
+func localSentiment(text string) float64 {
+	lower := strings.ToLower(text)
+	s := 0.0
+	for _, term := range negativeSentimentTerms {
+		if strings.Contains(lower, term) {
+			s--
+		}
+	}
+	for _, term := range positiveSentimentTerms {
+		if strings.Contains(lower, term) {
+			s++
+		}
+	}
+	if s < 0 && strings.Contains(text, "!!") {
+		s--
+	}
+	return s / (math.Abs(s) + 1)
+}
+
+// sentimentSchema is the structured output the LLM scoring asks for.
+var sentimentSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"scores": {
+			Type:  jsonschema.Array,
+			Items: &jsonschema.Definition{Type: jsonschema.Number},
+		},
+	},
+	Required:             []string{"scores"},
+	AdditionalProperties: false,
+}
+
+// llmSentiment scores texts with the model, in order.
+func llmSentiment(client *openai.Client, model string, texts []string) ([]float64, error) {
+	var out []float64
+	for start := 0; start < len(texts); start += sentimentBatchSize {
+		end := min(start+sentimentBatchSize, len(texts))
+		batch := texts[start:end]
+
+		input, err := json.Marshal(map[string][]string{"messages": batch})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding sentiment request: %v", err)
+		}
+		resp, err := client.CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{
+				Model: model,
+				Messages: []openai.ChatCompletionMessage{
+					{
+						Role: openai.ChatMessageRoleSystem,
+						Content: `You rate the sentiment of messages in customer support channels. You receive a JSON object {"messages": [...]}. ` +
+							`Respond with {"scores": [...]}, exactly one number per message in the same order, from -1 (angry, frustrated customer) ` +
+							`through 0 (neutral, e.g. a plain question or status update) to 1 (pleased, thankful).`,
+					},
+					{
+						Role:    openai.ChatMessageRoleUser,
+						Content: string(input),
+					},
+				},
+				ResponseFormat: &openai.ChatCompletionResponseFormat{
+					Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+					JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+						Name:   "sentiment",
+						Schema: &sentimentSchema,
+						Strict: true,
+					},
+				},
+				Temperature: 0,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scoring sentiment: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("openai returned no choices")
+		}
+		var result struct {
+			Scores []float64 `json:"scores"`
+		}
+		if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
+			return nil, fmt.Errorf("error decoding sentiment scores: %v", err)
+		}
+		if len(result.Scores) != len(batch) {
+			return nil, fmt.Errorf("sentiment scoring returned %d scores for %d messages", len(result.Scores), len(batch))
+		}
+		for _, score := range result.Scores {
+			out = append(out, math.Max(-1, math.Min(1, score)))
+		}
+	}
+	return out, nil
+}
+
+// supportFocus reports whether the run uses the support prompt, whose
+// digests get the Customer Sentiment section.
+func (p *pipeline) supportFocus() bool {
+	if prompt := p.config.focusPromptFor(p.flags.Focus); prompt != nil && prompt.Builtin != "" {
+		return prompt.Builtin == "support"
+	}
+	return p.flags.Focus == "support"
+}
+
+// scoreSentiment returns the sentiment of the Slack updates by timestamp:
+// stored scores, and new ones for the rest, which are stored in turn.
+func (p *pipeline) scoreSentiment(updates []Update, since time.Time) (map[string]float64, error) {
+	scores := make(map[string]float64)
+	channels := make(map[string]bool)
+	for _, u := range updates {
+		if u.Source == "" {
+			channels[u.Channel] = true
+		}
+	}
+	for _, channel := range sortedKeys(channels) {
+		if err := loadSentiment(p.db, channel, since, scores); err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []Update
+	var texts []string
+	for _, u := range updates {
+		if _, ok := scores[u.Timestamp]; ok || u.Source != "" || u.Link == "" {
+			continue
+		}
+		text := u.Text
+		if u.Translation != "" {
+			text = u.Translation
+		}
+		pending = append(pending, u)
+		texts = append(texts, text)
+	}
+	if len(pending) == 0 {
+		return scores, nil
+	}
+
+	var fresh []float64
+	if p.config.SentimentScoring == sentimentLLM {
+		var err error
+		if fresh, err = llmSentiment(p.client, p.config.OpenAICheapModel, texts); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, text := range texts {
+			fresh = append(fresh, localSentiment(text))
+		}
+	}
+	for i, u := range pending {
+		scores[u.Timestamp] = fresh[i]
+		if _, err := p.db.Exec(`UPDATE messages SET sentiment = $2 WHERE slack_id = $1`, u.Timestamp, fresh[i]); err != nil {
+			return nil, fmt.Errorf("error saving sentiment: %v", err)
+		}
+	}
+	p.logger.Info("Scored message sentiment", zap.String("method", p.config.SentimentScoring), zap.Int("messages", len(pending)))
+	return scores, nil
+}
+
+// loadSentiment adds the stored scores of the channel's messages since the
+// given time to scores.
+func loadSentiment(db *sql.DB, channel string, since time.Time, scores map[string]float64) error {
+	rows, err := db.Query(`
+		SELECT m.slack_id, m.sentiment FROM messages m
+		JOIN channels c ON m.channel_id = c.id
+		WHERE c.name = $1 AND m.timestamp >= $2 AND m.sentiment IS NOT NULL`, channel, since)
+	if err != nil {
+		return fmt.Errorf("error querying sentiment: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts string
+		var score float64
+		if err := rows.Scan(&ts, &score); err != nil {
+			return fmt.Errorf("error scanning sentiment row: %v", err)
+		}
+		scores[ts] = score
+	}
+	return rows.Err()
+}
+
+// averageSentiment is the channel's average stored score in [from, before).
+func averageSentiment(db *sql.DB, channel string, from, before time.Time) (avg float64, n int, err error) {
+	var nullAvg sql.NullFloat64
+	err = db.QueryRow(`
+		SELECT AVG(m.sentiment), COUNT(m.sentiment) FROM messages m
+		JOIN channels c ON m.channel_id = c.id
+		WHERE c.name = $1 AND m.timestamp >= $2 AND m.timestamp < $3 AND m.sentiment IS NOT NULL`,
+		channel, from, before).Scan(&nullAvg, &n)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error querying last week's sentiment: %v", err)
+	}
+	return nullAvg.Float64, n, nil
+}
+
+// sentimentSection scores the support messages and renders the Customer
+// Sentiment section: channels whose average fell since the week before
+// since, and the angriest threads. It returns "" when there is nothing to
+// report.
+func (p *pipeline) sentimentSection(updates []Update, since time.Time) string {
+	scores, err := p.scoreSentiment(updates, since)
+	if err != nil {
+		p.logger.Warn("Failed to score message sentiment", zap.Error(err))
+		return ""
+	}
+
+	type channelMood struct {
+		sum float64
+		n   int
+	}
+	moods := make(map[string]*channelMood)
+	var scored []Update
+	for _, u := range updates {
+		score, ok := scores[u.Timestamp]
+		if !ok || u.Source != "" {
+			continue
+		}
+		if moods[u.Channel] == nil {
+			moods[u.Channel] = &channelMood{}
+		}
+		moods[u.Channel].sum += score
+		moods[u.Channel].n++
+		scored = append(scored, u)
+	}
+
+	var trends []string
+	for _, channel := range sortedKeys(moods) {
+		mood := moods[channel]
+		if mood.n < sentimentMinMessages {
+			continue
+		}
+		current := mood.sum / float64(mood.n)
+		previous, n, err := averageSentiment(p.db, channel, since.AddDate(0, 0, -7), since)
+		if err != nil {
+			p.logger.Warn("Failed to load last week's sentiment", zap.String("channel", channel), zap.Error(err))
+			continue
+		}
+		p.logger.Debug("Channel sentiment", zap.String("channel", channel), zap.Float64("average", current), zap.Float64("previous", previous), zap.Int("previous_messages", n))
+		if n >= sentimentMinMessages && current <= previous-sentimentTrendDrop {
+			trends = append(trends, fmt.Sprintf("- Customer frustration trending up in #%s: average sentiment %.2f over %d messages, from %.2f the week before\n",
+				strings.TrimPrefix(channel, "#"), current, mood.n, previous))
+		}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		if scores[scored[i].Timestamp] != scores[scored[j].Timestamp] {
+			return scores[scored[i].Timestamp] < scores[scored[j].Timestamp]
+		}
+		return newerFirst(scored[i], scored[j])
+	})
+	var angriest []string
+	for _, u := range scored {
+		if scores[u.Timestamp] > angryScore || len(angriest) == maxAngryThreads {
+			break
+		}
+		text := u.Text
+		if u.Translation != "" {
+			text = u.Translation
+		}
+		angriest = append(angriest, fmt.Sprintf("- #%s [%s](%s) (%.2f)\n", strings.TrimPrefix(u.Channel, "#"), excerpt(text, 80), u.Link, scores[u.Timestamp]))
+	}
+
+	if len(trends) == 0 && len(angriest) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n\n## Customer Sentiment\n\n")
+	for _, t := range trends {
+		sb.WriteString(t)
+	}
+	if len(angriest) > 0 {
+		if len(trends) > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("Angriest threads:\n\n")
+		for _, a := range angriest {
+			sb.WriteString(a)
+		}
+	}
+	return sb.String()
+}
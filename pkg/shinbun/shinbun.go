@@ -0,0 +1,2430 @@
+package shinbun
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/joho/godotenv"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+
+	"shinbun/delivery"
+	"shinbun/internal/commontypes"
+	"shinbun/internal/migrate"
+	"shinbun/internal/store"
+)
+
+type Config struct {
+	SlackToken           string
+	OpenAIToken          string
+	DBHost               string
+	DBPort               string
+	DBName               string
+	DBUser               string
+	DBPassword           string
+	DBDriver             string // postgres or sqlite (DB_DRIVER)
+	DBPath               string // the SQLite database file (DB_PATH)
+	DefaultFocusChannels []string
+	SupportFocusChannels []string
+	// FocusProfiles are the focuses defined in FOCUS_CONFIG, keyed by
+	// lowercase name
+	FocusProfiles map[string]*focusProfile
+	// Email configuration
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	EmailFrom    string
+	EmailTo      []string
+	EmailCC      []string
+	EmailBCC     []string
+	EmailReplyTo string
+	// EmailOverrides replaces the addressing above per focus (EMAIL_TO_<FOCUS>, ...)
+	EmailOverrides map[string]emailAddressing
+	// DKIM signing (optional)
+	DKIMDomain         string
+	DKIMSelector       string
+	DKIMPrivateKeyFile string
+	// Branding: logo URL or file to embed, colors, and markdown header/footer blocks
+	EmailLogo         string
+	EmailAccentColor  string
+	EmailHeadingColor string
+	EmailHeaderText   string
+	EmailFooterText   string
+	// MastheadImage draws a masthead image per edition for email: "template"
+	// or "dalle" (MASTHEAD_IMAGE)
+	MastheadImage string
+	// AudioEdition narrates each digest as an MP3, attached to the email or
+	// linked from the archive (AUDIO_EDITION, AUDIO_MODEL, AUDIO_VOICE)
+	AudioEdition audioSettings
+	// Zendesk configuration (optional)
+	ZendeskSubdomain string
+	ZendeskEmail     string
+	ZendeskAPIToken  string
+	ZendeskFocus     []string
+	// Status page configuration (optional)
+	StatusPageProvider string
+	StatusPageURL      string
+	StatusPageFocus    []string
+	// IMAP mailbox configuration (optional)
+	IMAPHost           string
+	IMAPPort           string
+	IMAPUser           string
+	IMAPPassword       string
+	IMAPFolders        []string
+	IMAPSubjectFilters []string
+	IMAPFromFilters    []string
+	IMAPFocus          []string
+	// Google Calendar context (optional)
+	GoogleCalendarID      string
+	GoogleCredentialsFile string
+	// GitLab source (optional)
+	GitLabURL      string
+	GitLabToken    string
+	GitLabProjects []string
+	GitLabFocus    []string
+	// Linear source (optional)
+	LinearAPIKey string
+	LinearTeams  []string
+	LinearFocus  []string
+	// Discord source (optional)
+	DiscordBotToken   string
+	DiscordChannelIDs []string
+	DiscordFocus      []string
+	// Microsoft Teams source (optional)
+	TeamsTenantID     string
+	TeamsClientID     string
+	TeamsClientSecret string
+	TeamsChannels     []string
+	TeamsFocus        []string
+	// Wiki page-change sources (optional)
+	ConfluenceURL      string
+	ConfluenceEmail    string
+	ConfluenceAPIToken string
+	ConfluenceSpaces   []string
+	NotionAPIKey       string
+	NotionDatabaseIDs  []string
+	DocsFocus          []string
+	// CorrelationSimilarity is the minimum embedding cosine similarity for
+	// merging items from different sources; 0 correlates by ticket ID only.
+	CorrelationSimilarity float64
+	// Embedding provider for correlation: openai (default), local or cohere
+	EmbeddingProvider string
+	EmbeddingModel    string
+	EmbeddingBaseURL  string
+	CohereAPIKey      string
+	// Prompt budget: token cap for messages (-1 fits the model's context
+	// window) and optional per-source shares
+	PromptTokenBudget  int
+	SourceBudgetShares map[string]float64
+	// Bot message ingestion
+	IngestBotMessages bool
+	ExcludedAppIDs    []string
+	// Low-quality message filters applied at ingestion (0/false disables)
+	MinMessageChars int
+	SkipEmojiOnly   bool
+	SkipJoinLeave   bool
+	// Per-focus author allow/deny lists (AUTHORS_ALLOW_<FOCUS>, AUTHORS_DENY_<FOCUS>)
+	AuthorAllow map[string][]string
+	AuthorDeny  map[string][]string
+	// Translation of foreign-language messages (optional)
+	TranslationProvider   string
+	TranslationTargetLang string
+	DeepLAPIKey           string
+	DeepLAPIURL           string
+	// Priority scoring weights
+	ScoreWeights    map[string]float64
+	AuthorWeights   map[string]float64
+	ChannelWeights  map[string]float64
+	CategoryWeights map[string]float64
+	// ChannelInstructions tell the model what is wanted from a channel's
+	// messages (CHANNEL_INSTRUCTION_<CHANNEL>), by channelInstructionKey
+	ChannelInstructions map[string]string
+	// LearnWeights learns channel and category weights from reader feedback;
+	// CHANNEL_WEIGHTS and CATEGORY_WEIGHTS override what is learned
+	LearnWeights bool
+	LearningRate float64
+	// FeedbackLinks adds thumbs up/down links to the items of tracked emails
+	FeedbackLinks bool
+	// CodeBlockMaxChars truncates code blocks in messages (0 keeps them whole)
+	CodeBlockMaxChars int
+	// Long messages are excerpted to their first and last MessageExcerptLines
+	// lines plus lines with ExcerptKeywords (MessageMaxChars 0 disables)
+	MessageMaxChars     int
+	MessageExcerptLines int
+	ExcerptKeywords     []string
+	// MaxChannelMessages bounds a channel's messages held for a digest;
+	// beyond it only the highest-priority stored ones are loaded (0 disables)
+	MaxChannelMessages int
+	// TicketURLTemplates link ticket IDs by prefix (TICKET_URL_TEMPLATES)
+	TicketURLTemplates map[string]string
+	// CategoryTerms are the urgent, alert and support terms by language
+	// (URGENT_TERMS_<LANG>, ALERT_TERMS_<LANG>, SUPPORT_TERMS_<LANG>)
+	CategoryTerms termSet
+	// Schedules run a focus's digest on a cron schedule in --serve mode
+	// (SCHEDULE_<FOCUS>, e.g. SCHEDULE_DEFAULT="0 9 * * MON")
+	Schedules map[string]cronSchedule
+	// FollowThreads merges discussions that explicitly move between channels
+	FollowThreads bool
+	// SelectionReportAppendix appends the list of messages dropped by the prompt budget to the digest
+	SelectionReportAppendix bool
+	// OpenAI models and per-run spending caps (0 disables a cap)
+	OpenAIModel      string
+	OpenAICheapModel string
+	MaxCostPerRun    float64
+	MaxTokensPerRun  int
+	MapChunkTokens   int
+	MapConcurrency   int
+	// MapSectionTokens are the map-reduce notes tokens per digest section
+	// (MAP_SECTION_TOKENS)
+	MapSectionTokens map[string]int
+	// OpenAIBatchFocuses are summarized through the Batch API (OPENAI_BATCH_FOCUSES)
+	OpenAIBatchFocuses []string
+	// LLM gateway: base URL, extra headers and model aliases for OpenAI requests
+	OpenAIBaseURL      string
+	OpenAIHeaders      map[string]string
+	OpenAIModelAliases map[string]string
+	// Egress: shared CA bundle plus per-client proxy and CA overrides
+	CABundle       string
+	SlackProxyURL  string
+	SlackCABundle  string
+	OpenAIProxyURL string
+	OpenAICABundle string
+	SMTPProxyURL   string
+	SMTPCABundle   string
+	// Circuit breakers per external host (threshold 0 disables)
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+	// DigestTemplate is a text/template file for --no-llm and degraded digests
+	DigestTemplate string
+	// SkipPreflight skips checking Slack, OpenAI, SMTP and the schema up front
+	SkipPreflight bool
+	// Slack digest posting (optional)
+	SlackDigestChannel  string
+	SlackHighlightCount int
+	// SlackPostTimes schedule the Slack post for a local time of day, by
+	// focus; "" applies to every focus (SLACK_POST_AT, SLACK_POST_AT_<FOCUS>)
+	SlackPostTimes map[string]slackPostTime
+	// TeamsWebhookURL is a Teams incoming webhook digests are posted to
+	TeamsWebhookURL string
+	// Discord posts digests to a Discord channel by webhook or as the bot
+	Discord discordSettings
+	// OperatorNotify is the Slack channel or user told once about monitored
+	// channels the bot can't read (OPERATOR_NOTIFY)
+	OperatorNotify string
+	// Digest archive server; PublicBaseURL is where it is reachable
+	HTTPAddr      string
+	PublicBaseURL string
+	// StaticArchive publishes archived digests as HTML pages to a directory or S3
+	StaticArchive staticArchiveSettings
+	// EmailTracking sends each recipient a copy with an open pixel and wrapped links
+	EmailTracking bool
+	// EmailMaxBytes is the largest email body, as HTML, sent in one piece
+	EmailMaxBytes int
+	// Topic subscriptions: recipients' topics, sent as an addendum to their
+	// copy or as a separate email; TopicPreferences lets them edit their own
+	TopicSubscriptions map[string][]string
+	TopicDelivery      string
+	TopicPreferences   bool
+	// Newsletter naming: DIGEST_NAME_<FOCUS>, and optional LLM edition titles
+	DigestNames   map[string]string
+	EditionTitles bool
+	// DigestStatistics appends message statistics for the period to the digest
+	DigestStatistics bool
+	// ReactionSignals maps emoji names to workflow states (REACTION_SIGNALS)
+	ReactionSignals map[string]string
+	// ReactionPriorityThreshold is the reaction count that raises a message's
+	// priority; 0 disables (REACTION_PRIORITY_THRESHOLD)
+	ReactionPriorityThreshold int
+	// Blocker tracking: a Risks and Blockers section from messages matching BlockerPatterns
+	TrackBlockers   bool
+	BlockerPatterns []string
+	// Incident tracking: an Incidents section listing open incidents until a
+	// resolution is seen (TRACK_INCIDENTS, INCIDENT_ID_PREFIXES,
+	// INCIDENT_MIN_PRIORITY, INCIDENT_RESOLVED_PATTERNS)
+	TrackIncidents bool
+	Incidents      incidentSettings
+	// Follow-ups: a Still Outstanding section of action items from previous
+	// digests with no completion signal, and optional weekly reminder DMs to
+	// their owners (TRACK_ACTION_ITEMS, ACTION_ITEM_PATTERNS, ACTION_ITEM_REMINDERS)
+	TrackActionItems    bool
+	ActionItemPatterns  []string
+	ActionItemReminders bool
+	// ExtractActionItems adds an Action Items section extracted by the cheap
+	// model as structured output, and records the items (EXTRACT_ACTION_ITEMS)
+	ExtractActionItems bool
+	// SentimentScoring scores support-focus messages with "llm" or "local"
+	// for a Customer Sentiment section (SENTIMENT_SCORING, empty disables)
+	SentimentScoring string
+	// BusinessHours flag messages posted outside them (BUSINESS_DAYS,
+	// BUSINESS_HOURS, BUSINESS_TIMEZONE); AfterHoursCallout adds a digest
+	// section on that activity
+	BusinessHours     businessHours
+	AfterHoursCallout bool
+	// QuietChannels lists the monitored channels with no new messages
+	QuietChannels bool
+	// Community highlights: the most-reacted messages (count 0 disables)
+	CommunityHighlightsCount        int
+	CommunityHighlightsMinReactions int
+	// Post-processing of the model's summary: processors run in the listed order
+	SummaryPostProcessors []string
+	BannedWords           []string
+	SummaryMaxChars       int
+	// Hooks: shell commands run with the run context as JSON on stdin
+	HookPreRun       string
+	HookPostSummary  string
+	HookPostDelivery string
+	HookTimeout      time.Duration
+	// DeliveryTargets are registered delivery targets to use besides email and Slack
+	DeliveryTargets []string
+	// JobMaxAttempts is how often a staged job is tried before it is dead-lettered
+	JobMaxAttempts int
+	// Clock is the time source for the run; --as-of replaces it
+	Clock Clock
+	// Usage counts the run's Slack and OpenAI API calls
+	Usage *apiUsage
+}
+
+type Flags struct {
+	ListChannels bool
+	Focus        string
+	FromDateStr  string
+	DryRun       bool
+	Stream       bool
+	NoLLM        bool
+	Serve        bool
+	// QueueScheduled makes the --serve scheduler queue its runs for runs
+	// next workers instead of running them itself
+	QueueScheduled bool
+	// RunLease is how long a scheduled run may be running before the
+	// scheduler takes it to be abandoned and runs it again
+	RunLease   time.Duration
+	Migrate    bool
+	Pager      bool
+	Output     cliOutput
+	AsOfStr    string
+	DumpPrompt string
+	Sample     int
+	Batch      bool
+	// RunID is the runs row of a queued, staged or scheduled run, and 0
+	// for runs started from the command line
+	RunID int
+	// OutputPath is a file the finished digest is also written to, as
+	// OutputFormat: md, html or json
+	OutputPath   string
+	OutputFormat string
+}
+
+type Update = commontypes.Update
+
+type Attachment = commontypes.Attachment
+
+// newLogger creates a production logger at the given level ("debug", "info", ...),
+// defaulting to info.
+func newLogger(level string) *zap.Logger {
+	zapConfig := zap.NewProductionConfig()
+	if level != "" {
+		if lvl, err := zap.ParseAtomicLevel(level); err == nil {
+			zapConfig.Level = lvl
+		}
+	}
+	logger, err := zapConfig.Build()
+	if err != nil {
+		logger, _ = zap.NewProduction()
+	}
+	return logger
+}
+
+func loadConfig() (*Config, error) {
+	err := godotenv.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading .env file: %v", err)
+	}
+
+	profiles, err := loadFocusProfiles(os.Getenv("FOCUS_CONFIG"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FOCUS_CONFIG: %v", err)
+	}
+
+	defaultChannelsStr := os.Getenv("DEFAULT_FOCUS_CHANNELS")
+	var defaultChannels []string
+	if defaultChannelsStr != "" {
+		defaultChannels = strings.Split(defaultChannelsStr, ",")
+	} else if profiles["default"] == nil {
+		return nil, fmt.Errorf("DEFAULT_FOCUS_CHANNELS environment variable is required unless FOCUS_CONFIG defines a default focus")
+	}
+
+	supportChannelsStr := os.Getenv("SUPPORT_FOCUS_CHANNELS")
+	var supportChannels []string
+	if supportChannelsStr != "" {
+		supportChannels = strings.Split(supportChannelsStr, ",")
+	}
+
+	emailToStr := os.Getenv("EMAIL_TO")
+	var emailTo []string
+	if emailToStr != "" {
+		emailTo = strings.Split(emailToStr, ",")
+	}
+
+	config := &Config{
+		Clock:                   systemClock{},
+		Usage:                   newAPIUsage(),
+		SlackToken:              os.Getenv("SLACK_BOT_TOKEN"),
+		OpenAIToken:             os.Getenv("OPENAI_API_KEY"),
+		DBHost:                  os.Getenv("DB_HOST"),
+		DBPort:                  os.Getenv("DB_PORT"),
+		DBName:                  os.Getenv("DB_NAME"),
+		DBUser:                  os.Getenv("DB_USER"),
+		DBPassword:              os.Getenv("DB_PASSWORD"),
+		DBDriver:                os.Getenv("DB_DRIVER"),
+		DBPath:                  os.Getenv("DB_PATH"),
+		DefaultFocusChannels:    defaultChannels,
+		SupportFocusChannels:    supportChannels,
+		SMTPHost:                os.Getenv("SMTP_HOST"),
+		SMTPPort:                os.Getenv("SMTP_PORT"),
+		SMTPUser:                os.Getenv("SMTP_USER"),
+		SMTPPassword:            os.Getenv("SMTP_PASSWORD"),
+		EmailFrom:               os.Getenv("EMAIL_FROM"),
+		EmailTo:                 emailTo,
+		EmailCC:                 splitList(os.Getenv("EMAIL_CC")),
+		EmailBCC:                splitList(os.Getenv("EMAIL_BCC")),
+		EmailReplyTo:            strings.TrimSpace(os.Getenv("EMAIL_REPLY_TO")),
+		EmailOverrides:          emailOverrides(os.Environ()),
+		ZendeskSubdomain:        os.Getenv("ZENDESK_SUBDOMAIN"),
+		ZendeskEmail:            os.Getenv("ZENDESK_EMAIL"),
+		ZendeskAPIToken:         os.Getenv("ZENDESK_API_TOKEN"),
+		ZendeskFocus:            focusList(os.Getenv("ZENDESK_FOCUS"), "support"),
+		StatusPageProvider:      os.Getenv("STATUSPAGE_PROVIDER"),
+		StatusPageURL:           os.Getenv("STATUSPAGE_URL"),
+		StatusPageFocus:         focusList(os.Getenv("STATUSPAGE_FOCUS"), "default,support"),
+		IMAPHost:                os.Getenv("IMAP_HOST"),
+		IMAPPort:                os.Getenv("IMAP_PORT"),
+		IMAPUser:                os.Getenv("IMAP_USER"),
+		IMAPPassword:            os.Getenv("IMAP_PASSWORD"),
+		IMAPFolders:             splitList(os.Getenv("IMAP_FOLDERS")),
+		IMAPSubjectFilters:      splitList(os.Getenv("IMAP_SUBJECT_FILTERS")),
+		IMAPFromFilters:         splitList(os.Getenv("IMAP_FROM_FILTERS")),
+		IMAPFocus:               focusList(os.Getenv("IMAP_FOCUS"), "default,support"),
+		GoogleCalendarID:        os.Getenv("GOOGLE_CALENDAR_ID"),
+		GoogleCredentialsFile:   os.Getenv("GOOGLE_CREDENTIALS_FILE"),
+		GitLabURL:               os.Getenv("GITLAB_URL"),
+		GitLabToken:             os.Getenv("GITLAB_TOKEN"),
+		GitLabProjects:          splitList(os.Getenv("GITLAB_PROJECTS")),
+		GitLabFocus:             focusList(os.Getenv("GITLAB_FOCUS"), "default"),
+		LinearAPIKey:            os.Getenv("LINEAR_API_KEY"),
+		LinearTeams:             splitList(os.Getenv("LINEAR_TEAMS")),
+		LinearFocus:             focusList(os.Getenv("LINEAR_FOCUS"), "default"),
+		DiscordBotToken:         os.Getenv("DISCORD_BOT_TOKEN"),
+		DiscordChannelIDs:       splitList(os.Getenv("DISCORD_CHANNEL_IDS")),
+		DiscordFocus:            focusList(os.Getenv("DISCORD_FOCUS"), "default"),
+		TeamsTenantID:           os.Getenv("TEAMS_TENANT_ID"),
+		TeamsClientID:           os.Getenv("TEAMS_CLIENT_ID"),
+		TeamsClientSecret:       os.Getenv("TEAMS_CLIENT_SECRET"),
+		TeamsChannels:           splitList(os.Getenv("TEAMS_CHANNELS")),
+		TeamsFocus:              focusList(os.Getenv("TEAMS_FOCUS"), "default"),
+		ConfluenceURL:           os.Getenv("CONFLUENCE_URL"),
+		ConfluenceEmail:         os.Getenv("CONFLUENCE_EMAIL"),
+		ConfluenceAPIToken:      os.Getenv("CONFLUENCE_API_TOKEN"),
+		ConfluenceSpaces:        splitList(os.Getenv("CONFLUENCE_SPACES")),
+		NotionAPIKey:            os.Getenv("NOTION_API_KEY"),
+		NotionDatabaseIDs:       splitList(os.Getenv("NOTION_DATABASE_IDS")),
+		DocsFocus:               focusList(os.Getenv("DOCS_FOCUS"), "default"),
+		EmbeddingProvider:       strings.TrimSpace(os.Getenv("EMBEDDING_PROVIDER")),
+		EmbeddingModel:          strings.TrimSpace(os.Getenv("EMBEDDING_MODEL")),
+		EmbeddingBaseURL:        strings.TrimSpace(os.Getenv("EMBEDDING_BASE_URL")),
+		CohereAPIKey:            os.Getenv("COHERE_API_KEY"),
+		IngestBotMessages:       os.Getenv("INGEST_BOT_MESSAGES") == "true",
+		ExcludedAppIDs:          splitList(os.Getenv("EXCLUDED_APP_IDS")),
+		SkipEmojiOnly:           os.Getenv("SKIP_EMOJI_ONLY_MESSAGES") == "true",
+		SkipJoinLeave:           os.Getenv("SKIP_JOIN_LEAVE_MESSAGES") == "true",
+		AuthorAllow:             focusLists(os.Environ(), "AUTHORS_ALLOW_"),
+		AuthorDeny:              focusLists(os.Environ(), "AUTHORS_DENY_"),
+		SelectionReportAppendix: os.Getenv("SELECTION_REPORT_APPENDIX") == "true",
+		TranslationProvider:     os.Getenv("TRANSLATION_PROVIDER"),
+		TranslationTargetLang:   os.Getenv("TRANSLATION_TARGET_LANG"),
+		DeepLAPIKey:             os.Getenv("DEEPL_API_KEY"),
+		DeepLAPIURL:             os.Getenv("DEEPL_API_URL"),
+		OpenAIModel:             os.Getenv("OPENAI_MODEL"),
+		OpenAICheapModel:        os.Getenv("OPENAI_CHEAP_MODEL"),
+		OpenAIBaseURL:           strings.TrimSpace(os.Getenv("OPENAI_BASE_URL")),
+		OpenAIBatchFocuses:      splitList(os.Getenv("OPENAI_BATCH_FOCUSES")),
+		CABundle:                os.Getenv("CA_BUNDLE"),
+		SlackProxyURL:           os.Getenv("SLACK_PROXY_URL"),
+		SlackCABundle:           os.Getenv("SLACK_CA_BUNDLE"),
+		OpenAIProxyURL:          os.Getenv("OPENAI_PROXY_URL"),
+		OpenAICABundle:          os.Getenv("OPENAI_CA_BUNDLE"),
+		SMTPProxyURL:            os.Getenv("SMTP_PROXY_URL"),
+		SMTPCABundle:            os.Getenv("SMTP_CA_BUNDLE"),
+		DigestTemplate:          os.Getenv("DIGEST_TEMPLATE"),
+		SkipPreflight:           os.Getenv("SKIP_PREFLIGHT") == "true",
+		SlackDigestChannel:      os.Getenv("SLACK_DIGEST_CHANNEL"),
+		TeamsWebhookURL:         strings.TrimSpace(os.Getenv("TEAMS_WEBHOOK_URL")),
+		OperatorNotify:          strings.TrimSpace(os.Getenv("OPERATOR_NOTIFY")),
+		HTTPAddr:                os.Getenv("HTTP_ADDR"),
+		PublicBaseURL:           os.Getenv("PUBLIC_BASE_URL"),
+		EmailTracking:           os.Getenv("EMAIL_TRACKING") == "true",
+		TopicDelivery:           os.Getenv("TOPIC_DELIVERY"),
+		TopicPreferences:        os.Getenv("TOPIC_PREFERENCES") == "true",
+		LearnWeights:            os.Getenv("LEARN_WEIGHTS") == "true",
+		FeedbackLinks:           os.Getenv("FEEDBACK_LINKS") == "true",
+		DigestStatistics:        os.Getenv("DIGEST_STATISTICS") == "true",
+		AfterHoursCallout:       os.Getenv("AFTER_HOURS_CALLOUT") == "true",
+		QuietChannels:           os.Getenv("QUIET_CHANNELS") == "true",
+		FollowThreads:           os.Getenv("FOLLOW_THREADS") == "true",
+		DigestNames:             focusValues(os.Environ(), "DIGEST_NAME_"),
+		ChannelInstructions:     focusValues(os.Environ(), "CHANNEL_INSTRUCTION_"),
+		EditionTitles:           os.Getenv("DIGEST_EDITION_TITLES") == "true",
+		TrackBlockers:           os.Getenv("TRACK_BLOCKERS") == "true",
+		BlockerPatterns:         splitList(os.Getenv("BLOCKER_PATTERNS")),
+		TrackIncidents:          os.Getenv("TRACK_INCIDENTS") == "true",
+		Incidents: incidentSettings{
+			IDPrefixes:       splitList(os.Getenv("INCIDENT_ID_PREFIXES")),
+			ResolvedPatterns: splitList(os.Getenv("INCIDENT_RESOLVED_PATTERNS")),
+		},
+		Discord: discordSettings{
+			WebhookURL: strings.TrimSpace(os.Getenv("DISCORD_WEBHOOK_URL")),
+			ChannelID:  strings.TrimSpace(os.Getenv("DISCORD_DIGEST_CHANNEL")),
+			Format:     strings.ToLower(os.Getenv("DISCORD_DIGEST_FORMAT")),
+		},
+		StaticArchive: staticArchiveSettings{
+			Target:          strings.TrimSpace(os.Getenv("STATIC_ARCHIVE")),
+			S3Endpoint:      strings.TrimSpace(os.Getenv("STATIC_ARCHIVE_S3_ENDPOINT")),
+			S3Region:        os.Getenv("AWS_REGION"),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		AudioEdition: audioSettings{
+			Mode:  strings.ToLower(os.Getenv("AUDIO_EDITION")),
+			Model: os.Getenv("AUDIO_MODEL"),
+			Voice: os.Getenv("AUDIO_VOICE"),
+		},
+		TrackActionItems:      os.Getenv("TRACK_ACTION_ITEMS") == "true",
+		ActionItemPatterns:    splitList(os.Getenv("ACTION_ITEM_PATTERNS")),
+		ActionItemReminders:   os.Getenv("ACTION_ITEM_REMINDERS") == "true",
+		ExtractActionItems:    os.Getenv("EXTRACT_ACTION_ITEMS") == "true",
+		SentimentScoring:      strings.ToLower(os.Getenv("SENTIMENT_SCORING")),
+		SummaryPostProcessors: splitList(os.Getenv("SUMMARY_POSTPROCESSORS")),
+		BannedWords:           splitList(os.Getenv("BANNED_WORDS")),
+		ExcerptKeywords:       splitList(os.Getenv("EXCERPT_KEYWORDS")),
+		HookPreRun:            os.Getenv("HOOK_PRE_RUN"),
+		DeliveryTargets:       splitList(os.Getenv("DELIVERY_TARGETS")),
+		HookPostSummary:       os.Getenv("HOOK_POST_SUMMARY"),
+		HookPostDelivery:      os.Getenv("HOOK_POST_DELIVERY"),
+		DKIMDomain:            os.Getenv("DKIM_DOMAIN"),
+		DKIMSelector:          os.Getenv("DKIM_SELECTOR"),
+		DKIMPrivateKeyFile:    os.Getenv("DKIM_PRIVATE_KEY_FILE"),
+		EmailLogo:             os.Getenv("EMAIL_LOGO"),
+		EmailAccentColor:      os.Getenv("EMAIL_ACCENT_COLOR"),
+		EmailHeadingColor:     os.Getenv("EMAIL_HEADING_COLOR"),
+		EmailHeaderText:       strings.ReplaceAll(os.Getenv("EMAIL_HEADER_TEXT"), `\n`, "\n"),
+		EmailFooterText:       strings.ReplaceAll(os.Getenv("EMAIL_FOOTER_TEXT"), `\n`, "\n"),
+		MastheadImage:         strings.ToLower(os.Getenv("MASTHEAD_IMAGE")),
+	}
+
+	backend, err := store.New(config.DBDriver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_DRIVER: %v", err)
+	}
+	config.DBDriver = backend.Driver()
+
+	required := map[string]string{
+		"SLACK_BOT_TOKEN": config.SlackToken,
+	}
+	if config.DBDriver == store.Postgres {
+		required["DB_HOST"] = config.DBHost
+		required["DB_PORT"] = config.DBPort
+		required["DB_NAME"] = config.DBName
+		required["DB_USER"] = config.DBUser
+		required["DB_PASSWORD"] = config.DBPassword
+	} else if config.DBPath == "" {
+		config.DBPath = "shinbun.db"
+	}
+
+	for _, k := range sortedKeys(required) {
+		if required[k] == "" {
+			return nil, fmt.Errorf("%s is required", k)
+		}
+	}
+
+	config.CorrelationSimilarity = 0.85
+	if v := os.Getenv("CORRELATION_SIMILARITY"); v != "" {
+		similarity, err := strconv.ParseFloat(v, 64)
+		if err != nil || similarity < 0 || similarity > 1 {
+			return nil, fmt.Errorf("CORRELATION_SIMILARITY must be a number between 0 and 1")
+		}
+		config.CorrelationSimilarity = similarity
+	}
+
+	config.PromptTokenBudget = -1 // fit the model's context window
+	if v := os.Getenv("PROMPT_TOKEN_BUDGET"); v != "" {
+		budget, err := strconv.Atoi(v)
+		if err != nil || budget < 0 {
+			return nil, fmt.Errorf("PROMPT_TOKEN_BUDGET must be a non-negative integer")
+		}
+		config.PromptTokenBudget = budget
+	}
+
+	if v := os.Getenv("MAX_COST_PER_RUN"); v != "" {
+		cost, err := strconv.ParseFloat(v, 64)
+		if err != nil || cost < 0 {
+			return nil, fmt.Errorf("MAX_COST_PER_RUN must be a non-negative number of US dollars")
+		}
+		config.MaxCostPerRun = cost
+	}
+
+	config.MessageMaxChars = 4000
+	if v := os.Getenv("MESSAGE_MAX_CHARS"); v != "" {
+		chars, err := strconv.Atoi(v)
+		if err != nil || chars < 0 {
+			return nil, fmt.Errorf("MESSAGE_MAX_CHARS must be a non-negative integer")
+		}
+		config.MessageMaxChars = chars
+	}
+	config.MessageExcerptLines = 10
+	if v := os.Getenv("MESSAGE_EXCERPT_LINES"); v != "" {
+		lines, err := strconv.Atoi(v)
+		if err != nil || lines < 1 {
+			return nil, fmt.Errorf("MESSAGE_EXCERPT_LINES must be a positive integer")
+		}
+		config.MessageExcerptLines = lines
+	}
+	if len(config.ExcerptKeywords) == 0 {
+		config.ExcerptKeywords = defaultExcerptKeywords
+	}
+	config.MaxChannelMessages = 5000
+	if v := os.Getenv("MAX_CHANNEL_MESSAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("MAX_CHANNEL_MESSAGES must be a non-negative integer")
+		}
+		config.MaxChannelMessages = n
+	}
+
+	config.CodeBlockMaxChars = 600
+	if v := os.Getenv("CODE_BLOCK_MAX_CHARS"); v != "" {
+		chars, err := strconv.Atoi(v)
+		if err != nil || chars < 0 {
+			return nil, fmt.Errorf("CODE_BLOCK_MAX_CHARS must be a non-negative integer")
+		}
+		config.CodeBlockMaxChars = chars
+	}
+
+	if v := os.Getenv("MAX_TOKENS_PER_RUN"); v != "" {
+		tokens, err := strconv.Atoi(v)
+		if err != nil || tokens < 0 {
+			return nil, fmt.Errorf("MAX_TOKENS_PER_RUN must be a non-negative integer")
+		}
+		config.MaxTokensPerRun = tokens
+	}
+
+	config.MapChunkTokens = 8000
+	if v := os.Getenv("MAP_CHUNK_TOKENS"); v != "" {
+		tokens, err := strconv.Atoi(v)
+		if err != nil || tokens <= 0 {
+			return nil, fmt.Errorf("MAP_CHUNK_TOKENS must be a positive integer")
+		}
+		config.MapChunkTokens = tokens
+	}
+
+	config.MapConcurrency = 4
+	if v := os.Getenv("MAP_CONCURRENCY"); v != "" {
+		concurrency, err := strconv.Atoi(v)
+		if err != nil || concurrency <= 0 {
+			return nil, fmt.Errorf("MAP_CONCURRENCY must be a positive integer")
+		}
+		config.MapConcurrency = concurrency
+	}
+
+	sectionTokens, err := parseSectionTokens(os.Getenv("MAP_SECTION_TOKENS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAP_SECTION_TOKENS: %v", err)
+	}
+	config.MapSectionTokens = sectionTokens
+
+	if v := os.Getenv("MIN_MESSAGE_CHARS"); v != "" {
+		chars, err := strconv.Atoi(v)
+		if err != nil || chars < 0 {
+			return nil, fmt.Errorf("MIN_MESSAGE_CHARS must be a non-negative integer")
+		}
+		config.MinMessageChars = chars
+	}
+
+	if len(config.BlockerPatterns) == 0 {
+		config.BlockerPatterns = defaultBlockerPatterns
+	}
+	if len(config.Incidents.IDPrefixes) == 0 {
+		config.Incidents.IDPrefixes = []string{"INC"}
+	}
+	if len(config.Incidents.ResolvedPatterns) == 0 {
+		config.Incidents.ResolvedPatterns = defaultIncidentResolvedPatterns
+	}
+	if len(config.ActionItemPatterns) == 0 {
+		config.ActionItemPatterns = defaultActionItemPatterns
+	}
+	if config.Discord.Format == "" {
+		config.Discord.Format = discordFormatText
+	}
+	if err := config.Discord.validate(config.DiscordBotToken); err != nil {
+		return nil, err
+	}
+	switch config.SentimentScoring {
+	case "", sentimentLLM, sentimentLocal:
+	default:
+		return nil, fmt.Errorf("SENTIMENT_SCORING must be %s or %s", sentimentLLM, sentimentLocal)
+	}
+	config.Incidents.MinPriority = 4
+	if v := os.Getenv("INCIDENT_MIN_PRIORITY"); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil || priority < 1 {
+			return nil, fmt.Errorf("INCIDENT_MIN_PRIORITY must be a positive integer")
+		}
+		config.Incidents.MinPriority = priority
+	}
+
+	config.CommunityHighlightsMinReactions = 5
+	config.ReactionPriorityThreshold = 10
+	highlightSettings := map[string]*int{
+		"COMMUNITY_HIGHLIGHTS_COUNT":         &config.CommunityHighlightsCount,
+		"COMMUNITY_HIGHLIGHTS_MIN_REACTIONS": &config.CommunityHighlightsMinReactions,
+		"REACTION_PRIORITY_THRESHOLD":        &config.ReactionPriorityThreshold,
+	}
+	for _, name := range sortedKeys(highlightSettings) {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*highlightSettings[name] = n
+		}
+	}
+
+	config.SlackHighlightCount = 10
+	if v := os.Getenv("SLACK_HIGHLIGHT_COUNT"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("SLACK_HIGHLIGHT_COUNT must be a positive integer")
+		}
+		config.SlackHighlightCount = count
+	}
+
+	config.EmailMaxBytes = defaultEmailMaxBytes
+	if v := os.Getenv("EMAIL_MAX_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("EMAIL_MAX_BYTES must be a positive integer")
+		}
+		config.EmailMaxBytes = n
+	}
+
+	for _, name := range config.SummaryPostProcessors {
+		if !slices.Contains(postProcessorNames, name) {
+			return nil, fmt.Errorf("unknown post-processor %q in SUMMARY_POSTPROCESSORS (known: %s)", name, strings.Join(postProcessorNames, ", "))
+		}
+	}
+	if v := os.Getenv("SUMMARY_MAX_CHARS"); v != "" {
+		chars, err := strconv.Atoi(v)
+		if err != nil || chars <= 0 {
+			return nil, fmt.Errorf("SUMMARY_MAX_CHARS must be a positive integer")
+		}
+		config.SummaryMaxChars = chars
+	}
+
+	config.CircuitBreakerThreshold = 3
+	if v := os.Getenv("CIRCUIT_BREAKER_THRESHOLD"); v != "" {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("CIRCUIT_BREAKER_THRESHOLD must be a non-negative integer")
+		}
+		config.CircuitBreakerThreshold = threshold
+	}
+
+	config.CircuitBreakerCooldown = time.Minute
+	if v := os.Getenv("CIRCUIT_BREAKER_COOLDOWN"); v != "" {
+		cooldown, err := time.ParseDuration(v)
+		if err != nil || cooldown < 0 {
+			return nil, fmt.Errorf("CIRCUIT_BREAKER_COOLDOWN must be a duration such as 30s or 2m")
+		}
+		config.CircuitBreakerCooldown = cooldown
+	}
+
+	if err := config.StaticArchive.validate(); err != nil {
+		return nil, err
+	}
+
+	registered := delivery.Registered()
+	for _, name := range config.DeliveryTargets {
+		if !slices.Contains(registered, name) {
+			return nil, fmt.Errorf("unknown delivery target %q in DELIVERY_TARGETS (registered: %s)", name, strings.Join(registered, ", "))
+		}
+	}
+
+	config.LearningRate = 0.2
+	if v := os.Getenv("LEARNING_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("LEARNING_RATE must be a number above 0 and at most 1")
+		}
+		config.LearningRate = rate
+	}
+
+	config.JobMaxAttempts = 5
+	if v := os.Getenv("JOB_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("JOB_MAX_ATTEMPTS must be a positive integer")
+		}
+		config.JobMaxAttempts = attempts
+	}
+
+	config.HookTimeout = time.Minute
+	if v := os.Getenv("HOOK_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("HOOK_TIMEOUT must be a duration such as 30s or 2m")
+		}
+		config.HookTimeout = timeout
+	}
+
+	weightSettings := map[string]*map[string]float64{
+		"SOURCE_BUDGET_SHARES": &config.SourceBudgetShares,
+		"SCORE_WEIGHTS":        &config.ScoreWeights,
+		"AUTHOR_WEIGHTS":       &config.AuthorWeights,
+		"CHANNEL_WEIGHTS":      &config.ChannelWeights,
+		"CATEGORY_WEIGHTS":     &config.CategoryWeights,
+	}
+	for _, name := range sortedKeys(weightSettings) {
+		weights, err := parseWeights(os.Getenv(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		*weightSettings[name] = weights
+	}
+	signals, err := parseReactionSignals(os.Getenv("REACTION_SIGNALS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REACTION_SIGNALS: %v", err)
+	}
+	config.ReactionSignals = signals
+	tickets, err := parseTicketURLTemplates(os.Getenv("TICKET_URL_TEMPLATES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TICKET_URL_TEMPLATES: %v", err)
+	}
+	config.TicketURLTemplates = tickets
+	if config.OpenAIHeaders, err = parseHeaders(os.Getenv("OPENAI_HEADERS")); err != nil {
+		return nil, fmt.Errorf("invalid OPENAI_HEADERS: %v", err)
+	}
+	if config.OpenAIModelAliases, err = parseModelAliases(os.Getenv("OPENAI_MODEL_ALIASES")); err != nil {
+		return nil, fmt.Errorf("invalid OPENAI_MODEL_ALIASES: %v", err)
+	}
+	terms, err := categoryTermsFromEnv(os.Environ())
+	if err != nil {
+		return nil, fmt.Errorf("invalid URGENT_TERMS/ALERT_TERMS/SUPPORT_TERMS: %v", err)
+	}
+	config.CategoryTerms = terms
+	schedules, err := parseSchedules(focusValues(os.Environ(), "SCHEDULE_"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %v", err)
+	}
+	config.Schedules = schedules
+	config.applyFocusProfiles(profiles)
+	businessDays, businessHoursRange, businessTimezone := os.Getenv("BUSINESS_DAYS"), os.Getenv("BUSINESS_HOURS"), os.Getenv("BUSINESS_TIMEZONE")
+	if businessDays == "" {
+		businessDays = "mon-fri"
+	}
+	if businessHoursRange == "" {
+		businessHoursRange = "09:00-18:00"
+	}
+	if businessTimezone == "" {
+		// Message times are shown in JST
+		businessTimezone = "Asia/Tokyo"
+	}
+	hours, err := parseBusinessHours(businessDays, businessHoursRange, businessTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid business hours: %v", err)
+	}
+	config.BusinessHours = hours
+	postTimes := focusValues(os.Environ(), "SLACK_POST_AT_")
+	postTimes[""] = strings.TrimSpace(os.Getenv("SLACK_POST_AT"))
+	if config.SlackPostTimes, err = parseSlackPostTimes(postTimes, hours.Location); err != nil {
+		return nil, err
+	}
+	subscriptions, err := parseTopicSubscriptions(os.Getenv("TOPIC_SUBSCRIPTIONS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOPIC_SUBSCRIPTIONS: %v", err)
+	}
+	config.TopicSubscriptions = subscriptions
+	switch config.TopicDelivery {
+	case "":
+		config.TopicDelivery = topicDeliveryAddendum
+	case topicDeliveryAddendum, topicDeliveryEmail:
+	default:
+		return nil, fmt.Errorf("TOPIC_DELIVERY must be %s or %s", topicDeliveryAddendum, topicDeliveryEmail)
+	}
+
+	for _, source := range sortedKeys(config.SourceBudgetShares) {
+		if config.SourceBudgetShares[source] < 0 {
+			return nil, fmt.Errorf("invalid SOURCE_BUDGET_SHARES: negative share for %s", source)
+		}
+	}
+
+	if config.TranslationTargetLang == "" {
+		config.TranslationTargetLang = "EN"
+	}
+	if config.OpenAIModel == "" {
+		config.OpenAIModel = openai.GPT4oMini20240718
+	}
+	if config.OpenAICheapModel == "" {
+		config.OpenAICheapModel = openai.GPT4oMini
+	}
+
+	if config.DKIMDomain != "" {
+		if config.DKIMSelector == "" || config.DKIMPrivateKeyFile == "" {
+			return nil, fmt.Errorf("DKIM_DOMAIN requires DKIM_SELECTOR and DKIM_PRIVATE_KEY_FILE")
+		}
+		if _, err := loadDKIMKey(config.DKIMPrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.EmailAccentColor == "" {
+		config.EmailAccentColor = "#3498db"
+	}
+	if config.EmailHeadingColor == "" {
+		config.EmailHeadingColor = "#2c3e50"
+	}
+	colors := map[string]string{"EMAIL_ACCENT_COLOR": config.EmailAccentColor, "EMAIL_HEADING_COLOR": config.EmailHeadingColor}
+	for _, name := range sortedKeys(colors) {
+		if !cssColorPattern.MatchString(colors[name]) {
+			return nil, fmt.Errorf("%s must be a hex color such as #3498db", name)
+		}
+	}
+	if config.EmailLogo != "" && !config.logoIsURL() {
+		if _, err := os.Stat(config.EmailLogo); err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_LOGO: %v", err)
+		}
+	}
+	switch config.MastheadImage {
+	case "", mastheadImageTemplate, mastheadImageDallE:
+	default:
+		return nil, fmt.Errorf("MASTHEAD_IMAGE must be %s or %s", mastheadImageTemplate, mastheadImageDallE)
+	}
+
+	if err := config.AudioEdition.validate(config.PublicBaseURL); err != nil {
+		return nil, err
+	}
+	if config.AudioEdition.Model == "" {
+		config.AudioEdition.Model = string(openai.TTSModel1)
+	}
+	if config.AudioEdition.Voice == "" {
+		config.AudioEdition.Voice = string(openai.VoiceAlloy)
+	}
+
+	if config.EmailTracking && config.PublicBaseURL == "" {
+		return nil, fmt.Errorf("EMAIL_TRACKING requires PUBLIC_BASE_URL")
+	}
+	if config.TopicPreferences && !config.EmailTracking {
+		return nil, fmt.Errorf("TOPIC_PREFERENCES requires EMAIL_TRACKING")
+	}
+
+	if config.HTTPAddr == "" {
+		config.HTTPAddr = ":8080"
+	}
+
+	if config.IMAPPort == "" {
+		config.IMAPPort = "993"
+	}
+	if len(config.IMAPFolders) == 0 {
+		config.IMAPFolders = []string{"INBOX"}
+	}
+
+	return config, nil
+}
+
+// splitList parses a comma-separated value, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// sortedKeys returns the keys of m in order, for iterating maps where the
+// order shows in output or errors.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseFromDate(fromDateStr string, now time.Time) (time.Time, error) {
+	if fromDateStr == "" {
+		return time.Time{}, nil
+	}
+
+	layout := "2006-01-02"
+	t, err := time.Parse(layout, fromDateStr)
+	if err == nil {
+		year, month, day := t.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, time.Local), nil
+	}
+
+	// Try parsing as a duration relative to now (e.g., "24h", "168h", "7d")
+	// Handle "d" for days separately as time.ParseDuration doesn't support it
+	if strings.HasSuffix(fromDateStr, "d") {
+		daysStr := strings.TrimSuffix(fromDateStr, "d")
+		days, err := strconv.Atoi(daysStr)
+		if err == nil && days > 0 {
+			// Convert days to hours
+			hours := days * 24
+			fromDateStr = fmt.Sprintf("%dh", hours)
+		} else {
+			// Invalid number of days format
+			return time.Time{}, errors.New("invalid day format in --from-date duration")
+		}
+	}
+
+	// Now parse the duration (original or converted from days)
+	dur, err := time.ParseDuration(fromDateStr)
+	if err == nil {
+		if dur > 0 {
+			dur = -dur
+		}
+		return now.Add(dur), nil
+	}
+
+	return time.Time{}, errors.New("invalid --from-date format. Use YYYY-MM-DD or duration (e.g., 24h, 7d)")
+}
+
+// connectDB connects to the DB_DRIVER database: PostgreSQL at DB_HOST, or
+// the SQLite file at DB_PATH.
+func connectDB(config *Config) (*sql.DB, error) {
+	backend, err := store.New(config.DBDriver)
+	if err != nil {
+		return nil, err
+	}
+	dsn := config.DBPath
+	if backend.Driver() == store.Postgres {
+		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName)
+	}
+
+	db, err := backend.Open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	return db, nil
+}
+
+// newSlackClient returns a Slack client using the Slack network settings and
+// circuit breakers.
+func newSlackClient(config *Config, logger *zap.Logger) (*slack.Client, error) {
+	slackHTTP, err := newHTTPClient(config.networkFor("slack"), 0)
+	if err != nil {
+		return nil, err
+	}
+	slackHTTP = withUsage(slackHTTP, config.Usage, usageSlack)
+	slackHTTP = withCircuitBreakers(slackHTTP, config.CircuitBreakerThreshold, config.CircuitBreakerCooldown, logger)
+	return slack.New(config.SlackToken, slack.OptionHTTPClient(slackHTTP)), nil
+}
+
+func getChannelID(api *slack.Client, db *sql.DB, channelName string, logger *zap.Logger) (slackID string, dbID int, err error) {
+	query := `SELECT id, slack_id FROM channels WHERE name = $1`
+	err = db.QueryRow(query, channelName).Scan(&dbID, &slackID)
+	if err == nil {
+		logger.Debug("Found channel in database",
+			zap.String("channel_name", channelName),
+			zap.String("slack_id", slackID),
+			zap.Int("db_id", dbID))
+		return slackID, dbID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", 0, fmt.Errorf("error querying channel from database: %v", err)
+	}
+
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           100,
+		Types:           []string{"public_channel", "private_channel"},
+	}
+
+	for {
+		channels, nextCursor, err := api.GetConversations(params)
+		if err != nil {
+			return "", 0, fmt.Errorf("error getting conversations: %v", err)
+		}
+
+		for _, channel := range channels {
+			if channel.Name == channelName {
+				logger.Info("Found channel in Slack",
+					zap.String("channel_name", channelName),
+					zap.String("channel_id", channel.ID))
+
+				dbID, err := upsertChannel(db, channel, logger)
+				if err != nil {
+					logger.Error("Failed to store channel in database",
+						zap.String("channel_name", channelName),
+						zap.Error(err))
+				}
+				return channel.ID, dbID, nil
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		params.Cursor = nextCursor
+	}
+
+	return "", 0, fmt.Errorf("channel %s not found", channelName)
+}
+
+func upsertChannel(db *sql.DB, channel slack.Channel, logger *zap.Logger) (int, error) {
+	var id int
+	query := `
+		INSERT INTO channels (slack_id, name, topic, purpose)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		ON CONFLICT (slack_id) 
+		DO UPDATE SET name = EXCLUDED.name, topic = EXCLUDED.topic, purpose = EXCLUDED.purpose, updated_at = CURRENT_TIMESTAMP
+		RETURNING id`
+
+	logger.Debug("Upserting channel",
+		zap.String("slack_id", channel.ID),
+		zap.String("name", channel.Name))
+
+	err := db.QueryRow(query, channel.ID, channel.Name, channel.Topic.Value, channel.Purpose.Value).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error upserting channel: %v", err)
+	}
+
+	return id, nil
+}
+
+func getLastFetchTime(db *sql.DB, channelID int, now time.Time, logger *zap.Logger) (time.Time, error) {
+	var lastFetched sql.NullTime
+	query := `SELECT last_fetched FROM channels WHERE id = $1`
+
+	logger.Debug("Getting last fetch time", zap.Int("channel_id", channelID))
+	err := db.QueryRow(query, channelID).Scan(&lastFetched)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting last fetch time: %v", err)
+	}
+
+	if !lastFetched.Valid {
+		return now.AddDate(0, 0, -7), nil
+	}
+
+	return lastFetched.Time, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// updateLastFetchTime advances last_fetched to the newest stored message. It
+// never moves backwards, and since it follows the data rather than the clock,
+// messages posted while a run is in progress are picked up by the next one.
+func updateLastFetchTime(db execer, channelID int, newest time.Time, logger *zap.Logger) error {
+	query := `UPDATE channels SET last_fetched = CASE WHEN last_fetched > $2 THEN last_fetched ELSE $2 END WHERE id = $1`
+
+	logger.Debug("Updating last fetch time", zap.Int("channel_id", channelID), zap.Time("newest", newest))
+	_, err := db.Exec(query, channelID, newest)
+	if err != nil {
+		return fmt.Errorf("error updating last fetch time: %v", err)
+	}
+
+	return nil
+}
+
+func saveMessage(db execer, channelID int, msg Update, logger *zap.Logger) error {
+	msgTime, err := formatTimestamp(msg.Timestamp)
+	if err != nil {
+		return fmt.Errorf("error parsing timestamp: %v", err)
+	}
+
+	query := `
+		INSERT INTO messages (slack_id, channel_id, text, timestamp, permalink, translation, author, category, priority, reaction_count, status)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9, $10, NULLIF($11, ''))
+		ON CONFLICT (slack_id) DO UPDATE
+		SET text = EXCLUDED.text,
+		    permalink = EXCLUDED.permalink,
+		    translation = COALESCE(EXCLUDED.translation, messages.translation),
+		    author = COALESCE(EXCLUDED.author, messages.author),
+		    category = COALESCE(EXCLUDED.category, messages.category),
+		    priority = EXCLUDED.priority,
+		    reaction_count = CASE WHEN EXCLUDED.reaction_count > messages.reaction_count THEN EXCLUDED.reaction_count ELSE messages.reaction_count END,
+		    status = EXCLUDED.status`
+
+	logger.Debug("Saving message",
+		zap.Int("channel_id", channelID),
+		zap.String("slack_id", msg.Timestamp),
+		zap.Time("parsed_time", msgTime))
+
+	_, err = db.Exec(query, msg.Timestamp, channelID, msg.Text, msgTime, msg.Link, msg.Translation, msg.Author, msg.Category, msg.Priority, msg.ReactionCount, msg.Status)
+	if err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+
+	if err := saveReactions(db, msg); err != nil {
+		return err
+	}
+	return saveAttachments(db, msg)
+}
+
+// saveMessagePage stores a page of a channel's messages in one transaction.
+// It returns the newest message's time, for advancing last_fetched once the
+// whole fetch is stored.
+func saveMessagePage(db *sql.DB, channelID int, updates []Update, logger *zap.Logger) (time.Time, error) {
+	var newest time.Time
+	if len(updates) == 0 {
+		return newest, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return newest, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, update := range updates {
+		if err := saveMessage(tx, channelID, update, logger); err != nil {
+			return time.Time{}, err
+		}
+		if ts, err := formatTimestamp(update.Timestamp); err == nil && ts.After(newest) {
+			newest = ts
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("error committing messages: %v", err)
+	}
+	return newest, nil
+}
+
+// getMessagesFromDB loads the channel's stored messages from since and,
+// unless until is zero, before until. With a limit and more messages than
+// that, only the limit with the highest stored priority, then reactions, are
+// loaded; the newest win ties.
+func getMessagesFromDB(db *sql.DB, channelID int, since, until time.Time, limit int, logger *zap.Logger) ([]Update, error) {
+	query := `
+		SELECT text, m.slack_id, permalink, c.name, COALESCE(translation, ''), COALESCE(author, ''), reaction_count, COALESCE(status, ''),
+			COALESCE(category, ''), COALESCE(priority, 0)
+		FROM messages m
+		JOIN channels c ON m.channel_id = c.id
+		WHERE channel_id = $1 AND timestamp >= $2`
+	args := []any{channelID, since}
+	if !until.IsZero() {
+		query += ` AND timestamp < $3`
+		args = append(args, until)
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(` ORDER BY COALESCE(priority, 0) DESC, reaction_count DESC, timestamp DESC, permalink LIMIT %d`, limit)
+	} else {
+		query += ` ORDER BY timestamp DESC, permalink`
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages: %v", err)
+	}
+	defer rows.Close()
+
+	var updates []Update
+	for rows.Next() {
+		var update Update
+		if err := rows.Scan(&update.Text, &update.Timestamp, &update.Link, &update.Channel, &update.Translation, &update.Author, &update.ReactionCount, &update.Status,
+			&update.Category, &update.Priority); err != nil {
+			return nil, fmt.Errorf("error scanning message row: %v", err)
+		}
+		updates = append(updates, update)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message rows: %v", err)
+	}
+	if limit > 0 {
+		sort.SliceStable(updates, func(i, j int) bool { return newerFirst(updates[i], updates[j]) })
+	}
+
+	reactions, err := loadReactions(db, channelID, since)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := loadAttachments(db, channelID, since)
+	if err != nil {
+		return nil, err
+	}
+	for i := range updates {
+		updates[i].Reactions = reactions[updates[i].Timestamp]
+		updates[i].Attachments = attachments[updates[i].Timestamp]
+		// Stored before attachment-only messages were described
+		if strings.TrimSpace(updates[i].Text) == "" {
+			updates[i].Text = attachmentsText(updates[i].Attachments)
+		}
+	}
+	return updates, nil
+}
+
+// summarizeChannel fetches the channel's messages after since and, unless
+// until is zero, up to until, sending each page's updates to pages as it
+// arrives. It stops early, without error, when stop is closed.
+func summarizeChannel(api *slack.Client, permalinks *permalinkCache, channelID string, channelName string, since, until time.Time, filter ingestionFilter, users *userDirectory, terms termSet, pages chan<- []Update, stop <-chan struct{}, logger *zap.Logger) error {
+	// Aggregate stats across pages
+	totalMessagesFetched := 0
+	totalSkippedBots := 0
+	totalThreadReplies := 0
+	totalLowQuality := 0
+	totalAuthorFiltered := 0
+	totalProcessedMessages := 0
+	cursor := "" // Start with no cursor
+
+	for {
+		params := &slack.GetConversationHistoryParameters{
+			ChannelID: channelID,
+			Oldest:    fmt.Sprintf("%d", since.Unix()),
+			Limit:     200, // Increased limit
+			Cursor:    cursor,
+		}
+		if !until.IsZero() {
+			params.Latest = fmt.Sprintf("%d", until.Unix())
+		}
+		history, err := api.GetConversationHistory(params)
+		if err != nil {
+			return fmt.Errorf("error getting channel history (cursor: %s): %v", cursor, err)
+		}
+
+		totalMessagesFetched += len(history.Messages)
+		var updates []Update
+		pageSkippedBots := 0
+		pageThreadReplies := 0
+		pageProcessedMessages := 0
+
+		// Process messages from the current page
+		for _, msg := range history.Messages {
+			// Skip our own posts, excluded bots, non-messages, and thread replies
+			isBotOrNonMessage := msg.Type != "message" || filter.excludes(msg)
+			isThreadReply := msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp
+			if isBotOrNonMessage || isThreadReply {
+				if isBotOrNonMessage {
+					pageSkippedBots++
+				}
+				if isThreadReply {
+					pageThreadReplies++
+				}
+				continue
+			}
+			if filter.excludesAuthor(msg) {
+				filter.Skipped["author"]++
+				totalAuthorFiltered++
+				continue
+			}
+			if reason := filter.lowQuality(msg); reason != "" {
+				filter.Skipped[reason]++
+				totalLowQuality++
+				continue
+			}
+
+			permalink, err := permalinks.permalink(api, channelID, channelName, msg.Timestamp)
+			if err != nil {
+				logger.Warn("Couldn't get permalink for message",
+					zap.String("channel_name", channelName),
+					zap.String("timestamp", msg.Timestamp),
+					zap.Error(err))
+				permalink = "N/A" // Keep original behavior
+			}
+
+			reactionCount := 0
+			for _, reaction := range msg.Reactions {
+				reactionCount += reaction.Count
+			}
+
+			attachments := slackAttachments(msg)
+			text := users.rewriteMentions(msg.Text)
+			if strings.TrimSpace(text) == "" {
+				text = attachmentsText(attachments)
+			}
+			category, priority := terms.categorize(channelName, text)
+			status := reactionStatus(msg.Reactions, filter.Signals)
+			priority = adjustPriorityForStatus(priority, status)
+			priority = adjustPriorityForReactions(priority, reactionCount, filter.ReactionBoost)
+			updates = append(updates, Update{
+				Text:          text,
+				Timestamp:     msg.Timestamp,
+				Link:          permalink,
+				Channel:       channelName,
+				Category:      category,
+				Priority:      priority,
+				Author:        msg.User,
+				Mentions:      mentionedUsers(msg.Text),
+				ReactionCount: reactionCount,
+				Reactions:     reactionCounts(msg.Reactions),
+				Status:        status,
+				Attachments:   attachments,
+			})
+			pageProcessedMessages++
+		}
+
+		// Accumulate stats for this page
+		totalSkippedBots += pageSkippedBots
+		totalThreadReplies += pageThreadReplies
+		totalProcessedMessages += pageProcessedMessages
+
+		select {
+		case pages <- updates:
+		case <-stop:
+			logger.Info("Stopped fetching channel", zap.String("channel_name", channelName))
+			return nil
+		}
+
+		// Check if we need to fetch more pages
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			break // Exit loop if no more pages
+		}
+		cursor = history.ResponseMetaData.NextCursor // Set cursor for the next iteration
+	}
+
+	logger.Info("Processed messages from channel",
+		zap.String("channel_name", channelName),
+		zap.Int("total_messages_fetched", totalMessagesFetched),
+		zap.Int("skipped_bots", totalSkippedBots),
+		zap.Int("thread_replies", totalThreadReplies),
+		zap.Int("skipped_low_quality", totalLowQuality),
+		zap.Int("skipped_by_author", totalAuthorFiltered),
+		zap.Int("processed_messages", totalProcessedMessages),
+		zap.Int("cached_permalinks", permalinks.Hits),
+		zap.Int("fetched_permalinks", permalinks.Misses),
+		zap.Int("built_permalinks", permalinks.Built))
+
+	return nil
+}
+
+// sourceLabel names the origin of an update for the prompt.
+func sourceLabel(update Update) string {
+	if update.Source == "" {
+		return "slack"
+	}
+	return update.Source
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func formatTimestamp(timestamp string) (time.Time, error) {
+	tsFloat := float64(0)
+	if _, err := fmt.Sscanf(timestamp, "%f", &tsFloat); err != nil {
+		return time.Time{}, fmt.Errorf("error parsing timestamp: %v", err)
+	}
+
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error loading JST timezone: %v", err)
+	}
+
+	return time.Unix(int64(tsFloat), 0).In(jst), nil
+}
+
+// promptContext is background for the summary prompt that isn't itself an
+// update: calendar events, what each channel is for, what is wanted from
+// each channel, and the time of the run.
+type promptContext struct {
+	Calendar string
+	Channels string
+	// Instructions are the configured channel instructions, by
+	// channelInstructionKey
+	Instructions map[string]string
+	Now          time.Time
+	// Prompt is the focus's prompt from FOCUS_CONFIG; nil uses the built-in one
+	Prompt *focusPrompt
+}
+
+// generateSummary summarizes updates in a single completion with the given model.
+func generateSummary(client *openai.Client, model string, updates []Update, focus string, background promptContext, stream io.Writer, logger *zap.Logger) (string, error) {
+	systemMessage, prompt := summaryPrompt(updates, focus, background)
+
+	logger.Info("Generating summary with OpenAI",
+		zap.String("focus", focus),
+		zap.String("model", model),
+		zap.Int("message_count", len(updates)))
+
+	return completeSummary(client, model, systemMessage, prompt, focus, stream, logger)
+}
+
+// formatUpdatesForPrompt renders updates grouped by category for the prompt and
+// reports whether any documentation updates are included. Each category starts
+// with the instructions for the channels in it.
+func formatUpdatesForPrompt(updates []Update, instructions map[string]string) (string, bool) {
+	sortByScore(updates)
+
+	var alertUpdates []Update
+	var supportUpdates []Update
+	var generalUpdates []Update
+	var docsUpdates []Update
+	var highPriorityUpdates []Update
+
+	for _, update := range updates {
+		if update.Priority >= 3 {
+			highPriorityUpdates = append(highPriorityUpdates, update)
+		}
+		switch update.Category {
+		case "alert":
+			alertUpdates = append(alertUpdates, update)
+		case "support":
+			supportUpdates = append(supportUpdates, update)
+		case "docs":
+			docsUpdates = append(docsUpdates, update)
+		default:
+			generalUpdates = append(generalUpdates, update)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Here are the messages from the last week, grouped by category:\n\n")
+
+	writeUpdates := func(updates []Update, section string) {
+		if len(updates) > 0 {
+			sb.WriteString(fmt.Sprintf("%s:\n", section))
+			writeChannelInstructions(&sb, updates, instructions)
+			for _, update := range updates {
+				msgTime, err := formatTimestamp(update.Timestamp)
+				timeStr := "unknown time"
+				if err == nil {
+					timeStr = msgTime.Format("2006-01-02 15:04:05 JST")
+				}
+				if update.AfterHours {
+					timeStr += " (outside business hours)"
+				}
+
+				sb.WriteString(fmt.Sprintf("Source: %s\n", sourceLabel(update)))
+				sb.WriteString(fmt.Sprintf("Channel: %s\n", update.Channel))
+				sb.WriteString(fmt.Sprintf("Time: %s\n", timeStr))
+				sb.WriteString(fmt.Sprintf("Message: %s\n", formatMessage(update.Text)))
+				if update.Translation != "" {
+					sb.WriteString(fmt.Sprintf("Translation: %s\n", formatMessage(update.Translation)))
+				}
+				if len(update.Attachments) > 0 {
+					sb.WriteString(fmt.Sprintf("Attachments: %s\n", formatAttachments(update.Attachments)))
+				}
+				if update.Status != "" {
+					sb.WriteString(fmt.Sprintf("Status: %s (marked by a team reaction)\n", update.Status))
+				}
+				if update.ReactionCount > 0 {
+					sb.WriteString(fmt.Sprintf("Reactions: %s\n", formatReactions(update)))
+				}
+				sb.WriteString(fmt.Sprintf("Link: %s\n", update.Link))
+				if len(update.RelatedLinks) > 0 {
+					sb.WriteString(fmt.Sprintf("Related Links: %s\n", strings.Join(update.RelatedLinks, ", ")))
+				}
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	writeUpdates(highPriorityUpdates, "High Priority Messages")
+	writeUpdates(alertUpdates, "Alert Messages")
+	writeUpdates(supportUpdates, "Support Messages")
+	writeUpdates(generalUpdates, "General Messages")
+	writeUpdates(docsUpdates, "Documentation Updates")
+
+	return sb.String(), len(docsUpdates) > 0
+}
+
+// channelInstructionsHeader introduces a category's channel instructions.
+const channelInstructionsHeader = "Instructions for channels in this section:"
+
+// writeChannelInstructions lists the instructions for the updates' channels,
+// once per channel in order of appearance.
+func writeChannelInstructions(sb *strings.Builder, updates []Update, instructions map[string]string) {
+	seen := make(map[string]bool)
+	var lines []string
+	for _, update := range updates {
+		key := channelInstructionKey(update.Channel)
+		if seen[key] || instructions[key] == "" {
+			continue
+		}
+		seen[key] = true
+		lines = append(lines, fmt.Sprintf("- %s: %s\n", update.Channel, instructions[key]))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sb.WriteString(channelInstructionsHeader + "\n")
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+	sb.WriteString("\n")
+}
+
+// buildSummaryPrompt returns the system message and user prompt for the focus,
+// wrapping the formatted messages.
+func buildSummaryPrompt(messages string, hasDocs bool, focus string, background promptContext) (systemMessage string, prompt string) {
+	var docsInstruction string
+	if hasDocs {
+		docsInstruction = `
+Finish with a "Docs updated this week" section listing each page from the Documentation Updates with a one-line synopsis and its link.
+`
+	}
+
+	if strings.Contains(messages, "\nAttachments: ") {
+		docsInstruction += `
+Some messages list the files and links shared with them under Attachments; only their titles are known, not their contents. When a shared document matters to an item, name it and link it.
+`
+	}
+
+	if strings.Contains(messages, "\n"+channelInstructionsHeader+"\n") {
+		docsInstruction += `
+Some sections start with instructions for particular channels, saying what the reader wants from them. Follow each one for that channel's messages, e.g. leave out what it says to skip; they don't apply to other channels.
+`
+	}
+
+	if strings.Contains(messages, "```") {
+		docsInstruction += `
+Some messages include code or log excerpts in fenced blocks. When one is key to an item (an error message, a failing command), quote the relevant line or two in a fenced code block; never paste long excerpts.
+`
+	}
+
+	var contextSection string
+	if background.Calendar != "" {
+		contextSection = `
+Scheduled events from the team calendar during this period. When a message relates to one of these events, connect them in the summary (e.g. "during Tuesday's maintenance window..."):
+` + background.Calendar
+	}
+	if background.Channels != "" {
+		contextSection += `
+What each channel is for, from its Slack purpose and topic. Use it to judge what messages mean (e.g. alerts in an automated alerts channel are routine unless they say otherwise):
+` + background.Channels
+	}
+
+	style := focus
+	if background.Prompt != nil && background.Prompt.Builtin != "" {
+		style = background.Prompt.Builtin
+	}
+	switch style {
+	case "support":
+		systemMessage = `You are a highly efficient support team assistant. You analyze Slack messages from support channels and provide a concise, actionable summary focused on customer issues, escalations, and resolutions. Prioritize clarity and urgency.`
+		prompt = `Summarize the following support-related messages. Structure the summary into these sections:
+
+1.  **Critical/Urgent Issues:** Bullet points for any urgent matters needing immediate attention.
+2.  **New Support Requests:** Briefly list new issues raised.
+3.  **Updates & Resolutions:** Summarize progress on ongoing issues or confirmed resolutions.
+4.  **Statistics:** Provide a brief statistical overview including: the total number of requests/messages summarized, a breakdown of request types (if possible), components frequently mentioned, and teams involved/mentioned.
+
+Each message includes a "Source:" field (e.g. slack, discord). When an item comes from a source other than Slack, mention the source.
+Messages in another language include a "Translation:" field; summarize from the translation.
+Messages starting with "Related items" combine the same topic across sources; present each as a single entry and include its "Link:" and all of its "Related Links:".
+
+IMPORTANT: Each message below includes a \"Link:\" field containing the exact Slack message URL. When referencing messages, MUST use these exact URLs in markdown links: [Description](exact-slack-url).
+
+Use a professional and direct tone. Focus on actionable information.
+` + docsInstruction + `
+Current time for context: ` + background.Now.Format("2006-01-02 15:04 JST") + `.
+` + contextSection + `
+Messages:
+` + messages + `
+Please provide the support-focused summary.`
+
+	default: // Default focus
+		systemMessage = `You are a helpful assistant providing a fun, newspaper-style summary of Slack channel updates. Highlight key info and urgent items clearly.`
+		prompt = `You are an assistant that is providing me with important updates and information. You are going to give me key information for the week prior. I like my information presented
+like a newspaper, with key information at the top, important highlights, and any urgent topics clearly called out. The remaining information should
+be presented as a short summary with key highlights or takeaways that I should be aware of.
+
+Messages in another language include a "Translation:" field. Summarize from the translation, but keep names and terms from the original where helpful.
+
+Each message includes a timestamp in JST (Japan Standard Time). Use these timestamps to provide accurate timing information in your summary.
+For example, if a message is from "2025-02-01 14:30:00 JST", say "yesterday at 2:30 PM" or "on February 1st" as appropriate.
+The current time is ` + background.Now.Format("2006-01-02 15:04:05 JST") + `.
+
+Structure the summary in the following sections:
+
+1. "Top highlights" - 3-5 bullet points of the most important items, with links to the relevant Slack messages.
+2. "Urgent Incidents and Support Issues" - Bullet points of major support issues and incidents, with links to the relevant Slack message. Include any data in the information like when the incident started.
+3. "General Updates" - Group and summarize other interesting topics and announcements, provide any takeaways.
+4. "Support and Incident Summary" - Provide an overview of support requests and incidents, provide any takeaways and identify any follow up actions that I need.
+` + docsInstruction + `
+Each message includes a "Source:" field (e.g. slack, discord). When an item comes from a source other than Slack, label it with its source, e.g. "(via Discord)".
+Messages starting with "Related items" combine the same topic across sources (e.g. a Slack thread, the incident and the ticket). Present each as a single entry and include its "Link:" and all of its "Related Links:".
+
+IMPORTANT: Each message below includes a "Link:" field containing the exact Slack message URL. When referencing messages in your summary, you MUST use these exact URLs in your markdown links. Do not modify the URLs or use placeholders. Format your links as [description](url)
+
+After you create your summary, review the above context to make sure the summary meets those expectations both in terms of format and content. 
+Also you need to double-check that the links to the slack message are correct and working links. They should be exactly the link provided in the 'Link:' field.
+
+As for the tone, I want you to sound cheery and bright. Make it happy and fun to read with little jokes and fun comments.
+` + contextSection + `
+Messages to summarize:
+` + messages + `
+
+Please summarize these messages, making sure to use the exact Slack message URLs provided in the Link: fields above.` // End of prompt assignment
+
+	}
+
+	if custom := background.Prompt; custom != nil {
+		if custom.System != "" {
+			systemMessage = custom.System
+		}
+		if custom.Template != nil {
+			prompt = custom.render(promptTemplateData{
+				Focus:        focus,
+				Now:          background.Now.Format("2006-01-02 15:04 JST"),
+				Instructions: docsInstruction,
+				Context:      contextSection,
+				Messages:     messages,
+			}, prompt)
+		}
+	}
+	return systemMessage, prompt
+}
+
+// summaryRequest is the chat completion request for a summary prompt.
+func summaryRequest(model string, systemMessage string, prompt string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: systemMessage, // Use the selected system message
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: 0.7,
+	}
+}
+
+// completeSummary sends the prompt to OpenAI and returns the generated markdown.
+// When stream is non-nil, tokens are also written to it as they arrive.
+func completeSummary(client *openai.Client, model string, systemMessage string, prompt string, focus string, stream io.Writer, logger *zap.Logger) (string, error) {
+	logger.Debug("Prompt to OpenAI", zap.String("focus", focus), zap.String("system_message", systemMessage), zap.String("user_prompt_prefix", prompt[:min(500, len(prompt))])) // Log prefix only
+
+	request := summaryRequest(model, systemMessage, prompt)
+	if stream != nil {
+		return streamSummary(client, request, stream)
+	}
+
+	resp, err := client.CreateChatCompletion(context.Background(), request)
+	if err != nil {
+		return "", fmt.Errorf("error generating summary: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("openai returned no choices")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+// streamSummary runs the completion as a stream, copying each delta to out and
+// returning the full text once the stream ends.
+func streamSummary(client *openai.Client, request openai.ChatCompletionRequest, out io.Writer) (string, error) {
+	request.Stream = true
+	stream, err := client.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		return "", fmt.Errorf("error generating summary: %v", err)
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error streaming summary: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		delta := resp.Choices[0].Delta.Content
+		sb.WriteString(delta)
+		fmt.Fprint(out, delta)
+	}
+	fmt.Fprintln(out)
+
+	if sb.Len() == 0 {
+		return "", errors.New("openai returned an empty summary")
+	}
+	return sb.String(), nil
+}
+
+func listChannels(api *slack.Client, out cliOutput, logger *zap.Logger) error {
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           1000,
+		Types:           []string{"public_channel", "private_channel"},
+	}
+
+	logger.Info("Fetching channel list from Slack")
+	out.text("\nAvailable channels:")
+
+	for {
+		channels, nextCursor, err := api.GetConversations(params)
+		if err != nil {
+			return fmt.Errorf("error getting conversations: %v", err)
+		}
+
+		for _, channel := range channels {
+			private := ""
+			if channel.IsPrivate {
+				private = " (private)"
+			}
+			out.event("channel",
+				map[string]any{"name": channel.Name, "id": channel.ID, "private": channel.IsPrivate},
+				fmt.Sprintf("- %s (ID: %s)%s", channel.Name, channel.ID, private))
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		params.Cursor = nextCursor
+	}
+
+	return nil
+}
+
+func markdownToHTML(md string) string {
+	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
+	p := parser.NewWithExtensions(extensions)
+	doc := p.Parse([]byte(md))
+
+	htmlFlags := html.CommonFlags | html.HrefTargetBlank
+	opts := html.RendererOptions{Flags: htmlFlags}
+	renderer := html.NewRenderer(opts)
+
+	return string(markdown.Render(doc, renderer))
+}
+
+func sendEmail(config *Config, addressing emailAddressing, subject, body string, media editionMedia, logger *zap.Logger) error {
+	return sendHTMLEmail(config, addressing, subject, renderHTMLPage(body, config.emailBranding(media)), media, logger)
+}
+
+// emailAddressing is who a digest is sent to and who replies go to.
+type emailAddressing struct {
+	To      []string
+	CC      []string
+	BCC     []string
+	ReplyTo string
+}
+
+// recipients returns every envelope recipient, including BCC.
+func (a emailAddressing) recipients() []string {
+	all := append([]string{}, a.To...)
+	all = append(all, a.CC...)
+	return append(all, a.BCC...)
+}
+
+// emailOverrides collects per-focus addressing from EMAIL_TO_<FOCUS>,
+// EMAIL_CC_<FOCUS>, EMAIL_BCC_<FOCUS> and EMAIL_REPLY_TO_<FOCUS>, keyed by
+// lowercased focus.
+func emailOverrides(environ []string) map[string]emailAddressing {
+	overrides := make(map[string]emailAddressing)
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		for _, prefix := range []string{"EMAIL_REPLY_TO_", "EMAIL_TO_", "EMAIL_CC_", "EMAIL_BCC_"} {
+			focus, ok := strings.CutPrefix(key, prefix)
+			if !ok || focus == "" {
+				continue
+			}
+			focus = strings.ToLower(focus)
+			a := overrides[focus]
+			switch prefix {
+			case "EMAIL_TO_":
+				a.To = splitList(value)
+			case "EMAIL_CC_":
+				a.CC = splitList(value)
+			case "EMAIL_BCC_":
+				a.BCC = splitList(value)
+			case "EMAIL_REPLY_TO_":
+				a.ReplyTo = strings.TrimSpace(value)
+			}
+			overrides[focus] = a
+			break
+		}
+	}
+	return overrides
+}
+
+// focusValues collects <PREFIX><FOCUS>=value settings keyed by lowercase focus.
+func focusValues(environ []string, prefix string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		focus, ok := strings.CutPrefix(key, prefix)
+		if !ok || focus == "" {
+			continue
+		}
+		values[strings.ToLower(focus)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+// focusLists collects <PREFIX><FOCUS>=a,b,c settings keyed by lowercase focus.
+func focusLists(environ []string, prefix string) map[string][]string {
+	lists := make(map[string][]string)
+	for focus, value := range focusValues(environ, prefix) {
+		lists[focus] = splitList(value)
+	}
+	return lists
+}
+
+// addressingFor returns the addressing for a focus: the global EMAIL_* values
+// with any per-focus overrides applied field by field.
+func (c *Config) addressingFor(focus string) emailAddressing {
+	a := emailAddressing{To: c.EmailTo, CC: c.EmailCC, BCC: c.EmailBCC, ReplyTo: c.EmailReplyTo}
+	override, ok := c.EmailOverrides[strings.ToLower(focus)]
+	if !ok {
+		return a
+	}
+	if override.To != nil {
+		a.To = override.To
+	}
+	if override.CC != nil {
+		a.CC = override.CC
+	}
+	if override.BCC != nil {
+		a.BCC = override.BCC
+	}
+	if override.ReplyTo != "" {
+		a.ReplyTo = override.ReplyTo
+	}
+	return a
+}
+
+// sendHTMLEmail sends an already rendered HTML page. BCC recipients only
+// appear in the SMTP envelope.
+func sendHTMLEmail(config *Config, addressing emailAddressing, subject, page string, media editionMedia, logger *zap.Logger) error {
+	recipients := addressing.recipients()
+	if len(recipients) == 0 {
+		logger.Info("No email recipients configured, skipping email send")
+		return nil
+	}
+
+	if config.SMTPHost == "" || config.SMTPPort == "" {
+		logger.Info("SMTP configuration not provided, skipping email send")
+		return nil
+	}
+
+	message, err := buildEmailMessage(config, addressing, subject, page, media)
+	if err != nil {
+		return err
+	}
+
+	if err := deliverSMTP(config, recipients, message, nil); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	logger.Info("Email sent successfully",
+		zap.Strings("to", addressing.To),
+		zap.Strings("cc", addressing.CC),
+		zap.Int("bcc", len(addressing.BCC)))
+	return nil
+}
+
+// buildEmailMessage assembles the headers and HTML body with the edition's
+// media, DKIM-signed when configured.
+func buildEmailMessage(config *Config, addressing emailAddressing, subject, page string, media editionMedia) ([]byte, error) {
+	contentType := "text/html; charset=UTF-8"
+	body := []byte(page)
+	var images []inlineImage
+	if config.EmailLogo != "" && !config.logoIsURL() {
+		logo, err := readLogo(config.EmailLogo)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, logo)
+	}
+	if media.Masthead != nil {
+		images = append(images, media.Masthead.Image)
+	}
+	if len(images) > 0 {
+		var err error
+		if contentType, body, err = attachInline(page, images); err != nil {
+			return nil, err
+		}
+	}
+	if media.Audio != nil {
+		var err error
+		if contentType, body, err = attachAudio(contentType, body, media.Audio); err != nil {
+			return nil, err
+		}
+	}
+
+	// Headers are written in a fixed order so identical messages are byte-identical
+	headers := [][2]string{{"From", config.EmailFrom}}
+	if len(addressing.To) > 0 {
+		headers = append(headers, [2]string{"To", strings.Join(addressing.To, ", ")})
+	}
+	if len(addressing.CC) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(addressing.CC, ", ")})
+	}
+	if addressing.ReplyTo != "" {
+		headers = append(headers, [2]string{"Reply-To", addressing.ReplyTo})
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", contentType},
+	)
+
+	var message strings.Builder
+	for _, header := range headers {
+		message.WriteString(fmt.Sprintf("%s: %s\r\n", header[0], header[1]))
+	}
+	message.WriteString("\r\n")
+	message.Write(body)
+
+	return signDKIM(config, []byte(message.String()))
+}
+
+// deliverSMTP does what smtp.SendMail does, but dials through the configured
+// proxy and verifies STARTTLS against the SMTP CA bundle. When trace is set,
+// the SMTP dialogue is written to it.
+func deliverSMTP(config *Config, to []string, message []byte, trace io.Writer) error {
+	step := func(format string, args ...any) {
+		if trace != nil {
+			fmt.Fprintf(trace, "-- "+format+"\n", args...)
+		}
+	}
+
+	c, err := openSMTP(config, trace, step)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Mail(config.EmailFrom); err != nil {
+		return fmt.Errorf("MAIL FROM: %v", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s: %v", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %v", err)
+	}
+	step("sending %d byte message", len(message))
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("DATA: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("DATA: %v", err)
+	}
+	return c.Quit()
+}
+
+// openSMTP connects to the SMTP server and gets as far as authenticating,
+// upgrading to TLS when the server offers it.
+func openSMTP(config *Config, trace io.Writer, step func(format string, args ...any)) (*smtp.Client, error) {
+	settings := config.networkFor("smtp")
+	addr := net.JoinHostPort(config.SMTPHost, config.SMTPPort)
+	step("connecting to %s", addr)
+	conn, err := dialThroughSettings(settings, addr, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %v", err)
+	}
+	if trace != nil {
+		conn = newTranscriptConn(conn, trace)
+	}
+	c, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("greeting: %v", err)
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig, err := settings.tlsConfig(config.SMTPHost)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("STARTTLS: %v", err)
+		}
+		step("TLS established; the rest of the dialogue is encrypted")
+	} else {
+		step("server does not offer STARTTLS")
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		step("authenticating as %s", config.SMTPUser)
+		auth := smtp.PlainAuth("", config.SMTPUser, config.SMTPPassword, config.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("AUTH: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// Main runs the shinbun command line: a subcommand named by the first
+// argument, or a digest run configured by flags.
+func Main() {
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			logger := newLogger(os.Getenv("LOG_LEVEL"))
+			if err := command(os.Args[2:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	flags := Flags{}
+	flag.BoolVar(&flags.ListChannels, "list-channels", false, "List available Slack channels and exit")
+	flags.registerWindow(flag.CommandLine)
+	flag.BoolVar(&flags.DryRun, "dry-run", false, "Run without sending email")
+	flag.BoolVar(&flags.Serve, "serve", false, "Serve archived digests over HTTP and run the SCHEDULE_<FOCUS> digests instead of generating one")
+	flag.BoolVar(&flags.QueueScheduled, "queue-scheduled", false, "With --serve, queue the scheduled digests for runs next workers instead of running them")
+	flag.DurationVar(&flags.RunLease, "lease", defaultRunLease, "With --serve, run again scheduled digests left running this long, whose replica presumably died")
+	flag.BoolVar(&flags.Migrate, "migrate", false, "Create or upgrade the database schema and exit")
+	flags.registerSummary(flag.CommandLine)
+	flags.registerOutput(flag.CommandLine)
+	flag.Parse()
+
+	logger := flags.logger()
+	if err := flags.check(logger); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	db, err := connectDB(config)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	if flags.Migrate {
+		applied, err := migrate.Up(db, logger)
+		if err != nil {
+			logger.Fatal("Failed to migrate database", zap.Error(err))
+		}
+		logger.Info("Database schema is up to date", zap.Int("applied", len(applied)), zap.Int("version", migrate.Latest()))
+		return
+	}
+
+	if flags.Serve {
+		if err := serve(db, config, flags, logger); err != nil {
+			logger.Fatal("Digest archive server stopped", zap.Error(err))
+		}
+		return
+	}
+
+	fromDate, until, err := resolveWindow(config, flags.FromDateStr, flags.AsOfStr, logger)
+	if err != nil {
+		logger.Fatal("Invalid run window", zap.Error(err))
+	}
+
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		logger.Fatal("Invalid Slack network configuration", zap.Error(err))
+	}
+
+	if flags.ListChannels {
+		if err := listChannels(api, flags.Output, logger); err != nil {
+			logger.Fatal("Failed to list channels", zap.Error(err))
+		}
+		return
+	}
+
+	if _, err := runDigest(api, db, config, flags, fromDate, until, logger); err != nil {
+		logger.Fatal("Digest run failed", zap.Error(err))
+	}
+}
+
+// resolveWindow parses the --from-date and --as-of values of a run. With an
+// as-of time the config's clock is moved to it, and until is set to it.
+func resolveWindow(config *Config, fromDateStr, asOfStr string, logger *zap.Logger) (fromDate, until time.Time, err error) {
+	if asOfStr != "" {
+		asOf, err := parseAsOf(asOfStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		config.Clock = newAsOfClock(asOf)
+		until = asOf
+		logger.Info("Running as of a past time", zap.Time("as_of", asOf))
+	}
+
+	fromDate, err = parseFromDate(fromDateStr, config.Clock.Now())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --from-date: %v", err)
+	}
+	if fromDate.IsZero() && !until.IsZero() {
+		// Fetch watermarks describe the present, not the backdated run
+		fromDate = until.AddDate(0, 0, -7)
+	}
+	return fromDate, until, nil
+}
+
+// deliverSummary archives the summary, emails it and posts its highlights to
+// Slack, or prints the email and Slack message in dry-run mode. The
+// post-summary hook runs first and can veto delivery by failing; the
+// post-delivery hook gets the outcome of each step. Steps that done, the
+// outcome of an earlier attempt, records as saved or sent are skipped; the
+// returned outcome is nil when the hook vetoed delivery.
+func deliverSummary(api *slack.Client, client *openai.Client, db *sql.DB, config *Config, flags Flags, targets []namedTarget, summary string, editionTitle string, done map[string]string, logger *zap.Logger) map[string]string {
+	now := config.Clock.Now()
+	issue := digestIssue{Name: config.newsletterName(flags.Focus), Title: editionTitle, Date: now}
+	if flags.Sample == 0 {
+		number, err := issueNumber(db, flags.Focus, now)
+		if err != nil {
+			logger.Error("Failed to number digest issue", zap.Error(err))
+		}
+		issue.Number = number
+	}
+	emailSubject := issue.subject()
+	narrated := summary
+	body := newTicketLinker(config.TicketURLTemplates).link(summary)
+	summary = issue.masthead() + body
+	archiveURL := digestURL(config.PublicBaseURL, flags.Focus, now)
+	if flags.Sample > 0 {
+		// A preview must not take the day's archive slot or an issue number
+		emailSubject = "[Sample] " + emailSubject
+		archiveURL = ""
+	}
+
+	hctx := hookContext{Focus: flags.Focus, Time: now, DryRun: flags.DryRun, Summary: summary, Subject: emailSubject, Issue: issue.Number}
+	hctx.Hook = hookPostSummary
+	if err := runHook(config, hctx, logger); err != nil {
+		logger.Error("Post-summary hook failed, not delivering the digest", zap.Error(err))
+		return nil
+	}
+
+	outcome := make(map[string]string)
+	for step, status := range done {
+		outcome[step] = status
+	}
+	delivered := func(step string) bool { return done[step] == "saved" || done[step] == "sent" }
+
+	if flags.OutputPath != "" && !delivered("output") {
+		out := newDigestOutput(config, flags.Focus, issue, emailSubject, summary, archiveURL)
+		if err := out.write(flags.OutputPath, flags.OutputFormat); err != nil {
+			logger.Error("Failed to write digest file", zap.Error(err))
+			outcome["output"] = "failed"
+		} else {
+			logger.Info("Wrote digest file", zap.String("path", flags.OutputPath), zap.String("format", flags.OutputFormat))
+			outcome["output"] = "saved"
+		}
+	}
+	defer func() {
+		hctx.Hook = hookPostDelivery
+		hctx.ArchiveURL = archiveURL
+		hctx.Delivery = outcome
+		if err := runHook(config, hctx, logger); err != nil {
+			logger.Error("Post-delivery hook failed", zap.Error(err))
+		}
+	}()
+
+	if config.AudioEdition.Mode == audioEditionLink && flags.Sample == 0 && !flags.NoLLM {
+		// The listen link goes above the digest everywhere it is delivered
+		if delivered("archive") {
+			if _, err := getDigestAudio(db, flags.Focus, now); err == nil {
+				summary = issue.masthead() + listenLine(archiveURL) + body
+			}
+		} else if audio := narrateEdition(client, config, flags, issue, narrated, logger); audio != nil {
+			if err := saveDigestAudio(db, flags.Focus, now, audio); err != nil {
+				logger.Error("Failed to save digest audio", zap.Error(err))
+			} else {
+				summary = issue.masthead() + listenLine(archiveURL) + body
+			}
+		}
+	}
+
+	if flags.DryRun {
+		outcome["archive"] = "dry_run"
+	} else if flags.Sample > 0 {
+		logger.Info("Sample digests are not archived")
+		outcome["archive"] = "skipped"
+	} else if delivered("archive") {
+		logger.Info("Digest already archived")
+	} else if err := saveDigest(db, flags.Focus, now, issue, summary, logger); err != nil {
+		logger.Error("Failed to archive digest", zap.Error(err))
+		archiveURL = ""
+		outcome["archive"] = "failed"
+	} else {
+		outcome["archive"] = "saved"
+	}
+	if config.StaticArchive.Target != "" && outcome["archive"] == "saved" && !delivered("site") {
+		if err := publishDigest(db, config, flags.Focus, now, summary, logger); err != nil {
+			logger.Error("Failed to publish digest to the static archive", zap.Error(err))
+			outcome["site"] = "failed"
+		} else {
+			outcome["site"] = "saved"
+		}
+	}
+
+	emailBody := summary
+	if archiveURL != "" {
+		emailBody += fmt.Sprintf("\n\n---\n\n[View in browser](%s)\n", archiveURL)
+	}
+
+	willEmail := config.SMTPHost != "" && len(config.addressingFor(flags.Focus).recipients()) > 0
+	var media editionMedia
+	if config.MastheadImage != "" && willEmail && !flags.DryRun && !delivered("email") {
+		media.Masthead = newEditionMasthead(client, config, issue, flags.NoLLM, logger)
+	}
+	if config.AudioEdition.Mode == audioEditionAttach && willEmail && flags.Sample == 0 && !flags.NoLLM && !delivered("email") {
+		media.Audio = narrateEdition(client, config, flags, issue, narrated, logger)
+	}
+	emailParts := splitEmail(emailSubject, emailBody, archiveURL, config.EmailMaxBytes, config.emailBranding(media))
+	if len(emailParts) > 1 || emailParts[0].Body != emailBody {
+		logger.Warn("Digest is too large for one email, splitting it", zap.Int("max_bytes", config.EmailMaxBytes), zap.Int("parts", len(emailParts)))
+	}
+
+	if delivered("email") {
+		logger.Info("Digest already emailed")
+	} else if !flags.DryRun {
+		addressing := config.addressingFor(flags.Focus)
+		addenda := topicAddenda(db, config, summary, logger)
+		var errs []error
+		for i, part := range emailParts {
+			// Topics go with the end of the digest
+			var partAddenda map[string]string
+			if i == len(emailParts)-1 {
+				partAddenda = addenda
+			}
+			partMedia := media
+			if i > 0 {
+				// The narration goes with the first part only
+				partMedia.Audio = nil
+			}
+			errs = append(errs, sendDigestEmails(db, config, addressing, part.Subject, part.Body, flags.Focus, now, config.EmailTracking && archiveURL != "", partAddenda, partMedia, logger))
+		}
+		outcome["email"] = "sent"
+		if err := errors.Join(errs...); err != nil {
+			logger.Error("Failed to send email", zap.Error(err))
+			outcome["email"] = "failed"
+		}
+	} else {
+		outcome["email"] = "dry_run"
+		logger.Info("Dry run enabled, skipping email send.")
+		for _, part := range emailParts {
+			flags.Output.event("email", map[string]any{"subject": part.Subject, "body": part.Body},
+				"\n--- Email Subject ---\n"+part.Subject+"\n\n--- Email Body (HTML) ---\n"+part.Body)
+		}
+		addenda := topicAddenda(db, config, summary, logger)
+		for _, recipient := range sortedKeys(addenda) {
+			flags.Output.event("topics", map[string]any{"recipient": recipient, "body": addenda[recipient]},
+				fmt.Sprintf("\n--- Topics for %s ---\n%s", recipient, addenda[recipient]))
+		}
+	}
+
+	if flags.DryRun {
+		for _, t := range targets {
+			outcome[t.Name] = "dry_run"
+		}
+	} else {
+		var pending []namedTarget
+		for _, t := range targets {
+			if !delivered(t.Name) {
+				pending = append(pending, t)
+			}
+		}
+		deliverToTargets(pending, deliveryDigest(flags.Focus, now, issue, emailSubject, summary, archiveURL, config), outcome, logger)
+	}
+
+	if config.TeamsWebhookURL != "" && !delivered("teams") {
+		deliverToTeams(config, flags, emailSubject, summary, archiveURL, outcome, logger)
+	}
+
+	if config.Discord.enabled() && !delivered("discord") {
+		deliverToDiscord(config, flags, emailSubject, summary, archiveURL, outcome, logger)
+	}
+
+	if config.SlackDigestChannel == "" || delivered("slack") {
+		return outcome
+	}
+	post, continued := buildDigestBlocks(emailSubject, summary, archiveURL, config.SlackHighlightCount)
+	// Scheduling goes by the wall clock, also for backdated runs
+	var postAt time.Time
+	if postTime, ok := config.slackPostTimeFor(flags.Focus); ok {
+		postAt = postTime.postAt(time.Now())
+	}
+	if !postAt.IsZero() && (len(continued) > 0 || archiveURL == "") {
+		logger.Warn("Digest needs replies in its Slack thread, which can't be scheduled; posting it now", zap.Int("continued", len(continued)), zap.Bool("archive_url", archiveURL != ""))
+		postAt = time.Time{}
+	}
+
+	if !flags.DryRun && !postAt.IsZero() {
+		// No ts until Slack posts it, so the post can't collect reaction feedback
+		outcome["slack"] = "sent"
+		if err := scheduleDigestToSlack(api, config.SlackDigestChannel, emailSubject, post, postAt, logger); err != nil {
+			logger.Error("Failed to schedule digest post to Slack", zap.Error(err))
+			outcome["slack"] = "failed"
+		}
+	} else if !flags.DryRun {
+		outcome["slack"] = "sent"
+		channelID, ts, err := postDigestToSlack(api, config.SlackDigestChannel, emailSubject, summary, archiveURL, config.SlackHighlightCount, logger)
+		if err != nil {
+			logger.Error("Failed to post digest to Slack", zap.Error(err))
+			outcome["slack"] = "failed"
+		}
+		if ts != "" {
+			if err := recordDigestPost(db, channelID, ts, flags.Focus, now); err != nil {
+				logger.Warn("Failed to record digest post for feedback", zap.Error(err))
+			}
+		}
+	} else {
+		outcome["slack"] = "dry_run"
+		for i, blockSet := range append([][]slack.Block{post}, continued...) {
+			blocks, err := json.MarshalIndent(slack.Blocks{BlockSet: blockSet}, "", "  ")
+			if err != nil {
+				logger.Error("Failed to render Slack blocks", zap.Error(err))
+				return outcome
+			}
+			if i == 0 && !postAt.IsZero() {
+				flags.Output.event("slack_blocks", map[string]any{"channel": config.SlackDigestChannel, "post_at": postAt, "blocks": json.RawMessage(blocks)},
+					fmt.Sprintf("\n--- Slack Blocks (%s, scheduled for %s) ---\n%s", config.SlackDigestChannel, postAt.Format("2006-01-02 15:04 MST"), blocks))
+				continue
+			}
+			if i == 0 {
+				flags.Output.event("slack_blocks", map[string]any{"channel": config.SlackDigestChannel, "blocks": json.RawMessage(blocks)},
+					fmt.Sprintf("\n--- Slack Blocks (%s) ---\n%s", config.SlackDigestChannel, blocks))
+				continue
+			}
+			flags.Output.event("slack_thread_blocks", map[string]any{"channel": config.SlackDigestChannel, "blocks": json.RawMessage(blocks)},
+				fmt.Sprintf("\n--- Slack Thread Blocks (%s) ---\n%s", config.SlackDigestChannel, blocks))
+		}
+	}
+	return outcome
+}
@@ -0,0 +1,169 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Workflow states that reactions can signal, strongest first: a resolved
+// message stays resolved even if it was escalated on the way.
+const (
+	statusResolved     = "resolved"
+	statusEscalated    = "escalated"
+	statusAcknowledged = "acknowledged"
+)
+
+var statusRank = map[string]int{
+	statusResolved:     3,
+	statusEscalated:    2,
+	statusAcknowledged: 1,
+}
+
+// parseReactionSignals parses "emoji=state" lists such as
+// "white_check_mark=resolved,eyes=acknowledged,rotating_light=escalated".
+// Emoji are Slack names without colons or skin tones.
+func parseReactionSignals(value string) (map[string]string, error) {
+	signals := make(map[string]string)
+	for _, entry := range splitList(value) {
+		emoji, state, ok := strings.Cut(entry, "=")
+		emoji = strings.Trim(strings.TrimSpace(emoji), ":")
+		state = strings.ToLower(strings.TrimSpace(state))
+		if !ok || emoji == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected emoji=state", entry)
+		}
+		if statusRank[state] == 0 {
+			return nil, fmt.Errorf("unknown state %q in %q, expected resolved, acknowledged or escalated", state, entry)
+		}
+		signals[emoji] = state
+	}
+	return signals, nil
+}
+
+// reactionStatus returns the strongest workflow state signalled by the
+// reactions, or "".
+func reactionStatus(reactions []slack.ItemReaction, signals map[string]string) string {
+	status := ""
+	for _, r := range reactions {
+		name, _, _ := strings.Cut(r.Name, "::") // drop skin tone
+		if state := signals[name]; statusRank[state] > statusRank[status] {
+			status = state
+		}
+	}
+	return status
+}
+
+// adjustPriorityForStatus raises escalated messages and lowers resolved ones,
+// which no longer need attention.
+func adjustPriorityForStatus(priority int, status string) int {
+	switch status {
+	case statusEscalated:
+		return priority + 2
+	case statusResolved:
+		return max(1, priority-1)
+	}
+	return priority
+}
+
+// reactionCounts counts the reactions by emoji, folding skin tones together.
+func reactionCounts(reactions []slack.ItemReaction) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range reactions {
+		name, _, _ := strings.Cut(r.Name, "::")
+		counts[name] += r.Count
+	}
+	return counts
+}
+
+// adjustPriorityForReactions raises messages many people reacted to, such as
+// well-received announcements, by one.
+func adjustPriorityForReactions(priority, count, threshold int) int {
+	if threshold > 0 && count >= threshold {
+		return priority + 1
+	}
+	return priority
+}
+
+// mergeReactions adds the counts of b to those of a.
+func mergeReactions(a, b map[string]int) map[string]int {
+	if len(b) == 0 {
+		return a
+	}
+	merged := make(map[string]int, len(a)+len(b))
+	for name, n := range a {
+		merged[name] += n
+	}
+	for name, n := range b {
+		merged[name] += n
+	}
+	return merged
+}
+
+// formatReactions describes an update's reactions for the prompt, e.g.
+// "12 (:+1: 8, :tada: 4)", listing the most used emoji first.
+func formatReactions(u Update) string {
+	names := sortedKeys(u.Reactions)
+	sort.SliceStable(names, func(i, j int) bool { return u.Reactions[names[i]] > u.Reactions[names[j]] })
+	var parts []string
+	for _, name := range names {
+		if len(parts) == 5 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf(":%s: %d", name, u.Reactions[name]))
+	}
+	if len(parts) == 0 {
+		return strconv.Itoa(u.ReactionCount)
+	}
+	return fmt.Sprintf("%d (%s)", u.ReactionCount, strings.Join(parts, ", "))
+}
+
+// saveReactions replaces a fetched message's stored reactions with its
+// current ones. Updates loaded from the database carry no reactions to save.
+func saveReactions(db execer, msg Update) error {
+	if msg.Reactions == nil {
+		return nil
+	}
+	if _, err := db.Exec(`DELETE FROM message_reactions WHERE slack_id = $1`, msg.Timestamp); err != nil {
+		return fmt.Errorf("error clearing reactions: %v", err)
+	}
+	for _, name := range sortedKeys(msg.Reactions) {
+		if _, err := db.Exec(`INSERT INTO message_reactions (slack_id, emoji, count) VALUES ($1, $2, $3)`,
+			msg.Timestamp, name, msg.Reactions[name]); err != nil {
+			return fmt.Errorf("error saving reactions: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadReactions returns the stored reactions of the channel's messages since
+// the given time, by message timestamp.
+func loadReactions(db *sql.DB, channelID int, since time.Time) (map[string]map[string]int, error) {
+	rows, err := db.Query(`
+		SELECT r.slack_id, r.emoji, r.count
+		FROM message_reactions r
+		JOIN messages m ON m.slack_id = r.slack_id
+		WHERE m.channel_id = $1 AND m.timestamp >= $2`, channelID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reactions: %v", err)
+	}
+	defer rows.Close()
+
+	reactions := make(map[string]map[string]int)
+	for rows.Next() {
+		var ts, emoji string
+		var count int
+		if err := rows.Scan(&ts, &emoji, &count); err != nil {
+			return nil, fmt.Errorf("error scanning reaction row: %v", err)
+		}
+		if reactions[ts] == nil {
+			reactions[ts] = make(map[string]int)
+		}
+		reactions[ts][emoji] = count
+	}
+	return reactions, rows.Err()
+}
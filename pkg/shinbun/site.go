@@ -0,0 +1,318 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/s3"
+)
+
+// staticArchiveSettings publish archived digests as a static site
+// (STATIC_ARCHIVE and, for S3, STATIC_ARCHIVE_S3_ENDPOINT and the AWS_
+// credentials).
+type staticArchiveSettings struct {
+	// Target is a directory or s3://bucket/prefix
+	Target          string
+	S3Endpoint      string
+	S3Region        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// s3Target splits an s3://bucket/prefix target; ok is false for a directory.
+func (s staticArchiveSettings) s3Target() (bucket, prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(s.Target, "s3://")
+	if !ok {
+		return "", "", false
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	return bucket, strings.Trim(prefix, "/"), true
+}
+
+// validate checks that an S3 target names a bucket and has credentials.
+func (s staticArchiveSettings) validate() error {
+	bucket, _, isS3 := s.s3Target()
+	if !isS3 {
+		return nil
+	}
+	if bucket == "" {
+		return errors.New("STATIC_ARCHIVE must be s3://bucket or s3://bucket/prefix")
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for an s3:// STATIC_ARCHIVE")
+	}
+	return nil
+}
+
+// siteWriter stores the files of the static archive by slash-separated path.
+type siteWriter interface {
+	WriteFile(path, contentType string, data []byte) error
+}
+
+// dirSite writes the archive into a local directory.
+type dirSite struct {
+	dir string
+}
+
+func (d dirSite) WriteFile(path, contentType string, data []byte) error {
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return fmt.Errorf("invalid archive path %q", path)
+	}
+	full := filepath.Join(d.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return fmt.Errorf("error creating archive directory: %v", err)
+	}
+	// Write then rename, so a web server never serves half a page
+	tmp := fmt.Sprintf("%s.%d.tmp", full, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, full); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// s3Site uploads the archive into a bucket under a key prefix.
+type s3Site struct {
+	client *s3.Client
+	prefix string
+}
+
+func (s s3Site) WriteFile(path, contentType string, data []byte) error {
+	key := path
+	if s.prefix != "" {
+		key = s.prefix + "/" + path
+	}
+	return s.client.PutObject(key, contentType, data)
+}
+
+// newSiteWriter returns the writer for the configured static archive.
+func newSiteWriter(config *Config, httpClient *http.Client) siteWriter {
+	settings := config.StaticArchive
+	bucket, prefix, isS3 := settings.s3Target()
+	if !isS3 {
+		return dirSite{dir: settings.Target}
+	}
+	return s3Site{
+		client: s3.NewClient(bucket, settings.S3Region, settings.AccessKeyID, settings.SecretAccessKey, settings.SessionToken, settings.S3Endpoint, httpClient),
+		prefix: prefix,
+	}
+}
+
+// archivedDigest is a row of the digests table, for the archive indexes.
+type archivedDigest struct {
+	Focus string
+	Date  time.Time
+	Issue int
+	Title string
+}
+
+// sitePagePath is where a digest is published. It mirrors the archive
+// server's /digests/{focus}/{date}, so PUBLIC_BASE_URL can point at the site.
+func sitePagePath(focus string, date time.Time) string {
+	return "digests/" + focus + "/" + date.Format("2006-01-02") + "/index.html"
+}
+
+// publishDigest writes the digest's page to the static archive and refreshes
+// the index pages.
+func publishDigest(db *sql.DB, config *Config, focus string, date time.Time, content string, logger *zap.Logger) error {
+	httpClient, err := newHTTPClient(config.networkFor(""), 60*time.Second)
+	if err != nil {
+		return fmt.Errorf("invalid network configuration: %v", err)
+	}
+	site := newSiteWriter(config, httpClient)
+	if err := writeDigestPage(site, config, focus, date, content); err != nil {
+		return err
+	}
+	if err := writeDigestAudio(site, db, focus, date); err != nil {
+		return err
+	}
+	if err := writeSiteIndexes(site, db, config); err != nil {
+		return err
+	}
+	logger.Info("Published digest to the static archive", zap.String("target", config.StaticArchive.Target), zap.String("path", sitePagePath(focus, date)))
+	return nil
+}
+
+// republishDigests writes every archived digest to the static archive, e.g.
+// after enabling it or changing the branding.
+func republishDigests(db *sql.DB, config *Config, logger *zap.Logger) (int, error) {
+	httpClient, err := newHTTPClient(config.networkFor(""), 60*time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("invalid network configuration: %v", err)
+	}
+	site := newSiteWriter(config, httpClient)
+	digests, err := listArchivedDigests(db)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range digests {
+		content, err := getDigest(db, d.Focus, d.Date)
+		if err != nil {
+			return 0, fmt.Errorf("error loading digest %s %s: %v", d.Focus, d.Date.Format("2006-01-02"), err)
+		}
+		if err := writeDigestPage(site, config, d.Focus, d.Date, content); err != nil {
+			return 0, err
+		}
+		if err := writeDigestAudio(site, db, d.Focus, d.Date); err != nil {
+			return 0, err
+		}
+		logger.Debug("Published digest", zap.String("focus", d.Focus), zap.Time("date", d.Date))
+	}
+	return len(digests), writeSiteIndexes(site, db, config)
+}
+
+// runPublishCommand republishes the whole archive to STATIC_ARCHIVE.
+func runPublishCommand(args []string, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("digests publish", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if config.StaticArchive.Target == "" {
+		return errors.New("STATIC_ARCHIVE must be set")
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := republishDigests(db, config, logger)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Published %d digest(s) to %s\n", n, config.StaticArchive.Target)
+	return nil
+}
+
+func writeDigestPage(site siteWriter, config *Config, focus string, date time.Time, content string) error {
+	nav := fmt.Sprintf(`<p class="site-nav"><a href="../../../index.html">All digests</a> · <a href="../index.html">%s</a></p>`+"\n",
+		html.EscapeString(config.newsletterName(focus)))
+	page := renderHTMLDocument(nav+markdownToHTML(content), config.webBranding())
+	return site.WriteFile(sitePagePath(focus, date), "text/html; charset=utf-8", []byte(page))
+}
+
+// writeDigestAudio publishes a digest's narration next to its page, where
+// the listen link points, when it has one.
+func writeDigestAudio(site siteWriter, db *sql.DB, focus string, date time.Time) error {
+	audio, err := getDigestAudio(db, focus, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading digest audio: %v", err)
+	}
+	return site.WriteFile(path.Dir(sitePagePath(focus, date))+"/"+audioFilename, "audio/mpeg", audio)
+}
+
+// writeSiteIndexes writes index.html, listing every digest by date, and an
+// index per focus.
+func writeSiteIndexes(site siteWriter, db *sql.DB, config *Config) error {
+	digests, err := listArchivedDigests(db)
+	if err != nil {
+		return err
+	}
+	byFocus := make(map[string][]archivedDigest)
+	for _, d := range digests {
+		byFocus[d.Focus] = append(byFocus[d.Focus], d)
+	}
+	brand := config.webBranding()
+
+	var sb strings.Builder
+	sb.WriteString("<h1>Digest Archive</h1>\n")
+	if len(byFocus) > 1 {
+		var links []string
+		for _, focus := range sortedKeys(byFocus) {
+			links = append(links, fmt.Sprintf(`<a href="digests/%s/index.html">%s</a>`, url.PathEscape(focus), html.EscapeString(config.newsletterName(focus))))
+		}
+		sb.WriteString(`<p class="site-nav">` + strings.Join(links, " · ") + "</p>\n")
+	}
+	writeDigestList(&sb, config, digests, "digests/", true)
+	if err := site.WriteFile("index.html", "text/html; charset=utf-8", []byte(renderHTMLDocument(sb.String(), brand))); err != nil {
+		return err
+	}
+
+	for focus, list := range byFocus {
+		sb.Reset()
+		sb.WriteString(`<p class="site-nav"><a href="../../index.html">All digests</a></p>` + "\n")
+		sb.WriteString("<h1>" + html.EscapeString(config.newsletterName(focus)) + "</h1>\n")
+		writeDigestList(&sb, config, list, "", false)
+		if err := site.WriteFile("digests/"+focus+"/index.html", "text/html; charset=utf-8", []byte(renderHTMLDocument(sb.String(), brand))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDigestList renders digests, newest first, grouped by month; base is
+// the link prefix of a digest's focus directory.
+func writeDigestList(sb *strings.Builder, config *Config, digests []archivedDigest, base string, withFocus bool) {
+	if len(digests) == 0 {
+		sb.WriteString("<p>No digests yet.</p>\n")
+		return
+	}
+	month := ""
+	for _, d := range digests {
+		if m := d.Date.Format("January 2006"); m != month {
+			if month != "" {
+				sb.WriteString("</ul>\n")
+			}
+			month = m
+			sb.WriteString("<h2>" + m + "</h2>\n<ul>\n")
+		}
+		href := d.Date.Format("2006-01-02") + "/index.html"
+		if withFocus {
+			href = url.PathEscape(d.Focus) + "/" + href
+		}
+		label := d.Date.Format("Mon, January 2")
+		if withFocus {
+			label += " — " + config.newsletterName(d.Focus)
+		}
+		if d.Issue > 0 {
+			label += fmt.Sprintf(" #%d", d.Issue)
+		}
+		fmt.Fprintf(sb, `<li><a href="%s">%s</a>`, base+href, html.EscapeString(label))
+		if d.Title != "" {
+			sb.WriteString(": <em>" + html.EscapeString(d.Title) + "</em>")
+		}
+		sb.WriteString("</li>\n")
+	}
+	sb.WriteString("</ul>\n")
+}
+
+func listArchivedDigests(db *sql.DB) ([]archivedDigest, error) {
+	rows, err := db.Query(`SELECT focus, digest_date, COALESCE(issue, 0), COALESCE(title, '') FROM digests ORDER BY digest_date DESC, focus`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing digests: %v", err)
+	}
+	defer rows.Close()
+
+	var digests []archivedDigest
+	for rows.Next() {
+		var d archivedDigest
+		if err := rows.Scan(&d.Focus, &d.Date, &d.Issue, &d.Title); err != nil {
+			return nil, fmt.Errorf("error scanning digest: %v", err)
+		}
+		digests = append(digests, d)
+	}
+	return digests, rows.Err()
+}
@@ -0,0 +1,316 @@
+package shinbun
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSectionTextLen is Slack's limit for section block text.
+	maxSectionTextLen = 3000
+	// maxMessageBlocks is Slack's limit for blocks in one message.
+	maxMessageBlocks = 50
+	// maxReplyTextLen keeps thread replies under Slack's recommended text length.
+	maxReplyTextLen = 4000
+	// slackScheduleMinLead is how far ahead a post must be to be scheduled;
+	// Slack rejects post_at times that have passed by the time it arrives.
+	slackScheduleMinLead = time.Minute
+)
+
+// slackPostTime is the local time of day digests are posted to Slack
+// (SLACK_POST_AT, SLACK_POST_AT_<FOCUS>).
+type slackPostTime struct {
+	Minute   int // after midnight
+	Location *time.Location
+}
+
+// parseSlackPostTime parses "09:00" or "09:00 America/New_York"; the time
+// zone defaults to loc.
+func parseSlackPostTime(value string, loc *time.Location) (slackPostTime, error) {
+	clock, zone, hasZone := strings.Cut(strings.TrimSpace(value), " ")
+	minute, err := parseClockTime(clock)
+	if err != nil {
+		return slackPostTime{}, err
+	}
+	if minute == 24*60 {
+		return slackPostTime{}, fmt.Errorf("invalid time %q, expected HH:MM before 24:00", clock)
+	}
+	if hasZone {
+		if loc, err = time.LoadLocation(strings.TrimSpace(zone)); err != nil {
+			return slackPostTime{}, fmt.Errorf("invalid timezone %q: %v", zone, err)
+		}
+	}
+	return slackPostTime{Minute: minute, Location: loc}, nil
+}
+
+// parseSlackPostTimes parses post times by focus, "" being SLACK_POST_AT.
+// Empty values are left out.
+func parseSlackPostTimes(specs map[string]string, loc *time.Location) (map[string]slackPostTime, error) {
+	times := make(map[string]slackPostTime)
+	for focus, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		name := "SLACK_POST_AT"
+		if focus != "" {
+			name += "_" + strings.ToUpper(focus)
+		}
+		t, err := parseSlackPostTime(spec, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %v", name, spec, err)
+		}
+		times[focus] = t
+	}
+	return times, nil
+}
+
+// slackPostTimeFor returns the focus's Slack post time, if it has one.
+func (c *Config) slackPostTimeFor(focus string) (slackPostTime, bool) {
+	if t, ok := c.SlackPostTimes[strings.ToLower(focus)]; ok {
+		return t, true
+	}
+	t, ok := c.SlackPostTimes[""]
+	return t, ok
+}
+
+// postAt returns when a digest finished at now is posted: at the post time
+// today if that is still ahead, otherwise at once (the zero time).
+func (t slackPostTime) postAt(now time.Time) time.Time {
+	local := now.In(t.Location)
+	at := time.Date(local.Year(), local.Month(), local.Day(), t.Minute/60, t.Minute%60, 0, 0, t.Location)
+	if at.Before(now.Add(slackScheduleMinLead)) {
+		return time.Time{}
+	}
+	return at
+}
+
+// digestHighlights is one "## heading" of the digest with its list items.
+type digestHighlights struct {
+	Heading string
+	Lines   []string
+}
+
+// parseHighlights splits the digest markdown into sections, keeping at most
+// limit list items overall. Text before the first section heading is ignored;
+// it is usually the digest title.
+func parseHighlights(summary string, limit int) []digestHighlights {
+	var sections []digestHighlights
+	items := 0
+	for _, line := range strings.Split(summary, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "# ") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			sections = append(sections, digestHighlights{Heading: strings.TrimSpace(strings.TrimLeft(trimmed, "#"))})
+			continue
+		}
+		if len(sections) == 0 || trimmed == "" || !markdownListPattern.MatchString(line) {
+			continue
+		}
+		if items >= limit {
+			break
+		}
+		current := &sections[len(sections)-1]
+		current.Lines = append(current.Lines, mrkdwnLine(strings.TrimLeft(line, " \t")))
+		items++
+	}
+
+	var kept []digestHighlights
+	for _, s := range sections {
+		if len(s.Lines) > 0 {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// buildDigestBlocks renders the top highlights of the digest as Block Kit: a
+// title section (with an overflow menu linking to the full digest when
+// archiveURL is set), a divider and sections per digest section, and a closing
+// context block. Highlights that don't fit in one message are returned as the
+// blocks of continuation messages for its thread.
+func buildDigestBlocks(title string, summary string, archiveURL string, limit int) (blocks []slack.Block, continued [][]slack.Block) {
+	var titleAccessory *slack.Accessory
+	if archiveURL != "" {
+		option := slack.NewOptionBlockObject("full_digest", slack.NewTextBlockObject(slack.PlainTextType, "View full digest", false, false), nil)
+		option.URL = archiveURL
+		titleAccessory = slack.NewAccessory(slack.NewOverflowBlockElement("digest_menu", option))
+	}
+
+	blocks = []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*", escapeMrkdwn(title)), false, false), nil, titleAccessory),
+	}
+
+	// A divider and the section's text, split over as many section blocks as
+	// it takes
+	var groups [][]slack.Block
+	shown := 0
+	for _, section := range parseHighlights(summary, limit) {
+		group := []slack.Block{slack.NewDividerBlock()}
+		text := mrkdwnLine("## "+section.Heading) + "\n" + strings.Join(section.Lines, "\n")
+		for _, chunk := range splitMrkdwn(text, maxSectionTextLen) {
+			group = append(group, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false), nil, nil))
+		}
+		groups = append(groups, group)
+		shown += len(section.Lines)
+	}
+
+	// Leave room for the closing divider and context block
+	next := 0
+	for ; next < len(groups) && len(blocks)+len(groups[next])+2 <= maxMessageBlocks; next++ {
+		blocks = append(blocks, groups[next]...)
+	}
+	var current []slack.Block
+	for _, group := range groups[next:] {
+		if len(current) > 0 && len(current)+len(group) > maxMessageBlocks {
+			continued = append(continued, current)
+			current = nil
+		}
+		current = append(current, group...)
+	}
+	if len(current) > 0 {
+		continued = append(continued, current)
+	}
+
+	footer := fmt.Sprintf("Top %d highlights", shown)
+	if shown == 0 {
+		footer = "No highlights could be extracted from this digest"
+	}
+	if len(continued) > 0 {
+		footer += " · More in the thread"
+	}
+	if archiveURL != "" {
+		footer += fmt.Sprintf(" · <%s|Read the full digest>", archiveURL)
+	} else {
+		footer += " · Full digest in the thread"
+	}
+	blocks = append(blocks,
+		slack.NewDividerBlock(),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, footer, false, false)),
+	)
+	return blocks, continued
+}
+
+// splitMrkdwn splits text into chunks of at most limit runes at line breaks,
+// so each can be posted as its own message. Longer lines are split between
+// words.
+func splitMrkdwn(text string, limit int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, splitLongLine(line, limit)...)
+	}
+
+	var chunks []string
+	var current strings.Builder
+	for _, line := range lines {
+		if current.Len() > 0 && len([]rune(current.String()))+len([]rune(line))+1 > limit {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// splitLongLine splits line into pieces of at most limit runes, at the last
+// space that fits when there is one.
+func splitLongLine(line string, limit int) []string {
+	runes := []rune(line)
+	var pieces []string
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		pieces = append(pieces, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(pieces, string(runes))
+}
+
+// postDigestToSlack posts the digest highlights to the channel with link and
+// media unfurling disabled. Without an archive URL to link to, the full digest,
+// converted to mrkdwn, follows in the thread, after any highlights that didn't
+// fit in the post. It returns the channel ID and timestamp of the post, also
+// when only the thread failed.
+func postDigestToSlack(api *slack.Client, channel string, title string, summary string, archiveURL string, limit int, logger *zap.Logger) (channelID, ts string, err error) {
+	blocks, continued := buildDigestBlocks(title, summary, archiveURL, limit)
+	channelID, ts, err = api.PostMessage(channel,
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionBlocks(blocks...),
+		slack.MsgOptionDisableLinkUnfurl(),
+		slack.MsgOptionDisableMediaUnfurl(),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("error posting digest to Slack: %v", err)
+	}
+
+	logger.Info("Posted digest to Slack",
+		zap.String("channel", channelID),
+		zap.String("ts", ts),
+		zap.Int("blocks", len(blocks)),
+		zap.Int("continued", len(continued)))
+
+	for _, more := range continued {
+		_, _, err := api.PostMessage(channelID,
+			slack.MsgOptionText(title+" (continued)", false),
+			slack.MsgOptionBlocks(more...),
+			slack.MsgOptionTS(ts),
+			slack.MsgOptionDisableLinkUnfurl(),
+			slack.MsgOptionDisableMediaUnfurl(),
+		)
+		if err != nil {
+			return channelID, ts, fmt.Errorf("error posting digest continuation to Slack thread: %v", err)
+		}
+	}
+	if archiveURL != "" {
+		return channelID, ts, nil
+	}
+	for _, chunk := range splitMrkdwn(markdownToMrkdwn(summary), maxReplyTextLen) {
+		_, _, err := api.PostMessage(channelID,
+			slack.MsgOptionText(chunk, false),
+			slack.MsgOptionTS(ts),
+			slack.MsgOptionDisableLinkUnfurl(),
+			slack.MsgOptionDisableMediaUnfurl(),
+		)
+		if err != nil {
+			return channelID, ts, fmt.Errorf("error posting full digest to Slack thread: %v", err)
+		}
+	}
+	return channelID, ts, nil
+}
+
+// scheduleDigestToSlack schedules the digest highlights post for postAt with
+// chat.scheduleMessage. Replies can't be scheduled into the thread of a post
+// that doesn't exist yet, so callers post digests that need a thread at once.
+func scheduleDigestToSlack(api *slack.Client, channel string, title string, blocks []slack.Block, postAt time.Time, logger *zap.Logger) error {
+	channelID, _, err := api.ScheduleMessage(channel, strconv.FormatInt(postAt.Unix(), 10),
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionBlocks(blocks...),
+		slack.MsgOptionDisableLinkUnfurl(),
+		slack.MsgOptionDisableMediaUnfurl(),
+	)
+	if err != nil {
+		return fmt.Errorf("error scheduling digest post to Slack: %v", err)
+	}
+	logger.Info("Scheduled digest post to Slack",
+		zap.String("channel", channelID),
+		zap.Time("post_at", postAt),
+		zap.Int("blocks", len(blocks)))
+	return nil
+}
@@ -0,0 +1,130 @@
+package shinbun
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// highlightsDigest is a digest with the given number of sections of one
+// list item each.
+func highlightsDigest(sections int) string {
+	var b strings.Builder
+	b.WriteString("# Daily digest\n")
+	for i := 1; i <= sections; i++ {
+		fmt.Fprintf(&b, "\n## Section %d\n- Item %d\n", i, i)
+	}
+	return b.String()
+}
+
+// sectionHeadings returns the section headings rendered in blocks, in order.
+func sectionHeadings(blocks []slack.Block) []string {
+	var headings []string
+	for _, block := range blocks {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok || section.Text == nil {
+			continue
+		}
+		if heading, ok := strings.CutPrefix(firstLine(section.Text.Text), "*Section "); ok {
+			headings = append(headings, strings.TrimSuffix(heading, "*"))
+		}
+	}
+	return headings
+}
+
+func TestBuildDigestBlocks(t *testing.T) {
+	tests := []struct {
+		name      string
+		sections  int
+		continued int
+	}{
+		{"fits in one message", 5, 0},
+		{"one continuation", 30, 1},
+		{"several continuations", 80, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, continued := buildDigestBlocks("Daily digest", highlightsDigest(tt.sections), "", 100)
+			if len(continued) != tt.continued {
+				t.Fatalf("got %d continuation messages, want %d", len(continued), tt.continued)
+			}
+			if len(blocks) > maxMessageBlocks {
+				t.Errorf("first message has %d blocks, over the limit of %d", len(blocks), maxMessageBlocks)
+			}
+			for i, message := range continued {
+				if len(message) > maxMessageBlocks {
+					t.Errorf("continuation %d has %d blocks, over the limit of %d", i+1, len(message), maxMessageBlocks)
+				}
+			}
+
+			if _, ok := blocks[len(blocks)-2].(*slack.DividerBlock); !ok {
+				t.Errorf("first message doesn't end with a divider before its footer")
+			}
+			context, ok := blocks[len(blocks)-1].(*slack.ContextBlock)
+			if !ok {
+				t.Fatalf("first message doesn't end with a context block")
+			}
+			footer := context.ContextElements.Elements[0].(*slack.TextBlockObject).Text
+			if !strings.HasPrefix(footer, fmt.Sprintf("Top %d highlights", tt.sections)) {
+				t.Errorf("footer %q doesn't count %d highlights", footer, tt.sections)
+			}
+			if got := strings.Contains(footer, "More in the thread"); got != (tt.continued > 0) {
+				t.Errorf("footer %q mentions the thread: %v, want %v", footer, got, tt.continued > 0)
+			}
+
+			// Every section is shown once, in order
+			headings := sectionHeadings(blocks)
+			for _, message := range continued {
+				headings = append(headings, sectionHeadings(message)...)
+			}
+			if len(headings) != tt.sections {
+				t.Fatalf("got %d sections, want %d", len(headings), tt.sections)
+			}
+			for i, heading := range headings {
+				if heading != fmt.Sprint(i+1) {
+					t.Errorf("section %d is %q", i+1, heading)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDigestBlocksLongSection(t *testing.T) {
+	// A section over Slack's text limit is split into several section blocks
+	summary := "## Incidents\n" + strings.Repeat("- "+strings.Repeat("word ", 100)+"\n", 20)
+	blocks, continued := buildDigestBlocks("Daily digest", summary, "https://example.com/d/1", 100)
+	if len(continued) != 0 {
+		t.Fatalf("got %d continuation messages, want 0", len(continued))
+	}
+	var sections int
+	for _, block := range blocks[1:] {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok {
+			continue
+		}
+		sections++
+		if n := len([]rune(section.Text.Text)); n > maxSectionTextLen {
+			t.Errorf("section text is %d runes, over the limit of %d", n, maxSectionTextLen)
+		}
+	}
+	if sections < 2 {
+		t.Errorf("got %d section blocks, want the section split over several", sections)
+	}
+	if blocks[0].(*slack.SectionBlock).Accessory == nil {
+		t.Errorf("title has no menu linking to the full digest")
+	}
+}
+
+func TestParseHighlightsLimit(t *testing.T) {
+	highlights := parseHighlights(highlightsDigest(10), 4)
+	if len(highlights) != 4 {
+		t.Fatalf("got %d sections, want 4", len(highlights))
+	}
+	for i, h := range highlights {
+		if want := fmt.Sprintf("Section %d", i+1); h.Heading != want || len(h.Lines) != 1 {
+			t.Errorf("section %d = %q with %d lines, want %q with 1", i+1, h.Heading, len(h.Lines), want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package shinbun
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/confluence"
+	"shinbun/internal/discord"
+	"shinbun/internal/gitlab"
+	"shinbun/internal/imapsource"
+	"shinbun/internal/linear"
+	"shinbun/internal/notion"
+	"shinbun/internal/statuspage"
+	"shinbun/internal/teams"
+	"shinbun/internal/zendesk"
+)
+
+// externalSource is a non-Slack feed of updates that is merged into the digest.
+type externalSource struct {
+	Name  string
+	Focus []string
+	Fetch func(since time.Time, logger *zap.Logger) ([]Update, error)
+}
+
+// focusList parses a comma-separated list of focus names, falling back to def.
+func focusList(value, def string) []string {
+	if strings.TrimSpace(value) == "" {
+		value = def
+	}
+	return splitList(value)
+}
+
+func (s externalSource) enabledFor(focus string) bool {
+	for _, f := range s.Focus {
+		if f == focus || f == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredSources returns every external source that has credentials configured.
+// HTTP-based sources share httpClient.
+func configuredSources(config *Config, httpClient *http.Client, logger *zap.Logger) []externalSource {
+	var sources []externalSource
+
+	if config.ZendeskSubdomain != "" && config.ZendeskAPIToken != "" {
+		client := zendesk.NewClient(config.ZendeskSubdomain, config.ZendeskEmail, config.ZendeskAPIToken, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "zendesk",
+			Focus: config.ZendeskFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.StatusPageURL != "" {
+		client := statuspage.NewClient(config.StatusPageProvider, config.StatusPageURL, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "statuspage",
+			Focus: config.StatusPageFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.IMAPHost != "" && config.IMAPUser != "" {
+		source := imapsource.NewSource(imapsource.Config{
+			Host:           config.IMAPHost,
+			Port:           config.IMAPPort,
+			Username:       config.IMAPUser,
+			Password:       config.IMAPPassword,
+			Folders:        config.IMAPFolders,
+			SubjectFilters: config.IMAPSubjectFilters,
+			FromFilters:    config.IMAPFromFilters,
+		})
+		sources = append(sources, externalSource{
+			Name:  "imap",
+			Focus: config.IMAPFocus,
+			Fetch: source.FetchUpdates,
+		})
+	}
+
+	if config.GitLabToken != "" && len(config.GitLabProjects) > 0 {
+		client := gitlab.NewClient(config.GitLabURL, config.GitLabToken, config.GitLabProjects, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "gitlab",
+			Focus: config.GitLabFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.LinearAPIKey != "" && len(config.LinearTeams) > 0 {
+		client := linear.NewClient(config.LinearAPIKey, config.LinearTeams, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "linear",
+			Focus: config.LinearFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.DiscordBotToken != "" && len(config.DiscordChannelIDs) > 0 {
+		client := discord.NewClient(config.DiscordBotToken, config.DiscordChannelIDs, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "discord",
+			Focus: config.DiscordFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.TeamsTenantID != "" && config.TeamsClientID != "" && len(config.TeamsChannels) > 0 {
+		var refs []teams.ChannelRef
+		for _, c := range config.TeamsChannels {
+			ref, err := teams.ParseChannelRef(c)
+			if err != nil {
+				logger.Warn("Skipping Teams channel", zap.Error(err))
+				continue
+			}
+			refs = append(refs, ref)
+		}
+		client := teams.NewClient(config.TeamsTenantID, config.TeamsClientID, config.TeamsClientSecret, refs)
+		sources = append(sources, externalSource{
+			Name:  "teams",
+			Focus: config.TeamsFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.ConfluenceURL != "" && config.ConfluenceAPIToken != "" && len(config.ConfluenceSpaces) > 0 {
+		client := confluence.NewClient(config.ConfluenceURL, config.ConfluenceEmail, config.ConfluenceAPIToken, config.ConfluenceSpaces, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "confluence",
+			Focus: config.DocsFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	if config.NotionAPIKey != "" && len(config.NotionDatabaseIDs) > 0 {
+		client := notion.NewClient(config.NotionAPIKey, config.NotionDatabaseIDs, httpClient)
+		sources = append(sources, externalSource{
+			Name:  "notion",
+			Focus: config.DocsFocus,
+			Fetch: client.FetchUpdates,
+		})
+	}
+
+	return sources
+}
+
+// fetchExternalUpdates collects updates from all external sources enabled for
+// the focus. A failing source is logged and skipped so Slack results still ship.
+func fetchExternalUpdates(config *Config, focus string, since time.Time, httpClient *http.Client, logger *zap.Logger) []Update {
+	var updates []Update
+	for _, source := range configuredSources(config, httpClient, logger) {
+		if !source.enabledFor(focus) {
+			continue
+		}
+
+		logger.Info("Fetching external source",
+			zap.String("source", source.Name),
+			zap.Time("since", since))
+
+		sourceUpdates, err := source.Fetch(since, logger)
+		if err != nil {
+			logger.Error("Failed to fetch external source", zap.String("source", source.Name), zap.Error(err))
+			continue
+		}
+		for i := range sourceUpdates {
+			if sourceUpdates[i].Source == "" {
+				sourceUpdates[i].Source = source.Name
+			}
+			// Sources without a native category go through the same rules as Slack messages
+			if sourceUpdates[i].Category == "" {
+				sourceUpdates[i].Category, sourceUpdates[i].Priority = config.CategoryTerms.categorize(sourceUpdates[i].Channel, sourceUpdates[i].Text)
+			}
+		}
+		updates = append(updates, sourceUpdates...)
+	}
+	return updates
+}
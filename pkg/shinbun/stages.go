@@ -0,0 +1,253 @@
+package shinbun
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/internal/migrate"
+)
+
+// The stage commands split a digest run, so messages can be fetched and
+// stored on one schedule and summarized and delivered on another:
+//
+//	shinbun fetch      fetch and store new messages
+//	shinbun summarize  summarize stored messages and print the digest
+//	shinbun send       summarize stored messages and deliver the digest
+//
+// Without a subcommand, shinbun does all three in one go.
+
+// registerWindow adds the flags choosing the focus and the period.
+func (f *Flags) registerWindow(fs *flag.FlagSet) {
+	fs.StringVar(&f.Focus, "focus", "default", "Specify the channel focus category (e.g., 'default', 'support')")
+	fs.StringVar(&f.FromDateStr, "from-date", "", "Fetch messages starting from this date (YYYY-MM-DD) or duration (e.g., '24h', '7d'). Defaults to last fetch time.")
+	fs.StringVar(&f.AsOfStr, "as-of", "", "Run as if it were this date (YYYY-MM-DD) or time (RFC 3339), e.g. to backfill a missed digest")
+}
+
+// registerSummary adds the flags shaping how the digest is written.
+func (f *Flags) registerSummary(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Stream, "stream", false, "Print the summary to the terminal as it is generated")
+	fs.BoolVar(&f.Pager, "pager", false, "Show the digest in $PAGER (default 'less -R') when run in a terminal")
+	fs.BoolVar(&f.NoLLM, "no-llm", false, "Render the digest from the template without calling OpenAI")
+	fs.StringVar(&f.DumpPrompt, "dump-prompt", "", "Write the summary prompt (system message and user prompt) to this file")
+	fs.IntVar(&f.Sample, "sample", 0, "Summarize a sample of this many messages, stratified by channel, day and priority, as a labelled preview")
+	fs.BoolVar(&f.Batch, "batch", false, "Summarize through the OpenAI Batch API at half the cost, waiting up to a day for the result")
+	fs.StringVar(&f.OutputPath, "output", "", "Also write the finished digest to this file")
+	fs.StringVar(&f.OutputFormat, "format", outputFormatMarkdown, "Format of the --output file: md, html or json")
+}
+
+// registerOutput adds the flags for what goes to stdout.
+func (f *Flags) registerOutput(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Output.Quiet, "quiet", false, "Print nothing to stdout and log errors only")
+	fs.BoolVar(&f.Output.JSON, "json", false, "Write stdout output as JSON events, one per line")
+}
+
+// logger returns the run's logger: errors only with --quiet.
+func (f *Flags) logger() *zap.Logger {
+	if f.Output.Quiet {
+		return newLogger("error")
+	}
+	return newLogger(os.Getenv("LOG_LEVEL"))
+}
+
+// check rejects conflicting flags and drops --stream where it can't apply.
+func (f *Flags) check(logger *zap.Logger) error {
+	if f.Output.Quiet && f.Output.JSON {
+		return errors.New("--quiet and --json cannot be combined")
+	}
+	if err := checkOutputFormat(f.OutputPath, f.OutputFormat); err != nil {
+		return err
+	}
+	if f.QueueScheduled && !f.Serve {
+		return errors.New("--queue-scheduled only applies to --serve")
+	}
+	if f.Serve {
+		if err := checkLease(f.RunLease); err != nil {
+			return err
+		}
+	}
+	if f.Sample < 0 {
+		return errors.New("--sample must be a positive number of messages")
+	}
+	if f.Stream && (f.Output.Quiet || f.Output.JSON) {
+		// Raw tokens would end up between the JSON events, or be printed at all
+		logger.Info("--stream is ignored with --quiet and --json")
+		f.Stream = false
+	}
+	return nil
+}
+
+func runFetchCommand(args []string, logger *zap.Logger) error {
+	flags := Flags{}
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	flags.registerWindow(fs)
+	fs.BoolVar(&flags.NoLLM, "no-llm", false, "Don't translate messages with OpenAI")
+	flags.registerOutput(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if flags.Output.Quiet {
+		logger = flags.logger()
+	}
+	if err := flags.check(logger); err != nil {
+		return err
+	}
+
+	p, fromDate, until, err := stagePipeline(flags, preflightStages{Fetch: true}, logger)
+	if err != nil {
+		return err
+	}
+	defer p.db.Close()
+
+	if _, err := reconcileChannels(p.api, p.db, p.channels, logger); err != nil {
+		logger.Warn("Failed to reconcile channels with Slack", zap.Error(err))
+	}
+	var failed []string
+	for _, channelName := range p.channels {
+		channelName = strings.TrimSpace(channelName)
+		if channelName == "" {
+			continue
+		}
+		_, saved, err := p.fetchChannel(channelName, fromDate, until, false)
+		if err != nil && channelNeedsInvite(err) {
+			logger.Warn("Bot can't read channel, skipping it", zap.String("channel", channelName), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to fetch channel", zap.String("channel", channelName), zap.Error(err))
+			failed = append(failed, channelName)
+			continue
+		}
+		flags.Output.event("fetch", map[string]any{"channel": channelName, "messages": saved},
+			fmt.Sprintf("%s: %d new messages", channelName, saved))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to fetch %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runSummarizeCommand(args []string, logger *zap.Logger) error {
+	return runStoredDigest("summarize", args, false, logger)
+}
+
+func runSendCommand(args []string, logger *zap.Logger) error {
+	return runStoredDigest("send", args, true, logger)
+}
+
+// runStoredDigest writes the digest from the stored messages and, for send,
+// delivers it. Nothing is fetched from Slack; external sources still are.
+func runStoredDigest(name string, args []string, deliver bool, logger *zap.Logger) error {
+	flags := Flags{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.registerWindow(fs)
+	if deliver {
+		fs.BoolVar(&flags.DryRun, "dry-run", false, "Print the email and Slack message instead of sending them")
+	}
+	flags.registerSummary(fs)
+	flags.registerOutput(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if flags.Output.Quiet {
+		logger = flags.logger()
+	}
+	if err := flags.check(logger); err != nil {
+		return err
+	}
+	if !deliver {
+		// Nothing is delivered, so nothing may be recorded as if it were
+		flags.DryRun = true
+	}
+
+	p, fromDate, until, err := stagePipeline(flags, preflightStages{Summarize: true, Deliver: deliver}, logger)
+	if err != nil {
+		return err
+	}
+	defer p.db.Close()
+	defer p.config.Usage.log(logger)
+
+	summary, editionTitle, err := p.digestStored(fromDate, until)
+	if err != nil || summary == "" {
+		return err
+	}
+	if !deliver {
+		if flags.OutputPath == "" {
+			return nil
+		}
+		// Not numbered: the digest isn't archived
+		issue := digestIssue{Name: p.config.newsletterName(flags.Focus), Title: editionTitle, Date: p.config.Clock.Now()}
+		out := newDigestOutput(p.config, flags.Focus, issue, issue.subject(), issue.masthead()+summary, "")
+		return out.write(flags.OutputPath, flags.OutputFormat)
+	}
+	outcome := deliverSummary(p.api, p.client, p.db, p.config, flags, p.targets, summary, editionTitle, nil, logger)
+	var failed []string
+	for _, step := range sortedKeys(outcome) {
+		if outcome[step] == "failed" {
+			failed = append(failed, step)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("delivery failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// stagePipeline sets up a stage command's pipeline and run window, and runs
+// the preflight checks for its stages. The caller closes the pipeline's
+// database.
+func stagePipeline(flags Flags, stages preflightStages, logger *zap.Logger) (*pipeline, time.Time, time.Time, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	fromDate, until, err := resolveWindow(config, flags.FromDateStr, flags.AsOfStr, logger)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	api, err := newSlackClient(config, logger)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	p, err := newPipeline(api, db, config, flags, logger)
+	if err != nil {
+		db.Close()
+		return nil, time.Time{}, time.Time{}, err
+	}
+	if err := p.preflight(stages); err != nil {
+		db.Close()
+		return nil, time.Time{}, time.Time{}, err
+	}
+	return p, fromDate, until, nil
+}
+
+func runMigrateCommand(args []string, logger *zap.Logger) error {
+	if len(args) != 0 {
+		return errors.New("usage: shinbun migrate")
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := migrate.Up(db, logger)
+	if err != nil {
+		return fmt.Errorf("error migrating database: %v", err)
+	}
+	fmt.Printf("Database schema is at version %d (%d migrations applied)\n", migrate.Latest(), len(applied))
+	return nil
+}
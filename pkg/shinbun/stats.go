@@ -0,0 +1,252 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// topPosterLimit bounds the number of posters listed in statistics.
+const topPosterLimit = 10
+
+// countRow is one labelled count in a statistics breakdown.
+type countRow struct {
+	Label string
+	Count int
+}
+
+// messageStats summarizes the stored Slack messages since a point in time.
+// Days and hours are in JST, like message times in the digest.
+type messageStats struct {
+	Since      time.Time
+	Total      int
+	Channels   []countRow
+	Weekdays   []countRow
+	Hours      []countRow
+	Posters    []countRow
+	Categories []countRow
+	Statuses   []countRow
+	// AfterHours counts the messages posted outside BusinessHours
+	AfterHours    int
+	BusinessHours businessHours
+}
+
+var weekdayNames = []string{"", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// collectStats aggregates the messages table. Messages outside hours are
+// counted as after-hours activity.
+func collectStats(db *sql.DB, since time.Time, hours businessHours) (messageStats, error) {
+	stats := messageStats{Since: since, BusinessHours: hours}
+	if err := collectTimeStats(db, &stats); err != nil {
+		return stats, err
+	}
+
+	breakdowns := []struct {
+		target *[]countRow
+		query  string
+	}{
+		{&stats.Channels, `
+			SELECT c.name, COUNT(*) FROM messages m JOIN channels c ON c.id = m.channel_id
+			WHERE m.timestamp >= $1 GROUP BY c.name ORDER BY 2 DESC, 1`},
+		{&stats.Posters, fmt.Sprintf(`
+			SELECT author, COUNT(*) FROM messages
+			WHERE timestamp >= $1 AND author IS NOT NULL GROUP BY author ORDER BY 2 DESC, 1 LIMIT %d`, topPosterLimit)},
+		{&stats.Categories, `
+			SELECT COALESCE(category, 'uncategorized'), COUNT(*) FROM messages
+			WHERE timestamp >= $1 GROUP BY 1 ORDER BY 2 DESC, 1`},
+		{&stats.Statuses, `
+			SELECT status, COUNT(*) FROM messages
+			WHERE timestamp >= $1 AND status IS NOT NULL GROUP BY 1 ORDER BY 2 DESC, 1`},
+	}
+	for _, b := range breakdowns {
+		rows, err := queryCounts(db, b.query, since)
+		if err != nil {
+			return stats, err
+		}
+		*b.target = rows
+	}
+	return stats, nil
+}
+
+// collectTimeStats counts the messages since stats.Since in total, by JST
+// weekday and hour, and outside business hours. Times are converted in Go
+// rather than SQL, so each message gets the UTC offset in effect when it was
+// posted, across daylight saving changes too.
+func collectTimeStats(db *sql.DB, stats *messageStats) error {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		tokyo = time.FixedZone("Asia/Tokyo", 9*60*60)
+	}
+	rows, err := db.Query(`SELECT timestamp FROM messages WHERE timestamp >= $1`, stats.Since)
+	if err != nil {
+		return fmt.Errorf("error querying message times: %v", err)
+	}
+	defer rows.Close()
+
+	weekdays := make(map[int]int) // ISO weekday, 1 for Monday
+	hours := make(map[int]int)
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return fmt.Errorf("error scanning message time: %v", err)
+		}
+		stats.Total++
+		if !stats.BusinessHours.contains(t) {
+			stats.AfterHours++
+		}
+		local := t.In(tokyo)
+		weekdays[(int(local.Weekday())+6)%7+1]++
+		hours[local.Hour()]++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying message times: %v", err)
+	}
+
+	stats.Weekdays = rankCounts(weekdays, func(day int) string { return weekdayNames[day] })
+	stats.Hours = rankCounts(hours, func(hour int) string { return fmt.Sprintf("%02d:00", hour) })
+	return nil
+}
+
+// rankCounts returns the counts labelled, most first and in key order among
+// equal counts, like the ORDER BY 2 DESC, 1 of the other breakdowns.
+func rankCounts(counts map[int]int, label func(int) string) []countRow {
+	keys := make([]int, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	rows := make([]countRow, len(keys))
+	for i, key := range keys {
+		rows[i] = countRow{Label: label(key), Count: counts[key]}
+	}
+	return rows
+}
+
+func queryCounts(db *sql.DB, query string, since time.Time) ([]countRow, error) {
+	rows, err := db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message statistics: %v", err)
+	}
+	defer rows.Close()
+
+	var counts []countRow
+	for rows.Next() {
+		var row countRow
+		if err := rows.Scan(&row.Label, &row.Count); err != nil {
+			return nil, fmt.Errorf("error scanning message statistics: %v", err)
+		}
+		counts = append(counts, row)
+	}
+	return counts, rows.Err()
+}
+
+func (s messageStats) sections() []struct {
+	Title string
+	Rows  []countRow
+} {
+	return []struct {
+		Title string
+		Rows  []countRow
+	}{
+		{"Messages per channel", s.Channels},
+		{"Busiest days", s.Weekdays},
+		{"Busiest hours (JST)", s.Hours},
+		{"Top posters", s.Posters},
+		{"Categories", s.Categories},
+		{"Workflow status (reactions)", s.Statuses},
+	}
+}
+
+// writeText prints the statistics as aligned tables.
+func (s messageStats) writeText(w io.Writer) {
+	fmt.Fprintf(w, "%d messages since %s\n", s.Total, s.Since.Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "%d after hours (%s) %s\n", s.AfterHours, s.BusinessHours, percent(s.AfterHours, s.Total))
+	for _, section := range s.sections() {
+		fmt.Fprintf(w, "\n%s\n", section.Title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range section.Rows {
+			fmt.Fprintf(tw, "  %s\t%d\t%s\n", row.Label, row.Count, percent(row.Count, s.Total))
+		}
+		tw.Flush()
+	}
+}
+
+// markdown renders the statistics as a digest section. Hours are limited to
+// the busiest five to keep the digest short.
+func (s messageStats) markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\n---\n\n## Statistics\n\n%d Slack messages since %s.\n", s.Total, s.Since.Format("2006-01-02")))
+	for _, section := range s.sections() {
+		rows := section.Rows
+		if section.Title == "Busiest hours (JST)" && len(rows) > 5 {
+			rows = rows[:5]
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		parts := make([]string, len(rows))
+		for i, row := range rows {
+			parts[i] = fmt.Sprintf("%s %d", row.Label, row.Count)
+		}
+		sb.WriteString(fmt.Sprintf("\n- **%s:** %s", section.Title, strings.Join(parts, ", ")))
+	}
+	if s.AfterHours > 0 {
+		sb.WriteString(fmt.Sprintf("\n- **After-hours activity:** %d messages (%s) outside %s", s.AfterHours, percent(s.AfterHours, s.Total), s.BusinessHours))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+func runStatsCommand(args []string, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	sinceStr := fs.String("since", "30d", "Date (YYYY-MM-DD) or duration (e.g. '24h', '30d') to count messages from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	since, err := parseFromDate(*sinceStr, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --since: %v", err)
+	}
+	if since.IsZero() {
+		return errors.New("--since is required")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats, err := collectStats(db, since, config.BusinessHours)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Collected message statistics", zap.Int("total", stats.Total))
+	stats.writeText(os.Stdout)
+	return nil
+}
@@ -0,0 +1,45 @@
+package shinbun
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectStatsUsesEachMessagesOffset(t *testing.T) {
+	db := openTestDB(t)
+	hours, err := parseBusinessHours("mon-fri", "09:00-18:00", "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO channels (id, slack_id, name) VALUES (1, 'C01', 'general')`); err != nil {
+		t.Fatal(err)
+	}
+	// New York moved from UTC-5 to UTC-4 on 2025-03-09
+	times := []time.Time{
+		time.Date(2025, 3, 7, 14, 30, 0, 0, time.UTC),  // Friday 09:30 EST
+		time.Date(2025, 3, 8, 15, 0, 0, 0, time.UTC),   // Saturday
+		time.Date(2025, 3, 10, 13, 30, 0, 0, time.UTC), // Monday 09:30 EDT
+	}
+	for i, ts := range times {
+		if _, err := db.Exec(`INSERT INTO messages (slack_id, channel_id, text, timestamp) VALUES ($1, 1, 'hello', $2)`, ts.Format(time.RFC3339), ts); err != nil {
+			t.Fatalf("inserting message %d: %v", i, err)
+		}
+	}
+
+	stats, err := collectStats(db, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), hours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 3 || stats.AfterHours != 1 {
+		t.Errorf("total %d, after hours %d; want 3 and 1", stats.Total, stats.AfterHours)
+	}
+	wantDays := []countRow{{"Mon", 1}, {"Fri", 1}, {"Sun", 1}}
+	if !reflect.DeepEqual(stats.Weekdays, wantDays) {
+		t.Errorf("weekdays %v, want %v", stats.Weekdays, wantDays)
+	}
+	wantHours := []countRow{{"00:00", 1}, {"22:00", 1}, {"23:00", 1}}
+	if !reflect.DeepEqual(stats.Hours, wantHours) {
+		t.Errorf("hours %v, want %v", stats.Hours, wantHours)
+	}
+}
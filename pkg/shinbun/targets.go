@@ -0,0 +1,67 @@
+package shinbun
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shinbun/delivery"
+)
+
+// deliveryTargetTimeout bounds a single target's delivery.
+const deliveryTargetTimeout = 2 * time.Minute
+
+// namedTarget is an enabled delivery target with the name it was registered under.
+type namedTarget struct {
+	Name string
+	delivery.Target
+}
+
+// newDeliveryTargets creates the targets listed in DELIVERY_TARGETS.
+func newDeliveryTargets(config *Config, httpClient *http.Client, logger *zap.Logger) ([]namedTarget, error) {
+	var targets []namedTarget
+	for _, name := range config.DeliveryTargets {
+		target, err := delivery.New(name, delivery.Options{
+			Getenv:     os.Getenv,
+			HTTPClient: httpClient,
+			Logger:     logger.With(zap.String("delivery_target", name)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, namedTarget{Name: name, Target: target})
+	}
+	return targets, nil
+}
+
+// deliverToTargets hands the digest to each target in turn, recording the
+// outcome per target name. A failing target doesn't stop the others.
+func deliverToTargets(targets []namedTarget, digest delivery.Digest, outcome map[string]string, logger *zap.Logger) {
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTargetTimeout)
+		err := t.Deliver(ctx, digest)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to deliver digest", zap.String("delivery_target", t.Name), zap.Error(err))
+			outcome[t.Name] = "failed"
+			continue
+		}
+		logger.Info("Delivered digest", zap.String("delivery_target", t.Name))
+		outcome[t.Name] = "sent"
+	}
+}
+
+func deliveryDigest(focus string, date time.Time, issue digestIssue, subject, summary, archiveURL string, config *Config) delivery.Digest {
+	return delivery.Digest{
+		Focus:      focus,
+		Date:       date,
+		Issue:      issue.Number,
+		Subject:    subject,
+		Markdown:   summary,
+		HTML:       renderHTMLPage(summary, config.emailBranding(editionMedia{})),
+		ArchiveURL: archiveURL,
+	}
+}
@@ -0,0 +1,225 @@
+package shinbun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxTeamsCardBytes keeps each card under the 28 KB Teams accepts per
+// incoming-webhook message, leaving room for the envelope.
+const maxTeamsCardBytes = 25000
+
+// cardElement is an Adaptive Card body element.
+type cardElement map[string]any
+
+// buildTeamsCards renders the digest as Adaptive Cards: the title, then each
+// heading and paragraph or list as a text block, and a button to the archive
+// when archiveURL is set. A digest too large for one card is spread over
+// several, the later ones titled as continuations.
+func buildTeamsCards(title, summary, archiveURL string) []map[string]any {
+	elements := teamsElements(summary)
+
+	var cards []map[string]any
+	var body []cardElement
+	newBody := func() {
+		heading := title
+		if len(cards) > 0 {
+			heading += " (continued)"
+		}
+		body = []cardElement{{"type": "TextBlock", "text": heading, "size": "Large", "weight": "Bolder", "wrap": true}}
+	}
+	finish := func() {
+		cards = append(cards, adaptiveCard(body, archiveURL))
+	}
+	newBody()
+	for _, el := range elements {
+		body = append(body, el)
+		if len(body) > 2 && cardSize(adaptiveCard(body, archiveURL)) > maxTeamsCardBytes {
+			body = body[:len(body)-1]
+			finish()
+			newBody()
+			body = append(body, el)
+		}
+	}
+	finish()
+	return cards
+}
+
+func adaptiveCard(body []cardElement, archiveURL string) map[string]any {
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+		"msteams": map[string]any{"width": "Full"},
+	}
+	if archiveURL != "" {
+		card["actions"] = []cardElement{{"type": "Action.OpenUrl", "title": "View full digest", "url": archiveURL}}
+	}
+	return card
+}
+
+func cardSize(card map[string]any) int {
+	encoded, _ := json.Marshal(card)
+	return len(encoded)
+}
+
+// teamsElements converts digest markdown to text blocks. Text blocks support
+// bold, italic, links and lists; headings become bold blocks, with a
+// separator above second-level ones, and code blocks monospaced ones.
+func teamsElements(md string) []cardElement {
+	var elements []cardElement
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			elements = append(elements, cardElement{"type": "TextBlock", "text": strings.Join(paragraph, "\n"), "wrap": true})
+			paragraph = nil
+		}
+	}
+
+	inCode := false
+	var code []string
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				elements = append(elements, cardElement{"type": "TextBlock", "text": strings.Join(code, "\n"), "fontType": "Monospace", "wrap": true})
+				code = nil
+			} else {
+				flush()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "" || markdownRulePattern.MatchString(line):
+			flush()
+		case markdownHeadingPattern.MatchString(line):
+			flush()
+			marks := strings.TrimSpace(line)
+			level := len(marks) - len(strings.TrimLeft(marks, "#"))
+			heading := cardElement{"type": "TextBlock", "text": teamsInline(markdownHeadingPattern.FindStringSubmatch(line)[1]), "weight": "Bolder", "wrap": true}
+			if level <= 2 {
+				heading["size"] = "Medium"
+				heading["separator"] = true
+				heading["spacing"] = "Large"
+			}
+			elements = append(elements, heading)
+		case markdownListPattern.MatchString(line):
+			// Text blocks don't nest lists; keep the items, flattened
+			marker := strings.TrimSpace(markdownListPattern.FindString(line))
+			if marker == "*" || marker == "+" {
+				marker = "-"
+			}
+			paragraph = append(paragraph, marker+" "+teamsInline(markdownListPattern.ReplaceAllString(line, "")))
+		case len(paragraph) > 0 && !markdownListPattern.MatchString(paragraph[len(paragraph)-1]):
+			// A paragraph's lines wrap into one
+			paragraph[len(paragraph)-1] += " " + teamsInline(strings.TrimSpace(line))
+		default:
+			paragraph = append(paragraph, teamsInline(strings.TrimSpace(line)))
+		}
+	}
+	if inCode {
+		elements = append(elements, cardElement{"type": "TextBlock", "text": strings.Join(code, "\n"), "fontType": "Monospace", "wrap": true})
+	}
+	flush()
+	return elements
+}
+
+// teamsInline rewrites what text blocks don't render: single-asterisk
+// italics, strikethrough, images and code spans.
+func teamsInline(text string) string {
+	text = markdownImagePattern.ReplaceAllString(text, "[$1]($2)")
+	text = markdownCodeSpan.ReplaceAllStringFunc(text, func(span string) string { return strings.Trim(span, "`") })
+	text = markdownStrikePattern.ReplaceAllString(text, "$1")
+	return markdownItalicPattern.ReplaceAllString(text, "${1}_${2}_")
+}
+
+// postDigestToTeams posts the digest to a Teams incoming webhook, one message
+// per card.
+func postDigestToTeams(client *http.Client, webhookURL, title, summary, archiveURL string) error {
+	cards := buildTeamsCards(title, summary, archiveURL)
+	for i, card := range cards {
+		if err := postTeamsCard(client, webhookURL, card); err != nil {
+			return fmt.Errorf("error posting card %d of %d to Teams: %v", i+1, len(cards), err)
+		}
+	}
+	return nil
+}
+
+// teamsMessage wraps a card the way incoming webhooks expect it.
+func teamsMessage(card map[string]any) map[string]any {
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
+
+func postTeamsCard(client *http.Client, webhookURL string, card map[string]any) error {
+	payload, err := json.Marshal(teamsMessage(card))
+	if err != nil {
+		return fmt.Errorf("error encoding card: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTargetTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	// Connector webhooks report some failures with a 200 and a message
+	if resp.StatusCode/100 != 2 || strings.Contains(strings.ToLower(string(body)), "failed") {
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, excerpt(string(body), 200))
+	}
+	return nil
+}
+
+// deliverToTeams posts the digest to the Teams webhook, or prints the cards
+// on a dry run, recording the outcome under "teams".
+func deliverToTeams(config *Config, flags Flags, title, summary, archiveURL string, outcome map[string]string, logger *zap.Logger) {
+	if flags.DryRun {
+		outcome["teams"] = "dry_run"
+		for _, card := range buildTeamsCards(title, summary, archiveURL) {
+			payload, err := json.MarshalIndent(teamsMessage(card), "", "  ")
+			if err != nil {
+				logger.Error("Failed to render Teams card", zap.Error(err))
+				return
+			}
+			flags.Output.event("teams_card", map[string]any{"payload": json.RawMessage(payload)},
+				fmt.Sprintf("\n--- Teams Card ---\n%s", payload))
+		}
+		return
+	}
+
+	outcome["teams"] = "sent"
+	client, err := newHTTPClient(config.networkFor(""), 30*time.Second)
+	if err == nil {
+		err = postDigestToTeams(client, config.TeamsWebhookURL, title, summary, archiveURL)
+	}
+	if err != nil {
+		logger.Error("Failed to post digest to Teams", zap.Error(err))
+		outcome["teams"] = "failed"
+	}
+}
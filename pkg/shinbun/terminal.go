@@ -0,0 +1,137 @@
+package shinbun
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiCyan      = "\x1b[36m"
+	ansiBlue      = "\x1b[34m"
+)
+
+// maxTerminalLinkLen is how long a link's URL may be before it is shortened.
+const maxTerminalLinkLen = 40
+
+var markdownItalicUnderscore = regexp.MustCompile(`(^|\W)_([^_\s](?:[^_]*[^_\s])?)_`)
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// useANSI reports whether stdout should get ANSI formatting: it is a terminal
+// and NO_COLOR (https://no-color.org) isn't set.
+func useANSI() bool {
+	return isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// renderANSI renders the digest markdown for a terminal: styled headings,
+// bold and italics, bullets, and links as their text followed by a shortened
+// URL.
+func renderANSI(md string) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			inFence = !inFence
+			continue
+		case inFence:
+			out = append(out, ansiDim+"  "+line+ansiReset)
+		case markdownHeadingPattern.MatchString(line):
+			heading := markdownHeadingPattern.FindStringSubmatch(line)[1]
+			style := ansiBold + ansiCyan
+			if strings.HasPrefix(trimmed, "# ") {
+				style += ansiUnderline
+			}
+			out = append(out, style+stripMarkdownEmphasis(heading)+ansiReset)
+		case markdownRulePattern.MatchString(line):
+			out = append(out, ansiDim+strings.Repeat("─", 40)+ansiReset)
+		case markdownListPattern.MatchString(line):
+			loc := markdownListPattern.FindStringIndex(line)
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			bullet := strings.TrimSpace(line[:loc[1]])
+			if !strings.HasSuffix(bullet, ".") {
+				bullet = "•"
+			}
+			out = append(out, indent+bullet+" "+ansiInline(line[loc[1]:]))
+		default:
+			out = append(out, ansiInline(line))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func ansiInline(text string) string {
+	text = markdownLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		m := markdownLinkPattern.FindStringSubmatch(link)
+		return ansiBlue + m[1] + ansiReset + " " + ansiDim + "(" + shortenURL(m[2]) + ")" + ansiReset
+	})
+	text = markdownBoldPattern.ReplaceAllStringFunc(text, func(bold string) string {
+		m := markdownBoldPattern.FindStringSubmatch(bold)
+		return ansiBold + m[1] + m[2] + ansiReset
+	})
+	text = markdownItalicPattern.ReplaceAllString(text, "${1}"+ansiItalic+"${2}"+ansiReset)
+	text = markdownItalicUnderscore.ReplaceAllString(text, "${1}"+ansiItalic+"${2}"+ansiReset)
+	return markdownCodeSpan.ReplaceAllStringFunc(text, func(code string) string {
+		return ansiDim + strings.Trim(code, "`") + ansiReset
+	})
+}
+
+func stripMarkdownEmphasis(text string) string {
+	return strings.NewReplacer("**", "", "__", "").Replace(text)
+}
+
+// shortenURL keeps the host and as much of the path as fits.
+func shortenURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	short := u.Host + u.Path
+	if runes := []rune(short); len(runes) > maxTerminalLinkLen {
+		short = string(runes[:maxTerminalLinkLen-1]) + "…"
+	}
+	return short
+}
+
+// printSummary writes the digest to stdout, styled when stdout is a terminal
+// and through $PAGER (default "less -R") when paging is requested.
+func printSummary(summary string, page bool) {
+	ansi := useANSI()
+	text := summary
+	if ansi {
+		text = renderANSI(summary)
+	}
+	if page && isTerminal(os.Stdout) {
+		if err := runPager(text + "\n"); err == nil {
+			return
+		}
+	}
+	fmt.Println("\nSummary:")
+	fmt.Println(text)
+}
+
+func runPager(text string) error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
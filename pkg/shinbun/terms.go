@@ -0,0 +1,153 @@
+package shinbun
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// categoryTerms are the words, in one language, that make a message urgent
+// (each one found raises its priority) or its channel an alert or support
+// channel.
+type categoryTerms struct {
+	Urgent  []string
+	Alert   []string
+	Support []string
+}
+
+// termSet holds categoryTerms by language code. A nil termSet uses the
+// defaults.
+type termSet map[string]categoryTerms
+
+// defaultCategoryTerms are the built-in lists. English applies to every
+// message, since English terms are common in other languages' technical
+// chat; another language's list is added when a message is detected to be
+// in it.
+var defaultCategoryTerms = termSet{
+	"en": {
+		Urgent:  []string{"urgent", "emergency", "critical", "outage", "down", "broken", "failed", "error"},
+		Alert:   []string{"alert", "incident"},
+		Support: []string{"support"},
+	},
+	"ja": {
+		Urgent:  []string{"緊急", "至急", "障害", "重大", "停止", "ダウン", "落ちて", "壊れ", "失敗", "エラー", "不具合"},
+		Alert:   []string{"アラート", "障害", "インシデント"},
+		Support: []string{"サポート", "問い合わせ", "問合せ"},
+	},
+}
+
+// categoryLanguages are the languages term lists can be configured for:
+// the ones detectLanguage tells apart.
+var categoryLanguages = []string{"en", "ja", "ko", "ru"}
+
+// detectLanguage guesses the language of text from its script: kana (or Han
+// characters alone) mean Japanese, Hangul Korean and Cyrillic Russian.
+// Anything else is taken for English.
+func detectLanguage(text string) string {
+	han := false
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			return "ja"
+		case unicode.Is(unicode.Hangul, r):
+			return "ko"
+		case unicode.Is(unicode.Cyrillic, r):
+			return "ru"
+		case unicode.Is(unicode.Han, r):
+			han = true
+		}
+	}
+	if han {
+		return "ja"
+	}
+	return "en"
+}
+
+// lists returns the terms for text: English plus those of its language.
+func (t termSet) lists(text string) []categoryTerms {
+	if t == nil {
+		t = defaultCategoryTerms
+	}
+	lists := []categoryTerms{t["en"]}
+	if lang := detectLanguage(text); lang != "en" {
+		lists = append(lists, t[lang])
+	}
+	return lists
+}
+
+// categorize returns the category and base priority of a message: the
+// channel name decides alert or support, and each urgent term in the text
+// adds one to the priority.
+func (t termSet) categorize(channelName, text string) (category string, priority int) {
+	category = "general"
+	priority = 1
+
+	channel := strings.ToLower(channelName)
+	containsAny := func(s string, terms []string) bool {
+		for _, term := range terms {
+			if strings.Contains(s, strings.ToLower(term)) {
+				return true
+			}
+		}
+		return false
+	}
+	var alert, support []string
+	for _, l := range t.lists(channelName) {
+		alert = append(alert, l.Alert...)
+		support = append(support, l.Support...)
+	}
+	switch {
+	case containsAny(channel, alert):
+		category = "alert"
+		priority = 3
+	case containsAny(channel, support):
+		category = "support"
+		priority = 2
+	}
+
+	lowercaseText := strings.ToLower(text)
+	seen := make(map[string]bool)
+	for _, l := range t.lists(text) {
+		for _, term := range l.Urgent {
+			term = strings.ToLower(term)
+			if !seen[term] && strings.Contains(lowercaseText, term) {
+				seen[term] = true
+				priority++
+			}
+		}
+	}
+	return category, priority
+}
+
+// categoryTermsFromEnv builds the term lists from URGENT_TERMS_<LANG>,
+// ALERT_TERMS_<LANG> and SUPPORT_TERMS_<LANG>, each replacing the default
+// list for that language.
+func categoryTermsFromEnv(environ []string) (termSet, error) {
+	urgent := focusValues(environ, "URGENT_TERMS_")
+	alert := focusValues(environ, "ALERT_TERMS_")
+	support := focusValues(environ, "SUPPORT_TERMS_")
+	for _, values := range []map[string]string{urgent, alert, support} {
+		for lang := range values {
+			if !slices.Contains(categoryLanguages, lang) {
+				return nil, fmt.Errorf("unsupported language %q, expected one of %s", lang, strings.Join(categoryLanguages, ", "))
+			}
+		}
+	}
+
+	terms := make(termSet)
+	for _, lang := range categoryLanguages {
+		t := defaultCategoryTerms[lang]
+		if v, ok := urgent[lang]; ok {
+			t.Urgent = splitList(v)
+		}
+		if v, ok := alert[lang]; ok {
+			t.Alert = splitList(v)
+		}
+		if v, ok := support[lang]; ok {
+			t.Support = splitList(v)
+		}
+		terms[lang] = t
+	}
+	return terms, nil
+}
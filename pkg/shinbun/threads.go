@@ -0,0 +1,224 @@
+package shinbun
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// threadFollowWindow is how long after a handoff (or before a "continuing
+	// from") messages in the other channel are taken as the same discussion.
+	threadFollowWindow = 2 * time.Hour
+	// maxFollowedMessages bounds the messages a handoff pulls in from the
+	// other channel.
+	maxFollowedMessages = 5
+)
+
+// channelRef matches a channel reference: Slack's <#C123|name> or <#C123>, or
+// a typed #name.
+const channelRef = `(?:<#(C[A-Z0-9]+)(?:\|([^>]*))?>|#([a-z0-9][a-z0-9._-]*))`
+
+var (
+	// handoffToPattern matches a discussion moving on to another channel, e.g.
+	// "moving this to #incident-1234" or "let's continue in #billing".
+	handoffToPattern = regexp.MustCompile(`(?i)\b(?:mov(?:e|ed|ing)|continu(?:e|ed|ing)|tak(?:e|en|ing)|follow(?:ing|ed)?[- ]?up|carry(?:ing)? on|head(?:ing)? over)\b[^.!?\n]{0,40}?\b(?:to|in|into|over in|on)\s+` + channelRef)
+	// handoffFromPattern matches a discussion picked up from another channel,
+	// e.g. "continuing from #general" or "moved over from #support".
+	handoffFromPattern = regexp.MustCompile(`(?i)\b(?:mov(?:e|ed|ing)|continu(?:e|ed|ing)|pick(?:ed|ing)? up|carr(?:y|ied|ying) over|following up)\b[^.!?\n]{0,40}?\bfrom\s+` + channelRef)
+)
+
+// handoff is a message naming the channel its discussion moved to or came from.
+type handoff struct {
+	Index   int
+	Channel string
+	// Forward is true for "moving to", false for "continuing from"
+	Forward bool
+}
+
+// channelNames maps Slack channel IDs to the names of channels in the
+// database, for references that carry only the ID.
+func channelNames(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`SELECT slack_id, name FROM channels`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading channel names: %v", err)
+	}
+	defer rows.Close()
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("error scanning channel: %v", err)
+		}
+		names[id] = normalizeChannel(name)
+	}
+	return names, rows.Err()
+}
+
+func normalizeChannel(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
+
+// findHandoffs returns the messages that explicitly continue a discussion in,
+// or from, another channel.
+func findHandoffs(updates []Update, names map[string]string) []handoff {
+	var handoffs []handoff
+	for i, u := range updates {
+		if u.Source != "" {
+			continue
+		}
+		for _, p := range []struct {
+			pattern *regexp.Regexp
+			forward bool
+		}{{handoffToPattern, true}, {handoffFromPattern, false}} {
+			m := p.pattern.FindStringSubmatch(u.Text)
+			if m == nil {
+				continue
+			}
+			channel := m[2]
+			if channel == "" {
+				channel = names[m[1]]
+			}
+			if channel == "" {
+				channel = m[3]
+			}
+			channel = normalizeChannel(channel)
+			if channel != "" && channel != normalizeChannel(u.Channel) {
+				handoffs = append(handoffs, handoff{Index: i, Channel: channel, Forward: p.forward})
+				break
+			}
+		}
+	}
+	return handoffs
+}
+
+// followThreads merges discussions that explicitly move between channels
+// ("moving this to #incident-1234") into one update, so the digest tells them
+// as one story. A handoff takes in the other channel's messages within
+// threadFollowWindow after it, or the last one before a "continuing from".
+// Channels outside the digest are left alone.
+func followThreads(updates []Update, names map[string]string, logger *zap.Logger) []Update {
+	handoffs := findHandoffs(updates, names)
+	if len(handoffs) == 0 {
+		return updates
+	}
+
+	byChannel := make(map[string][]int)
+	for i, u := range updates {
+		if u.Source == "" {
+			channel := normalizeChannel(u.Channel)
+			byChannel[channel] = append(byChannel[channel], i)
+		}
+	}
+	for _, members := range byChannel {
+		sort.SliceStable(members, func(a, b int) bool { return updates[members[a]].Timestamp < updates[members[b]].Timestamp })
+	}
+
+	parent := make([]int, len(updates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(a, b int) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+
+	followed := 0
+	for _, h := range handoffs {
+		at, err := formatTimestamp(updates[h.Index].Timestamp)
+		if err != nil {
+			continue
+		}
+		var linked []int
+		for _, j := range byChannel[h.Channel] {
+			t, err := formatTimestamp(updates[j].Timestamp)
+			if err != nil {
+				continue
+			}
+			if h.Forward && !t.Before(at) && t.Sub(at) <= threadFollowWindow && len(linked) < maxFollowedMessages {
+				linked = append(linked, j)
+			}
+			if !h.Forward && t.Before(at) && at.Sub(t) <= threadFollowWindow {
+				linked = []int{j}
+			}
+		}
+		for _, j := range linked {
+			union(h.Index, j)
+		}
+		if len(linked) > 0 {
+			followed++
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range updates {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+	var merged []Update
+	for _, root := range roots {
+		if members := groups[root]; len(members) == 1 {
+			merged = append(merged, updates[members[0]])
+		} else {
+			merged = append(merged, mergeThread(updates, members))
+		}
+	}
+
+	logger.Info("Followed discussions across channels",
+		zap.Int("handoffs", len(handoffs)),
+		zap.Int("followed", followed),
+		zap.Int("input_updates", len(updates)),
+		zap.Int("output_updates", len(merged)))
+	return merged
+}
+
+// mergeThread combines the fragments of a discussion that moved between
+// channels, in the order they were posted. The first message supplies the
+// link and the channel; the highest score and priority are kept.
+func mergeThread(updates []Update, members []int) Update {
+	sort.SliceStable(members, func(a, b int) bool { return updates[members[a]].Timestamp < updates[members[b]].Timestamp })
+
+	merged := updates[members[0]]
+	var channels []string
+	seen := make(map[string]bool)
+	var sb strings.Builder
+	for _, i := range members {
+		u := updates[i]
+		if !seen[u.Channel] {
+			seen[u.Channel] = true
+			channels = append(channels, "#"+strings.TrimPrefix(u.Channel, "#"))
+		}
+		sb.WriteString(fmt.Sprintf("\n- [#%s] %s", strings.TrimPrefix(u.Channel, "#"), u.Text))
+		if i != members[0] {
+			merged.RelatedLinks = append(merged.RelatedLinks, u.Link)
+			merged.ReactionCount += u.ReactionCount
+			merged.Reactions = mergeReactions(merged.Reactions, u.Reactions)
+		}
+		merged.RelatedLinks = append(merged.RelatedLinks, u.RelatedLinks...)
+		if u.Score > merged.Score {
+			merged.Score = u.Score
+		}
+		if u.Priority > merged.Priority {
+			merged.Priority = u.Priority
+		}
+	}
+	merged.Text = fmt.Sprintf("Discussion that moved across channels (%s):", strings.Join(channels, " → ")) + sb.String()
+	return merged
+}
@@ -0,0 +1,128 @@
+package shinbun
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ticketLinkedPattern matches the spans where a ticket ID is already part of a
+// link or code and must be left alone: markdown links, Slack's <...> markup,
+// bare URLs and code spans.
+var ticketLinkedPattern = regexp.MustCompile(`\[[^\]]*\]\([^)\s]*\)|<[^>\s][^>]*>|https?://\S+|` + "`[^`]+`")
+
+// parseTicketURLTemplates parses TICKET_URL_TEMPLATES, e.g.
+// "PROJ=https://acme.atlassian.net/browse/{id},INC=https://status.example.com/{number}".
+// A "*" key applies to any other prefix.
+func parseTicketURLTemplates(value string) (map[string]string, error) {
+	templates := make(map[string]string)
+	for _, entry := range splitList(value) {
+		prefix, template, ok := strings.Cut(entry, "=")
+		prefix = strings.ToUpper(strings.TrimSpace(prefix))
+		template = strings.TrimSpace(template)
+		if !ok || prefix == "" || template == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected PREFIX=url", entry)
+		}
+		if !strings.Contains(template, "{id}") && !strings.Contains(template, "{number}") {
+			return nil, fmt.Errorf("template for %s has neither {id} nor {number}", prefix)
+		}
+		templates[prefix] = template
+	}
+	return templates, nil
+}
+
+// ticketLinker turns ticket IDs such as PROJ-1234 into links to the ticket.
+type ticketLinker struct {
+	templates map[string]string
+}
+
+// newTicketLinker returns nil when no templates are configured; a nil linker
+// leaves text as it is.
+func newTicketLinker(templates map[string]string) *ticketLinker {
+	if len(templates) == 0 {
+		return nil
+	}
+	return &ticketLinker{templates: templates}
+}
+
+// url returns the link to the ticket, or "" when its prefix has no template.
+func (l *ticketLinker) url(id string) string {
+	prefix, number, _ := strings.Cut(id, "-")
+	if ignoredIDPrefixes[prefix] {
+		return ""
+	}
+	template, ok := l.templates[prefix]
+	if !ok {
+		template, ok = l.templates["*"]
+	}
+	if !ok {
+		return ""
+	}
+	return strings.NewReplacer("{id}", id, "{prefix}", prefix, "{number}", number).Replace(template)
+}
+
+// replace rewrites the ticket IDs of text outside links and code with format,
+// given the ID and its URL.
+func (l *ticketLinker) replace(text string, format func(id, url string) string) string {
+	if l == nil {
+		return text
+	}
+	linked := ticketLinkedPattern.FindAllStringIndex(text, -1)
+	var sb strings.Builder
+	last := 0
+	for _, m := range ticketIDPattern.FindAllStringIndex(text, -1) {
+		inside := false
+		for _, span := range linked {
+			if m[0] >= span[0] && m[1] <= span[1] {
+				inside = true
+				break
+			}
+		}
+		id := text[m[0]:m[1]]
+		url := l.url(id)
+		if inside || url == "" {
+			continue
+		}
+		sb.WriteString(text[last:m[0]])
+		sb.WriteString(format(id, url))
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// link makes the ticket IDs of a markdown digest links.
+func (l *ticketLinker) link(markdown string) string {
+	return l.replace(markdown, func(id, url string) string { return fmt.Sprintf("[%s](%s)", id, url) })
+}
+
+// annotate returns copies of updates with each ticket ID followed by its URL,
+// so the model can cite the ticket.
+func (l *ticketLinker) annotate(updates []Update) []Update {
+	if l == nil {
+		return updates
+	}
+	annotated := make([]Update, len(updates))
+	for i, u := range updates {
+		u.Text = l.replace(u.Text, func(id, url string) string { return fmt.Sprintf("%s (%s)", id, url) })
+		annotated[i] = u
+	}
+	return annotated
+}
+
+// urls returns the links of the tickets mentioned in updates, which the model
+// saw in the prompt.
+func (l *ticketLinker) urls(updates []Update) []string {
+	if l == nil {
+		return nil
+	}
+	var urls []string
+	for _, u := range updates {
+		for _, id := range extractTicketIDs(u.Text) {
+			if url := l.url(id); url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
@@ -0,0 +1,191 @@
+package shinbun
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"go.uber.org/zap"
+)
+
+// fallbackEncoding counts tokens for models tiktoken doesn't know, e.g.
+// behind a gateway; it is the tokenizer of current OpenAI models.
+const fallbackEncoding = "o200k_base"
+
+// modelContextWindows are the context windows, in tokens, of the chat models
+// shinbun is typically run with. Dated snapshots are matched by prefix.
+var modelContextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4-32k":     32768,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+}
+
+// contextWindowFor returns the context window of the longest known model
+// name prefixing model.
+func contextWindowFor(model string) (int, bool) {
+	best := ""
+	for name := range modelContextWindows {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	return modelContextWindows[best], true
+}
+
+var (
+	tokenizersMu sync.Mutex
+	// tokenizers holds each encoding by name, nil when it couldn't be loaded
+	tokenizers   = make(map[string]*tiktoken.Tiktoken)
+	setBPELoader sync.Once
+)
+
+// loadTokenizers loads the encodings of models, downloading them with client
+// the first time, so prompt tokens are counted as OpenAI counts them. Without
+// them, counts fall back to estimateTokens until a later run loads them.
+func loadTokenizers(models []string, client *http.Client, logger *zap.Logger) {
+	setBPELoader.Do(func() { tiktoken.SetBpeLoader(bpeLoader{client: client}) })
+	loaded := make(map[string]bool)
+	for _, model := range models {
+		name := encodingFor(model)
+		if loaded[name] {
+			continue
+		}
+		loaded[name] = true
+		enc, err := tiktoken.GetEncoding(name)
+		tokenizersMu.Lock()
+		tokenizers[name] = enc
+		tokenizersMu.Unlock()
+		if err != nil {
+			logger.Warn("Tokenizer unavailable, estimating prompt tokens from text length",
+				zap.String("model", model), zap.String("encoding", name), zap.Error(err))
+		}
+	}
+}
+
+// encodingFor names model's encoding, falling back to fallbackEncoding.
+func encodingFor(model string) string {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name
+		}
+	}
+	return fallbackEncoding
+}
+
+func tokenizerFor(model string) *tiktoken.Tiktoken {
+	name := encodingFor(model)
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	enc, ok := tokenizers[name]
+	if !ok {
+		enc, _ = tiktoken.GetEncoding(name)
+		tokenizers[name] = enc
+	}
+	return enc
+}
+
+// countTokens is the number of tokens text takes in a prompt to model.
+func countTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	if enc := tokenizerFor(model); enc != nil {
+		return len(enc.EncodeOrdinary(text))
+	}
+	return estimateTokens(text)
+}
+
+// estimateTokens approximates the token count of text when no tokenizer is
+// available: ~4 characters per token for ASCII, and one token per character
+// otherwise, since CJK text is rarely encoded more densely.
+func estimateTokens(text string) int {
+	ascii := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] < utf8.RuneSelf {
+			ascii++
+		}
+	}
+	return ascii/4 + utf8.RuneCountInString(text) - ascii + 1
+}
+
+// bpeLoader fetches encodings through the configured proxy and CA bundle and
+// caches them on disk, in TIKTOKEN_CACHE_DIR or the user cache directory.
+type bpeLoader struct {
+	client *http.Client
+}
+
+func (l bpeLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	dir := os.Getenv("TIKTOKEN_CACHE_DIR")
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		dir = filepath.Join(cache, "shinbun", "tiktoken")
+	}
+	path := filepath.Join(dir, filepath.Base(url))
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if contents, err = l.download(url); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0o755); err == nil {
+			// A failed write only costs another download next run
+			tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+			if os.WriteFile(tmp, contents, 0o644) == nil {
+				os.Rename(tmp, path)
+			}
+		}
+	}
+
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(string(contents), "\n") {
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding file %s: %v", path, err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(rank))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding file %s: %v", path, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, nil
+}
+
+func (l bpeLoader) download(url string) ([]byte, error) {
+	resp, err := l.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading encoding: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading encoding: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
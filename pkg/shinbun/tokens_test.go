@@ -0,0 +1,45 @@
+package shinbun
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 1},
+		{"abcdefgh", 3},
+		{"Deploy finished", 4},
+		{"日本語", 4},
+		{"ab日本", 3},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestContextWindowFor(t *testing.T) {
+	tests := []struct {
+		model  string
+		want   int
+		wantOK bool
+	}{
+		{"gpt-4o", 128000, true},
+		{"gpt-4o-mini-2024-07-18", 128000, true},
+		{"gpt-4.1-mini", 1047576, true},
+		{"gpt-4-turbo-2024-04-09", 128000, true},
+		{"gpt-4-32k-0613", 32768, true},
+		{"gpt-4-0613", 8192, true},
+		{"gpt-3.5-turbo-0125", 16385, true},
+		{"o3-mini", 200000, true},
+		{"corp-small", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := contextWindowFor(tt.model)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("contextWindowFor(%q) = %d, %v, want %d, %v", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
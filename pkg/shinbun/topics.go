@@ -0,0 +1,232 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// topicDeliveryAddendum appends a subscriber's topics to their copy of the
+	// digest; topicDeliveryEmail sends them in an email of their own.
+	topicDeliveryAddendum = "addendum"
+	topicDeliveryEmail    = "email"
+
+	topicsPathPrefix = "/topics/"
+)
+
+// parseTopicSubscriptions parses TOPIC_SUBSCRIPTIONS, e.g.
+// "alice@example.com=kubernetes|Acme Corp,bob@example.com=billing".
+func parseTopicSubscriptions(value string) (map[string][]string, error) {
+	subscriptions := make(map[string][]string)
+	for _, entry := range splitList(value) {
+		recipient, topics, ok := strings.Cut(entry, "=")
+		recipient = strings.ToLower(strings.TrimSpace(recipient))
+		if !ok || recipient == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected address=topic|topic", entry)
+		}
+		for _, topic := range strings.Split(topics, "|") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				subscriptions[recipient] = append(subscriptions[recipient], topic)
+			}
+		}
+	}
+	return subscriptions, nil
+}
+
+// topicSubscriptions returns the configured subscriptions, with those saved
+// from the preferences page replacing a recipient's configured topics.
+func topicSubscriptions(db *sql.DB, config *Config) (map[string][]string, error) {
+	subscriptions := make(map[string][]string, len(config.TopicSubscriptions))
+	for recipient, topics := range config.TopicSubscriptions {
+		subscriptions[recipient] = topics
+	}
+	if !config.TopicPreferences {
+		return subscriptions, nil
+	}
+
+	rows, err := db.Query(`SELECT recipient, topics FROM topic_subscriptions`)
+	if err != nil {
+		return subscriptions, fmt.Errorf("error loading topic subscriptions: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var recipient, topics string
+		if err := rows.Scan(&recipient, &topics); err != nil {
+			return subscriptions, fmt.Errorf("error scanning topic subscription: %v", err)
+		}
+		subscriptions[recipient] = splitTopics(topics)
+	}
+	return subscriptions, rows.Err()
+}
+
+// splitTopics splits topics given one per line or separated by commas.
+func splitTopics(value string) []string {
+	return splitList(strings.ReplaceAll(value, "\n", ","))
+}
+
+func saveTopics(db *sql.DB, recipient string, topics []string) error {
+	_, err := db.Exec(`
+		INSERT INTO topic_subscriptions (recipient, topics) VALUES ($1, $2)
+		ON CONFLICT (recipient) DO UPDATE SET topics = EXCLUDED.topics, updated_at = CURRENT_TIMESTAMP`,
+		strings.ToLower(recipient), strings.Join(topics, "\n"))
+	if err != nil {
+		return fmt.Errorf("error saving topic subscriptions: %v", err)
+	}
+	return nil
+}
+
+// topicPattern matches topic as a whole word or phrase, in any case.
+func topicPattern(topic string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|\W)` + regexp.QuoteMeta(topic) + `($|\W)`)
+}
+
+// topicItems returns the list items of summary that mention any of topics.
+// Link targets are not searched, only the text.
+func topicItems(summary string, topics []string) []string {
+	patterns := make([]*regexp.Regexp, 0, len(topics))
+	for _, topic := range topics {
+		patterns = append(patterns, topicPattern(topic))
+	}
+	var items []string
+	for _, line := range strings.Split(summary, "\n") {
+		if !markdownListPattern.MatchString(line) {
+			continue
+		}
+		text := markdownLinkPattern.ReplaceAllString(line, "$1")
+		for _, p := range patterns {
+			if p.MatchString(text) {
+				items = append(items, markdownListPattern.ReplaceAllString(line, "- "))
+				break
+			}
+		}
+	}
+	return items
+}
+
+// topicAddenda returns, for each subscriber with matching items in summary,
+// the section listing them. Failing to load saved subscriptions falls back to
+// the configured ones.
+func topicAddenda(db *sql.DB, config *Config, summary string, logger *zap.Logger) map[string]string {
+	subscriptions, err := topicSubscriptions(db, config)
+	if err != nil {
+		logger.Warn("Failed to load saved topic subscriptions, using configured ones", zap.Error(err))
+	}
+	addenda := make(map[string]string)
+	for _, recipient := range sortedKeys(subscriptions) {
+		topics := subscriptions[recipient]
+		items := topicItems(summary, topics)
+		if len(items) == 0 {
+			continue
+		}
+		addenda[recipient] = fmt.Sprintf("## Your Topics\n\n_Items mentioning %s._\n\n%s\n", strings.Join(topics, ", "), strings.Join(items, "\n"))
+	}
+	logger.Debug("Matched topic subscriptions", zap.Int("subscribers", len(subscriptions)), zap.Int("with_items", len(addenda)))
+	return addenda
+}
+
+// sendDigestEmails sends the digest to addressing. With TOPIC_DELIVERY
+// addendum a subscriber's topics are appended to their own copy, so they are
+// split out of a shared email; subscribers who aren't recipients of the digest,
+// and all of them with TOPIC_DELIVERY email, get a topics email instead.
+func sendDigestEmails(db *sql.DB, config *Config, addressing emailAddressing, subject, body, focus string, date time.Time, tracked bool, addenda map[string]string, media editionMedia, logger *zap.Logger) error {
+	separate := make(map[string]string)
+	for recipient, addendum := range addenda {
+		separate[recipient] = addendum
+	}
+	inline := make(map[string]string)
+	if config.TopicDelivery == topicDeliveryAddendum {
+		for _, recipient := range addressing.recipients() {
+			if addendum, ok := addenda[strings.ToLower(recipient)]; ok {
+				inline[recipient] = addendum
+				delete(separate, strings.ToLower(recipient))
+			}
+		}
+	}
+
+	var errs []error
+	if tracked {
+		errs = append(errs, sendTrackedEmails(db, config, addressing, subject, body, focus, date, inline, media, logger))
+	} else {
+		shared := addressing
+		keep := func(list []string) []string {
+			var kept []string
+			for _, recipient := range list {
+				if _, ok := inline[recipient]; !ok {
+					kept = append(kept, recipient)
+				}
+			}
+			return kept
+		}
+		shared.To, shared.CC, shared.BCC = keep(addressing.To), keep(addressing.CC), keep(addressing.BCC)
+		if len(inline) == 0 || len(shared.recipients()) > 0 {
+			errs = append(errs, sendEmail(config, shared, subject, body, media, logger))
+		}
+		for _, recipient := range sortedKeys(inline) {
+			single := emailAddressing{To: []string{recipient}, ReplyTo: addressing.ReplyTo}
+			errs = append(errs, sendEmail(config, single, subject, body+"\n\n"+inline[recipient], media, logger))
+		}
+	}
+
+	// Topics emails show the masthead but leave the narration to the digest
+	topicsMedia := editionMedia{Masthead: media.Masthead}
+	for _, recipient := range sortedKeys(separate) {
+		single := emailAddressing{To: []string{recipient}, ReplyTo: addressing.ReplyTo}
+		if err := sendEmail(config, single, "Your topics: "+subject, separate[recipient], topicsMedia, logger); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send topics email to %s: %v", recipient, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleTopics serves the preferences page where a recipient of a tracked
+// email, identified by its token, edits their topic subscriptions.
+func handleTopics(db *sql.DB, config *Config, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	token := strings.TrimPrefix(r.URL.Path, topicsPathPrefix)
+	var recipient string
+	err := db.QueryRow(`SELECT recipient FROM email_deliveries WHERE token = $1`, token).Scan(&recipient)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to look up tracking token", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	message := ""
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if err := saveTopics(db, recipient, splitTopics(r.PostFormValue("topics"))); err != nil {
+			logger.Error("Failed to save topic subscriptions", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		message = "<p>Saved. Your next digest will use these topics.</p>"
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	subscriptions, err := topicSubscriptions(db, config)
+	if err != nil {
+		logger.Error("Failed to load topic subscriptions", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><body>
+<h1>Your Topics</h1>
+%s<p>Digest items mentioning these topics are collected for %s. One topic per line; leave empty to unsubscribe.</p>
+<form method="post"><textarea name="topics" rows="8" cols="40">%s</textarea><br><button type="submit">Save</button></form>
+</body></html>`, message, html.EscapeString(recipient), html.EscapeString(strings.Join(subscriptions[strings.ToLower(recipient)], "\n")))
+}
@@ -0,0 +1,218 @@
+package shinbun
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	trackOpenPrefix     = "/t/open/"
+	trackClickPrefix    = "/t/click/"
+	trackFeedbackPrefix = "/t/feedback/"
+)
+
+// transparentGIF is a 1x1 transparent GIF served as the open-tracking pixel.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// sendTrackedEmails sends every recipient (To, CC and BCC alike) their own copy
+// of the digest with a tracking pixel and links wrapped through the redirect
+// endpoint, so opens and clicks are recorded per recipient per digest.
+// addenda are appended to their recipient's copy.
+func sendTrackedEmails(db *sql.DB, config *Config, addressing emailAddressing, subject, body, focus string, date time.Time, addenda map[string]string, media editionMedia, logger *zap.Logger) error {
+	var failed []string
+	for _, recipient := range addressing.recipients() {
+		token, err := newTrackingToken()
+		if err != nil {
+			return err
+		}
+		if err := recordDelivery(db, token, focus, date, recipient); err != nil {
+			return err
+		}
+
+		tracked := body
+		if addendum, ok := addenda[recipient]; ok {
+			tracked += "\n\n" + addendum
+		}
+		if config.FeedbackLinks {
+			tracked = addFeedbackLinks(tracked, config.PublicBaseURL, token)
+		}
+		tracked = trackLinks(tracked, config.PublicBaseURL, token)
+		if config.TopicPreferences {
+			tracked += fmt.Sprintf("\n\n[Manage your topics](%s)\n", trackingURL(config.PublicBaseURL, topicsPathPrefix, token))
+		}
+		page := renderHTMLPage(tracked, config.emailBranding(media))
+		pixel := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="">`, trackingURL(config.PublicBaseURL, trackOpenPrefix, token)+".gif")
+		page = strings.Replace(page, "</body>", pixel+"\n</body>", 1)
+
+		single := emailAddressing{To: []string{recipient}, ReplyTo: addressing.ReplyTo}
+		if err := sendHTMLEmail(config, single, subject, page, media, logger); err != nil {
+			logger.Error("Failed to send tracked email", zap.String("recipient", recipient), zap.Error(err))
+			failed = append(failed, recipient)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to send email to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func newTrackingToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating tracking token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func trackingURL(baseURL, prefix, token string) string {
+	return strings.TrimRight(baseURL, "/") + prefix + token
+}
+
+// trackLinks rewrites the markdown links in body to go through the click
+// redirect. mailto: and other non-HTTP links are left alone, as are the
+// feedback links.
+func trackLinks(body, baseURL, token string) string {
+	feedbackURL := trackingURL(baseURL, trackFeedbackPrefix, token)
+	return markdownLinkPattern.ReplaceAllStringFunc(body, func(link string) string {
+		m := markdownLinkPattern.FindStringSubmatch(link)
+		if (!strings.HasPrefix(m[2], "http://") && !strings.HasPrefix(m[2], "https://")) || strings.HasPrefix(m[2], feedbackURL) {
+			return link
+		}
+		return fmt.Sprintf("[%s](%s?u=%s)", m[1], trackingURL(baseURL, trackClickPrefix, token), url.QueryEscape(m[2]))
+	})
+}
+
+// addFeedbackLinks appends thumbs up and down links to every list item of body
+// that links somewhere, voting on the item's first link.
+func addFeedbackLinks(body, baseURL, token string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if !markdownListPattern.MatchString(line) {
+			continue
+		}
+		for _, m := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(m[2], "http://") || strings.HasPrefix(m[2], "https://") {
+				vote := trackingURL(baseURL, trackFeedbackPrefix, token) + "?u=" + url.QueryEscape(m[2]) + "&v="
+				lines[i] = fmt.Sprintf("%s [👍](%sup) [👎](%sdown)", strings.TrimRight(line, " "), vote, vote)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func recordDelivery(db *sql.DB, token, focus string, date time.Time, recipient string) error {
+	_, err := db.Exec(`INSERT INTO email_deliveries (token, focus, digest_date, recipient) VALUES ($1, $2, $3, $4)`,
+		token, focus, date.Format("2006-01-02"), recipient)
+	if err != nil {
+		return fmt.Errorf("error recording email delivery: %v", err)
+	}
+	return nil
+}
+
+func recordTrackingEvent(db *sql.DB, token, event, target string) error {
+	_, err := db.Exec(`INSERT INTO email_events (token, event, url) VALUES ($1, $2, NULLIF($3, ''))`, token, event, target)
+	if err != nil {
+		return fmt.Errorf("error recording %s event: %v", event, err)
+	}
+	return nil
+}
+
+// handleOpen records an open and always answers with the pixel, so unknown
+// tokens don't show a broken image.
+func handleOpen(db *sql.DB, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, trackOpenPrefix), ".gif")
+	if err := recordTrackingEvent(db, token, "open", ""); err != nil {
+		logger.Debug("Ignoring open for unknown token", zap.String("token", token), zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(transparentGIF)
+}
+
+// handleClick records a click and redirects to the target. Only links that
+// appear in the tracked digest, or its archive page, are redirected to, so the
+// endpoint can't be used as an open redirect.
+func handleClick(db *sql.DB, publicBaseURL string, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	token := strings.TrimPrefix(r.URL.Path, trackClickPrefix)
+	target := r.URL.Query().Get("u")
+
+	allowed, err := trackedLink(db, publicBaseURL, token, target)
+	if err != nil {
+		logger.Error("Failed to look up tracking token", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := recordTrackingEvent(db, token, "click", target); err != nil {
+		logger.Error("Failed to record click", zap.Error(err))
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleFeedback records a thumbs up or down on a digest item.
+func handleFeedback(db *sql.DB, publicBaseURL string, w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	token := strings.TrimPrefix(r.URL.Path, trackFeedbackPrefix)
+	target := r.URL.Query().Get("u")
+	event := map[string]string{"up": "thumbs_up", "down": "thumbs_down"}[r.URL.Query().Get("v")]
+
+	allowed, err := trackedLink(db, publicBaseURL, token, target)
+	if err != nil {
+		logger.Error("Failed to look up tracking token", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed || event == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := recordTrackingEvent(db, token, event, target); err != nil {
+		logger.Error("Failed to record feedback", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!DOCTYPE html><html><body><p>Thanks, your feedback was recorded.</p></body></html>")
+}
+
+// trackedLink reports whether target is a link of the digest the token was
+// sent with, or its archive page. Unknown tokens are not an error.
+func trackedLink(db *sql.DB, publicBaseURL, token, target string) (bool, error) {
+	var focus string
+	var date time.Time
+	err := db.QueryRow(`SELECT focus, digest_date FROM email_deliveries WHERE token = $1`, token).Scan(&focus, &date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if target == "" {
+		return false, nil
+	}
+	if target == digestURL(publicBaseURL, focus, date) {
+		return true, nil
+	}
+	content, err := getDigest(db, focus, date)
+	return err == nil && strings.Contains(content, "("+target+")"), nil
+}
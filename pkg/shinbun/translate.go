@@ -0,0 +1,167 @@
+package shinbun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+
+	"shinbun/internal/deepl"
+)
+
+// translationBatchSize bounds the number of messages per LLM translation request.
+const translationBatchSize = 20
+
+// translateFunc translates texts into the target language, preserving order.
+// Texts already in the target language come back as "".
+type translateFunc func(texts []string) ([]string, error)
+
+// newTranslator returns the configured translation provider, or nil when
+// translation is disabled.
+func newTranslator(config *Config, client *openai.Client, httpClient *http.Client) (translateFunc, error) {
+	target := config.TranslationTargetLang
+	switch config.TranslationProvider {
+	case "":
+		return nil, nil
+	case "deepl":
+		if config.DeepLAPIKey == "" {
+			return nil, fmt.Errorf("DEEPL_API_KEY is required for TRANSLATION_PROVIDER=deepl")
+		}
+		dl := deepl.NewClient(config.DeepLAPIKey, config.DeepLAPIURL, httpClient)
+		return func(texts []string) ([]string, error) {
+			translations, err := dl.Translate(texts, target)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]string, len(translations))
+			for i, t := range translations {
+				// DeepL reports e.g. "EN" for a target of "EN-US"
+				if !strings.HasPrefix(strings.ToUpper(target), t.DetectedSourceLanguage) {
+					out[i] = t.Text
+				}
+			}
+			return out, nil
+		}, nil
+	case "openai":
+		return func(texts []string) ([]string, error) {
+			return translateWithLLM(client, texts, target)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown TRANSLATION_PROVIDER %q (use openai or deepl)", config.TranslationProvider)
+	}
+}
+
+func translateWithLLM(client *openai.Client, texts []string, target string) ([]string, error) {
+	var out []string
+	for start := 0; start < len(texts); start += translationBatchSize {
+		end := min(start+translationBatchSize, len(texts))
+		batch := texts[start:end]
+
+		input, err := json.Marshal(map[string][]string{"messages": batch})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding translation request: %v", err)
+		}
+
+		resp, err := client.CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{
+				Model: openai.GPT4oMini20240718,
+				Messages: []openai.ChatCompletionMessage{
+					{
+						Role: openai.ChatMessageRoleSystem,
+						Content: fmt.Sprintf(`You translate Slack messages into the language with code %s. You receive a JSON object {"messages": [...]}. `+
+							`Respond with a JSON object {"translations": [...]} with exactly one entry per message, in the same order. `+
+							`Use an empty string for messages that are already in the target language. Keep URLs, code, names and Slack mentions unchanged.`, target),
+					},
+					{
+						Role:    openai.ChatMessageRoleUser,
+						Content: string(input),
+					},
+				},
+				ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+				Temperature:    0,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error translating messages: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("translation returned no choices")
+		}
+
+		var result struct {
+			Translations []string `json:"translations"`
+		}
+		if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
+			return nil, fmt.Errorf("error decoding translations: %v", err)
+		}
+		if len(result.Translations) != len(batch) {
+			return nil, fmt.Errorf("translation returned %d entries for %d messages", len(result.Translations), len(batch))
+		}
+		out = append(out, result.Translations...)
+	}
+	return out, nil
+}
+
+// mayNeedTranslation skips messages that can't be in a foreign language: empty
+// ones, and, for an English target, pure-ASCII ones.
+func mayNeedTranslation(text, target string) bool {
+	if strings.TrimSpace(text) == "" {
+		return false
+	}
+	if strings.HasPrefix(strings.ToUpper(target), "EN") {
+		for _, r := range text {
+			if r > unicode.MaxASCII && unicode.IsLetter(r) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// translateUpdates fills in Translation for updates not in the target language.
+// Updates that already carry a translation are left alone. On failure the
+// updates are returned untranslated.
+func translateUpdates(translate translateFunc, target string, updates []Update, logger *zap.Logger) []Update {
+	if translate == nil {
+		return updates
+	}
+
+	var indexes []int
+	var texts []string
+	for i, u := range updates {
+		if u.Translation == "" && mayNeedTranslation(u.Text, target) {
+			indexes = append(indexes, i)
+			texts = append(texts, u.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return updates
+	}
+
+	translations, err := translate(texts)
+	if err != nil {
+		logger.Error("Failed to translate messages, continuing with originals", zap.Error(err))
+		return updates
+	}
+
+	translated := 0
+	for n, i := range indexes {
+		if t := strings.TrimSpace(translations[n]); t != "" && t != strings.TrimSpace(updates[i].Text) {
+			updates[i].Translation = t
+			translated++
+		}
+	}
+
+	logger.Info("Translated messages",
+		zap.String("target_lang", target),
+		zap.Int("candidates", len(texts)),
+		zap.Int("translated", translated))
+	return updates
+}
@@ -0,0 +1,252 @@
+package shinbun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	usageSlack  = "slack"
+	usageOpenAI = "openai"
+)
+
+// apiUsage is a run's use of the Slack and OpenAI APIs, counted by
+// usageTransport on their HTTP clients. It is logged at the end of a run and
+// stored with queued runs, to tune concurrency and budgets against.
+type apiUsage struct {
+	mu sync.Mutex
+	// SlackCalls counts Slack Web API calls by method, e.g. conversations.history.
+	SlackCalls       map[string]int `json:"slack_calls"`
+	SlackRateLimited int            `json:"slack_rate_limited"`
+	// SlackRetryAfterMS adds up the waits Slack's rate-limited responses asked for.
+	SlackRetryAfterMS int64 `json:"slack_retry_after_ms"`
+	// OpenAIRequests counts OpenAI requests by endpoint, e.g. chat/completions.
+	OpenAIRequests    map[string]int `json:"openai_requests"`
+	OpenAIErrors      int            `json:"openai_errors"`
+	OpenAIRateLimited int            `json:"openai_rate_limited"`
+	// Latencies run to the response headers, so streams count their first token.
+	OpenAILatencyMS    int64 `json:"openai_latency_ms"`
+	OpenAIMaxLatencyMS int64 `json:"openai_max_latency_ms"`
+	PromptTokens       int   `json:"prompt_tokens"`
+	CompletionTokens   int   `json:"completion_tokens"`
+	// OpenAIBackoffMS is the time map-reduce workers paused after rate limits.
+	OpenAIBackoffMS int64 `json:"openai_backoff_ms"`
+}
+
+func newAPIUsage() *apiUsage {
+	return &apiUsage{SlackCalls: make(map[string]int), OpenAIRequests: make(map[string]int)}
+}
+
+// backoff records a pause taken because of a rate limit.
+func (u *apiUsage) backoff(d time.Duration) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.OpenAIBackoffMS += d.Milliseconds()
+}
+
+// tokens records token usage reported outside a response, e.g. in a batch
+// result file.
+func (u *apiUsage) tokens(prompt, completion int) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.PromptTokens += prompt
+	u.CompletionTokens += completion
+}
+
+// add merges other into u, e.g. the usage of a staged run's job into the run's.
+func (u *apiUsage) add(other *apiUsage) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.SlackCalls == nil {
+		u.SlackCalls = make(map[string]int)
+	}
+	if u.OpenAIRequests == nil {
+		u.OpenAIRequests = make(map[string]int)
+	}
+	for method, n := range other.SlackCalls {
+		u.SlackCalls[method] += n
+	}
+	for endpoint, n := range other.OpenAIRequests {
+		u.OpenAIRequests[endpoint] += n
+	}
+	u.SlackRateLimited += other.SlackRateLimited
+	u.SlackRetryAfterMS += other.SlackRetryAfterMS
+	u.OpenAIErrors += other.OpenAIErrors
+	u.OpenAIRateLimited += other.OpenAIRateLimited
+	u.OpenAILatencyMS += other.OpenAILatencyMS
+	u.OpenAIMaxLatencyMS = max(u.OpenAIMaxLatencyMS, other.OpenAIMaxLatencyMS)
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.OpenAIBackoffMS += other.OpenAIBackoffMS
+}
+
+func (u *apiUsage) json() (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	encoded, err := json.Marshal(u)
+	return string(encoded), err
+}
+
+// totals returns the number of Slack calls and OpenAI requests.
+func (u *apiUsage) totals() (slackCalls, openAIRequests int) {
+	for _, n := range u.SlackCalls {
+		slackCalls += n
+	}
+	for _, n := range u.OpenAIRequests {
+		openAIRequests += n
+	}
+	return slackCalls, openAIRequests
+}
+
+// brief is the usage in a few words, for runs list.
+func (u *apiUsage) brief() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	slackCalls, openAIRequests := u.totals()
+	brief := fmt.Sprintf("%d slack, %d openai, %d tokens", slackCalls, openAIRequests, u.PromptTokens+u.CompletionTokens)
+	if limited := u.SlackRateLimited + u.OpenAIRateLimited; limited > 0 {
+		brief += fmt.Sprintf(", %d rate limited", limited)
+	}
+	return brief
+}
+
+// log writes the usage summary at the end of a run.
+func (u *apiUsage) log(logger *zap.Logger) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	slackCalls, openAIRequests := u.totals()
+	var meanLatency time.Duration
+	if openAIRequests > 0 {
+		meanLatency = time.Duration(u.OpenAILatencyMS/int64(openAIRequests)) * time.Millisecond
+	}
+	logger.Info("API usage",
+		zap.Int("slack_calls", slackCalls),
+		zap.Any("slack_calls_by_method", u.SlackCalls),
+		zap.Int("slack_rate_limited", u.SlackRateLimited),
+		zap.Duration("slack_retry_after", time.Duration(u.SlackRetryAfterMS)*time.Millisecond),
+		zap.Int("openai_requests", openAIRequests),
+		zap.Any("openai_requests_by_endpoint", u.OpenAIRequests),
+		zap.Int("openai_errors", u.OpenAIErrors),
+		zap.Int("openai_rate_limited", u.OpenAIRateLimited),
+		zap.Duration("openai_mean_latency", meanLatency),
+		zap.Duration("openai_max_latency", time.Duration(u.OpenAIMaxLatencyMS)*time.Millisecond),
+		zap.Int("prompt_tokens", u.PromptTokens),
+		zap.Int("completion_tokens", u.CompletionTokens),
+		zap.Duration("openai_backoff", time.Duration(u.OpenAIBackoffMS)*time.Millisecond),
+	)
+}
+
+// usageTransport counts the requests of one API's client into usage.
+type usageTransport struct {
+	base    http.RoundTripper
+	service string
+	usage   *apiUsage
+}
+
+// withUsage returns a copy of client whose requests are counted as calls to
+// service. A nil usage leaves the client as it is.
+func withUsage(client *http.Client, usage *apiUsage, service string) *http.Client {
+	if usage == nil {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &usageTransport{base: base, service: service, usage: usage}
+	return &wrapped
+}
+
+func (t *usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+
+	if t.service == usageSlack {
+		t.recordSlack(req, resp)
+	} else {
+		resp, err = t.recordOpenAI(req, resp, err, latency)
+	}
+	return resp, err
+}
+
+func (t *usageTransport) recordSlack(req *http.Request, resp *http.Response) {
+	u := t.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.SlackCalls[strings.TrimPrefix(req.URL.Path, "/api/")]++
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		u.SlackRateLimited++
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			u.SlackRetryAfterMS += int64(seconds) * 1000
+		}
+	}
+}
+
+// recordOpenAI counts the request and, for JSON responses, reads the token
+// usage from the body, which it replaces with a copy. Streamed responses
+// carry no usage.
+func (t *usageTransport) recordOpenAI(req *http.Request, resp *http.Response, err error, latency time.Duration) (*http.Response, error) {
+	var usage struct {
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err == nil && resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			resp, err = nil, readErr
+		} else {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			json.Unmarshal(body, &usage)
+		}
+	}
+
+	u := t.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	endpoint := req.URL.Path
+	if i := strings.Index(endpoint, "/v1/"); i >= 0 {
+		endpoint = endpoint[i+len("/v1/"):]
+	}
+	u.OpenAIRequests[endpoint]++
+	u.OpenAILatencyMS += latency.Milliseconds()
+	u.OpenAIMaxLatencyMS = max(u.OpenAIMaxLatencyMS, latency.Milliseconds())
+	switch {
+	case err != nil || resp.StatusCode >= 500:
+		u.OpenAIErrors++
+	case resp.StatusCode == http.StatusTooManyRequests:
+		u.OpenAIRateLimited++
+	case resp.StatusCode >= 400:
+		u.OpenAIErrors++
+	}
+	u.PromptTokens += usage.Usage.PromptTokens
+	u.CompletionTokens += usage.Usage.CompletionTokens
+	return resp, err
+}
@@ -0,0 +1,137 @@
+package shinbun
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// userRefreshAge is how long a cached user name is used before users.info is
+// asked again, for people who change their display name.
+const userRefreshAge = 7 * 24 * time.Hour
+
+// userMentionPattern matches a Slack user mention, <@U123> or the older
+// <@U123|name>.
+var userMentionPattern = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|([^>]*))?>`)
+
+// specialMentionPattern matches <!here>, <!channel> and <!everyone>, with an
+// optional label.
+var specialMentionPattern = regexp.MustCompile(`<!(here|channel|everyone)(?:\|[^>]*)?>`)
+
+// userDirectory resolves Slack user IDs to display names. Names are kept in
+// memory for the run and in the users table across runs; users.info (the
+// users:read scope) is asked for unknown or stale ones.
+type userDirectory struct {
+	api    *slack.Client
+	db     *sql.DB
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	names map[string]string
+	// failed stops users.info lookups after an error such as a missing scope
+	failed bool
+}
+
+func newUserDirectory(api *slack.Client, db *sql.DB, logger *zap.Logger) *userDirectory {
+	return &userDirectory{api: api, db: db, logger: logger, names: make(map[string]string)}
+}
+
+// name returns the user's display name, or "" when it is unknown.
+func (d *userDirectory) name(id string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.names[id]; ok {
+		return name
+	}
+
+	var stored string
+	var fetchedAt time.Time
+	err := d.db.QueryRow(`SELECT name, fetched_at FROM users WHERE slack_id = $1`, id).Scan(&stored, &fetchedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		d.logger.Warn("Failed to load user name", zap.String("user", id), zap.Error(err))
+	}
+	if stored != "" && time.Since(fetchedAt) < userRefreshAge {
+		d.names[id] = stored
+		return stored
+	}
+
+	name := stored
+	if !d.failed {
+		fetched, err := d.fetch(id)
+		if err != nil {
+			d.failed = true
+			d.logger.Warn("Failed to look up Slack user; mentions of unknown users are left as IDs", zap.String("user", id), zap.Error(err))
+		} else if fetched != "" {
+			name = fetched
+		}
+	}
+	d.names[id] = name
+	return name
+}
+
+// fetch asks users.info for the user's name and stores it.
+func (d *userDirectory) fetch(id string) (string, error) {
+	user, err := d.api.GetUserInfo(id)
+	if err != nil {
+		return "", err
+	}
+	name := user.Profile.DisplayName
+	if name == "" {
+		name = user.RealName
+	}
+	if name == "" {
+		name = user.Name
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO users (slack_id, name, real_name, fetched_at) VALUES ($1, $2, NULLIF($3, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT (slack_id) DO UPDATE
+		SET name = EXCLUDED.name, real_name = EXCLUDED.real_name, fetched_at = EXCLUDED.fetched_at`,
+		id, name, user.RealName)
+	if err != nil {
+		d.logger.Warn("Failed to save user name", zap.String("user", id), zap.Error(err))
+	}
+	return name, nil
+}
+
+// rewriteMentions replaces user mentions with @name, and <!here> and the
+// like with @here, so the model sees who is meant instead of user IDs.
+// Mentions of users that can't be resolved keep their label, if any, or stay
+// as they are. A nil directory only rewrites the special mentions.
+func (d *userDirectory) rewriteMentions(text string) string {
+	text = specialMentionPattern.ReplaceAllString(text, "@$1")
+	if d == nil {
+		return text
+	}
+	return userMentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		m := userMentionPattern.FindStringSubmatch(mention)
+		if name := d.name(m[1]); name != "" {
+			return "@" + name
+		}
+		if m[2] != "" {
+			return "@" + m[2]
+		}
+		return mention
+	})
+}
+
+// mentionedUsers returns the IDs of the users text mentions, in order.
+func mentionedUsers(text string) []string {
+	var ids []string
+	for _, m := range userMentionPattern.FindAllStringSubmatch(text, -1) {
+		ids = append(ids, m[1])
+	}
+	return ids
+}
+
+// resolveMentions rewrites the mentions in the text of updates.
+func resolveMentions(d *userDirectory, updates []Update) []Update {
+	for i := range updates {
+		updates[i].Text = d.rewriteMentions(updates[i].Text)
+	}
+	return updates
+}